@@ -15,6 +15,20 @@ func main() {
 		Long:  "Zark is a user-friendly, high-performance version control system",
 	}
 
+	// -C behaves like git's: every command runs as if started in that directory,
+	// so repository discovery and relative pathspecs are resolved from there.
+	var workDir string
+	rootCmd.PersistentFlags().StringVarP(&workDir, "directory", "C", "", "Run as if zark was started in this directory")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if workDir == "" {
+			return nil
+		}
+		if err := os.Chdir(workDir); err != nil {
+			return fmt.Errorf("cannot change to '%s': %w", workDir, err)
+		}
+		return nil
+	}
+
 	rootCmd.AddCommand(commands.StartCmd())
 	rootCmd.AddCommand(commands.SaveCmd())
 	rootCmd.AddCommand(commands.HistoryCmd())
@@ -25,6 +39,21 @@ func main() {
 	rootCmd.AddCommand(commands.GCCmd())
 	rootCmd.AddCommand(commands.SearchCmd())
 	rootCmd.AddCommand(commands.LFSCmd())
+	rootCmd.AddCommand(commands.ConfigCmd())
+	rootCmd.AddCommand(commands.KeysCmd())
+	rootCmd.AddCommand(commands.VerifyCommitCmd())
+	rootCmd.AddCommand(commands.SecretsCmd())
+	rootCmd.AddCommand(commands.RemoteCmd())
+	rootCmd.AddCommand(commands.CloneCmd())
+	rootCmd.AddCommand(commands.FetchCmd())
+	rootCmd.AddCommand(commands.PushCmd())
+	rootCmd.AddCommand(commands.PullCmd())
+	rootCmd.AddCommand(commands.ServeCmd())
+	rootCmd.AddCommand(commands.BundleCmd())
+	rootCmd.AddCommand(commands.ImportCmd())
+	rootCmd.AddCommand(commands.ExportCmd())
+	rootCmd.AddCommand(commands.FastImportCmd())
+	rootCmd.AddCommand(commands.FastExportCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
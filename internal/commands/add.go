@@ -1,9 +1,6 @@
 package commands
 
 import (
-	"fmt"
-	"os"
-
 	"github.com/spf13/cobra"
 	"zark/internal/core"
 )
@@ -16,18 +13,13 @@ func AddCmd() *cobra.Command {
 		Long:  "This command updates the index using the current content found in the working tree, preparing the content for the next commit.",
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cwd, err := os.Getwd()
+			repo, err := openRepository()
 			if err != nil {
-				return fmt.Errorf("failed to get current directory: %w", err)
-			}
-
-			repo := core.NewRepository(cwd)
-			if !repo.Exists() {
-				return fmt.Errorf("not a zark repository (or any of the parent directories)")
+				return err
 			}
 
 			// Call the core logic for adding files
 			return core.AddFiles(repo, args)
 		},
 	}
-}
\ No newline at end of file
+}
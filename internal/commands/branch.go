@@ -19,6 +19,7 @@ func BranchCmd() *cobra.Command {
 
 	cmd.AddCommand(branchCreateCmd())
 	cmd.AddCommand(branchListCmd())
+	cmd.AddCommand(branchSetUpstreamCmd())
 
 	return cmd
 }
@@ -42,14 +43,9 @@ func branchCreateCmd() *cobra.Command {
 				return fmt.Errorf("branch name cannot be empty")
 			}
 
-			cwd, err := os.Getwd()
+			repo, err := openRepository()
 			if err != nil {
-				return fmt.Errorf("failed to get current directory: %w", err)
-			}
-
-			repo := core.NewRepository(cwd)
-			if !repo.Exists() {
-				return fmt.Errorf("not a zark repository")
+				return err
 			}
 
 			return core.CreateBranch(repo, branchName)
@@ -62,17 +58,52 @@ func branchListCmd() *cobra.Command {
 		Use:   "list",
 		Short: "List all branches",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cwd, err := os.Getwd()
+			repo, err := openRepository()
 			if err != nil {
-				return fmt.Errorf("failed to get current directory: %w", err)
+				return err
 			}
 
-			repo := core.NewRepository(cwd)
-			if !repo.Exists() {
-				return fmt.Errorf("not a zark repository")
+			return core.ListBranches(repo)
+		},
+	}
+}
+
+func branchSetUpstreamCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "set-upstream [<remote>/<branch>]",
+		Short:   "Choose the remote branch the current branch pulls from and pushes to",
+		Long:    "Makes a remote branch (by default the one of the same name on 'origin') the upstream of the current branch, so 'zark pull' and 'zark push' know where to go.",
+		Example: "  zark branch set-upstream origin/main",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+			branch, err := core.CurrentBranch(repo)
+			if err != nil {
+				return err
+			}
+			if branch == "" {
+				return fmt.Errorf("you are not on a branch; check out the branch to set the upstream of first")
 			}
 
-			return core.ListBranches(repo)
+			remote, remoteBranch := core.DefaultRemote, branch
+			if len(args) > 0 {
+				var ok bool
+				remote, remoteBranch, ok = strings.Cut(args[0], "/")
+				if !ok || remote == "" || remoteBranch == "" {
+					return fmt.Errorf("name the upstream as <remote>/<branch>, e.g. '%s/%s'", core.DefaultRemote, branch)
+				}
+			}
+			if err := core.SetUpstream(repo, branch, remote, remoteBranch); err != nil {
+				return err
+			}
+			fmt.Printf("'%s' now tracks '%s/%s'.\n", branch, remote, remoteBranch)
+			if _, err := core.ResolveRef(repo, "refs/remotes/"+remote+"/"+remoteBranch); err != nil {
+				fmt.Printf("hint: '%s/%s' hasn't been fetched yet; 'zark pull' will fetch it, or 'zark push' will create it.\n", remote, remoteBranch)
+			}
+			return nil
 		},
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// BundleCmd creates the `zark bundle` command.
+func BundleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Move history between machines in a single file",
+		Long: "A bundle is one file holding branches or tags and the commits they need, for carrying work to a machine with no network, " +
+			"for example on a USB stick. On the other machine, use the bundle's path like a remote: 'zark clone project.bundle' or " +
+			"'zark remote add usb /media/usb/project.bundle' and then 'zark fetch usb'.",
+	}
+
+	cmd.AddCommand(bundleCreateCmd())
+	cmd.AddCommand(bundleVerifyCmd())
+
+	return cmd
+}
+
+func bundleCreateCmd() *cobra.Command {
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "create <file> [<rev-range>...]",
+		Short: "Write branches and their history to a bundle file",
+		Long: "Writes the named branches or tags and their history to a bundle file. To send only what the other machine does not have yet, " +
+			"give a range: 'v1.0..main' leaves out everything v1.0 already has, and the other machine must have v1.0 before it can fetch the bundle.",
+		Example: "  zark bundle create project.bundle main\n" +
+			"  zark bundle create project.bundle --all\n" +
+			"  zark bundle create update.bundle origin/main..main",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			revs := args[1:]
+			if all {
+				revs = append(revs, "--all")
+			}
+			bundle, err := core.CreateBundle(repo, args[0], revs)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Wrote '%s' with %d object(s):\n", args[0], bundle.Objects)
+			printBundle(bundle)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "Include every branch and tag")
+	return cmd
+}
+
+func bundleVerifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify <file>",
+		Short: "Check that a bundle is intact and can be fetched here",
+		Long:  "Checks that the bundle file is complete and undamaged and, inside a repository, that the repository has the commits the bundle builds on.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Outside a repository only the file itself can be checked.
+			repo, _ := openRepository()
+			bundle, missing, err := core.VerifyBundle(repo, args[0])
+			if err != nil {
+				return err
+			}
+			printBundle(bundle)
+			if len(missing) > 0 {
+				for _, hash := range missing {
+					fmt.Printf("  missing: %s\n", hash)
+				}
+				return fmt.Errorf("this repository lacks %d commit(s) the bundle builds on.\nhint: fetch that history first, or ask for a bundle made from a commit you have", len(missing))
+			}
+			if repo == nil && len(bundle.Prerequisites) > 0 {
+				fmt.Println("The bundle is intact. Run this inside the repository to fetch into, to check it has the commits required.")
+				return nil
+			}
+			fmt.Printf("'%s' is intact and can be fetched.\n", args[0])
+			return nil
+		},
+	}
+}
+
+// printBundle lists a bundle's references and the commits it requires.
+func printBundle(bundle *core.Bundle) {
+	names := make([]string, 0, len(bundle.Refs))
+	for name := range bundle.Refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %s %s\n", bundle.Refs[name][:8], shortRefName(name))
+	}
+	for _, hash := range bundle.Prerequisites {
+		fmt.Printf("  requires %s\n", hash[:8])
+	}
+}
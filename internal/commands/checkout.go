@@ -1,9 +1,6 @@
 package commands
 
 import (
-	"fmt"
-	"os"
-
 	"github.com/spf13/cobra"
 	"zark/internal/core"
 )
@@ -16,18 +13,13 @@ func CheckoutCmd() *cobra.Command {
 		Long:  "This command switches branches or restores working tree files. It updates the files in the working tree to match the version in the specified branch or commit.",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cwd, err := os.Getwd()
+			repo, err := openRepository()
 			if err != nil {
-				return fmt.Errorf("failed to get current directory: %w", err)
-			}
-
-			repo := core.NewRepository(cwd)
-			if !repo.Exists() {
-				return fmt.Errorf("not a zark repository (or any of the parent directories)")
+				return err
 			}
 
 			// Call the core logic for checkout
 			return core.Checkout(repo, args[0])
 		},
 	}
-}
\ No newline at end of file
+}
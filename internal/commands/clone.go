@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// CloneCmd creates the `zark clone` command.
+func CloneCmd() *cobra.Command {
+	var opts core.CloneOptions
+	cmd := &cobra.Command{
+		Use:   "clone <path-or-url> [directory]",
+		Short: "Copy a repository into a new directory",
+		Long: "Creates a new directory with a full copy of a repository, including its history, and checks out its main branch. The original is remembered as the remote 'origin'.\n\n" +
+			"For big repositories, --depth 1 copies only the latest commit of each branch, and --filter=blob:none leaves out file contents " +
+			"until a checkout or diff needs them; they are then downloaded from 'origin'. --filter=blob:limit=1m only leaves out files over 1 MB.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := ""
+			if len(args) > 1 {
+				dir = args[1]
+			}
+
+			repo, result, err := core.CloneWithOptions(args[0], dir, opts)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Cloned into '%s' (%d object(s)).\n", filepath.Base(repo.Path), result.Objects)
+			if len(result.Updates) == 0 {
+				fmt.Println("The repository is empty; make your first save, then 'zark push'.")
+			}
+			if shallow, _ := core.ShallowCommits(repo); len(shallow) > 0 {
+				fmt.Printf("This is a shallow clone with the last %d commit(s) of each branch.\n", opts.Depth)
+				fmt.Println("hint: run 'zark fetch --deepen <n>' for more history, or 'zark fetch --unshallow' for all of it")
+			}
+			if opts.Filter != "" {
+				fmt.Printf("This is a partial clone (%s): files left out are downloaded from 'origin' when needed.\n", opts.Filter)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&opts.Depth, "depth", 0, "Copy only the last <n> commits of each branch")
+	cmd.Flags().StringVar(&opts.Filter, "filter", "", "Leave out file contents until needed: blob:none, or blob:limit=<size> for big files only")
+	return cmd
+}
@@ -0,0 +1,209 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// configScopeFlags holds the --system/--global/--local selection shared by the config subcommands.
+type configScopeFlags struct {
+	system, global, local bool
+}
+
+// scope returns the selected scope, or ok=false if none was given.
+func (f *configScopeFlags) scope() (core.ConfigScope, bool, error) {
+	count := 0
+	var scope core.ConfigScope
+	if f.system {
+		count, scope = count+1, core.ScopeSystem
+	}
+	if f.global {
+		count, scope = count+1, core.ScopeGlobal
+	}
+	if f.local {
+		count, scope = count+1, core.ScopeLocal
+	}
+	if count > 1 {
+		return 0, false, fmt.Errorf("only one of --system, --global or --local can be used")
+	}
+	return scope, count == 1, nil
+}
+
+// ConfigCmd creates the `zark config` command.
+func ConfigCmd() *cobra.Command {
+	flags := &configScopeFlags{}
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Get and set repository or global options",
+		Long: `Settings are read from three files, each overriding the one before it:
+  system  /etc/zark/config
+  global  ~/.config/zark/config
+  local   .zark/config in the current repository
+ZARK_* environment variables override all of them.
+
+For example, set your identity once for every repository with:
+  zark config set --global user.name "Your Name"
+  zark config set --global user.email you@example.com`,
+	}
+
+	cmd.PersistentFlags().BoolVar(&flags.system, "system", false, "Use the system-wide config file")
+	cmd.PersistentFlags().BoolVar(&flags.global, "global", false, "Use your per-user config file")
+	cmd.PersistentFlags().BoolVar(&flags.local, "local", false, "Use the repository config file")
+
+	cmd.AddCommand(configGetCmd(flags))
+	cmd.AddCommand(configSetCmd(flags))
+	cmd.AddCommand(configUnsetCmd(flags))
+	cmd.AddCommand(configListCmd(flags))
+
+	return cmd
+}
+
+func configGetCmd(flags *configScopeFlags) *cobra.Command {
+	var showOrigin bool
+	cmd := &cobra.Command{
+		Use:   "get [key]",
+		Short: "Print the value of a setting",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			set, err := loadConfigForFlags(flags)
+			if err != nil {
+				return err
+			}
+
+			value, ok := set.Lookup(args[0])
+			if !ok {
+				return fmt.Errorf("'%s' is not set", args[0])
+			}
+			printConfigValue(value, showOrigin, false)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&showOrigin, "show-origin", false, "Show which file or variable the value came from")
+
+	return cmd
+}
+
+func configSetCmd(flags *configScopeFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "set [key] [value]",
+		Short: "Change a setting (in the repository config unless --global or --system is given)",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := configFileForFlags(flags)
+			if err != nil {
+				return err
+			}
+			return core.SetConfigValue(path, args[0], args[1])
+		},
+	}
+}
+
+func configUnsetCmd(flags *configScopeFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "unset [key]",
+		Short: "Remove a setting",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := configFileForFlags(flags)
+			if err != nil {
+				return err
+			}
+			return core.UnsetConfigValue(path, args[0])
+		},
+	}
+}
+
+func configListCmd(flags *configScopeFlags) *cobra.Command {
+	var showOrigin bool
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all settings",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			set, err := loadConfigForFlags(flags)
+			if err != nil {
+				return err
+			}
+
+			for _, value := range set.Entries() {
+				printConfigValue(value, showOrigin, true)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&showOrigin, "show-origin", false, "Show which file or variable each value came from")
+
+	return cmd
+}
+
+// loadConfigForFlags loads the merged configuration. Outside a repository only
+// the system and global layers are available.
+func loadConfigForFlags(flags *configScopeFlags) (*core.ConfigSet, error) {
+	repo, err := openRepository()
+	if err != nil {
+		if !errors.Is(err, core.ErrNotRepository) {
+			return nil, err
+		}
+		if scope, scoped, _ := flags.scope(); scoped && scope == core.ScopeLocal {
+			return nil, err
+		}
+		repo = nil
+	}
+	set, err := core.LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, scoped, err := flags.scope()
+	if err != nil || !scoped {
+		return set, err
+	}
+	// A single scope was requested: only report values from that layer.
+	filtered := &core.ConfigSet{}
+	for _, value := range set.Entries() {
+		if value.Scope == scope {
+			filtered.Append(value)
+		}
+	}
+	return filtered, nil
+}
+
+// configFileForFlags returns the file that set/unset should modify.
+func configFileForFlags(flags *configScopeFlags) (string, error) {
+	scope, scoped, err := flags.scope()
+	if err != nil {
+		return "", err
+	}
+	if !scoped {
+		scope = core.ScopeLocal
+	}
+
+	var repo *core.Repository
+	if scope == core.ScopeLocal {
+		repo, err = openRepository()
+		if err != nil {
+			return "", fmt.Errorf("%w. Use --global to change your personal settings instead", err)
+		}
+	}
+
+	path := core.ConfigPathForScope(scope, repo)
+	if path == "" {
+		return "", fmt.Errorf("no %s config file is available", scope)
+	}
+	return path, nil
+}
+
+func printConfigValue(value core.ConfigValue, showOrigin, withKey bool) {
+	line := value.Value
+	if withKey {
+		line = value.Key + "=" + value.Value
+	}
+	if showOrigin {
+		line = value.Origin + "\t" + line
+	}
+	fmt.Println(line)
+}
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// ExportCmd creates the `zark export` command.
+func ExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write history out for another version control system",
+	}
+
+	cmd.AddCommand(exportGitCmd())
+
+	return cmd
+}
+
+func exportGitCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "git <directory>",
+		Short: "Write the branches, tags and history to a git repository",
+		Long: "Writes every branch and tag, with their history, to a git repository. A new directory becomes a bare git repository; " +
+			"an existing git repository is updated with what is new. History imported from git keeps its original commit IDs.",
+		Example: "  zark export git ../project.git && git clone ../project.git",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			result, err := core.ExportGit(repo, args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Exported %d commit(s) to the git repository at '%s' (%d object(s) written, %d reference(s) updated).\n",
+				result.Commits, result.Dir, result.Objects, result.Refs)
+			for _, note := range result.Notes {
+				fmt.Printf("note: %s\n", note)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// FastExportCmd creates the `zark fast-export` command.
+func FastExportCmd() *cobra.Command {
+	var options core.FastExportOptions
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "fast-export [<rev-range>...]",
+		Short: "Write history as a fast-import stream on standard output",
+		Long: "Writes the named branches or tags and their history to standard output in git's fast-import format, " +
+			"which 'git fast-import', 'zark fast-import' and many conversion tools read. A range such as 'v1.0..main' " +
+			"leaves out what v1.0 already has.\n\n" +
+			"To export in several runs, pass --export-marks the first time and both --import-marks and --export-marks after that: " +
+			"commits written before are then left out.",
+		Example: "  zark fast-export --all | (cd ../project.git && git fast-import)\n" +
+			"  zark fast-export main > history.stream",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			revs := args
+			if all {
+				revs = append(revs, "--all")
+			}
+			result, err := core.FastExport(repo, os.Stdout, revs, options)
+			if err != nil {
+				return err
+			}
+			// Standard output carries the stream, so notes go to standard error.
+			for _, note := range result.Notes {
+				fmt.Fprintf(os.Stderr, "note: %s\n", note)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "Export every branch and tag")
+	cmd.Flags().StringVar(&options.ImportMarks, "import-marks", "", "Leave out the commits named in this marks file from an earlier export")
+	cmd.Flags().StringVar(&options.ExportMarks, "export-marks", "", "Write the marks of everything exported to this file")
+	return cmd
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// FastImportCmd creates the `zark fast-import` command.
+func FastImportCmd() *cobra.Command {
+	var options core.FastImportOptions
+	cmd := &cobra.Command{
+		Use:   "fast-import",
+		Short: "Read history from a fast-import stream on standard input",
+		Long: "Reads a stream in git's fast-import format from standard input and stores its commits, branches and tags. " +
+			"Most conversion tools for other version control systems (Mercurial, Subversion, Perforce and more) can write this format, " +
+			"as can 'git fast-export' and 'zark fast-export'.\n\n" +
+			"Branches only move forward unless you pass --force, so commits you made here are never lost. " +
+			"Tag messages, notes, signatures and submodules are not kept. Files are named by marks or inline data; " +
+			"use --export-marks and --import-marks to continue a conversion in several runs.",
+		Example: "  hg-fast-export --stdout | zark fast-import\n" +
+			"  git fast-export --all | zark fast-import\n" +
+			"  zark fast-import --export-marks=marks.txt < history.stream",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			result, err := core.FastImport(repo, os.Stdin, options)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Imported %d commit(s) and %d file version(s).\n", result.Commits, result.Blobs)
+			for _, update := range result.Updates {
+				fmt.Println(formatRefUpdate(update, shortRefName(update.Name)))
+			}
+			for _, note := range result.Notes {
+				fmt.Printf("note: %s\n", note)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&options.ImportMarks, "import-marks", "", "Read marks left by an earlier import from this file")
+	cmd.Flags().StringVar(&options.ExportMarks, "export-marks", "", "Write the stream's marks to this file")
+	cmd.Flags().BoolVar(&options.Force, "force", false, "Let branches move backwards and tags move")
+	cmd.Flags().BoolVar(&options.AllowUnsafeFeatures, "allow-unsafe-features", false, "Let the stream name marks files to read and write")
+	return cmd
+}
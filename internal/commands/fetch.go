@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// FetchCmd creates the `zark fetch` command.
+func FetchCmd() *cobra.Command {
+	var opts core.FetchOptions
+	cmd := &cobra.Command{
+		Use:   "fetch [remote]",
+		Short: "Download branches and tags from a remote",
+		Long: "Downloads the commits you don't have yet from a remote ('origin' by default). Your own branches and files are not changed: the remote's branches appear as '<remote>/<branch>', e.g. 'origin/main'.\n\n" +
+			"In a shallow clone, --deepen <n> downloads <n> more commits of older history and --unshallow downloads all of it.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			remote := core.DefaultRemote
+			if len(args) > 0 {
+				remote = args[0]
+			}
+			if opts.Deepen < 0 {
+				return fmt.Errorf("--deepen takes a positive number of commits")
+			}
+			result, err := core.FetchWithOptions(repo, remote, opts)
+			if err != nil {
+				return err
+			}
+			printFetchResult(result)
+			if opts.Deepen > 0 || opts.Unshallow {
+				if shallow, _ := core.ShallowCommits(repo); len(shallow) == 0 {
+					fmt.Println("The whole history is here now.")
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&opts.Deepen, "deepen", 0, "Download <n> more commits of history in a shallow clone")
+	cmd.Flags().BoolVar(&opts.Unshallow, "unshallow", false, "Download all the history a shallow clone is missing")
+	return cmd
+}
+
+// printFetchResult lists the references a fetch changed.
+func printFetchResult(result *core.FetchResult) {
+	if len(result.Updates) == 0 {
+		if result.Objects > 0 {
+			fmt.Printf("Downloaded %d object(s) of older history from '%s'.\n", result.Objects, result.Remote)
+			return
+		}
+		fmt.Printf("Already up to date with '%s'.\n", result.Remote)
+		return
+	}
+	fmt.Printf("Downloaded %d object(s) from '%s':\n", result.Objects, result.Remote)
+	for _, update := range result.Updates {
+		fmt.Println(formatRefUpdate(update, shortRefName(update.Name)))
+	}
+}
+
+// formatRefUpdate describes one reference change on a single line.
+func formatRefUpdate(update core.RefUpdate, name string) string {
+	switch {
+	case update.Old == "":
+		return fmt.Sprintf("  * [new]      %s", name)
+	case update.New == "":
+		return fmt.Sprintf("  - [deleted]  %s", name)
+	case update.Force:
+		return fmt.Sprintf("  + %s...%s %s (forced)", update.Old[:7], update.New[:7], name)
+	default:
+		return fmt.Sprintf("    %s..%s  %s", update.Old[:7], update.New[:7], name)
+	}
+}
+
+// shortRefName drops the refs/heads/, refs/tags/ or refs/remotes/ prefix.
+func shortRefName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix)
+		}
+	}
+	return name
+}
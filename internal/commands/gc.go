@@ -17,30 +17,30 @@ func GCCmd() *cobra.Command {
 		Short: "Cleanup unnecessary files and optimize the local repository",
 		Long:  "This command runs a number of housekeeping tasks within the current repository, such as compressing file revisions (to save disk space and increase performance).",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cwd, err := os.Getwd()
+			repo, err := openRepository()
 			if err != nil {
-				return fmt.Errorf("failed to get current directory: %w", err)
-			}
-
-			repo := core.NewRepository(cwd)
-			if !repo.Exists() {
-				return fmt.Errorf("not a zark repository (or any of the parent directories)")
+				return err
 			}
 
 			packer, err := core.NewPacker(repo)
 			if err != nil {
 				return fmt.Errorf("failed to initialize packer: %w", err)
 			}
+			packed, err := core.NewStorage(repo).PackedObjects()
+			if err != nil {
+				return err
+			}
 
 			objectCount := packer.GetObjectCount()
-			if objectCount == 0 {
+			if objectCount == 0 && len(packed) == 0 {
 				fmt.Println("Repository is already optimized. Nothing to do.")
 				return nil
 			}
 
 			// --- Beginner-Friendly Additions ---
 			fmt.Printf("This command will optimize your repository for better performance and less disk space.\n")
-			fmt.Printf("It will pack %d loose objects into a single, more efficient file.\n\n", objectCount)
+			fmt.Printf("It will delete objects no branch, tag or staged file needs any more (such as purged secrets),\n")
+			fmt.Printf("then pack the remaining objects into a single, more efficient file.\n\n")
 			fmt.Print("Do you want to continue? (y/N) ")
 
 			reader := bufio.NewReader(os.Stdin)
@@ -51,6 +51,20 @@ func GCCmd() *cobra.Command {
 			}
 			// ---
 
+			pruned, err := core.PruneObjects(repo)
+			if err != nil {
+				return fmt.Errorf("failed to remove unreachable objects: %w", err)
+			}
+			if pruned > 0 {
+				fmt.Printf("\nRemoved %d unreachable object(s).\n", pruned)
+			}
+
+			// Pruning unpacks everything that is still needed.
+			packer, err = core.NewPacker(repo)
+			if err != nil {
+				return fmt.Errorf("failed to initialize packer: %w", err)
+			}
+
 			fmt.Println("\nPacking objects...")
 			packHash, err := packer.PackObjects()
 			if err != nil {
@@ -67,4 +81,4 @@ func GCCmd() *cobra.Command {
 			return nil
 		},
 	}
-}
\ No newline at end of file
+}
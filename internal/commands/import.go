@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// ImportCmd creates the `zark import` command.
+func ImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Bring history in from another version control system",
+	}
+
+	cmd.AddCommand(importGitCmd())
+
+	return cmd
+}
+
+func importGitCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "git <path-to-git-repository>",
+		Short: "Convert the branches, tags and history of a git repository",
+		Long: "Converts the branches and tags of a git repository, with all their commits and files, into this repository. " +
+			"git itself is not needed. Run it again later to bring in only what is new: the commits already converted are remembered.\n\n" +
+			"Branches only move forward, so commits you made here are never lost. Annotated tags become plain tags, and git signatures and submodules are not kept.",
+		Example: "  zark start && zark import git ../old-project",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			result, err := core.ImportGit(repo, args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Imported %d commit(s) and %d file version(s) from git.\n", result.Commits, result.Blobs)
+			for _, update := range result.Updates {
+				fmt.Println(formatRefUpdate(update, shortRefName(update.Name)))
+			}
+			for _, note := range result.Notes {
+				fmt.Printf("note: %s\n", note)
+			}
+			return nil
+		},
+	}
+}
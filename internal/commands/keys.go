@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// KeysCmd creates the `zark keys` command.
+func KeysCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage the keys used to sign commits",
+		Long:  "Signing a commit proves it came from you. Zark signs commits with ed25519 keys, the same kind SSH uses, so you can also point user.signingkey at an existing ~/.ssh/id_ed25519.",
+	}
+
+	cmd.AddCommand(keysGenerateCmd())
+	cmd.AddCommand(keysListCmd())
+
+	return cmd
+}
+
+func keysGenerateCmd() *cobra.Command {
+	var comment string
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "generate [name]",
+		Short: "Create a new ed25519 signing key",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := "zark_ed25519"
+			if len(args) > 0 {
+				name = args[0]
+			}
+
+			dir, err := core.KeysDir()
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				return fmt.Errorf("failed to create keys directory: %w", err)
+			}
+
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil && !force {
+				return fmt.Errorf("a key named '%s' already exists at %s (use --force to replace it)", name, path)
+			}
+
+			// Default the comment to the configured email so the key is recognisable.
+			if comment == "" {
+				if config, err := core.LoadConfig(nil); err == nil {
+					comment = config.GetString("user.email", "")
+				}
+			}
+
+			key, err := core.GenerateSigningKey(comment)
+			if err != nil {
+				return err
+			}
+			if err := key.Save(path); err != nil {
+				return err
+			}
+
+			fmt.Printf("Created signing key %s\n", path)
+			fmt.Printf("Fingerprint: %s\n", core.SSHFingerprint(key.Public))
+			fmt.Printf("Public key:  %s\n", key.AuthorizedKey())
+
+			// --- Beginner-Friendly Additions ---
+			globalPath := core.ConfigPathForScope(core.ScopeGlobal, nil)
+			config, err := core.LoadConfig(nil)
+			if err == nil {
+				if _, ok := config.Get("user.signingkey"); !ok {
+					if err := core.SetConfigValue(globalPath, "user.signingkey", path); err != nil {
+						return err
+					}
+					fmt.Println("\nThis is now your default signing key. Sign a commit with 'zark save --sign'.")
+					return nil
+				}
+			}
+			fmt.Println("\nTo sign with this key, run:")
+			fmt.Printf("  zark config set --global user.signingkey %s\n", path)
+			// ---
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&comment, "comment", "c", "", "Comment stored with the key (defaults to user.email)")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite an existing key with the same name")
+
+	return cmd
+}
+
+func keysListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List your signing keys",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys, err := core.ListSigningKeys()
+			if err != nil {
+				return err
+			}
+
+			// Outside a repository only the global setting applies.
+			repo, err := openRepository()
+			if err != nil {
+				repo = nil
+			}
+			configured := ""
+			if config, err := core.LoadConfig(repo); err == nil {
+				configured = config.GetString("user.signingkey", "")
+			}
+
+			if len(keys) == 0 && configured == "" {
+				fmt.Println("No signing keys yet. Create one with 'zark keys generate'.")
+				return nil
+			}
+
+			listedConfigured := false
+			for _, key := range keys {
+				marker := " "
+				if configured != "" && sameFile(key.Path, configured) {
+					marker = "*"
+					listedConfigured = true
+				}
+				fmt.Printf("%s %-20s %s\n", marker, key.Name, key.Fingerprint)
+			}
+
+			// The configured key may live elsewhere, e.g. ~/.ssh/id_ed25519.
+			if configured != "" && !listedConfigured {
+				key, err := core.LoadSigningKey(configured)
+				if err != nil {
+					fmt.Printf("* %-20s (cannot be read: %v)\n", configured, err)
+				} else {
+					fmt.Printf("* %-20s %s\n", configured, core.SSHFingerprint(key.Public))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// sameFile reports whether two paths name the same file.
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
@@ -1,8 +1,10 @@
 package commands
 
 import (
+	"bufio"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"zark/internal/core"
@@ -13,10 +15,21 @@ func LFSCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "lfs",
 		Short: "Manage large files with Large File Storage (LFS)",
-		Long:  `LFS replaces large files such as audio samples, videos, datasets, and graphics with tiny text pointers inside Zark. The large files themselves are stored on a remote server.`,
+		Long:  `LFS replaces large files such as audio samples, videos, datasets, and graphics with tiny text pointers inside Zark. The large files themselves are kept in .zark/lfs/objects and can be stored on a remote server.`,
 	}
 
 	cmd.AddCommand(lfsTrackCmd())
+	cmd.AddCommand(lfsUntrackCmd())
+	cmd.AddCommand(lfsLsFilesCmd())
+	cmd.AddCommand(lfsStatusCmd())
+	cmd.AddCommand(lfsPruneCmd())
+	cmd.AddCommand(lfsMigrateCmd())
+	cmd.AddCommand(lfsLockCmd())
+	cmd.AddCommand(lfsUnlockCmd())
+	cmd.AddCommand(lfsLocksCmd())
+	cmd.AddCommand(lfsPushCmd())
+	cmd.AddCommand(lfsFetchCmd())
+	cmd.AddCommand(lfsPullCmd())
 
 	return cmd
 }
@@ -25,17 +38,29 @@ func lfsTrackCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "track [pattern]",
 		Short: "Start tracking a file pattern with LFS",
-		Long:  `Configures Zark to store files matching a path pattern with LFS. For example, 'zark lfs track "*.zip"' will track all .zip files.`,
-		Args:  cobra.ExactArgs(1),
+		Long:  `Configures Zark to store files matching a path pattern with LFS. For example, 'zark lfs track "*.zip"' will track all .zip files. Without a pattern, lists the patterns that are tracked.`,
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cwd, err := os.Getwd()
+			repo, err := openRepository()
 			if err != nil {
-				return fmt.Errorf("failed to get current directory: %w", err)
+				return err
 			}
 
-			repo := core.NewRepository(cwd)
-			if !repo.Exists() {
-				return fmt.Errorf("not a zark repository. Please run 'zark start' to initialize a new repository")
+			if len(args) == 0 {
+				attributes, err := core.LoadAttributes(repo)
+				if err != nil {
+					return err
+				}
+				patterns := core.LFSTrackedPatterns(attributes)
+				if len(patterns) == 0 {
+					fmt.Println("No patterns are tracked with LFS yet. Try 'zark lfs track \"*.zip\"'.")
+					return nil
+				}
+				fmt.Println("Patterns tracked with LFS:")
+				for _, pattern := range patterns {
+					fmt.Printf("  %s\n", pattern)
+				}
+				return nil
 			}
 
 			pattern := args[0]
@@ -58,4 +83,432 @@ func lfsTrackCmd() *cobra.Command {
 			return nil
 		},
 	}
-}
\ No newline at end of file
+}
+
+func lfsUntrackCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "untrack <pattern>",
+		Short: "Stop tracking a file pattern with LFS",
+		Long:  "Removes a pattern from .zarkattributes. Files already saved as LFS pointers stay that way until you add them again.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			if err := core.UntrackLFS(repo, args[0]); err != nil {
+				return err
+			}
+			fmt.Println("Next step: run 'zark add .zarkattributes' and save to share the change.")
+			return nil
+		},
+	}
+}
+
+func lfsLsFilesCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ls-files [branch-or-commit]",
+		Short: "List the files stored with LFS",
+		Long:  "Lists the LFS files in a branch or commit (HEAD by default) with their object ID and size. '*' means the content is downloaded, '-' means only the pointer is available.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			rev := "HEAD"
+			if len(args) > 0 {
+				rev = args[0]
+			}
+			files, err := core.LFSFilesAt(repo, rev)
+			if err != nil {
+				return err
+			}
+			for _, file := range files {
+				marker := "-"
+				if core.HasLFSObject(repo, file.Pointer.OID) {
+					marker = "*"
+				}
+				fmt.Printf("%s %s %s (%d bytes)\n", file.Pointer.OID[:10], marker, file.Path, file.Pointer.Size)
+			}
+			return nil
+		},
+	}
+}
+
+func lfsStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show large files that are missing or not uploaded",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			report, err := core.LFSStatus(repo)
+			if err != nil {
+				return err
+			}
+			if len(report.Missing) == 0 && len(report.Unpushed) == 0 {
+				fmt.Println("All large files are downloaded and pushed.")
+				return nil
+			}
+			if len(report.Missing) > 0 {
+				fmt.Println("Missing locally:")
+				fmt.Println("  (use \"zark lfs fetch --all\" to download them)")
+				for _, file := range report.Missing {
+					fmt.Printf("\t%s (%s)\n", file.Path, file.Pointer.OID[:10])
+				}
+				fmt.Println()
+			}
+			if len(report.Unpushed) > 0 {
+				fmt.Println("Not pushed yet:")
+				fmt.Println("  (use \"zark lfs push\" to upload them)")
+				for _, file := range report.Unpushed {
+					fmt.Printf("\t%s (%s)\n", file.Path, file.Pointer.OID[:10])
+				}
+				fmt.Println()
+			}
+			return nil
+		},
+	}
+}
+
+func lfsPruneCmd() *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete local copies of old large files",
+		Long:  "Deletes large files from .zark/lfs/objects that are not used by HEAD, the staging area, or commits from the last lfs.pruneoffsetdays days (7 by default). Files that have not been pushed are always kept, so nothing is lost; older files can be downloaded again with 'zark lfs fetch'.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			result, err := core.PruneLFS(repo, dryRun)
+			if err != nil {
+				return err
+			}
+			verb := "Deleted"
+			if dryRun {
+				verb = "Would delete"
+				for _, obj := range result.Removed {
+					fmt.Printf("  %s (%d bytes)\n", obj.OID[:10], obj.Size)
+				}
+			}
+			fmt.Printf("%s %d file(s), freeing %d bytes. Kept %d file(s).\n", verb, len(result.Removed), result.Bytes, result.Kept)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be deleted without deleting anything")
+
+	return cmd
+}
+
+func lfsMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Move large files that are already committed into LFS",
+	}
+
+	cmd.AddCommand(lfsMigrateInfoCmd())
+	cmd.AddCommand(lfsMigrateImportCmd())
+
+	return cmd
+}
+
+func lfsMigrateInfoCmd() *cobra.Command {
+	var top int
+	cmd := &cobra.Command{
+		Use:   "info",
+		Short: "Show which file types take up the most space in history",
+		Long:  "Adds up the size of every version of every file in your branches and tags, grouped by extension, so you can decide what to move into LFS.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			usage, err := core.LFSMigrateInfo(repo)
+			if err != nil {
+				return err
+			}
+			if len(usage) == 0 {
+				fmt.Println("No files outside LFS in history.")
+				return nil
+			}
+			for i, u := range usage {
+				if i == top {
+					fmt.Printf("  ... and %d more\n", len(usage)-top)
+					break
+				}
+				fmt.Printf("  %-16s %12d bytes  %d file version(s)\n", u.Pattern, u.Bytes, u.Files)
+			}
+			fmt.Println("\nTo move a pattern into LFS, run 'zark lfs migrate import --include \"*.ext\"'.")
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&top, "top", 10, "How many patterns to show")
+
+	return cmd
+}
+
+func lfsMigrateImportCmd() *cobra.Command {
+	var include []string
+	var yes bool
+	cmd := &cobra.Command{
+		Use:   "import --include <pattern>",
+		Short: "Rewrite history so matching files are stored with LFS",
+		Long: "Rewrites every commit on every branch and tag so that files matching the --include patterns become LFS pointers, " +
+			"moving their content into .zark/lfs/objects and adding the patterns to .zarkattributes in each commit.\n\n" +
+			"Commit hashes change, signatures are dropped, and a map from old to new hashes is saved in .zark/rewrite-map.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+			if len(include) == 0 {
+				return fmt.Errorf("choose the files to migrate with --include, e.g. --include \"*.psd\"")
+			}
+
+			if !yes {
+				fmt.Println("This rewrites every commit in the repository. Commit hashes will change, and anyone")
+				fmt.Println("who already has a copy will need to clone it again.")
+				fmt.Print("Do you want to continue? (y/N) ")
+				response, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				if strings.TrimSpace(strings.ToLower(response)) != "y" {
+					fmt.Println("Migration cancelled.")
+					return nil
+				}
+			}
+
+			result, err := core.LFSMigrateImport(repo, include)
+			if err != nil {
+				return err
+			}
+			if len(result.Commits) == 0 {
+				fmt.Println("Nothing matched; history is unchanged.")
+				return nil
+			}
+
+			var bytes int64
+			for _, obj := range result.Objects {
+				bytes += obj.Size
+			}
+			fmt.Printf("Moved %d file version(s), %d bytes, into LFS and rewrote %d commit(s).\n", len(result.Objects), bytes, len(result.Commits))
+			for _, ref := range result.Refs {
+				fmt.Printf("  updated %s\n", ref)
+			}
+			fmt.Printf("Old and new commit hashes are listed in %s\n", result.MapPath)
+			fmt.Println("\nNext steps:")
+			fmt.Println("  1. Run 'zark lfs push' to upload the large files.")
+			fmt.Println("  2. Run 'zark gc' to delete the old copies from the object database.")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&include, "include", nil, "Pattern of files to move into LFS, e.g. \"*.psd\" (repeatable or comma-separated)")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Do not ask for confirmation")
+
+	return cmd
+}
+
+func lfsLockCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "lock <path>",
+		Short: "Lock a file so nobody else can change it",
+		Long: "Tells the LFS server that you are editing a file, so others cannot save changes to it until you unlock it. " +
+			"Use this for files that cannot be merged, like .psd or .blend files. Files marked 'lockable' in .zarkattributes " +
+			"are checked out read-only and become writable once you lock them.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			lock, err := core.LockLFSFile(repo, args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Locked %s (ID: %s).\n", lock.Path, lock.ID)
+			fmt.Println("Run 'zark lfs unlock' on it when you have saved and pushed your changes.")
+			return nil
+		},
+	}
+}
+
+func lfsUnlockCmd() *cobra.Command {
+	var id string
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "unlock [path]",
+		Short: "Release a file you locked",
+		Long:  "Releases a lock so that others can edit the file again. Use --force to break a lock held by someone else, if the server allows it.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 && id == "" {
+				return fmt.Errorf("give the path to unlock, or the lock's --id")
+			}
+
+			path := ""
+			if len(args) > 0 {
+				path = args[0]
+			}
+			lock, err := core.UnlockLFSFile(repo, path, id, force)
+			if err != nil {
+				return err
+			}
+			if lock != nil {
+				fmt.Printf("Unlocked %s.\n", lock.Path)
+			} else {
+				fmt.Println("Unlocked.")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&id, "id", "", "Unlock the lock with this ID instead of naming a path")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Break a lock held by someone else")
+
+	return cmd
+}
+
+func lfsLocksCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "locks",
+		Short: "List locked files",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			locks, ours, err := core.ListLFSLocks(repo)
+			if err != nil {
+				return err
+			}
+			if len(locks) == 0 {
+				fmt.Println("No files are locked.")
+				return nil
+			}
+			for _, lock := range locks {
+				owner := lock.OwnerName()
+				if ours[lock.ID] {
+					owner += " (you)"
+				}
+				fmt.Printf("%-40s %-24s ID: %s\n", lock.Path, owner, lock.ID)
+			}
+			return nil
+		},
+	}
+}
+
+func lfsPushCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "push",
+		Short: "Upload large files to the LFS server",
+		Long:  "Uploads every large file referenced by your branches and tags that the LFS server (lfs.url) does not have yet. If a push is interrupted, run it again to continue.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			result, err := core.PushLFS(repo)
+			if err != nil {
+				return err
+			}
+			printLFSTransfer("Uploaded", result)
+			return result.Err()
+		},
+	}
+}
+
+func lfsFetchCmd() *cobra.Command {
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "fetch [branch-or-commit]",
+		Short: "Download large files from the LFS server",
+		Long:  "Downloads the large files used by a branch or commit (HEAD by default) into .zark/lfs/objects without changing your working files. Interrupted downloads resume where they stopped.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			rev := "HEAD"
+			if len(args) > 0 {
+				rev = args[0]
+			}
+			if all {
+				rev = ""
+			}
+			result, err := core.FetchLFS(repo, rev)
+			if err != nil {
+				return err
+			}
+			printLFSTransfer("Downloaded", result)
+			return result.Err()
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Download the large files of every commit, not just one")
+
+	return cmd
+}
+
+func lfsPullCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "pull",
+		Short: "Download large files and put them in your working tree",
+		Long:  "Like 'zark lfs fetch', then replaces the small pointer files left by checkout with the real content.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			result, updated, err := core.PullLFS(repo)
+			if err != nil {
+				return err
+			}
+			printLFSTransfer("Downloaded", result)
+			for _, path := range updated {
+				fmt.Printf("  updated %s\n", path)
+			}
+			return result.Err()
+		},
+	}
+}
+
+// printLFSTransfer summarises an upload or download.
+func printLFSTransfer(verb string, result *core.LFSTransferResult) {
+	var bytes int64
+	for _, obj := range result.Transferred {
+		bytes += obj.Size
+	}
+	fmt.Printf("%s %d file(s), %d bytes", verb, len(result.Transferred), bytes)
+	if result.Skipped > 0 {
+		fmt.Printf(" (%d already up to date)", result.Skipped)
+	}
+	fmt.Println(".")
+}
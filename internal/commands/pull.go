@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// PullCmd creates the `zark pull` command.
+func PullCmd() *cobra.Command {
+	var ffOnly, merge, rebase, autostash, noAutostash, continuePull, abort bool
+
+	cmd := &cobra.Command{
+		Use:   "pull",
+		Short: "Download and apply new commits from the branch's upstream",
+		Long: "Fetches the upstream of the current branch (set by clone, 'zark push -u' or 'zark branch set-upstream') and brings its new commits into your branch.\n\n" +
+			"If you have no commits of your own, your branch simply moves forward. Otherwise the two are combined with a merge commit (--merge, the default), " +
+			"or your commits are replayed on top of the upstream ones (--rebase). With --ff-only, a pull that would need either is refused. " +
+			"The default comes from pull.strategy.\n\n" +
+			"Local changes that are not saved yet stop the pull, unless --autostash (or pull.autostash) puts them aside and brings them back afterwards. " +
+			"If both sides changed the same lines, the pull stops so you can fix the conflicts and run 'zark pull --continue'.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			var result *core.PullResult
+			switch {
+			case abort:
+				if err := core.PullAbort(repo); err != nil {
+					return err
+				}
+				fmt.Println("Pull aborted; your branch and files are back as they were.")
+				return nil
+			case continuePull:
+				result, err = core.PullContinue(repo)
+			default:
+				var opts core.PullOptions
+				switch {
+				case ffOnly:
+					opts.Strategy = core.PullFastForwardOnly
+				case merge:
+					opts.Strategy = core.PullMerge
+				case rebase:
+					opts.Strategy = core.PullRebase
+				}
+				if autostash || noAutostash {
+					opts.Autostash = &autostash
+				}
+				result, err = core.Pull(repo, opts)
+			}
+			if err != nil {
+				return err
+			}
+			return printPullResult(result)
+		},
+	}
+
+	cmd.Flags().BoolVar(&ffOnly, "ff-only", false, "Only move the branch forward; refuse if it has commits of its own")
+	cmd.Flags().BoolVar(&merge, "merge", false, "Combine diverged branches with a merge commit")
+	cmd.Flags().BoolVar(&rebase, "rebase", false, "Replay your commits on top of the upstream ones")
+	cmd.Flags().BoolVar(&autostash, "autostash", false, "Put local changes aside during the pull and bring them back afterwards")
+	cmd.Flags().BoolVar(&noAutostash, "no-autostash", false, "Refuse to pull with local changes, even if pull.autostash is set")
+	cmd.Flags().BoolVar(&continuePull, "continue", false, "Finish a pull that stopped on conflicts, once they are fixed and added")
+	cmd.Flags().BoolVar(&abort, "abort", false, "Give up on a pull that stopped on conflicts and go back to where you were")
+	cmd.MarkFlagsMutuallyExclusive("ff-only", "merge", "rebase")
+	cmd.MarkFlagsMutuallyExclusive("autostash", "no-autostash")
+	cmd.MarkFlagsMutuallyExclusive("continue", "abort")
+
+	return cmd
+}
+
+// printPullResult summarises a pull for someone who may be new to merging.
+func printPullResult(result *core.PullResult) error {
+	if result.Fetch != nil && len(result.Fetch.Updates) > 0 {
+		printFetchResult(result.Fetch)
+	}
+
+	switch result.Outcome {
+	case "up to date":
+		fmt.Printf("Already up to date with '%s'.\n", result.Upstream)
+		return nil
+	case "fast-forward":
+		fmt.Printf("Fast-forwarded '%s' to '%s' (%d new commit(s)).\n", result.Branch, result.Upstream, len(result.Incoming))
+	case "merge":
+		if len(result.Conflicts) == 0 {
+			fmt.Printf("Merged '%s' into '%s' with a merge commit.\n", result.Upstream, result.Branch)
+		}
+	case "rebase":
+		if len(result.Conflicts) == 0 {
+			fmt.Printf("Rebased '%s': %d commit(s) of yours replayed on top of '%s'.\n", result.Branch, result.Rebased, result.Upstream)
+			if result.Skipped > 0 {
+				fmt.Printf("%d commit(s) were dropped because '%s' already had their changes.\n", result.Skipped, result.Upstream)
+			}
+		}
+	}
+
+	const shown = 10
+	for i, commit := range result.Incoming {
+		if i == shown {
+			fmt.Printf("  ... and %d more\n", len(result.Incoming)-shown)
+			break
+		}
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		fmt.Printf("  %s %s (%s)\n", commit.Hash()[:8], subject, commit.Author)
+	}
+	if len(result.Changed) > 0 {
+		fmt.Printf("%d file(s) changed:\n", len(result.Changed))
+		for _, file := range result.Changed {
+			fmt.Printf("  %-9s %s\n", file.Change+":", file.Path)
+		}
+	}
+
+	if len(result.Conflicts) > 0 {
+		fmt.Printf("The pull stopped: %d file(s) were changed on both sides in ways zark can't combine:\n", len(result.Conflicts))
+		printConflicts(result.Conflicts)
+		if result.Stashed {
+			fmt.Println("Your local changes were put aside and will come back once the pull is done.")
+		}
+		return fmt.Errorf("fix the conflicts before going on.\n" +
+			"hint: edit the files, keep the lines you want and remove the <<<<<<<, ======= and >>>>>>> markers, then 'zark add' them\n" +
+			"hint: then run 'zark pull --continue', or 'zark pull --abort' to go back to where you were")
+	}
+
+	if result.Stashed {
+		if len(result.StashConflicts) == 0 {
+			fmt.Println("Your local changes were put aside and brought back.")
+		} else {
+			fmt.Println("Your local changes were brought back, but some clash with the pulled commits:")
+			printConflicts(result.StashConflicts)
+			fmt.Println("hint: edit those files to fix the conflicts; your changes are not saved yet.")
+		}
+	}
+	return nil
+}
+
+func printConflicts(conflicts []core.MergeConflict) {
+	for _, conflict := range conflicts {
+		if conflict.Reason == "" {
+			fmt.Printf("  both changed: %s\n", conflict.Path)
+		} else {
+			fmt.Printf("  %s (%s)\n", conflict.Path, conflict.Reason)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// PushCmd creates the `zark push` command.
+func PushCmd() *cobra.Command {
+	var opts core.PushOptions
+	cmd := &cobra.Command{
+		Use:   "push [remote] [branch]",
+		Short: "Upload a branch to a remote",
+		Long: "Sends your commits on a branch (the current one by default) to a remote. Without arguments, the current branch goes to its upstream, " +
+			"or else to the branch of the same name on 'origin'. If the remote has commits you don't have, the push is refused so nobody's work is lost.\n\n" +
+			"With -u, the remote branch becomes the branch's upstream, so later 'zark pull' and 'zark push' know where to go.",
+		Args: cobra.MaximumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			remote := core.DefaultRemote
+			if len(args) > 0 {
+				remote = args[0]
+			}
+			var branch string
+			if len(args) > 1 {
+				branch = args[1]
+			} else if branch, err = core.CurrentBranch(repo); err != nil {
+				return err
+			} else if branch == "" {
+				return fmt.Errorf("you are not on a branch; name the branch to push, e.g. 'zark push %s main'", remote)
+			}
+			if len(args) == 0 {
+				upstreamRemote, upstreamBranch, err := core.GetUpstream(repo, branch)
+				if err != nil {
+					return err
+				}
+				if upstreamRemote != "" {
+					remote, opts.RemoteBranch = upstreamRemote, upstreamBranch
+				}
+			}
+
+			result, err := core.Push(repo, remote, branch, opts)
+			if err != nil {
+				return err
+			}
+			if result.UpToDate {
+				fmt.Println("Everything up to date.")
+				return nil
+			}
+			fmt.Printf("Pushed to '%s' (%d object(s) sent):\n", remote, result.Objects)
+			fmt.Println(formatRefUpdate(result.Update, shortRefName(result.Update.Name)))
+			if opts.SetUpstream && !opts.Delete {
+				fmt.Printf("'%s' now tracks '%s/%s'.\n", branch, remote, shortRefName(result.Update.Name))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Force, "force", "f", false, "Replace the remote branch even if that throws away commits on it")
+	cmd.Flags().BoolVarP(&opts.Delete, "delete", "d", false, "Delete the branch on the remote")
+	cmd.Flags().BoolVarP(&opts.SetUpstream, "set-upstream", "u", false, "Make the remote branch this branch's upstream for later pulls and pushes")
+
+	return cmd
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// RemoteCmd creates the `zark remote` command.
+func RemoteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "remote",
+		Short: "Manage the other repositories you share work with",
+		Long:  "A remote is another copy of your repository, for example on a shared drive or a server. Give it a short name like 'origin' and use that name with 'zark fetch' and 'zark push'.",
+	}
+
+	cmd.AddCommand(remoteAddCmd())
+	cmd.AddCommand(remoteListCmd())
+	cmd.AddCommand(remoteRemoveCmd())
+
+	return cmd
+}
+
+func remoteAddCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "add <name> <path-or-url>",
+		Short: "Add a remote",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			if err := core.AddRemote(repo, args[0], args[1]); err != nil {
+				return err
+			}
+			fmt.Printf("Added remote '%s'.\n", args[0])
+			fmt.Printf("Next step: run 'zark fetch %s' to download its branches.\n", args[0])
+			return nil
+		},
+	}
+}
+
+func remoteListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List remotes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			remotes, err := core.ListRemotes(repo)
+			if err != nil {
+				return err
+			}
+			if len(remotes) == 0 {
+				fmt.Println("No remotes yet. Add one with 'zark remote add origin <path-or-url>'.")
+				return nil
+			}
+			for _, remote := range remotes {
+				fmt.Printf("%s\t%s\n", remote.Name, remote.URL)
+			}
+			return nil
+		},
+	}
+}
+
+func remoteRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove a remote and its remote-tracking branches",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			if err := core.RemoveRemote(repo, args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Removed remote '%s'.\n", args[0])
+			return nil
+		},
+	}
+}
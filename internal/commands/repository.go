@@ -0,0 +1,19 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"zark/internal/core"
+)
+
+// openRepository locates the repository the current command operates on,
+// searching upward from the working directory unless ZARK_DIR is set.
+func openRepository() (*core.Repository, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	return core.OpenRepository(cwd)
+}
@@ -12,8 +12,9 @@ import (
 
 // SaveCmd creates the `zark save` command.
 func SaveCmd() *cobra.Command {
-	var message string
-	var sign bool
+	var message, author, date string
+	var coAuthors []string
+	var sign, noVerify bool
 	cmd := &cobra.Command{
 		Use:   "save",
 		Short: "Save staged changes to the repository",
@@ -29,22 +30,35 @@ func SaveCmd() *cobra.Command {
 				return fmt.Errorf("commit message cannot be empty")
 			}
 
-			cwd, err := os.Getwd()
-			if err != nil {
-				return fmt.Errorf("failed to get current directory: %w", err)
+			opts := core.CommitOptions{Message: message, Sign: sign, NoVerify: noVerify}
+			if author != "" {
+				identity, err := core.ParseIdentity(author)
+				if err != nil {
+					return err
+				}
+				opts.Author = &identity
 			}
-
-			repo := core.NewRepository(cwd)
-			if !repo.Exists() {
-				return fmt.Errorf("not a zark repository")
+			if date != "" {
+				when, err := core.ParseDate(date)
+				if err != nil {
+					return err
+				}
+				opts.AuthorDate = when
+			}
+			for _, coAuthor := range coAuthors {
+				identity, err := core.ParseIdentity(coAuthor)
+				if err != nil {
+					return err
+				}
+				opts.CoAuthors = append(opts.CoAuthors, identity)
 			}
 
-			// Secret Scanning
-			if err := core.ScanForSecrets(repo); err != nil {
+			repo, err := openRepository()
+			if err != nil {
 				return err
 			}
 
-			commitHash, err := core.CreateCommit(repo, message, sign)
+			commitHash, err := core.CreateCommitWithOptions(repo, opts)
 			if err != nil {
 				return err
 			}
@@ -55,7 +69,11 @@ func SaveCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(&message, "message", "m", "", "Commit message")
-	cmd.Flags().BoolVarP(&sign, "sign", "s", false, "Sign the commit with GPG")
+	cmd.Flags().BoolVarP(&sign, "sign", "s", false, "Sign the commit with your ed25519/SSH key (user.signingkey)")
+	cmd.Flags().StringVar(&author, "author", "", "Record someone else as the author, as \"Name <email>\"")
+	cmd.Flags().StringVar(&date, "date", "", "Override the author date, e.g. \"2024-03-01 14:30 +0100\"")
+	cmd.Flags().BoolVarP(&noVerify, "no-verify", "n", false, "Skip the pre-save and commit-msg hooks, including the secret scan")
+	cmd.Flags().StringArrayVar(&coAuthors, "co-author", nil, "Credit a pair-programming partner, as \"Name <email>\" (repeatable)")
 
 	return cmd
-}
\ No newline at end of file
+}
@@ -2,7 +2,6 @@ package commands
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/spf13/cobra"
 	"zark/internal/core"
@@ -16,14 +15,9 @@ func SearchCmd() *cobra.Command {
 		Short: "Search for commits in the repository",
 		Long:  "Search for commits by message, author, or content.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cwd, err := os.Getwd()
+			repo, err := openRepository()
 			if err != nil {
-				return fmt.Errorf("failed to get current directory: %w", err)
-			}
-
-			repo := core.NewRepository(cwd)
-			if !repo.Exists() {
-				return fmt.Errorf("not a zark repository")
+				return err
 			}
 
 			query := ""
@@ -44,6 +38,9 @@ func SearchCmd() *cobra.Command {
 			for _, commit := range results {
 				fmt.Printf("commit %s\n", commit.Hash())
 				fmt.Printf("Author: %s <%s>\n", commit.Author, commit.Email)
+				if committer := commit.CommitterIdentity(); !committer.SamePerson(commit.AuthorIdentity()) {
+					fmt.Printf("Commit: %s\n", committer)
+				}
 				fmt.Printf("Date:   %s\n", commit.Timestamp.Format("Mon Jan 2 15:04:05 2006 -0700"))
 				fmt.Printf("\n\t%s\n\n", commit.Message)
 			}
@@ -52,8 +49,8 @@ func SearchCmd() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVar(&author, "author", "", "Search for commits by author")
+	cmd.Flags().StringVar(&author, "author", "", "Search for commits by author or co-author")
 	cmd.Flags().StringVar(&message, "message", "", "Search for commits by message content")
 
 	return cmd
-}
\ No newline at end of file
+}
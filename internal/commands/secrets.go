@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// SecretsCmd creates the `zark secrets` command.
+func SecretsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Find passwords, tokens and keys before they are saved",
+		Long:  "Zark scans staged files for secrets every time you save. Rules, excluded paths and allowlisted values can be configured in .zark/secrets.json.",
+	}
+
+	cmd.AddCommand(secretsScanCmd())
+	cmd.AddCommand(secretsBaselineCmd())
+	cmd.AddCommand(secretsPurgeCmd())
+
+	return cmd
+}
+
+func secretsScanCmd() *cobra.Command {
+	var history bool
+	cmd := &cobra.Command{
+		Use:   "scan",
+		Short: "Scan staged files, or the whole history, for secrets",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			where := "staged files"
+			var findings []core.SecretFinding
+			if history {
+				where = "history"
+				findings, err = core.ScanHistory(repo)
+			} else {
+				findings, err = core.FindSecrets(repo)
+			}
+			if err != nil {
+				return err
+			}
+			if len(findings) == 0 {
+				fmt.Printf("No secrets found in %s.\n", where)
+				return nil
+			}
+
+			fmt.Print(core.FormatSecretFindings(findings))
+			if history {
+				fmt.Println("\nTo remove them from every commit, rotate the secrets first, then run")
+				fmt.Println("'zark secrets purge --replace <secret>' or 'zark secrets purge --drop <path>'.")
+			}
+			return fmt.Errorf("%d potential secret(s) found", len(findings))
+		},
+	}
+
+	cmd.Flags().BoolVar(&history, "history", false, "Scan every commit reachable from a branch or tag, reporting the commit, path and line")
+
+	return cmd
+}
+
+func secretsPurgeCmd() *cobra.Command {
+	var replace, drop []string
+	var yes bool
+	cmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Rewrite history to remove leaked secrets",
+		Long: "Rewrites every commit on every branch and tag, replacing leaked strings with " + core.PurgeReplacement + " and/or deleting whole files.\n\n" +
+			"Commit hashes change, signatures are dropped, and a map from old to new hashes is saved in .zark/rewrite-map. " +
+			"Run 'zark gc' afterwards to delete the leaked content for good. A purge does not make a leaked secret safe again: rotate it.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			opts := core.PurgeOptions{Replacements: make(map[string]string), DropPaths: drop}
+			for _, r := range replace {
+				secret, replacement, found := strings.Cut(r, "==>")
+				if !found {
+					replacement = core.PurgeReplacement
+				}
+				opts.Replacements[secret] = replacement
+			}
+
+			if !yes {
+				fmt.Println("This rewrites every commit in the repository. Commit hashes will change, and anyone")
+				fmt.Println("who already has a copy will need to clone it again.")
+				fmt.Print("Do you want to continue? (y/N) ")
+				response, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				if strings.TrimSpace(strings.ToLower(response)) != "y" {
+					fmt.Println("Purge cancelled.")
+					return nil
+				}
+			}
+
+			result, err := core.PurgeHistory(repo, opts)
+			if err != nil {
+				return err
+			}
+			if len(result.Commits) == 0 {
+				fmt.Println("Nothing matched; history is unchanged.")
+				return nil
+			}
+
+			fmt.Printf("Rewrote %d commit(s).\n", len(result.Commits))
+			for _, ref := range result.Refs {
+				fmt.Printf("  updated %s\n", ref)
+			}
+			fmt.Printf("Old and new commit hashes are listed in %s\n", result.MapPath)
+			fmt.Println("\nNext steps:")
+			fmt.Println("  1. Run 'zark gc' to delete the old objects.")
+			fmt.Println("  2. Check 'zark status': your working files still contain whatever was purged.")
+			fmt.Println("  3. Rotate the leaked secrets; anyone who had a copy may still have them.")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&replace, "replace", nil, "Leaked string to replace, or \"secret==>replacement\" (repeatable)")
+	cmd.Flags().StringArrayVar(&drop, "drop", nil, "Remove files matching this pattern from every commit, e.g. \"config/prod.env\" (repeatable)")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Do not ask for confirmation")
+
+	return cmd
+}
+
+func secretsBaselineCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "baseline",
+		Short: "Accept the current findings so they no longer block saving",
+		Long:  "Records every current finding in .zark/secrets-baseline.json. Only do this after checking that each finding is a false positive or an already-rotated secret.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			baseline, err := core.LoadSecretBaseline(repo)
+			if err != nil {
+				return err
+			}
+			findings, err := core.FindSecrets(repo)
+			if err != nil {
+				return err
+			}
+			if len(findings) == 0 {
+				fmt.Println("Nothing new to add to the baseline.")
+				return nil
+			}
+
+			if err := core.WriteSecretBaseline(repo, append(baseline.Findings, findings...)); err != nil {
+				return err
+			}
+			fmt.Print(core.FormatSecretFindings(findings))
+			fmt.Printf("Added %d finding(s) to %s\n", len(findings), core.SecretBaselinePath(repo))
+			return nil
+		},
+	}
+}
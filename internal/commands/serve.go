@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// ServeCmd creates the `zark serve` command.
+func ServeCmd() *cobra.Command {
+	var addr, usersFile string
+
+	cmd := &cobra.Command{
+		Use:   "serve --http <address> [repository...]",
+		Short: "Share repositories with others over HTTP",
+		Long: "Serves one or more repositories (usually bare ones) over HTTP so others can clone, fetch and push with an http:// URL.\n" +
+			"Each repository is reachable under its directory name, without '.zark'. With no repositories given, the current one is served.\n\n" +
+			"With --users, people must log in with a password or token from the users file, and can only read or push the repositories it grants them. " +
+			"Use 'zark serve hash-password' and 'zark serve new-token' to fill it in.",
+		Example: "  zark serve --http :8080 /srv/project.zark\n  zark clone http://localhost:8080/project",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if addr == "" {
+				return fmt.Errorf("choose where to listen with --http, for example --http :8080")
+			}
+			paths := args
+			if len(paths) == 0 {
+				repo, err := openRepository()
+				if err != nil {
+					return err
+				}
+				paths = []string{repo.Path}
+			}
+			repos, err := core.OpenServedRepositories(paths)
+			if err != nil {
+				return err
+			}
+
+			server := core.NewHTTPServer(repos)
+			if usersFile != "" {
+				if server.Users, err = core.LoadServerUsers(usersFile); err != nil {
+					return err
+				}
+			} else {
+				fmt.Println("Warning: without --users, anyone who can reach this address can read and push.")
+			}
+			host := addr
+			if host[0] == ':' {
+				host = "localhost" + host
+			}
+			for _, name := range server.Names() {
+				fmt.Printf("Serving '%s' at http://%s/%s\n", name, host, name)
+			}
+			fmt.Println("Press Ctrl+C to stop.")
+			return http.ListenAndServe(addr, server)
+		},
+	}
+	cmd.Flags().StringVar(&addr, "http", "", "Address to listen on, such as :8080")
+	cmd.Flags().StringVar(&usersFile, "users", "", "JSON file of users, their passwords or tokens, and their access to each repository")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "hash-password",
+		Short: "Hash a password for the users file",
+		Long:  "Reads a password from standard input and prints the hash to put in the \"password\" field of a user in the users file.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Fprint(os.Stderr, "Password: ")
+			password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			password = strings.TrimRight(password, "\r\n")
+			if password == "" {
+				if err != nil && err != io.EOF {
+					return fmt.Errorf("failed to read password: %w", err)
+				}
+				return fmt.Errorf("no password given")
+			}
+			hash, err := core.HashPassword(password)
+			if err != nil {
+				return err
+			}
+			fmt.Println(hash)
+			return nil
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "new-token",
+		Short: "Create an access token for the users file",
+		Long:  "Generates a random access token. Give the token to the user and put its hash in their \"tokens\" list in the users file.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, hash, err := core.NewAccessToken()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Token (give this to the user): %s\n", token)
+			fmt.Printf("Hash (put this in the users file): %s\n", hash)
+			fmt.Println("The user sets it with 'zark config set remote.origin.token <token>'.")
+			return nil
+		},
+	})
+	return cmd
+}
@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 	"zark/internal/core"
@@ -10,30 +11,51 @@ import (
 
 // StartCmd creates the `zark start` command.
 func StartCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "start",
+	var bare bool
+	cmd := &cobra.Command{
+		Use:   "start [directory]",
 		Short: "Initialize a new Zark repository",
-		Long:  "Initialize a new Zark repository in the current directory, creating the necessary .zark directory structure.",
+		Long:  "Initialize a new Zark repository in the current directory (or the given one), creating the necessary .zark directory structure. With --bare, the repository has no working tree and its files sit directly in the directory; this is what you host as a shared central repository.",
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cwd, err := os.Getwd()
+			dir, err := os.Getwd()
 			if err != nil {
 				return fmt.Errorf("failed to get current directory: %w", err)
 			}
+			if len(args) > 0 {
+				dir, err = filepath.Abs(args[0])
+				if err != nil {
+					return fmt.Errorf("failed to resolve %s: %w", args[0], err)
+				}
+			}
+
+			repo := core.NewRepository(dir)
+			if bare {
+				repo = core.NewBareRepository(dir)
+			}
 
-			repo := core.NewRepository(cwd)
-			if repo.Exists() {
+			existed := repo.Exists()
+			if existed {
 				// Re-initializing is safe, but we'll inform the user.
-				fmt.Printf("Reinitialized existing Zark repository in %s/.zark\n", cwd)
+				fmt.Printf("Reinitialized existing Zark repository in %s\n", repo.ZarkDir)
 			}
 
 			if err := repo.Init(); err != nil {
 				return fmt.Errorf("failed to initialize repository: %w", err)
 			}
 
-			if !repo.Exists() {
-				fmt.Printf("Initialized empty Zark repository in %s/.zark\n", cwd)
+			if !existed {
+				if bare {
+					fmt.Printf("Initialized empty bare Zark repository in %s\n", repo.ZarkDir)
+				} else {
+					fmt.Printf("Initialized empty Zark repository in %s\n", repo.ZarkDir)
+				}
 			}
 			return nil
 		},
 	}
-}
\ No newline at end of file
+
+	cmd.Flags().BoolVar(&bare, "bare", false, "Create a bare repository with no working tree")
+
+	return cmd
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"zark/internal/core"
+)
+
+// VerifyCommitCmd creates the `zark verify-commit` command.
+func VerifyCommitCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify-commit [branch-or-commit]",
+		Short: "Check the signature of a commit",
+		Long:  "Checks that a commit is signed, that the signature matches its contents, and that the key is listed for the committer in an allowed_signers file (.zark/allowed_signers, ~/.config/zark/allowed_signers or signing.allowedsigners).",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+
+			hash, err := core.ResolveRef(repo, args[0])
+			if err != nil {
+				return fmt.Errorf("failed to resolve ref '%s': %w", args[0], err)
+			}
+			commit, err := core.NewStorage(repo).LoadCommit(hash)
+			if err != nil {
+				return err
+			}
+
+			result := core.VerifyCommit(repo, commit)
+			switch result.Status {
+			case core.SignatureGood:
+				fmt.Printf("Good signature from %s\n", result.Principal)
+				fmt.Printf("Key: %s\n", result.Fingerprint)
+				return nil
+			case core.SignatureUnsigned:
+				return fmt.Errorf("commit %s is not signed", hash[:8])
+			default:
+				return fmt.Errorf("%s signature on commit %s: %s", result.Status, hash[:8], result.Reason)
+			}
+		},
+	}
+}
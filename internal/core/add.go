@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
 // AddFiles handles the core logic of adding files to the index.
 func AddFiles(repo *Repository, paths []string) error {
+	if err := repo.RequireWorkTree(); err != nil {
+		return err
+	}
+
 	// Load the index, or create a new one if it doesn't exist.
 	index, err := LoadIndex(repo.IndexPath)
 	if err != nil {
@@ -22,7 +25,27 @@ func AddFiles(repo *Repository, paths []string) error {
 	// FIX: Pass the entire repo object to NewStorage.
 	storage := NewStorage(repo)
 
+	// Pathspecs are relative to the current directory, which may be
+	// anywhere inside the working tree.
+	var relPaths []string
+	for _, path := range paths {
+		relPath, err := repo.RelativePath(path)
+		if err != nil {
+			return err
+		}
+		relPaths = append(relPaths, relPath)
+	}
+	if err := RunHook(repo, HookPreAdd, fileListInput(relPaths)); err != nil {
+		return err
+	}
+
+	attributes, err := LoadAttributes(repo)
+	if err != nil {
+		return err
+	}
+
 	for _, path := range paths {
+
 		// Walk the file path. If it's a file, it will be visited once.
 		// If it's a directory, it will visit all files within it.
 		err := filepath.Walk(path, func(currentPath string, info os.FileInfo, err error) error {
@@ -31,8 +54,8 @@ func AddFiles(repo *Repository, paths []string) error {
 			}
 
 			// Skip the .zark directory itself
-			if strings.Contains(currentPath, ".zark") {
-				return nil
+			if repo.isZarkDir(currentPath, info) {
+				return filepath.SkipDir
 			}
 
 			// Skip directories
@@ -40,21 +63,23 @@ func AddFiles(repo *Repository, paths []string) error {
 				return nil
 			}
 
-			absPath, err := filepath.Abs(currentPath)
+			// Get the relative path from the repository root
+			relPath, err := repo.RelativePath(currentPath)
 			if err != nil {
-				return fmt.Errorf("failed to get absolute path for %s: %w", currentPath, err)
+				return err
 			}
 
-			// Get the relative path from the repository root
-			relPath, err := filepath.Rel(repo.Path, absPath)
+			// Read file content; symlinks are stored as their target path
+			content, mode, err := readWorkingFile(currentPath, info)
 			if err != nil {
-				return fmt.Errorf("failed to get relative path for %s: %w", absPath, err)
+				return err
 			}
 
-			// Read file content
-			content, err := os.ReadFile(currentPath)
-			if err != nil {
-				return fmt.Errorf("failed to read file %s: %w", currentPath, err)
+			// Files tracked by LFS are staged as pointers to the real content
+			if mode != ModeSymlink && attributes.IsLFS(relPath) {
+				if content, err = lfsClean(repo, content); err != nil {
+					return fmt.Errorf("failed to store %s in LFS: %w", relPath, err)
+				}
 			}
 
 			// Create a blob, store it, and add it to the index
@@ -63,7 +88,7 @@ func AddFiles(repo *Repository, paths []string) error {
 				return fmt.Errorf("failed to store blob for %s: %w", relPath, err)
 			}
 
-			index.Add(relPath, blob.Hash(), "100644", info.Size(), info.ModTime())
+			index.Add(relPath, blob.Hash(), mode, info.Size(), info.ModTime())
 			fmt.Printf("added '%s'\n", relPath)
 
 			return nil
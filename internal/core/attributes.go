@@ -0,0 +1,98 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AttributesFile is the name of the file, at the root of the working tree,
+// that assigns attributes such as filter=lfs to paths.
+const AttributesFile = ".zarkattributes"
+
+// AttributeRule is one line of .zarkattributes: a path pattern followed by
+// attributes written as "name" (set), "-name" (unset) or "name=value".
+type AttributeRule struct {
+	Pattern string
+	Attrs   map[string]string
+}
+
+// Attributes holds the rules of a .zarkattributes file in order.
+type Attributes struct {
+	Rules []AttributeRule
+}
+
+// ParseAttributes parses the contents of a .zarkattributes file.
+func ParseAttributes(data []byte) *Attributes {
+	attrs := &Attributes{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		rule := AttributeRule{Pattern: fields[0], Attrs: make(map[string]string)}
+		for _, field := range fields[1:] {
+			switch {
+			case strings.HasPrefix(field, "-"):
+				rule.Attrs[field[1:]] = "false"
+			case strings.Contains(field, "="):
+				name, value, _ := strings.Cut(field, "=")
+				rule.Attrs[name] = value
+			default:
+				rule.Attrs[field] = "true"
+			}
+		}
+		attrs.Rules = append(attrs.Rules, rule)
+	}
+	return attrs
+}
+
+// LoadAttributes reads .zarkattributes from the working tree. A missing file
+// means no path has any attributes.
+func LoadAttributes(repo *Repository) (*Attributes, error) {
+	data, err := os.ReadFile(filepath.Join(repo.Path, AttributesFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Attributes{}, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", AttributesFile, err)
+	}
+	return ParseAttributes(data), nil
+}
+
+// attributesFromTree reads .zarkattributes as committed in a tree, so that
+// checking out a commit uses the attributes that were in effect for it.
+func attributesFromTree(storage *Storage, entries []TreeEntry) (*Attributes, error) {
+	for _, entry := range entries {
+		if entry.Name == AttributesFile {
+			data, err := storage.Load(entry.Hash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load %s: %w", AttributesFile, err)
+			}
+			return ParseAttributes(data), nil
+		}
+	}
+	return &Attributes{}, nil
+}
+
+// Get returns the value of an attribute for path. Later lines override
+// earlier ones, as in Git.
+func (a *Attributes) Get(path, name string) (string, bool) {
+	value, found := "", false
+	for _, rule := range a.Rules {
+		if v, ok := rule.Attrs[name]; ok && matchPathGlob(rule.Pattern, path) {
+			value, found = v, true
+		}
+	}
+	return value, found
+}
+
+// IsLFS reports whether path is stored with the LFS filter.
+func (a *Attributes) IsLFS(path string) bool {
+	value, _ := a.Get(path, "filter")
+	return value == "lfs"
+}
@@ -0,0 +1,400 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// A bundle is a single file holding references and a pack of the objects
+// they need, for moving history between machines without a server. It
+// starts with a text header, ended by an empty line, then the pack:
+//
+//	# zark bundle v1
+//	head main
+//	prerequisite <hash>
+//	ref <hash> refs/heads/main
+//
+//	PACK...
+//
+// Prerequisites are commits the pack builds on but leaves out; a repository
+// must have them before it can fetch from the bundle.
+const bundleSignature = "# zark bundle v1"
+
+// Bundle describes the contents of a bundle file.
+type Bundle struct {
+	Path string
+	// Refs maps full reference names to the commits they point at.
+	Refs map[string]string
+	// Head is the branch a clone of the bundle checks out.
+	Head          string
+	Prerequisites []string
+	Objects       int
+	// packOffset is where the pack starts in the file.
+	packOffset int64
+}
+
+// CreateBundle writes the history selected by revs, as parseRevRange reads
+// them, to a bundle file at path. Commits left out by a range must be
+// present where the bundle is fetched.
+func CreateBundle(repo *Repository, path string, revs []string) (*Bundle, error) {
+	refs, excluded, err := parseRevRange(repo, revs)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("no branch or tag to put in the bundle.\nhint: name one, e.g. 'zark bundle create %s main', or use --all", path)
+	}
+	bundle := &Bundle{Path: path, Refs: refs}
+
+	storage := NewStorage(repo)
+	shared, err := ReachableObjects(storage, excluded)
+	if err != nil {
+		return nil, err
+	}
+	var wants []string
+	for _, hash := range bundle.Refs {
+		wants = append(wants, hash)
+	}
+	sort.Strings(wants)
+	objects, _, err := selectObjects(storage, func(hash string) bool { return shared[hash] }, fetchRequest{Wants: wants})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("the bundle would be empty: the commits excluded already contain everything in it")
+	}
+	bundle.Objects = len(objects)
+	bundle.Prerequisites = uniqueSorted(excluded)
+	bundle.Head = bundleHead(repo, bundle.Refs)
+
+	var header bytes.Buffer
+	fmt.Fprintln(&header, bundleSignature)
+	if bundle.Head != "" {
+		fmt.Fprintf(&header, "head %s\n", bundle.Head)
+	}
+	for _, hash := range bundle.Prerequisites {
+		fmt.Fprintf(&header, "prerequisite %s\n", hash)
+	}
+	names := make([]string, 0, len(bundle.Refs))
+	for name := range bundle.Refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&header, "ref %s %s\n", bundle.Refs[name], name)
+	}
+	header.WriteString("\n")
+	bundle.packOffset = int64(header.Len())
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bundle: %w", err)
+	}
+	w := bufio.NewWriter(file)
+	w.Write(header.Bytes())
+	err = NewObjectPacker(repo).WritePack(w, objects)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return bundle, nil
+}
+
+// parseRevRange reads revs naming the history to hand to another
+// repository. Each rev is a branch or tag to include, "HEAD" for the current
+// branch, or "--all" for every branch and tag. "A..B" includes B without
+// what A already has, and "^A" leaves out what A has. It returns the full
+// names of the included refs with their commits, and the excluded commits.
+func parseRevRange(repo *Repository, revs []string) (map[string]string, []string, error) {
+	refs := make(map[string]string)
+	var excluded []string
+	include := func(name string) error {
+		ref, hash, err := bundleRef(repo, name)
+		if err != nil {
+			return err
+		}
+		refs[ref] = hash
+		return nil
+	}
+	exclude := func(name string) error {
+		hash, err := ResolveRef(repo, name)
+		if err != nil {
+			return fmt.Errorf("failed to resolve '%s': %w", name, err)
+		}
+		excluded = append(excluded, hash)
+		return nil
+	}
+
+	for _, rev := range revs {
+		var err error
+		switch from, to, isRange := strings.Cut(rev, ".."); {
+		case rev == "--all":
+			all, listErr := ListRefs(repo)
+			if listErr != nil {
+				return nil, nil, listErr
+			}
+			for name, hash := range all {
+				if strings.HasPrefix(name, "refs/heads/") || strings.HasPrefix(name, "refs/tags/") {
+					refs[name] = hash
+				}
+			}
+		case isRange:
+			if from == "" {
+				return nil, nil, fmt.Errorf("'%s' has no commit before '..'; write the range as <commit>..<branch>, e.g. 'v1.0..main'", rev)
+			}
+			if to == "" {
+				to = "HEAD"
+			}
+			if err = exclude(from); err == nil {
+				err = include(to)
+			}
+		case strings.HasPrefix(rev, "^"):
+			err = exclude(rev[1:])
+		default:
+			err = include(rev)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return refs, excluded, nil
+}
+
+// bundleRef resolves a rev to include to the full name of a branch or tag,
+// since references are what the receiving repository gets.
+func bundleRef(repo *Repository, name string) (string, string, error) {
+	if name == "HEAD" {
+		branch, err := CurrentBranch(repo)
+		if err != nil {
+			return "", "", err
+		}
+		if branch == "" {
+			return "", "", fmt.Errorf("HEAD is detached; name a branch or tag instead")
+		}
+		name = "refs/heads/" + branch
+	}
+	candidates := []string{"refs/heads/" + name, "refs/tags/" + name}
+	if strings.HasPrefix(name, "refs/heads/") || strings.HasPrefix(name, "refs/tags/") {
+		candidates = []string{name}
+	}
+	refs, err := ListRefs(repo)
+	if err != nil {
+		return "", "", err
+	}
+	for _, ref := range candidates {
+		if hash, ok := refs[ref]; ok {
+			return ref, hash, nil
+		}
+	}
+	return "", "", fmt.Errorf("'%s' is not a branch or tag.\nhint: other repositories receive history by branch and tag, so name one of those, e.g. 'main'", name)
+}
+
+// bundleHead picks the branch a clone of the bundle checks out: the current
+// branch if it is in the bundle, then main, then the first branch by name.
+func bundleHead(repo *Repository, refs map[string]string) string {
+	var branches []string
+	for name := range refs {
+		if branch, ok := strings.CutPrefix(name, "refs/heads/"); ok {
+			branches = append(branches, branch)
+		}
+	}
+	sort.Strings(branches)
+	current, _ := CurrentBranch(repo)
+	for _, preferred := range []string{current, "main"} {
+		if _, ok := refs["refs/heads/"+preferred]; ok && preferred != "" {
+			return preferred
+		}
+	}
+	if len(branches) > 0 {
+		return branches[0]
+	}
+	return ""
+}
+
+// uniqueSorted returns the strings sorted, without duplicates.
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// ReadBundle reads a bundle's header and checks that its pack is complete
+// and undamaged.
+func ReadBundle(path string) (*Bundle, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	bundle := &Bundle{Path: path, Refs: make(map[string]string)}
+	for first := true; ; first = false {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a zark bundle or is truncated", path)
+		}
+		bundle.packOffset += int64(len(line))
+		line = strings.TrimSuffix(line, "\n")
+		if first {
+			if line != bundleSignature {
+				return nil, fmt.Errorf("'%s' is not a zark bundle", path)
+			}
+			continue
+		}
+		if line == "" {
+			break
+		}
+		// Bundles come from elsewhere, so names and hashes are checked
+		// before they become references or appear in messages.
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 2 && fields[0] == "head" && checkRefName("refs/heads/"+fields[1]) == nil:
+			bundle.Head = fields[1]
+		case len(fields) == 2 && fields[0] == "prerequisite" && isObjectHash(fields[1]):
+			bundle.Prerequisites = append(bundle.Prerequisites, fields[1])
+		case len(fields) == 3 && fields[0] == "ref" && isObjectHash(fields[1]) && checkRefName(fields[2]) == nil:
+			bundle.Refs[fields[2]] = fields[1]
+		default:
+			return nil, fmt.Errorf("bundle '%s' has a malformed header line: %s", path, line)
+		}
+	}
+
+	// The pack ends with a checksum of everything before it.
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	packSize := info.Size() - bundle.packOffset
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || string(header[:4]) != "PACK" {
+		return nil, fmt.Errorf("bundle '%s' has no pack after its header", path)
+	}
+	if packSize < int64(len(header))+sha256.Size {
+		return nil, fmt.Errorf("bundle '%s' is truncated", path)
+	}
+	bundle.Objects = int(binary.BigEndian.Uint32(header[8:]))
+	sum := sha256.New()
+	sum.Write(header[:])
+	if _, err := io.CopyN(sum, r, packSize-int64(len(header))-sha256.Size); err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	var trailer [sha256.Size]byte
+	if _, err := io.ReadFull(r, trailer[:]); err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	if !bytes.Equal(sum.Sum(nil), trailer[:]) {
+		return nil, fmt.Errorf("bundle '%s' is damaged: its pack checksum does not match", path)
+	}
+	return bundle, nil
+}
+
+// VerifyBundle reads a bundle and returns the prerequisites repo lacks. With
+// a nil repo only the file itself is checked.
+func VerifyBundle(repo *Repository, path string) (*Bundle, []string, error) {
+	bundle, err := ReadBundle(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if repo == nil {
+		return bundle, nil, nil
+	}
+	return bundle, bundle.missingPrerequisites(NewStorage(repo)), nil
+}
+
+func (b *Bundle) missingPrerequisites(storage *Storage) []string {
+	var missing []string
+	for _, hash := range b.Prerequisites {
+		if !storage.Has(hash) {
+			missing = append(missing, hash)
+		}
+	}
+	return missing
+}
+
+// isBundleFile reports whether path is a file rather than a repository
+// directory, which makes it a bundle when used as a remote.
+func isBundleFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// bundleRemote is a bundle file used as a read-only remote.
+type bundleRemote struct {
+	bundle *Bundle
+}
+
+func (r *bundleRemote) Refs() (map[string]string, string, error) {
+	return r.bundle.Refs, r.bundle.Head, nil
+}
+
+func (r *bundleRemote) Fetch(local *Repository, req fetchRequest) (*fetchReply, error) {
+	if req.Objects != nil {
+		return nil, fmt.Errorf("a bundle cannot supply the objects a partial clone left out")
+	}
+	// The bundle's pack is copied whole, so it cannot be cut down.
+	if req.Depth > 0 {
+		return nil, fmt.Errorf("a bundle holds all the history it was created with, so it cannot be fetched shallow.\n" +
+			"hint: leave out --depth, or create the bundle from a range such as 'v1.0..main'")
+	}
+	if req.Filter != nil {
+		return nil, fmt.Errorf("a bundle holds all the files it was created with, so it cannot leave any out.\n" +
+			"hint: leave out --filter")
+	}
+	storage := NewStorage(local)
+	needed := false
+	for _, want := range req.Wants {
+		if !storage.Has(want) {
+			needed = true
+		}
+	}
+	if !needed {
+		return &fetchReply{}, nil
+	}
+	if missing := r.bundle.missingPrerequisites(storage); len(missing) > 0 {
+		short := make([]string, len(missing))
+		for i, hash := range missing {
+			short[i] = hash[:8]
+		}
+		return nil, fmt.Errorf("the bundle builds on %d commit(s) this repository does not have: %s.\n"+
+			"hint: fetch that history first, or create the bundle from a commit this repository has", len(missing), strings.Join(short, ", "))
+	}
+
+	file, err := os.Open(r.bundle.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(r.bundle.packOffset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	received, err := UnpackObjects(storage, file)
+	if err != nil {
+		return nil, err
+	}
+	return &fetchReply{Objects: received}, nil
+}
+
+func (r *bundleRemote) Push(local *Repository, updates []RefUpdate) (int, error) {
+	return 0, fmt.Errorf("cannot push to a bundle.\nhint: write a new one with 'zark bundle create %s <branch>'", r.bundle.Path)
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	isolateConfig(t)
+	repo, _, cleanup := setupTestRepo(t)
+	defer cleanup()
+	base := commitFile(t, repo, "notes.txt", "one")
+	UpdateRef(repo, "refs/tags/v1.0", base)
+	dir := t.TempDir()
+	full := filepath.Join(dir, "project.bundle")
+
+	if _, err := CreateBundle(repo, full, []string{"abc"}); err == nil || !strings.Contains(err.Error(), "not a branch or tag") {
+		t.Errorf("Expected an unknown name to be refused, got %v", err)
+	}
+	bundle, err := CreateBundle(repo, full, []string{"--all"})
+	if err != nil {
+		t.Fatalf("CreateBundle failed: %v", err)
+	}
+	if bundle.Head != "main" || bundle.Refs["refs/heads/main"] != base || bundle.Refs["refs/tags/v1.0"] != base || len(bundle.Prerequisites) != 0 {
+		t.Errorf("Expected main and v1.0 without prerequisites, got %+v", bundle)
+	}
+
+	clone, result, err := Clone(full, filepath.Join(dir, "clone"))
+	if err != nil {
+		t.Fatalf("Clone from a bundle failed: %v", err)
+	}
+	if head, _ := ResolveRef(clone, "main"); head != base || result.Objects != bundle.Objects {
+		t.Errorf("Expected the clone to check out main with %d objects, got %s and %d", bundle.Objects, head, result.Objects)
+	}
+	if data, _ := os.ReadFile(filepath.Join(clone.Path, "notes.txt")); string(data) != "one" {
+		t.Errorf("Expected notes.txt in the clone, got %q", data)
+	}
+
+	// An incremental bundle only carries what v1.0 lacks.
+	next := commitFile(t, repo, "notes.txt", "two")
+	update := filepath.Join(dir, "update.bundle")
+	bundle, err = CreateBundle(repo, update, []string{"v1.0..main"})
+	if err != nil {
+		t.Fatalf("CreateBundle failed: %v", err)
+	}
+	if bundle.Objects != 3 || len(bundle.Prerequisites) != 1 || bundle.Prerequisites[0] != base {
+		t.Errorf("Expected 3 objects on top of %s, got %+v", base[:8], bundle)
+	}
+	if _, err := CreateBundle(repo, filepath.Join(dir, "empty.bundle"), []string{"main..main"}); err == nil {
+		t.Error("Expected an empty bundle to be refused")
+	}
+
+	if _, missing, err := VerifyBundle(clone, update); err != nil || len(missing) != 0 {
+		t.Errorf("Expected the clone to have the prerequisites, got %v %v", missing, err)
+	}
+	AddRemote(clone, "usb", update)
+	if _, err := Fetch(clone, "usb"); err != nil {
+		t.Fatalf("Fetch from a bundle failed: %v", err)
+	}
+	if hash, _ := ResolveRef(clone, "usb/main"); hash != next {
+		t.Errorf("Expected usb/main at %s, got %s", next[:8], hash)
+	}
+	if _, err := Push(clone, "usb", "main", PushOptions{Force: true}); err == nil || !strings.Contains(err.Error(), "bundle") {
+		t.Errorf("Expected pushing to a bundle to be refused, got %v", err)
+	}
+
+	t.Run("Missing prerequisites and damage are reported", func(t *testing.T) {
+		isolateConfig(t)
+		other, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		if _, missing, err := VerifyBundle(other, update); err != nil || len(missing) != 1 || missing[0] != base {
+			t.Errorf("Expected %s to be missing, got %v %v", base[:8], missing, err)
+		}
+		if _, _, err := Clone(update, filepath.Join(t.TempDir(), "clone")); err == nil || !strings.Contains(err.Error(), "does not have") {
+			t.Errorf("Expected cloning an incremental bundle to fail, got %v", err)
+		}
+		if _, _, err := CloneWithOptions(full, filepath.Join(t.TempDir(), "shallow"), CloneOptions{Depth: 1}); err == nil || !strings.Contains(err.Error(), "shallow") {
+			t.Errorf("Expected a shallow clone of a bundle to be refused, got %v", err)
+		}
+		if _, _, err := CloneWithOptions(full, filepath.Join(t.TempDir(), "partial"), CloneOptions{Filter: "blob:none"}); err == nil || !strings.Contains(err.Error(), "--filter") {
+			t.Errorf("Expected a partial clone of a bundle to be refused, got %v", err)
+		}
+
+		data, _ := os.ReadFile(update)
+		data[len(data)-40] ^= 0xff
+		damaged := filepath.Join(t.TempDir(), "damaged.bundle")
+		os.WriteFile(damaged, data, 0644)
+		if _, err := ReadBundle(damaged); err == nil || !strings.Contains(err.Error(), "damaged") {
+			t.Errorf("Expected a damaged bundle to be reported, got %v", err)
+		}
+		os.WriteFile(damaged, data[:len(data)/2], 0644)
+		if _, err := ReadBundle(damaged); err == nil {
+			t.Error("Expected a truncated bundle to be reported")
+		}
+
+		// Header lines with short hashes or names outside refs/ are refused.
+		good, _ := os.ReadFile(full)
+		end := strings.Index(string(good), "\n\n")
+		for _, line := range []string{"prerequisite abc", "ref abc refs/heads/short", "ref " + base + " refs/heads/../../escaped", "head ../escaped"} {
+			forged := append([]byte(string(good[:end])+"\n"+line), good[end:]...)
+			os.WriteFile(damaged, forged, 0644)
+			if _, err := ReadBundle(damaged); err == nil || !strings.Contains(err.Error(), "malformed header") {
+				t.Errorf("Expected %q to be refused, got %v", line, err)
+			}
+		}
+	})
+}
@@ -4,11 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 )
 
 // Checkout handles the core logic of checking out a branch or commit.
 func Checkout(repo *Repository, ref string) error {
+	if err := repo.RequireWorkTree(); err != nil {
+		return err
+	}
+
 	// FIX: Pass the entire repo object to NewStorage.
 	storage := NewStorage(repo)
 
@@ -23,6 +29,19 @@ func Checkout(repo *Repository, ref string) error {
 		return fmt.Errorf("failed to resolve ref '%s': %w", ref, err)
 	}
 
+	if isBranch {
+		if err := EnforceSignaturePolicy(repo, ref, []string{commitHash}); err != nil {
+			return err
+		}
+	}
+
+	// Hooks receive the previous and the new commit, like Git's post-checkout.
+	previousHash, _ := ResolveRef(repo, "HEAD")
+	hookInput := HookInput{Args: []string{previousHash, commitHash, ref}}
+	if err := RunHook(repo, HookPreCheckout, hookInput); err != nil {
+		return err
+	}
+
 	commitData, err := storage.Load(commitHash)
 	if err != nil {
 		return fmt.Errorf("failed to load commit object %s: %w", commitHash, err)
@@ -43,9 +62,83 @@ func Checkout(repo *Repository, ref string) error {
 	}
 	tree := Tree{Entries: treeEntries}
 
+	missingLFS, err := checkoutTree(repo, storage, tree.Entries)
+	if err != nil {
+		return err
+	}
+
+	var headContent string
+	if isBranch {
+		headContent = fmt.Sprintf("ref: refs/heads/%s", ref)
+	} else {
+		headContent = commitHash
+	}
+
+	if err := os.WriteFile(repo.HeadPath, []byte(headContent), 0644); err != nil {
+		return fmt.Errorf("failed to update HEAD: %w", err)
+	}
+
+	if len(missingLFS) > 0 {
+		fmt.Printf("%d large file(s) have not been downloaded yet and were checked out as pointers:\n", len(missingLFS))
+		for _, path := range missingLFS {
+			fmt.Printf("  %s\n", path)
+		}
+		fmt.Println("Run 'zark lfs pull' to download them.")
+	}
+
+	if err := RunHook(repo, HookPostCheckout, hookInput); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+
+	return nil
+}
+
+// checkTreePath refuses a tree entry name that would be written outside the
+// working tree or into .zark, where a planted hook would run. Trees can come
+// from other repositories, so every tree applied to the working tree is
+// checked first.
+func checkTreePath(name string) error {
+	if name == "" || path.IsAbs(name) || path.Clean(name) != name {
+		return fmt.Errorf("the tree holds the path '%s', which is not a clean relative path", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." || strings.EqualFold(part, ".zark") {
+			return fmt.Errorf("the tree holds the path '%s', which would be written outside the working tree or into .zark", name)
+		}
+	}
+	return nil
+}
+
+// checkTreePaths runs checkTreePath on each entry.
+func checkTreePaths(entries []TreeEntry) error {
+	for _, entry := range entries {
+		if err := checkTreePath(entry.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkoutTree replaces the tracked files of the working tree and the index
+// with entries. It returns the LFS files whose content is not available
+// locally and were written as pointers.
+func checkoutTree(repo *Repository, storage *Storage, entries []TreeEntry) ([]string, error) {
+	if err := checkTreePaths(entries); err != nil {
+		return nil, err
+	}
+	// A partial clone fetches the blobs it left out all at once, before
+	// anything in the working tree is touched.
+	hashes := make([]string, len(entries))
+	for i, entry := range entries {
+		hashes[i] = entry.Hash
+	}
+	if err := storage.Prefetch(hashes); err != nil {
+		return nil, err
+	}
+
 	index, err := LoadIndex(repo.IndexPath)
 	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to load index: %w", err)
+		return nil, fmt.Errorf("failed to load index: %w", err)
 	}
 
 	if index != nil {
@@ -54,41 +147,60 @@ func Checkout(repo *Repository, ref string) error {
 		}
 	}
 
+	attributes, err := attributesFromTree(storage, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	ownLocks, err := LoadOwnLFSLocks(repo)
+	if err != nil {
+		return nil, err
+	}
+
 	newIndex := NewIndex()
+	var missingLFS []string
 
-	for _, entry := range tree.Entries {
+	for _, entry := range entries {
 		filePath := filepath.Join(repo.Path, entry.Name)
 		blobData, err := storage.Load(entry.Hash)
 		if err != nil {
-			return fmt.Errorf("failed to load blob %s for file %s: %w", entry.Hash, entry.Name, err)
+			return nil, fmt.Errorf("failed to load blob %s for file %s: %w", entry.Hash, entry.Name, err)
 		}
 
 		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-			return fmt.Errorf("failed to create directory for %s: %w", filePath, err)
+			return nil, fmt.Errorf("failed to create directory for %s: %w", filePath, err)
 		}
 
-		if err := os.WriteFile(filePath, blobData, 0644); err != nil {
-			return fmt.Errorf("failed to write file %s: %w", filePath, err)
+		mode := normalizeMode(entry.Mode)
+		if mode != ModeSymlink && attributes.IsLFS(entry.Name) {
+			var downloaded bool
+			blobData, downloaded, err = lfsSmudge(repo, blobData)
+			if err != nil {
+				return nil, err
+			}
+			if !downloaded {
+				missingLFS = append(missingLFS, entry.Name)
+			}
+		}
+		if err := writeWorkingFile(filePath, blobData, mode); err != nil {
+			return nil, err
+		}
+		if _, locked := ownLocks[entry.Name]; attributes.IsLockable(entry.Name) && !locked {
+			// Lockable files stay read-only until 'zark lfs lock' is run on them.
+			if err := setWorkingFileWritable(repo, entry.Name, false); err != nil {
+				return nil, err
+			}
 		}
 
-		info, _ := os.Stat(filePath)
-		newIndex.Add(entry.Name, entry.Hash, "100644", info.Size(), info.ModTime())
+		info, err := os.Lstat(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", filePath, err)
+		}
+		newIndex.Add(entry.Name, entry.Hash, mode, info.Size(), info.ModTime())
 	}
 
 	if err := newIndex.Save(repo.IndexPath); err != nil {
-		return fmt.Errorf("failed to save new index after checkout: %w", err)
+		return nil, fmt.Errorf("failed to save new index after checkout: %w", err)
 	}
-
-	var headContent string
-	if isBranch {
-		headContent = fmt.Sprintf("ref: refs/heads/%s", ref)
-	} else {
-		headContent = commitHash
-	}
-
-	if err := os.WriteFile(repo.HeadPath, []byte(headContent), 0644); err != nil {
-		return fmt.Errorf("failed to update HEAD: %w", err)
-	}
-
-	return nil
-}
\ No newline at end of file
+	return missingLFS, nil
+}
@@ -5,16 +5,64 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
+// CommitOptions controls how CreateCommitWithOptions builds a commit.
+type CommitOptions struct {
+	Message string
+	Sign    bool
+	// Author overrides the configured identity for the author only; the
+	// committer is always the person running the command.
+	Author *Identity
+	// AuthorDate overrides the author timestamp when non-zero.
+	AuthorDate time.Time
+	// CoAuthors are appended to the message as Co-authored-by trailers.
+	CoAuthors []Identity
+	// NoVerify skips the pre-save and commit-msg hooks, including the secret scan.
+	NoVerify bool
+}
+
 // CreateCommit creates a new commit object from the index, signs it if requested,
 // and updates the current branch reference.
 func CreateCommit(repo *Repository, message string, sign bool) (string, error) {
+	return CreateCommitWithOptions(repo, CommitOptions{Message: message, Sign: sign})
+}
+
+// CreateCommitWithOptions creates a new commit object from the index using opts
+// and updates the current branch reference.
+func CreateCommitWithOptions(repo *Repository, opts CommitOptions) (string, error) {
+	if err := repo.RequireWorkTree(); err != nil {
+		return "", err
+	}
+
 	index, err := LoadIndex(repo.IndexPath)
 	if err != nil || len(index.Entries) == 0 {
 		return "", fmt.Errorf("nothing to commit, index is empty")
 	}
 
+	staged, err := StagedPaths(repo)
+	if err != nil {
+		return "", err
+	}
+	if !opts.NoVerify {
+		input := fileListInput(staged)
+		input.Env[EnvCommitMessage] = opts.Message
+		if err := RunHook(repo, HookPreSave, input); err != nil {
+			return "", fmt.Errorf("%w\nhint: to save anyway, run 'zark save --no-verify'", err)
+		}
+	}
+	if err := checkLFSLocks(repo, staged); err != nil {
+		return "", err
+	}
+	unresolved, err := unresolvedConflicts(repo)
+	if err != nil {
+		return "", err
+	}
+	if len(unresolved) > 0 {
+		return "", conflictMarkersError(unresolved)
+	}
+
 	storage := NewStorage(repo)
 	var treeEntries []TreeEntry
 	for _, entry := range index.Entries {
@@ -31,27 +79,28 @@ func CreateCommit(repo *Repository, message string, sign bool) (string, error) {
 	}
 
 	parent, _ := ResolveRef(repo, "HEAD")
-	config, err := repo.GetConfig()
-	if err != nil {
-		return "", fmt.Errorf("failed to load config: %w", err)
+	message := opts.Message
+	var coAuthorTrailers []Trailer
+	for _, coAuthor := range opts.CoAuthors {
+		coAuthorTrailers = append(coAuthorTrailers, Trailer{Key: TrailerCoAuthoredBy, Value: coAuthor.String()})
 	}
-
-	commit := NewCommit(tree.Hash(), parent, config.User.Name, config.User.Email, message)
-
-	if sign {
-		// Pass the commit object itself to be signed
-		signedCommit, err := SignCommit(commit)
+	message = AppendTrailers(message, coAuthorTrailers)
+	if !opts.NoVerify {
+		message, err = runCommitMsgHook(repo, message, staged)
 		if err != nil {
-			return "", fmt.Errorf("failed to sign commit: %w", err)
+			return "", err
 		}
-		// The signing process modifies the commit (e.g., adds a signature to the message),
-		// so we need to re-calculate its hash.
-		commit = signedCommit
-		commit.rehash()
 	}
 
-	if err := storage.Store(commit); err != nil {
-		return "", fmt.Errorf("failed to store commit object: %w", err)
+	parents := []string{parent}
+	if mergeHead := MergeInProgress(repo); mergeHead != "" {
+		parents = append(parents, mergeHead)
+	}
+	commitOpts := opts
+	commitOpts.Message = message
+	commit, err := newCommitObject(repo, storage, tree.Hash(), parents, commitOpts)
+	if err != nil {
+		return "", err
 	}
 
 	// Update the current branch to point to the new commit
@@ -68,6 +117,119 @@ func CreateCommit(repo *Repository, message string, sign bool) (string, error) {
 	if err := os.WriteFile(branchPath, []byte(commit.Hash()+"\n"), 0644); err != nil {
 		return "", fmt.Errorf("failed to update branch reference: %w", err)
 	}
+	clearMergeState(repo)
+
+	// The commit is already saved, so a failing post-save hook only warns.
+	input := fileListInput(staged)
+	input.Env[EnvCommitHash] = commit.Hash()
+	input.Env[EnvCommitMessage] = commit.Message
+	if err := RunHook(repo, HookPostSave, input); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
 
 	return commit.Hash(), nil
-}
\ No newline at end of file
+}
+
+// newCommitObject creates and stores a commit of the tree with the given
+// parents, first parent first, signing it if opts.Sign or commit.sign ask for
+// it. No reference is updated.
+func newCommitObject(repo *Repository, storage *Storage, treeHash string, parents []string, opts CommitOptions) (*Commit, error) {
+	author, committer, err := commitIdentities(repo, opts)
+	if err != nil {
+		return nil, err
+	}
+	commit := NewCommitWithIdentities(treeHash, parents[0], author, committer, opts.Message)
+	if len(parents) > 1 {
+		commit.MergeParents = parents[1:]
+		commit.rehash()
+	}
+
+	if opts.Sign || commitSignByDefault(repo) {
+		key, err := ConfiguredSigningKey(repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign commit: %w", err)
+		}
+		// The signature covers the commit without its signature, and is then
+		// stored alongside it, so the commit hash changes once signed.
+		if _, err := SignCommit(commit, key); err != nil {
+			return nil, fmt.Errorf("failed to sign commit: %w", err)
+		}
+	}
+
+	if err := storage.Store(commit); err != nil {
+		return nil, fmt.Errorf("failed to store commit object: %w", err)
+	}
+	return commit, nil
+}
+
+// runCommitMsgHook lets the commit-msg hook check or rewrite the message. Like
+// Git, the message is written to .zark/COMMIT_EDITMSG, whose path is passed as
+// the first argument, and read back afterwards.
+func runCommitMsgHook(repo *Repository, message string, staged []string) (string, error) {
+	msgFile := filepath.Join(repo.ZarkDir, "COMMIT_EDITMSG")
+	if err := os.WriteFile(msgFile, []byte(message+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write commit message: %w", err)
+	}
+
+	input := fileListInput(staged)
+	input.Args = []string{msgFile}
+	input.Env[EnvCommitMessage] = message
+	input.Env[EnvCommitMsgFile] = msgFile
+	input.Stdin = message + "\n"
+	if err := RunHook(repo, HookCommitMsg, input); err != nil {
+		return "", fmt.Errorf("%w\nhint: to save anyway, run 'zark save --no-verify'", err)
+	}
+
+	data, err := os.ReadFile(msgFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read commit message: %w", err)
+	}
+	message = strings.TrimSpace(string(data))
+	if message == "" {
+		return "", fmt.Errorf("aborting commit: the commit-msg hook left an empty message")
+	}
+	return message, nil
+}
+
+// commitIdentities works out the author and committer for a new commit.
+func commitIdentities(repo *Repository, opts CommitOptions) (Identity, Identity, error) {
+	config, err := repo.GetConfig()
+	if err != nil {
+		return Identity{}, Identity{}, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	committer, err := resolveIdentity(config, EnvCommitterName, EnvCommitterEmail, EnvCommitterDate)
+	if err != nil {
+		return Identity{}, Identity{}, err
+	}
+	if committer.Name == "" || committer.Email == "" {
+		committer.Name, committer.Email = guessIdentity(committer.Name, committer.Email)
+		fmt.Printf("hint: your name and email were guessed as '%s'.\n", committer)
+		fmt.Println("hint: set them with 'zark config set --global user.name \"Your Name\"' and 'zark config set --global user.email you@example.com'")
+	}
+
+	author, err := resolveIdentity(config, EnvAuthorName, EnvAuthorEmail, EnvAuthorDate)
+	if err != nil {
+		return Identity{}, Identity{}, err
+	}
+	if author.Name == "" || author.Email == "" {
+		author.Name, author.Email = guessIdentity(author.Name, author.Email)
+	}
+	if opts.Author != nil {
+		author.Name, author.Email = opts.Author.Name, opts.Author.Email
+	}
+	if !opts.AuthorDate.IsZero() {
+		author.When = opts.AuthorDate
+	}
+
+	return author, committer, nil
+}
+
+// commitSignByDefault reports whether commit.sign asks for every commit to be signed.
+func commitSignByDefault(repo *Repository) bool {
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return false
+	}
+	return config.GetBool("commit.sign", false)
+}
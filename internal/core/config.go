@@ -0,0 +1,487 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigScope identifies the layer a configuration value was read from.
+// Later scopes take precedence over earlier ones.
+type ConfigScope int
+
+const (
+	ScopeSystem ConfigScope = iota // Machine-wide config, e.g. /etc/zark/config
+	ScopeGlobal                    // Per-user config, e.g. ~/.config/zark/config
+	ScopeLocal                     // Per-repository config in .zark/config
+	ScopeEnv                       // ZARK_* environment overrides
+)
+
+func (s ConfigScope) String() string {
+	switch s {
+	case ScopeSystem:
+		return "system"
+	case ScopeGlobal:
+		return "global"
+	case ScopeLocal:
+		return "local"
+	case ScopeEnv:
+		return "env"
+	}
+	return "unknown"
+}
+
+// Environment variables that control where configuration is read from.
+const (
+	EnvConfigSystem   = "ZARK_CONFIG_SYSTEM"   // Overrides the system config file path
+	EnvConfigGlobal   = "ZARK_CONFIG_GLOBAL"   // Overrides the global config file path
+	EnvConfigNoSystem = "ZARK_CONFIG_NOSYSTEM" // Skips the system config file when set
+	EnvConfigCount    = "ZARK_CONFIG_COUNT"    // Number of ZARK_CONFIG_KEY_<n>/ZARK_CONFIG_VALUE_<n> pairs
+)
+
+// maxIncludeDepth guards against include cycles.
+const maxIncludeDepth = 10
+
+// ConfigValue is a single configuration entry and where it came from.
+type ConfigValue struct {
+	Key    string
+	Value  string
+	Scope  ConfigScope
+	Origin string // "file:<path>" or "env:<variable>"
+}
+
+// ConfigSet is the merged view of every configuration layer.
+type ConfigSet struct {
+	entries []ConfigValue
+}
+
+// Get returns the effective value of key, i.e. the one from the highest-precedence layer.
+func (c *ConfigSet) Get(key string) (string, bool) {
+	value, ok := c.Lookup(key)
+	return value.Value, ok
+}
+
+// Lookup returns the effective entry for key, including its origin.
+func (c *ConfigSet) Lookup(key string) (ConfigValue, bool) {
+	key = canonicalConfigKey(key)
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		if c.entries[i].Key == key {
+			return c.entries[i], true
+		}
+	}
+	return ConfigValue{}, false
+}
+
+// GetAll returns every value of a multi-valued key from every layer, lowest precedence first.
+func (c *ConfigSet) GetAll(key string) []string {
+	key = canonicalConfigKey(key)
+	var values []string
+	for _, entry := range c.entries {
+		if entry.Key == key {
+			values = append(values, entry.Value)
+		}
+	}
+	return values
+}
+
+// GetString returns the value of key, or def if it is not set.
+func (c *ConfigSet) GetString(key, def string) string {
+	if value, ok := c.Get(key); ok {
+		return value
+	}
+	return def
+}
+
+// GetBool returns the boolean value of key, or def if it is unset or invalid.
+func (c *ConfigSet) GetBool(key string, def bool) bool {
+	value, ok := c.Get(key)
+	if !ok {
+		return def
+	}
+	b, err := parseConfigBool(value)
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+// GetInt returns the integer value of key, or def if it is unset or invalid.
+func (c *ConfigSet) GetInt(key string, def int64) int64 {
+	value, ok := c.Get(key)
+	if !ok {
+		return def
+	}
+	n, err := parseConfigInt(value)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// Entries returns every entry from every layer in precedence order,
+// including values that are overridden by later layers.
+func (c *ConfigSet) Entries() []ConfigValue {
+	return append([]ConfigValue(nil), c.entries...)
+}
+
+// Append adds an entry with the highest precedence so far.
+func (c *ConfigSet) Append(value ConfigValue) {
+	value.Key = canonicalConfigKey(value.Key)
+	c.entries = append(c.entries, value)
+}
+
+// Subsections returns the distinct subsection names used under section,
+// e.g. the remote names for "remote".
+func (c *ConfigSet) Subsections(section string) []string {
+	section = strings.ToLower(section)
+	seen := make(map[string]bool)
+	var names []string
+	for _, entry := range c.entries {
+		sec, sub, _ := splitConfigKey(entry.Key)
+		if sec == section && sub != "" && !seen[sub] {
+			seen[sub] = true
+			names = append(names, sub)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadConfig reads and merges the system, global and repository configuration,
+// followed by environment overrides. repo may be nil outside a repository.
+func LoadConfig(repo *Repository) (*ConfigSet, error) {
+	set := &ConfigSet{}
+
+	for _, scope := range []ConfigScope{ScopeSystem, ScopeGlobal, ScopeLocal} {
+		path := ConfigPathForScope(scope, repo)
+		if path == "" {
+			continue
+		}
+		if err := set.loadFile(path, scope, repo, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := set.loadEnv(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// ConfigPathForScope returns the file backing a configuration scope, or ""
+// if the scope has no file (e.g. the local scope outside a repository).
+func ConfigPathForScope(scope ConfigScope, repo *Repository) string {
+	switch scope {
+	case ScopeSystem:
+		if os.Getenv(EnvConfigNoSystem) != "" {
+			return ""
+		}
+		if path := os.Getenv(EnvConfigSystem); path != "" {
+			return path
+		}
+		if runtime.GOOS == "windows" {
+			return filepath.Join(os.Getenv("ProgramData"), "zark", "config")
+		}
+		return "/etc/zark/config"
+	case ScopeGlobal:
+		if path := os.Getenv(EnvConfigGlobal); path != "" {
+			return path
+		}
+		if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+			return filepath.Join(xdg, "zark", "config")
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		return filepath.Join(home, ".config", "zark", "config")
+	case ScopeLocal:
+		if repo == nil {
+			return ""
+		}
+		return repo.ConfigPath
+	}
+	return ""
+}
+
+func (c *ConfigSet) loadFile(path string, scope ConfigScope, repo *Repository, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("config includes nested too deeply at %s", path)
+	}
+
+	tree, err := readConfigFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var values []ConfigValue
+	flattenConfig("", tree, func(key, value string) {
+		values = append(values, ConfigValue{Key: key, Value: value, Scope: scope, Origin: "file:" + path})
+	})
+	// Map iteration order is random; keep listings stable.
+	sort.SliceStable(values, func(i, j int) bool { return values[i].Key < values[j].Key })
+	c.entries = append(c.entries, values...)
+
+	// JSON objects have no order, so included files are read after the
+	// including file and their values take precedence over it.
+	for _, value := range values {
+		includePath, ok := includeTarget(value, repo)
+		if !ok {
+			continue
+		}
+		includePath = expandHome(includePath)
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(filepath.Dir(path), includePath)
+		}
+		if err := c.loadFile(includePath, scope, repo, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// includeTarget reports whether value is an include directive that applies to repo.
+// Supported forms are include.path and includeIf.dir:<directory>.path; the latter
+// applies when the repository's working tree (or metadata directory) lies inside
+// the given directory, which lets work and personal identities live side by side.
+func includeTarget(value ConfigValue, repo *Repository) (string, bool) {
+	section, subsection, name := splitConfigKey(value.Key)
+	if name != "path" {
+		return "", false
+	}
+	if section == "include" && subsection == "" {
+		return value.Value, true
+	}
+	if section != "includeif" || repo == nil {
+		return "", false
+	}
+
+	condition, ok := strings.CutPrefix(subsection, "dir:")
+	if !ok {
+		return "", false
+	}
+	dir := filepath.Clean(expandHome(condition))
+	for _, candidate := range []string{repo.Path, repo.ZarkDir} {
+		if candidate == dir || strings.HasPrefix(candidate, dir+string(filepath.Separator)) {
+			return value.Value, true
+		}
+	}
+	return "", false
+}
+
+func (c *ConfigSet) loadEnv() error {
+	for key, spec := range knownConfigKeys {
+		if spec.Env == "" {
+			continue
+		}
+		if value, ok := os.LookupEnv(spec.Env); ok {
+			c.entries = append(c.entries, ConfigValue{Key: key, Value: value, Scope: ScopeEnv, Origin: "env:" + spec.Env})
+		}
+	}
+
+	countStr := os.Getenv(EnvConfigCount)
+	if countStr == "" {
+		return nil
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count < 0 {
+		return fmt.Errorf("%s must be a non-negative number, got '%s'", EnvConfigCount, countStr)
+	}
+	for i := 0; i < count; i++ {
+		keyVar := fmt.Sprintf("ZARK_CONFIG_KEY_%d", i)
+		valueVar := fmt.Sprintf("ZARK_CONFIG_VALUE_%d", i)
+		key := os.Getenv(keyVar)
+		if key == "" {
+			return fmt.Errorf("%s is missing or empty", keyVar)
+		}
+		c.entries = append(c.entries, ConfigValue{
+			Key:    canonicalConfigKey(key),
+			Value:  os.Getenv(valueVar),
+			Scope:  ScopeEnv,
+			Origin: "env:" + keyVar,
+		})
+	}
+	return nil
+}
+
+// SetConfigValue validates value for key and writes it to the config file at path.
+func SetConfigValue(path, key, value string) error {
+	key, typed, err := ValidateConfigValue(key, value)
+	if err != nil {
+		return err
+	}
+
+	tree, err := readConfigFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		tree = make(map[string]any)
+	}
+
+	section, subsection, name := splitConfigKey(key)
+	node := childMap(tree, section)
+	if subsection != "" {
+		node = childMap(node, subsection)
+	}
+	node[name] = typed
+
+	return writeConfigFile(path, tree)
+}
+
+// UnsetConfigValue removes key from the config file at path.
+// It returns an error if the key is not set in that file.
+func UnsetConfigValue(path, key string) error {
+	key = canonicalConfigKey(key)
+	tree, err := readConfigFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("key '%s' is not set in %s", key, path)
+		}
+		return err
+	}
+
+	section, subsection, name := splitConfigKey(key)
+	sectionNode, _ := tree[section].(map[string]any)
+	node := sectionNode
+	if subsection != "" {
+		node, _ = sectionNode[subsection].(map[string]any)
+	}
+	if _, ok := node[name]; !ok {
+		return fmt.Errorf("key '%s' is not set in %s", key, path)
+	}
+
+	delete(node, name)
+	if subsection != "" && len(node) == 0 {
+		delete(sectionNode, subsection)
+	}
+	if len(sectionNode) == 0 {
+		delete(tree, section)
+	}
+	return writeConfigFile(path, tree)
+}
+
+// RemoveConfigSection deletes a whole section or subsection, e.g. "remote.origin".
+func RemoveConfigSection(path, section string) error {
+	tree, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	sec, sub, _ := strings.Cut(section, ".")
+	sec = strings.ToLower(sec)
+	if sub == "" {
+		delete(tree, sec)
+	} else if node, ok := tree[sec].(map[string]any); ok {
+		delete(node, sub)
+		if len(node) == 0 {
+			delete(tree, sec)
+		}
+	}
+	return writeConfigFile(path, tree)
+}
+
+func readConfigFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := make(map[string]any)
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return tree, nil
+	}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return tree, nil
+}
+
+func writeConfigFile(path string, tree map[string]any) error {
+	data, err := json.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// flattenConfig turns nested JSON objects into dotted keys. Section and
+// variable names are case-insensitive; subsection names keep their case.
+func flattenConfig(prefix string, node map[string]any, emit func(key, value string)) {
+	for name, raw := range node {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		switch v := raw.(type) {
+		case map[string]any:
+			flattenConfig(key, v, emit)
+		case string:
+			emit(canonicalConfigKey(key), v)
+		case bool:
+			emit(canonicalConfigKey(key), strconv.FormatBool(v))
+		case float64:
+			emit(canonicalConfigKey(key), strconv.FormatFloat(v, 'f', -1, 64))
+		case []any:
+			// Multi-valued keys are stored as arrays; each element is an entry.
+			for _, item := range v {
+				emit(canonicalConfigKey(key), fmt.Sprint(item))
+			}
+		}
+	}
+}
+
+func childMap(parent map[string]any, name string) map[string]any {
+	if child, ok := parent[name].(map[string]any); ok {
+		return child
+	}
+	child := make(map[string]any)
+	parent[name] = child
+	return child
+}
+
+// splitConfigKey splits "section.subsection.name" at the first and last dots,
+// so subsection names may themselves contain dots.
+func splitConfigKey(key string) (section, subsection, name string) {
+	first := strings.Index(key, ".")
+	last := strings.LastIndex(key, ".")
+	if first < 0 {
+		return key, "", ""
+	}
+	if first == last {
+		return key[:first], "", key[first+1:]
+	}
+	return key[:first], key[first+1 : last], key[last+1:]
+}
+
+// canonicalConfigKey lowercases the section and variable name of a key.
+func canonicalConfigKey(key string) string {
+	section, subsection, name := splitConfigKey(key)
+	if subsection == "" {
+		return strings.ToLower(section) + "." + strings.ToLower(name)
+	}
+	return strings.ToLower(section) + "." + subsection + "." + strings.ToLower(name)
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// configKind is the type a known configuration key must hold.
+type configKind int
+
+const (
+	configString configKind = iota
+	configBool
+	configInt
+	configPath
+	configEnum
+)
+
+// configKey describes a configuration key Zark understands.
+type configKey struct {
+	Kind    configKind
+	Choices []string // Allowed values for configEnum keys
+	Env     string   // Environment variable that overrides the key, if any
+	Help    string
+}
+
+// knownConfigKeys lists the keys Zark reads. Keys with a subsection use "*"
+// in its place, e.g. "remote.*.url".
+var knownConfigKeys = map[string]configKey{
+	"user.name":  {Kind: configString, Env: "ZARK_USER_NAME", Help: "Your name, recorded on commits"},
+	"user.email": {Kind: configString, Env: "ZARK_USER_EMAIL", Help: "Your email address, recorded on commits"},
+	"core.bare":  {Kind: configBool, Help: "Whether the repository has no working tree"},
+
+	"user.signingkey": {Kind: configPath, Env: "ZARK_SIGNING_KEY", Help: "Private ed25519/SSH key used to sign commits"},
+	"commit.sign":     {Kind: configBool, Help: "Sign every commit, as if --sign were always given"},
+
+	"signing.allowedsigners":    {Kind: configPath, Help: "File mapping identities to the public keys trusted to sign for them"},
+	"branch.*.verifysignatures": {Kind: configBool, Help: "Refuse to check out or merge commits without a good signature on this branch"},
+
+	"remote.*.url":                {Kind: configString, Help: "Path or URL of a remote repository, e.g. remote.origin.url"},
+	"remote.*.token":              {Kind: configString, Help: "Token sent to an http:// remote served with 'zark serve --users' (default $ZARK_REMOTE_TOKEN)"},
+	"remote.*.promisor":           {Kind: configBool, Help: "Fetch the objects a partial clone left out from this remote when they are needed"},
+	"remote.*.partialclonefilter": {Kind: configString, Help: "Blobs left out when fetching from this remote, e.g. blob:none or blob:limit=1m"},
+
+	"branch.*.protected": {Kind: configBool, Help: "Refuse pushes that force-update or delete this branch"},
+	"branch.*.remote":    {Kind: configString, Help: "Remote that pull and push use for this branch, set with 'zark branch set-upstream'"},
+	"branch.*.merge":     {Kind: configString, Help: "Branch on the remote that this branch pulls from and pushes to"},
+
+	"pull.strategy":  {Kind: configEnum, Choices: []string{"merge", "rebase", "ff-only"}, Help: "How pull combines diverged branches: merge, rebase or ff-only (default merge)"},
+	"pull.autostash": {Kind: configBool, Help: "Put local changes aside during a pull and bring them back afterwards"},
+
+	"core.hookspath": {Kind: configPath, Help: "Directory holding hook scripts instead of .zark/hooks"},
+	"hook.*.command": {Kind: configString, Help: "Shell command to run as the named hook, e.g. hook.pre-save.command (repeatable)"},
+	"secrets.scan":   {Kind: configBool, Help: "Scan staged files for secrets before every save (default true)"},
+
+	"lfs.url":                 {Kind: configString, Env: "ZARK_LFS_URL", Help: "LFS server endpoint, e.g. https://example.com/project.git/info/lfs"},
+	"lfs.accesstoken":         {Kind: configString, Env: "ZARK_LFS_TOKEN", Help: "Token sent as a Bearer Authorization header to the LFS server"},
+	"lfs.concurrenttransfers": {Kind: configInt, Help: "How many LFS objects to upload or download at once (default 8)"},
+	"lfs.pruneoffsetdays":     {Kind: configInt, Help: "How many days of recent commits keep their LFS objects during 'zark lfs prune' (default 7)"},
+
+	"include.path":     {Kind: configPath, Help: "Another config file to read"},
+	"includeif.*.path": {Kind: configPath, Help: "A config file to read when the condition (e.g. dir:~/work/) matches"},
+}
+
+// lookupConfigKey finds the registry entry for a canonical key.
+func lookupConfigKey(key string) (configKey, bool) {
+	if spec, ok := knownConfigKeys[key]; ok {
+		return spec, true
+	}
+	section, subsection, name := splitConfigKey(key)
+	if subsection != "" {
+		spec, ok := knownConfigKeys[section+".*."+name]
+		return spec, ok
+	}
+	return configKey{}, false
+}
+
+// isKnownConfigSection reports whether any known key lives in section.
+func isKnownConfigSection(section string) bool {
+	for key := range knownConfigKeys {
+		if s, _, _ := splitConfigKey(key); s == section {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateConfigValue checks value against the type of key. It returns the
+// canonical key and the value converted to the type it is stored as.
+func ValidateConfigValue(key, value string) (string, any, error) {
+	section, _, name := splitConfigKey(key)
+	if section == "" || name == "" {
+		return "", nil, fmt.Errorf("invalid key '%s': keys look like 'section.name', e.g. 'user.name'", key)
+	}
+	key = canonicalConfigKey(key)
+
+	spec, ok := lookupConfigKey(key)
+	if !ok {
+		// Typos in sections Zark owns are almost always mistakes; other
+		// sections are left alone so tools can store their own settings.
+		if isKnownConfigSection(strings.ToLower(section)) {
+			return "", nil, fmt.Errorf("unknown key '%s'. Run 'zark config list' to see the current settings", key)
+		}
+		return key, value, nil
+	}
+
+	switch spec.Kind {
+	case configBool:
+		b, err := parseConfigBool(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid value for '%s': %w", key, err)
+		}
+		return key, b, nil
+	case configInt:
+		n, err := parseConfigInt(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid value for '%s': %w", key, err)
+		}
+		return key, n, nil
+	case configEnum:
+		for _, choice := range spec.Choices {
+			if strings.EqualFold(value, choice) {
+				return key, choice, nil
+			}
+		}
+		return "", nil, fmt.Errorf("invalid value for '%s': expected one of %s", key, strings.Join(spec.Choices, ", "))
+	case configPath:
+		if strings.TrimSpace(value) == "" {
+			return "", nil, fmt.Errorf("invalid value for '%s': path cannot be empty", key)
+		}
+	}
+	return key, value, nil
+}
+
+func parseConfigBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("'%s' is not a boolean (use true or false)", value)
+}
+
+// parseConfigInt parses integers with an optional k, m or g suffix.
+func parseConfigInt(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	multiplier := int64(1)
+	if n := len(value); n > 0 {
+		switch value[n-1] {
+		case 'k', 'K':
+			multiplier = 1 << 10
+		case 'm', 'M':
+			multiplier = 1 << 20
+		case 'g', 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier != 1 {
+			value = value[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a number", value)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// isolateConfig points the system and global config at files inside the test's
+// temporary directory so the developer's own settings cannot leak in.
+func isolateConfig(t *testing.T) (systemPath, globalPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	systemPath = filepath.Join(dir, "system")
+	globalPath = filepath.Join(dir, "global")
+	t.Setenv(EnvConfigSystem, systemPath)
+	t.Setenv(EnvConfigGlobal, globalPath)
+	return systemPath, globalPath
+}
+
+func TestLayeredConfig(t *testing.T) {
+	t.Run("Later layers override earlier ones", func(t *testing.T) {
+		systemPath, globalPath := isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		SetConfigValue(systemPath, "user.name", "System User")
+		SetConfigValue(systemPath, "user.email", "system@example.com")
+		SetConfigValue(globalPath, "user.name", "Global User")
+		SetConfigValue(repo.ConfigPath, "user.name", "Local User")
+
+		set, err := LoadConfig(repo)
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		value, _ := set.Lookup("user.name")
+		if value.Value != "Local User" || value.Scope != ScopeLocal {
+			t.Errorf("Expected the local user.name to win, got %+v", value)
+		}
+		if value.Origin != "file:"+repo.ConfigPath {
+			t.Errorf("Expected origin file:%s, got %s", repo.ConfigPath, value.Origin)
+		}
+		if email, _ := set.Get("user.email"); email != "system@example.com" {
+			t.Errorf("Expected user.email from the system config, got %s", email)
+		}
+
+		t.Setenv("ZARK_USER_NAME", "Env User")
+		config, err := repo.GetConfig()
+		if err != nil {
+			t.Fatalf("GetConfig failed: %v", err)
+		}
+		if config.User.Name != "Env User" {
+			t.Errorf("Expected ZARK_USER_NAME to override the files, got %s", config.User.Name)
+		}
+	})
+
+	t.Run("Generic environment overrides", func(t *testing.T) {
+		isolateConfig(t)
+		t.Setenv(EnvConfigCount, "1")
+		t.Setenv("ZARK_CONFIG_KEY_0", "core.bare")
+		t.Setenv("ZARK_CONFIG_VALUE_0", "true")
+
+		set, err := LoadConfig(nil)
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		if !set.GetBool("core.bare", false) {
+			t.Error("Expected core.bare to be set from the environment")
+		}
+	})
+
+	t.Run("Conditional includes apply per directory", func(t *testing.T) {
+		_, globalPath := isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		workConfig := filepath.Join(filepath.Dir(globalPath), "work")
+		SetConfigValue(workConfig, "user.email", "me@work.example.com")
+		SetConfigValue(globalPath, "user.email", "me@home.example.com")
+		SetConfigValue(globalPath, "includeIf.dir:"+repo.Path+".path", workConfig)
+		SetConfigValue(globalPath, "includeIf.dir:/somewhere/else.path", "/does/not/matter")
+
+		set, err := LoadConfig(repo)
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		if email, _ := set.Get("user.email"); email != "me@work.example.com" {
+			t.Errorf("Expected the work identity inside %s, got %s", repo.Path, email)
+		}
+
+		set, _ = LoadConfig(nil)
+		if email, _ := set.Get("user.email"); email != "me@home.example.com" {
+			t.Errorf("Expected the personal identity outside the repository, got %s", email)
+		}
+	})
+
+	t.Run("Known keys are validated", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config")
+
+		if err := SetConfigValue(path, "core.bare", "maybe"); err == nil {
+			t.Error("Expected a non-boolean core.bare to be rejected")
+		}
+		if err := SetConfigValue(path, "user.nmae", "typo"); err == nil {
+			t.Error("Expected an unknown key in the user section to be rejected")
+		}
+		if err := SetConfigValue(path, "tool.setting", "anything"); err != nil {
+			t.Errorf("Expected keys in other sections to be accepted, got %v", err)
+		}
+		if err := SetConfigValue(path, "core.bare", "yes"); err != nil {
+			t.Fatalf("SetConfigValue failed: %v", err)
+		}
+
+		data, _ := os.ReadFile(path)
+		if !strings.Contains(string(data), `"bare": true`) {
+			t.Errorf("Expected core.bare to be stored as a boolean. Got:\n%s", data)
+		}
+
+		if err := UnsetConfigValue(path, "core.bare"); err != nil {
+			t.Fatalf("UnsetConfigValue failed: %v", err)
+		}
+		if err := UnsetConfigValue(path, "core.bare"); err == nil {
+			t.Error("Expected unsetting a missing key to fail")
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotRepository is returned when no repository can be found for a directory.
+var ErrNotRepository = errors.New("not a zark repository (or any of the parent directories)")
+
+// Environment variables that override repository discovery.
+const (
+	EnvZarkDir      = "ZARK_DIR"       // Path to the .zark directory to use
+	EnvZarkWorkTree = "ZARK_WORK_TREE" // Path to the root of the working tree
+)
+
+// OpenRepository returns the repository that commands started in cwd operate on.
+// ZARK_DIR and ZARK_WORK_TREE take precedence; otherwise the repository is
+// discovered by searching cwd and its parents.
+func OpenRepository(cwd string) (*Repository, error) {
+	cwd, err := filepath.Abs(cwd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", cwd, err)
+	}
+
+	zarkDir := os.Getenv(EnvZarkDir)
+	workTree := os.Getenv(EnvZarkWorkTree)
+
+	if zarkDir == "" {
+		repo, err := FindRepository(cwd)
+		if err != nil {
+			return nil, err
+		}
+		if workTree != "" {
+			return NewRepositoryAt(absFrom(cwd, workTree), repo.ZarkDir), nil
+		}
+		return repo, nil
+	}
+
+	zarkDir = absFrom(cwd, zarkDir)
+	if info, err := os.Stat(zarkDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%s=%s is not a zark directory", EnvZarkDir, zarkDir)
+	}
+	if workTree == "" && configSaysBare(filepath.Join(zarkDir, "config")) {
+		return NewBareRepository(zarkDir), nil
+	}
+	// Like git, an explicit metadata directory without a work tree
+	// treats the current directory as the top of the working tree.
+	if workTree == "" {
+		workTree = cwd
+	}
+	return NewRepositoryAt(absFrom(cwd, workTree), zarkDir), nil
+}
+
+// FindRepository searches dir and its parent directories for a .zark directory.
+// The search does not cross filesystem boundaries.
+func FindRepository(dir string) (*Repository, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	startInfo, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", dir, err)
+	}
+
+	for {
+		if info, err := os.Stat(filepath.Join(dir, ".zark")); err == nil && info.IsDir() {
+			repo := NewRepository(dir)
+			repo.Bare = configSaysBare(repo.ConfigPath)
+			return repo, nil
+		}
+		if isBareRepository(dir) {
+			return NewBareRepository(dir), nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotRepository
+		}
+		parentInfo, err := os.Stat(parent)
+		if err != nil {
+			return nil, ErrNotRepository
+		}
+		if !sameFilesystem(startInfo, parentInfo) {
+			return nil, fmt.Errorf("%w; stopping at filesystem boundary %s", ErrNotRepository, dir)
+		}
+		dir = parent
+	}
+}
+
+// isBareRepository reports whether dir holds a bare repository's layout directly.
+func isBareRepository(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return configSaysBare(filepath.Join(dir, "config"))
+}
+
+// configSaysBare reads core.bare from a repository config file.
+func configSaysBare(configPath string) bool {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return false
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return false
+	}
+	return config.Core.Bare
+}
+
+// RelativePath converts a path given on the command line, relative to the
+// current directory, into a slash-separated path relative to the working tree root.
+func (r *Repository) RelativePath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path for %s: %w", path, err)
+	}
+
+	relPath, err := filepath.Rel(r.Path, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("'%s' is outside repository at '%s'", path, r.Path)
+	}
+	return filepath.ToSlash(relPath), nil
+}
+
+// isZarkDir reports whether path is the repository's metadata directory
+// or any other .zark directory that must never be tracked.
+func (r *Repository) isZarkDir(path string, info os.FileInfo) bool {
+	if !info.IsDir() {
+		return false
+	}
+	if info.Name() == ".zark" {
+		return true
+	}
+	absPath, err := filepath.Abs(path)
+	return err == nil && absPath == r.ZarkDir
+}
+
+func absFrom(base, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(base, path)
+}
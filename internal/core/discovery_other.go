@@ -0,0 +1,10 @@
+//go:build !unix
+
+package core
+
+import "os"
+
+// sameFilesystem always reports true on platforms without device numbers.
+func sameFilesystem(a, b os.FileInfo) bool {
+	return true
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepositoryDiscovery(t *testing.T) {
+	t.Run("Find the repository from a subdirectory", func(t *testing.T) {
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		subDir := filepath.Join(repo.Path, "src", "pkg")
+		os.MkdirAll(subDir, 0755)
+
+		found, err := FindRepository(subDir)
+		if err != nil {
+			t.Fatalf("FindRepository failed: %v", err)
+		}
+		if found.Path != repo.Path {
+			t.Errorf("Expected repository at %s, got %s", repo.Path, found.Path)
+		}
+	})
+
+	t.Run("Report a missing repository", func(t *testing.T) {
+		_, err := FindRepository(t.TempDir())
+		if !errors.Is(err, ErrNotRepository) {
+			t.Errorf("Expected ErrNotRepository, got %v", err)
+		}
+	})
+
+	t.Run("ZARK_DIR and ZARK_WORK_TREE override discovery", func(t *testing.T) {
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		workTree := t.TempDir()
+		t.Setenv(EnvZarkDir, repo.ZarkDir)
+		t.Setenv(EnvZarkWorkTree, workTree)
+
+		opened, err := OpenRepository(t.TempDir())
+		if err != nil {
+			t.Fatalf("OpenRepository failed: %v", err)
+		}
+		if opened.ZarkDir != repo.ZarkDir {
+			t.Errorf("Expected metadata directory %s, got %s", repo.ZarkDir, opened.ZarkDir)
+		}
+		if opened.Path != workTree {
+			t.Errorf("Expected work tree %s, got %s", workTree, opened.Path)
+		}
+	})
+
+	t.Run("Pathspecs are relative to the current subdirectory", func(t *testing.T) {
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		os.MkdirAll(filepath.Join("src", "pkg"), 0755)
+		os.WriteFile(filepath.Join("src", "pkg", "main.go"), []byte("package main"), 0644)
+		if err := os.Chdir(filepath.Join("src", "pkg")); err != nil {
+			t.Fatalf("Failed to change directory: %v", err)
+		}
+
+		if err := AddFiles(repo, []string{"main.go"}); err != nil {
+			t.Fatalf("AddFiles failed: %v", err)
+		}
+		findIndexEntry(t, repo, "src/pkg/main.go")
+
+		if err := AddFiles(repo, []string{"../../../outside.txt"}); err == nil {
+			t.Error("Expected AddFiles to reject a path outside the repository")
+		}
+	})
+}
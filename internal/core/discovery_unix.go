@@ -0,0 +1,18 @@
+//go:build unix
+
+package core
+
+import (
+	"os"
+	"syscall"
+)
+
+// sameFilesystem reports whether two files live on the same device.
+func sameFilesystem(a, b os.FileInfo) bool {
+	statA, okA := a.Sys().(*syscall.Stat_t)
+	statB, okB := b.Sys().(*syscall.Stat_t)
+	if !okA || !okB {
+		return true
+	}
+	return statA.Dev == statB.Dev
+}
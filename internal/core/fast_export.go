@@ -0,0 +1,259 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FastExportOptions controls FastExport.
+type FastExportOptions struct {
+	// ImportMarks names a marks file from an earlier export; the commits
+	// it names are not written again, so exports can be incremental.
+	ImportMarks string
+	// ExportMarks names a file to write the marks to afterwards.
+	ExportMarks string
+}
+
+// FastExportResult describes what a fast-export stream holds.
+type FastExportResult struct {
+	Commits int
+	Blobs   int
+	Refs    int
+	// Notes mention what the stream could not carry.
+	Notes []string
+}
+
+// fastExporter writes one stream.
+type fastExporter struct {
+	storage *Storage
+	out     *bufio.Writer
+	// marks maps the blobs and commits written so far to their marks.
+	marks    map[string]int
+	nextMark int
+	// shared holds the commits left out by the revs, which the importing
+	// side must already have.
+	shared map[string]bool
+	signed int
+	result *FastExportResult
+}
+
+// FastExport writes the history selected by revs, as parseRevRange reads
+// them, to out as a fast-import stream. Commits come parents first, each
+// with the file changes since its first parent, and are written to the
+// branch or tag that first reaches them.
+func FastExport(repo *Repository, out io.Writer, revs []string, options FastExportOptions) (*FastExportResult, error) {
+	refs, excluded, err := parseRevRange(repo, revs)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("nothing to export.\nhint: name a branch or tag, e.g. 'zark fast-export main', or use --all")
+	}
+	storage := NewStorage(repo)
+	shared, err := ReachableObjects(storage, excluded)
+	if err != nil {
+		return nil, err
+	}
+	ex := &fastExporter{
+		storage:  storage,
+		out:      bufio.NewWriter(out),
+		marks:    make(map[string]int),
+		nextMark: 1,
+		shared:   shared,
+		result:   &FastExportResult{},
+	}
+	if options.ImportMarks != "" {
+		marks, err := readMarks(options.ImportMarks)
+		if err != nil {
+			return nil, err
+		}
+		for number, hash := range marks {
+			ex.marks[hash] = number
+			if number >= ex.nextMark {
+				ex.nextMark = number + 1
+			}
+		}
+	}
+
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tip := refs[name]
+		if ex.shared[tip] {
+			continue
+		}
+		if _, done := ex.marks[tip]; done {
+			// Another branch or an earlier export wrote the commit, so
+			// the ref only needs pointing at it.
+			fmt.Fprintf(ex.out, "reset %s\nfrom %s\n\n", name, ex.commitRef(tip))
+		} else if err := ex.exportCommits(name, tip); err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", shortRefName(name), err)
+		}
+		ex.result.Refs++
+	}
+	fmt.Fprintf(ex.out, "done\n")
+	if err := ex.out.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write the stream: %w", err)
+	}
+	if ex.signed > 0 {
+		ex.result.Notes = append(ex.result.Notes, fmt.Sprintf("%d commit(s) were signed; the stream cannot carry zark signatures, so they were dropped", ex.signed))
+	}
+
+	if options.ExportMarks != "" {
+		marks := make(map[int]string, len(ex.marks))
+		for hash, number := range ex.marks {
+			marks[number] = hash
+		}
+		if err := writeMarks(options.ExportMarks, marks); err != nil {
+			return nil, err
+		}
+	}
+	return ex.result, nil
+}
+
+// done reports whether a commit is already in the stream or left out.
+func (ex *fastExporter) done(hash string) bool {
+	_, marked := ex.marks[hash]
+	return marked || ex.shared[hash]
+}
+
+// commitRef names a commit in the stream: by its mark, or by its hash when
+// the revs left it out.
+func (ex *fastExporter) commitRef(hash string) string {
+	if mark, ok := ex.marks[hash]; ok {
+		return ":" + strconv.Itoa(mark)
+	}
+	return hash
+}
+
+// mark gives an object the next mark.
+func (ex *fastExporter) mark(hash string) int {
+	ex.marks[hash] = ex.nextMark
+	ex.nextMark++
+	return ex.marks[hash]
+}
+
+// exportCommits writes root and the ancestors not yet written, parents
+// first, to the ref name.
+func (ex *fastExporter) exportCommits(name, root string) error {
+	stack := []string{root}
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		if ex.done(hash) {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		commit, err := ex.storage.LoadCommit(hash)
+		if err != nil {
+			return err
+		}
+		pending := false
+		for _, parent := range commit.Parents() {
+			if !ex.done(parent) {
+				stack = append(stack, parent)
+				pending = true
+			}
+		}
+		if pending {
+			continue
+		}
+		stack = stack[:len(stack)-1]
+		if err := ex.writeCommit(name, commit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ex *fastExporter) writeCommit(name string, commit *Commit) error {
+	parents := commit.Parents()
+	base := ""
+	if len(parents) > 0 {
+		base = parents[0]
+	}
+	old, err := commitTreeEntries(ex.storage, base)
+	if err != nil {
+		return err
+	}
+	entries, err := commitTreeEntries(ex.storage, commit.Hash())
+	if err != nil {
+		return err
+	}
+
+	var changes []string
+	for path := range old {
+		if _, ok := entries[path]; !ok {
+			changes = append(changes, "D "+fastQuote(path))
+		}
+	}
+	var changed []TreeEntry
+	for path, entry := range entries {
+		if previous, ok := old[path]; !ok || previous.Hash != entry.Hash || normalizeMode(previous.Mode) != normalizeMode(entry.Mode) {
+			changed = append(changed, entry)
+		}
+	}
+	sort.Strings(changes)
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Name < changed[j].Name })
+	for _, entry := range changed {
+		if _, ok := ex.marks[entry.Hash]; !ok {
+			if err := ex.writeBlob(entry.Hash); err != nil {
+				return err
+			}
+		}
+		changes = append(changes, fmt.Sprintf("M %s :%d %s", normalizeMode(entry.Mode), ex.marks[entry.Hash], fastQuote(entry.Name)))
+	}
+
+	if len(parents) == 0 {
+		// Without a parent, a commit would otherwise continue the branch.
+		fmt.Fprintf(ex.out, "reset %s\n", name)
+	}
+	fmt.Fprintf(ex.out, "commit %s\nmark :%d\n", name, ex.mark(commit.Hash()))
+	fmt.Fprintf(ex.out, "author %s\n", formatGitIdentity(commit.AuthorIdentity()))
+	fmt.Fprintf(ex.out, "committer %s\n", formatGitIdentity(commit.CommitterIdentity()))
+	// Stream messages end with a newline, as git's do.
+	fmt.Fprintf(ex.out, "data %d\n%s\n", len(commit.Message)+1, commit.Message)
+	for i, parent := range parents {
+		keyword := "merge"
+		if i == 0 {
+			keyword = "from"
+		}
+		fmt.Fprintf(ex.out, "%s %s\n", keyword, ex.commitRef(parent))
+	}
+	for _, change := range changes {
+		fmt.Fprintf(ex.out, "%s\n", change)
+	}
+	fmt.Fprintf(ex.out, "\n")
+	if commit.Signature != nil {
+		ex.signed++
+	}
+	ex.result.Commits++
+	return nil
+}
+
+func (ex *fastExporter) writeBlob(hash string) error {
+	data, err := ex.storage.Load(hash)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ex.out, "blob\nmark :%d\ndata %d\n", ex.mark(hash), len(data))
+	ex.out.Write(data)
+	fmt.Fprintf(ex.out, "\n")
+	ex.result.Blobs++
+	return nil
+}
+
+// fastQuote quotes a path for a file command when it would otherwise be
+// read differently.
+func fastQuote(path string) string {
+	if strings.HasPrefix(path, "\"") || strings.ContainsAny(path, "\\\n") {
+		return strconv.Quote(path)
+	}
+	return path
+}
@@ -0,0 +1,796 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The fast-import stream is git's text format for handing history between
+// tools: blob, commit, tag and reset commands, each followed by its own
+// lines, with "data" blocks carrying file contents and messages. Converters
+// for other version control systems write it, and `git fast-export` does
+// too. Marks (":1", ":2", ...) let later commands refer to blobs and commits
+// named earlier in the stream.
+
+// FastImportOptions controls FastImport.
+type FastImportOptions struct {
+	// ImportMarks names a marks file from an earlier import, so the stream
+	// can refer to what that import created.
+	ImportMarks string
+	// ExportMarks names a file to write the marks to once the stream is read.
+	ExportMarks string
+	// Force lets branches move backwards and tags move.
+	Force bool
+	// AllowUnsafeFeatures lets the stream name marks files itself with
+	// "feature import-marks" and "feature export-marks". Those read and
+	// write files on this machine, so only trusted streams should.
+	AllowUnsafeFeatures bool
+}
+
+// FastImportResult describes what a fast-import stream brought in.
+type FastImportResult struct {
+	Commits int
+	Blobs   int
+	// Updates lists the branches and tags created or moved.
+	Updates []RefUpdate
+	// Notes mention what could not be imported exactly or was left alone.
+	Notes []string
+}
+
+// fastImporter reads one stream into a repository.
+type fastImporter struct {
+	repo    *Repository
+	storage *Storage
+	in      *bufio.Reader
+	line    int
+	unread  *string
+	options FastImportOptions
+	// marks maps mark numbers to the blobs and commits they name.
+	marks map[int]string
+	// refs holds the repository's refs as they were before the stream.
+	refs map[string]string
+	// branches holds the tip of each ref the stream wrote; a ref reset
+	// without a commit maps to "".
+	branches map[string]string
+	// annotated holds the tags that came with a message.
+	annotated map[string]bool
+	signed    int
+	notes     bool
+	result    *FastImportResult
+}
+
+// FastImport reads a fast-import stream from in and stores its commits,
+// then points the branches and tags it names at them. The work tree is
+// only touched when the current branch moves.
+func FastImport(repo *Repository, in io.Reader, options FastImportOptions) (*FastImportResult, error) {
+	if err := repo.RequireWorkTree(); err != nil {
+		return nil, err
+	}
+	refs, err := ListRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+	im := &fastImporter{
+		repo:      repo,
+		storage:   NewStorage(repo),
+		in:        bufio.NewReader(in),
+		options:   options,
+		marks:     make(map[int]string),
+		refs:      refs,
+		branches:  make(map[string]string),
+		annotated: make(map[string]bool),
+		result:    &FastImportResult{},
+	}
+	if options.ImportMarks != "" {
+		if err := im.loadMarks(options.ImportMarks); err != nil {
+			return nil, err
+		}
+	}
+	if err := im.run(); err != nil {
+		return nil, fmt.Errorf("failed to import the stream at line %d: %w", im.line, err)
+	}
+	if im.options.ExportMarks != "" {
+		if err := im.saveMarks(im.options.ExportMarks); err != nil {
+			return nil, err
+		}
+	}
+	if im.signed > 0 {
+		im.note("%d commit(s) were signed in the stream; zark cannot keep those signatures, so they were dropped", im.signed)
+	}
+
+	wanted := make(map[string]string)
+	var names []string
+	for name, hash := range im.branches {
+		if hash != "" {
+			wanted[name] = hash
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	head := bundleHead(repo, wanted)
+	updates, notes, err := applyImportedRefs(repo, im.storage, names, wanted, head, "the stream", im.options.Force)
+	im.result.Updates = append(im.result.Updates, updates...)
+	im.result.Notes = append(im.result.Notes, notes...)
+	for _, update := range updates {
+		if im.annotated[update.Name] {
+			im.note("annotated tag '%s' became a plain tag; its message is not kept", shortRefName(update.Name))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return im.result, nil
+}
+
+func (im *fastImporter) note(format string, args ...interface{}) {
+	im.result.Notes = append(im.result.Notes, fmt.Sprintf(format, args...))
+}
+
+// run reads commands until the stream ends or says "done".
+func (im *fastImporter) run() error {
+	for {
+		line, err := im.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		command, arg, _ := strings.Cut(line, " ")
+		switch command {
+		case "blob":
+			err = im.blob()
+		case "commit":
+			err = im.commit(arg)
+		case "tag":
+			err = im.tag(arg)
+		case "reset":
+			err = im.reset(arg)
+		case "feature":
+			err = im.feature(arg)
+		case "done":
+			return nil
+		case "checkpoint", "progress", "option":
+			// Nothing to do: zark writes everything once the stream ends,
+			// and options are meant for git itself.
+		default:
+			return fmt.Errorf("'%s' is not a fast-import command zark supports", command)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readLine returns the next line of the stream without its newline.
+func (im *fastImporter) readLine() (string, error) {
+	if im.unread != nil {
+		line := *im.unread
+		im.unread = nil
+		return line, nil
+	}
+	line, err := im.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	im.line++
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+// next returns the next line that is not blank or a comment.
+func (im *fastImporter) next() (string, error) {
+	for {
+		line, err := im.readLine()
+		if err != nil || (line != "" && !strings.HasPrefix(line, "#")) {
+			return line, err
+		}
+	}
+}
+
+// expect returns the next line, which the current command requires.
+func (im *fastImporter) expect(what string) (string, error) {
+	line, err := im.next()
+	if err == io.EOF {
+		return "", fmt.Errorf("the stream ended before the %s", what)
+	}
+	return line, err
+}
+
+// data reads a data block: "data <length>" followed by that many bytes, or
+// "data <<END" followed by lines up to one holding just END.
+func (im *fastImporter) data(line string) ([]byte, error) {
+	arg, ok := strings.CutPrefix(line, "data ")
+	if !ok {
+		return nil, fmt.Errorf("expected 'data', got '%s'", line)
+	}
+	if delimiter, ok := strings.CutPrefix(arg, "<<"); ok {
+		var data strings.Builder
+		for {
+			line, err := im.readLine()
+			if err == io.EOF {
+				return nil, fmt.Errorf("the stream ended before '%s'", delimiter)
+			} else if err != nil {
+				return nil, err
+			}
+			if line == delimiter {
+				return []byte(data.String()), nil
+			}
+			data.WriteString(line + "\n")
+		}
+	}
+	length, err := strconv.Atoi(arg)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("malformed data length '%s'", arg)
+	}
+	// The buffer grows as the bytes arrive, so a length larger than the
+	// stream only costs what the stream holds.
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, im.in, int64(length)); err != nil {
+		return nil, fmt.Errorf("the stream ended inside a data block")
+	}
+	data := buf.Bytes()
+	im.line += bytes.Count(data, []byte("\n"))
+	// A newline may follow the data.
+	if next, err := im.in.Peek(1); err == nil && next[0] == '\n' {
+		im.in.ReadByte()
+		im.line++
+	}
+	return data, nil
+}
+
+// mark records that a "mark :<n>" line names hash.
+func (im *fastImporter) mark(line, hash string) error {
+	number, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(line, "mark "), ":"))
+	if err != nil || number <= 0 {
+		return fmt.Errorf("malformed mark '%s'", line)
+	}
+	im.marks[number] = hash
+	return nil
+}
+
+func (im *fastImporter) blob() error {
+	var mark string
+	for {
+		line, err := im.expect("blob's data")
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(line, "mark "):
+			mark = line
+		case strings.HasPrefix(line, "original-oid "):
+		default:
+			data, err := im.data(line)
+			if err != nil {
+				return err
+			}
+			blob := NewBlob(data)
+			if err := im.storage.Store(blob); err != nil {
+				return fmt.Errorf("failed to store blob: %w", err)
+			}
+			im.result.Blobs++
+			if mark != "" {
+				return im.mark(mark, blob.Hash())
+			}
+			return nil
+		}
+	}
+}
+
+// refName turns the ref a command names into a full branch or tag name.
+func refName(name string) (string, error) {
+	if !strings.HasPrefix(name, "refs/") {
+		name = "refs/heads/" + name
+	}
+	if !strings.HasPrefix(name, "refs/heads/") && !strings.HasPrefix(name, "refs/tags/") {
+		return "", fmt.Errorf("'%s' is not a branch or tag; zark fast-import only writes those", name)
+	}
+	if err := checkRefName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// setRef records the commit a ref now points at.
+func (im *fastImporter) setRef(name, hash string) {
+	im.branches[name] = hash
+}
+
+// resolve finds the commit a "from" or "merge" line names: a mark, a zark
+// commit hash, or a branch or tag written earlier in the stream or already
+// in the repository.
+func (im *fastImporter) resolve(value string) (string, error) {
+	if mark, ok := strings.CutPrefix(value, ":"); ok {
+		number, err := strconv.Atoi(mark)
+		if hash, found := im.marks[number]; err == nil && found {
+			return hash, nil
+		}
+		return "", fmt.Errorf("mark '%s' was not set earlier in the stream", value)
+	}
+	value = strings.TrimSuffix(value, "^0")
+	if len(value) == 64 && im.storage.Has(value) {
+		return value, nil
+	}
+	if name, err := refName(value); err == nil {
+		if hash, ok := im.branches[name]; ok && hash != "" {
+			return hash, nil
+		}
+	}
+	hash, err := ResolveRef(im.repo, value)
+	if err != nil {
+		return "", fmt.Errorf("cannot find commit '%s' named in the stream", value)
+	}
+	return hash, nil
+}
+
+func (im *fastImporter) commit(ref string) error {
+	name, err := refName(ref)
+	if err != nil {
+		return err
+	}
+	commit := &Commit{}
+	var author, committer *Identity
+	var mark string
+	for message := false; !message; {
+		line, err := im.expect("commit message")
+		if err != nil {
+			return err
+		}
+		keyword, value, _ := strings.Cut(line, " ")
+		switch keyword {
+		case "mark":
+			mark = line
+		case "original-oid", "encoding":
+		case "author", "committer":
+			identity, err := parseGitIdentity(value)
+			if err != nil {
+				return err
+			}
+			if keyword == "author" {
+				author = &identity
+			} else {
+				committer = &identity
+			}
+		case "gpgsig":
+			line, err := im.expect("signature")
+			if err == nil {
+				_, err = im.data(line)
+			}
+			if err != nil {
+				return err
+			}
+			im.signed++
+		default:
+			if committer == nil {
+				return fmt.Errorf("the commit to '%s' has no committer", ref)
+			}
+			data, err := im.data(line)
+			if err != nil {
+				return err
+			}
+			// Stream messages end with a newline; zark's don't.
+			commit.Message = strings.TrimSuffix(string(data), "\n")
+			message = true
+		}
+	}
+	if author == nil {
+		author = committer
+	}
+	commit.Author, commit.Email, commit.Timestamp = author.Name, author.Email, author.When
+	commit.Committer = committer
+
+	// Without "from", a commit continues the branch it is written to.
+	parent, started := im.branches[name]
+	if !started {
+		parent = im.refs[name]
+	}
+	line, more, err := im.commitLine()
+	for ; more && err == nil; line, more, err = im.commitLine() {
+		keyword, value, _ := strings.Cut(line, " ")
+		if keyword != "from" && keyword != "merge" {
+			break
+		}
+		hash, err := im.resolve(value)
+		if err != nil {
+			return err
+		}
+		if keyword == "from" {
+			parent = hash
+		} else {
+			commit.MergeParents = append(commit.MergeParents, hash)
+		}
+	}
+	entries, treeErr := commitTreeEntries(im.storage, parent)
+	if treeErr != nil {
+		return treeErr
+	}
+	for ; more && err == nil; line, more, err = im.commitLine() {
+		if handled, err := im.fileCommand(entries, line); err != nil {
+			return err
+		} else if !handled {
+			// The commit ended without a blank line.
+			im.unread = &line
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	sorted := make([]TreeEntry, 0, len(entries))
+	for _, entry := range entries {
+		sorted = append(sorted, entry)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	if commit.TreeHash, err = storeTreeEntries(im.storage, sorted); err != nil {
+		return err
+	}
+	commit.Parent = parent
+	commit.rehash()
+	if err := im.storage.Store(commit); err != nil {
+		return fmt.Errorf("failed to store commit: %w", err)
+	}
+	im.result.Commits++
+	im.setRef(name, commit.Hash())
+	if mark != "" {
+		return im.mark(mark, commit.Hash())
+	}
+	return nil
+}
+
+// commitLine returns the next line of a commit, skipping comments; more is
+// false once a blank line or the end of the stream ends the commit.
+func (im *fastImporter) commitLine() (line string, more bool, err error) {
+	for {
+		line, err = im.readLine()
+		if err == io.EOF || (err == nil && line == "") {
+			return "", false, nil
+		}
+		if err != nil || !strings.HasPrefix(line, "#") {
+			return line, err == nil, err
+		}
+	}
+}
+
+// fileCommand applies a commit's file command to its tree entries. It
+// reports false for a line that is not a file command.
+func (im *fastImporter) fileCommand(entries map[string]TreeEntry, line string) (bool, error) {
+	keyword, rest, _ := strings.Cut(line, " ")
+	switch keyword {
+	case "deleteall":
+		for name := range entries {
+			delete(entries, name)
+		}
+	case "M":
+		fields := strings.SplitN(rest, " ", 3)
+		if len(fields) != 3 {
+			return true, fmt.Errorf("malformed file command '%s'", line)
+		}
+		mode, dataref := fields[0], fields[1]
+		name, _, err := fastPath(fields[2], false)
+		if err != nil {
+			return true, err
+		}
+		hash, err := im.contents(dataref, name)
+		if err != nil {
+			return true, err
+		}
+		switch mode {
+		case "644", ModeFile:
+			mode = ModeFile
+		case "755", ModeExecutable:
+			mode = ModeExecutable
+		case ModeSymlink:
+		case gitModeSubmodule:
+			im.note("submodule '%s' was skipped; zark has no submodules", name)
+			return true, nil
+		default:
+			return true, fmt.Errorf("file mode '%s' for '%s' is not supported", mode, name)
+		}
+		putEntry(entries, TreeEntry{Mode: mode, Name: name, Hash: hash, Type: "blob"})
+	case "D":
+		name, _, err := fastPath(rest, false)
+		if err != nil {
+			return true, err
+		}
+		for _, entry := range matchingEntries(entries, name) {
+			delete(entries, entry.Name)
+		}
+	case "C", "R":
+		source, rest, err := fastPath(rest, true)
+		if err != nil {
+			return true, err
+		}
+		target, _, err := fastPath(rest, false)
+		if err != nil {
+			return true, err
+		}
+		matched := matchingEntries(entries, source)
+		if len(matched) == 0 {
+			return true, fmt.Errorf("cannot copy or rename '%s': it does not exist", source)
+		}
+		for _, entry := range matched {
+			if keyword == "R" {
+				delete(entries, entry.Name)
+			}
+			entry.Name = target + strings.TrimPrefix(entry.Name, source)
+			putEntry(entries, entry)
+		}
+	case "N":
+		if dataref, _, _ := strings.Cut(rest, " "); dataref == "inline" {
+			line, err := im.expect("note")
+			if err == nil {
+				_, err = im.data(line)
+			}
+			if err != nil {
+				return true, err
+			}
+		}
+		if !im.notes {
+			im.notes = true
+			im.note("notes in the stream were skipped; zark has no notes")
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// contents returns the blob a file command's dataref names: a mark, a zark
+// blob hash, or "inline" for a data block that follows the command.
+func (im *fastImporter) contents(dataref, name string) (string, error) {
+	switch {
+	case dataref == "inline":
+		line, err := im.expect("contents of " + name)
+		if err != nil {
+			return "", err
+		}
+		data, err := im.data(line)
+		if err != nil {
+			return "", err
+		}
+		blob := NewBlob(data)
+		if err := im.storage.Store(blob); err != nil {
+			return "", fmt.Errorf("failed to store blob: %w", err)
+		}
+		im.result.Blobs++
+		return blob.Hash(), nil
+	case strings.HasPrefix(dataref, ":"):
+		return im.resolve(dataref)
+	case len(dataref) == 64 && im.storage.Has(dataref):
+		return dataref, nil
+	}
+	return "", fmt.Errorf("cannot find the contents '%s' of '%s'; zark can only use marks and zark hashes", dataref, name)
+}
+
+// matchingEntries returns the entry at name, or every entry inside it when
+// name is a directory.
+func matchingEntries(entries map[string]TreeEntry, name string) []TreeEntry {
+	var matched []TreeEntry
+	for path, entry := range entries {
+		if path == name || strings.HasPrefix(path, name+"/") {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
+
+// putEntry adds entry to a commit's tree entries. A path cannot be both a file
+// and a directory, so a file at one of its parent directories and anything
+// under it are removed first.
+func putEntry(entries map[string]TreeEntry, entry TreeEntry) {
+	for _, old := range matchingEntries(entries, entry.Name) {
+		delete(entries, old.Name)
+	}
+	for dir := path.Dir(entry.Name); dir != "."; dir = path.Dir(dir) {
+		delete(entries, dir)
+	}
+	entries[entry.Name] = entry
+}
+
+// fastPath reads a path from the start of s, quoted C-style if it starts
+// with a double quote. When more follows, an unquoted path ends at the first
+// space and the rest is returned.
+func fastPath(s string, more bool) (string, string, error) {
+	name, rest := s, ""
+	if strings.HasPrefix(s, "\"") {
+		end := 1
+		for ; end < len(s) && s[end] != '"'; end++ {
+			if s[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(s) {
+			return "", "", fmt.Errorf("unterminated quoted path %s", s)
+		}
+		unquoted, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return "", "", fmt.Errorf("malformed quoted path %s", s[:end+1])
+		}
+		name, rest = unquoted, strings.TrimPrefix(s[end+1:], " ")
+	} else if more {
+		name, rest, _ = strings.Cut(s, " ")
+	}
+	if name == "" || path.IsAbs(name) || path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") ||
+		name == ".zark" || strings.HasPrefix(name, ".zark/") {
+		return "", "", fmt.Errorf("'%s' is not a path zark can store", name)
+	}
+	return name, rest, nil
+}
+
+// tag points a tag at a commit. Zark tags are plain names for commits, so
+// a tag's message and tagger are not kept.
+func (im *fastImporter) tag(tag string) error {
+	name, err := refName("refs/tags/" + tag)
+	if err != nil {
+		return err
+	}
+	var target, mark string
+	for {
+		line, err := im.expect("tag message")
+		if err != nil {
+			return err
+		}
+		keyword, value, _ := strings.Cut(line, " ")
+		switch keyword {
+		case "mark":
+			mark = line
+		case "from":
+			if target, err = im.resolve(value); err != nil {
+				return err
+			}
+		case "original-oid", "tagger":
+		default:
+			message, err := im.data(line)
+			if err != nil {
+				return err
+			}
+			if target == "" {
+				return fmt.Errorf("tag '%s' has no 'from' line naming its commit", tag)
+			}
+			im.annotated[name] = strings.TrimSpace(string(message)) != ""
+			im.setRef(name, target)
+			if mark != "" {
+				return im.mark(mark, target)
+			}
+			return nil
+		}
+	}
+}
+
+// reset points a branch at the commit its "from" line names, or empties it
+// so that the next commit to it starts a new history.
+func (im *fastImporter) reset(ref string) error {
+	name, err := refName(ref)
+	if err != nil {
+		return err
+	}
+	line, err := im.readLine()
+	if err == io.EOF {
+		im.setRef(name, "")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if value, ok := strings.CutPrefix(line, "from "); ok {
+		target, err := im.resolve(value)
+		if err != nil {
+			return err
+		}
+		im.setRef(name, target)
+		return nil
+	}
+	im.setRef(name, "")
+	if line != "" {
+		im.unread = &line
+	}
+	return nil
+}
+
+// feature accepts the features zark understands and refuses the rest, as
+// the stream asks importers to.
+func (im *fastImporter) feature(feature string) error {
+	name, value, _ := strings.Cut(feature, "=")
+	switch name {
+	case "done", "date-format":
+		if name == "date-format" && value != "raw" {
+			return fmt.Errorf("only raw dates are supported, not '%s'", value)
+		}
+	case "force":
+		im.options.Force = true
+	case "import-marks", "import-marks-if-exists", "export-marks":
+		if !im.options.AllowUnsafeFeatures {
+			return fmt.Errorf("the stream asks for 'feature %s', which reads or writes files on this machine.\n"+
+				"hint: name marks files with --import-marks and --export-marks, or pass --allow-unsafe-features if you trust the stream", name)
+		}
+		return im.marksFeature(name, value)
+	default:
+		return fmt.Errorf("the stream needs the '%s' feature, which zark fast-import does not support", name)
+	}
+	return nil
+}
+
+// marksFeature takes the marks files a trusted stream names.
+func (im *fastImporter) marksFeature(name, value string) error {
+	switch name {
+	case "import-marks", "import-marks-if-exists":
+		// Marks named on the command line win, as they do for git.
+		if im.options.ImportMarks == "" {
+			if _, err := os.Stat(value); name == "import-marks" || err == nil {
+				im.options.ImportMarks = value
+				return im.loadMarks(value)
+			}
+		}
+	case "export-marks":
+		if im.options.ExportMarks == "" {
+			im.options.ExportMarks = value
+		}
+	}
+	return nil
+}
+
+// loadMarks reads a marks file of ":<mark> <hash>" lines.
+func (im *fastImporter) loadMarks(path string) error {
+	marks, err := readMarks(path)
+	if err != nil {
+		return err
+	}
+	for number, hash := range marks {
+		im.marks[number] = hash
+	}
+	return nil
+}
+
+func (im *fastImporter) saveMarks(path string) error {
+	return writeMarks(path, im.marks)
+}
+
+// readMarks reads a marks file of ":<mark> <hash>" lines.
+func readMarks(path string) (map[int]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read marks file: %w", err)
+	}
+	marks := make(map[int]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		mark, hash, ok := strings.Cut(line, " ")
+		number, err := strconv.Atoi(strings.TrimPrefix(mark, ":"))
+		if !ok || err != nil || !strings.HasPrefix(mark, ":") || len(hash) != 64 {
+			// The line itself is left out, in case the file is not a
+			// marks file at all.
+			return nil, fmt.Errorf("malformed line %d in marks file %s", i+1, path)
+		}
+		marks[number] = hash
+	}
+	return marks, nil
+}
+
+// writeMarks writes marks to a file, in mark order.
+func writeMarks(path string, marks map[int]string) error {
+	numbers := make([]int, 0, len(marks))
+	for number := range marks {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	var data strings.Builder
+	for _, number := range numbers {
+		fmt.Fprintf(&data, ":%d %s\n", number, marks[number])
+	}
+	if err := os.WriteFile(path, []byte(data.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write marks file: %w", err)
+	}
+	return nil
+}
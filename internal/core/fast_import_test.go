@@ -0,0 +1,232 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const fastImportStream = `feature done
+# Written by hand, the way converters write it.
+blob
+mark :1
+data 6
+hello
+
+commit refs/heads/main
+mark :2
+author Ada Lovelace <ada@example.com> 1700000000 +0200
+committer Grace Hopper <grace@example.com> 1700000100 -0500
+data <<EOF
+Initial commit
+EOF
+M 644 :1 README.md
+M 100755 inline "bin/run me.sh"
+data 10
+#!/bin/sh
+
+commit refs/heads/topic
+mark :3
+committer Grace Hopper <grace@example.com> 1700000200 -0500
+data 12
+Rename file
+from :2
+R README.md docs/README.md
+
+commit refs/heads/main
+mark :4
+committer Grace Hopper <grace@example.com> 1700000300 -0500
+data 6
+Merge
+merge :3
+R README.md docs/README.md
+M 100644 inline notes.txt
+data 5
+notes
+tag v1
+from :2
+tagger Ada Lovelace <ada@example.com> 1700000400 +0200
+data 8
+Release
+
+reset refs/heads/empty
+
+done
+`
+
+func TestFastImport(t *testing.T) {
+	isolateConfig(t)
+	repo := NewRepository(t.TempDir())
+	if err := repo.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	marks := filepath.Join(t.TempDir(), "marks")
+	inDir(t, repo.Path, func() {
+		result, err := FastImport(repo, strings.NewReader(fastImportStream), FastImportOptions{ExportMarks: marks})
+		if err != nil {
+			t.Fatalf("FastImport failed: %v", err)
+		}
+		if result.Commits != 3 || result.Blobs != 3 || len(result.Updates) != 3 {
+			t.Errorf("Expected 3 commits, 3 blobs and 3 references, got %+v", result)
+		}
+		if !strings.Contains(strings.Join(result.Notes, "\n"), "annotated tag 'v1'") {
+			t.Errorf("Expected a note about the annotated tag, got %v", result.Notes)
+		}
+
+		storage := NewStorage(repo)
+		head, _ := ResolveRef(repo, "HEAD")
+		merge, err := storage.LoadCommit(head)
+		if err != nil {
+			t.Fatalf("LoadCommit failed: %v", err)
+		}
+		if len(merge.Parents()) != 2 || merge.Message != "Merge" || merge.Author != "Grace Hopper" {
+			t.Errorf("Expected the merge commit written by Grace, got %+v", merge)
+		}
+		entries, _ := commitTreeEntries(storage, head)
+		if script := entries["bin/run me.sh"]; script.Mode != ModeExecutable {
+			t.Errorf("Expected an executable bin/run me.sh, got %+v", script)
+		}
+		if _, ok := entries["README.md"]; ok || len(entries) != 3 {
+			t.Errorf("Expected README.md to be renamed, got %v", entries)
+		}
+		if data, _ := os.ReadFile("notes.txt"); string(data) != "notes" {
+			t.Errorf("Expected main to be checked out, got notes.txt %q", data)
+		}
+		if tag, _ := ResolveRef(repo, "v1"); tag != merge.Parent {
+			t.Errorf("Expected v1 at the first commit, got %s", tag)
+		}
+		if _, err := ResolveRef(repo, "empty"); err == nil {
+			t.Error("Expected a reset without a commit to leave no branch")
+		}
+
+		// Marks from the first import let a later stream build on it.
+		rewind := "reset refs/heads/main\nfrom :2\n"
+		result, err = FastImport(repo, strings.NewReader(rewind), FastImportOptions{ImportMarks: marks})
+		if err != nil || len(result.Updates) != 0 || !strings.Contains(strings.Join(result.Notes, "\n"), "has commits here") {
+			t.Errorf("Expected main not to move backwards, got %+v %v", result, err)
+		}
+		result, err = FastImport(repo, strings.NewReader(rewind), FastImportOptions{ImportMarks: marks, Force: true})
+		if err != nil || len(result.Updates) != 1 || !result.Updates[0].Force {
+			t.Errorf("Expected --force to move main back, got %+v %v", result, err)
+		}
+
+		broken := "blob\ndata 2\nok\ncommit refs/heads/main\ncommitter Nobody\n"
+		if _, err := FastImport(repo, strings.NewReader(broken), FastImportOptions{}); err == nil || !strings.Contains(err.Error(), "line 5") {
+			t.Errorf("Expected a malformed identity to be reported at line 5, got %v", err)
+		}
+
+		for _, stream := range []string{"reset refs/heads/../../escaped\n", "reset /main\n", "reset refs/heads/a//b\n",
+			"reset refs/heads/bad\x01name\n", "tag \nfrom :2\ndata 0\n", "tag ../v1\nfrom :2\ndata 0\n"} {
+			if _, err := FastImport(repo, strings.NewReader(stream), FastImportOptions{ImportMarks: marks}); err == nil || !strings.Contains(err.Error(), "not a valid reference name") {
+				t.Errorf("Expected %q to be refused, got %v", stream, err)
+			}
+		}
+		if _, err := FastImport(repo, strings.NewReader("blob\ndata 999999999999\nshort\n"), FastImportOptions{}); err == nil || !strings.Contains(err.Error(), "ended inside a data block") {
+			t.Errorf("Expected a data length past the end of the stream to be reported, got %v", err)
+		}
+
+		// A file replaces the directory at its path and a directory the file.
+		mixed := "commit refs/heads/mixed\ncommitter Ada Lovelace <ada@example.com> 1700000500 +0200\ndata 0\n" +
+			"M 644 inline a\ndata 1\na\nM 644 inline a/b\ndata 1\nb\nM 644 inline c/d\ndata 1\nd\nM 644 inline c\ndata 1\nc\n"
+		if _, err := FastImport(repo, strings.NewReader(mixed), FastImportOptions{}); err != nil {
+			t.Fatalf("FastImport failed: %v", err)
+		}
+		tip, _ := ResolveRef(repo, "refs/heads/mixed")
+		entries, _ = commitTreeEntries(storage, tip)
+		if _, ok := entries["a/b"]; !ok || len(entries) != 2 || entries["c"].Hash != NewBlob([]byte("c")).Hash() {
+			t.Errorf("Expected only a/b and c, got %v", entries)
+		}
+
+		// Marks files named by the stream itself need the caller's consent.
+		planted := filepath.Join(t.TempDir(), "planted")
+		stream := "feature export-marks=" + planted + "\nreset refs/heads/main\nfrom :2\n"
+		if _, err := FastImport(repo, strings.NewReader(stream), FastImportOptions{ImportMarks: marks}); err == nil || !strings.Contains(err.Error(), "--allow-unsafe-features") {
+			t.Errorf("Expected a stream naming a marks file to be refused, got %v", err)
+		}
+		if _, err := os.Stat(planted); !os.IsNotExist(err) {
+			t.Error("Expected the stream's marks file not to be written")
+		}
+		if _, err := FastImport(repo, strings.NewReader(stream), FastImportOptions{ImportMarks: marks, AllowUnsafeFeatures: true}); err != nil {
+			t.Errorf("Expected the feature to be allowed on request: %v", err)
+		}
+		if _, err := os.Stat(planted); err != nil {
+			t.Errorf("Expected the allowed marks file to be written: %v", err)
+		}
+		secret := filepath.Join(t.TempDir(), "secret")
+		os.WriteFile(secret, []byte("password hunter2\n"), 0600)
+		if _, err := FastImport(repo, strings.NewReader(""), FastImportOptions{ImportMarks: secret}); err == nil || strings.Contains(err.Error(), "hunter2") {
+			t.Errorf("Expected a bad marks file to be refused without echoing it, got %v", err)
+		}
+	})
+}
+
+func TestFastExport(t *testing.T) {
+	isolateConfig(t)
+	repo, _, cleanup := setupTestRepo(t)
+	defer cleanup()
+	commitFile(t, repo, "docs/a file.txt", "one\n")
+	UpdateRef(repo, "refs/tags/v1.0", commitFile(t, repo, "notes.txt", "two"))
+	dir := t.TempDir()
+	exportMarks, importMarks := filepath.Join(dir, "export-marks"), filepath.Join(dir, "import-marks")
+
+	var stream bytes.Buffer
+	result, err := FastExport(repo, &stream, []string{"--all"}, FastExportOptions{ExportMarks: exportMarks})
+	if err != nil {
+		t.Fatalf("FastExport failed: %v", err)
+	}
+	if result.Commits != 3 || result.Blobs != 3 || result.Refs != 2 {
+		t.Errorf("Expected 3 commits, 3 blobs and 2 references, got %+v", result)
+	}
+	if !strings.Contains(stream.String(), "M 100644 :3 docs/a file.txt\n") || !strings.HasSuffix(stream.String(), "done\n") {
+		t.Errorf("Unexpected stream:\n%s", stream.String())
+	}
+
+	// Importing the stream elsewhere gives the same files.
+	other := NewRepository(t.TempDir())
+	if err := other.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	sameFiles := func() {
+		t.Helper()
+		mine, _ := ResolveRef(repo, "main")
+		theirs, _ := ResolveRef(other, "main")
+		a, _ := commitTreeEntries(NewStorage(repo), mine)
+		b, err := commitTreeEntries(NewStorage(other), theirs)
+		if err != nil || !reflect.DeepEqual(a, b) {
+			t.Errorf("Expected the imported main to have the same files, got %v %v", b, err)
+		}
+	}
+	inDir(t, other.Path, func() {
+		if _, err := FastImport(other, &stream, FastImportOptions{ExportMarks: importMarks}); err != nil {
+			t.Fatalf("FastImport failed: %v", err)
+		}
+	})
+	sameFiles()
+	if _, err := ResolveRef(other, "v1.0"); err != nil {
+		t.Errorf("Expected v1.0 to be imported: %v", err)
+	}
+
+	// With marks, a second export only carries the new commit.
+	commitFile(t, repo, "notes.txt", "three")
+	stream.Reset()
+	result, err = FastExport(repo, &stream, []string{"main"}, FastExportOptions{ImportMarks: exportMarks, ExportMarks: exportMarks})
+	if err != nil {
+		t.Fatalf("FastExport failed: %v", err)
+	}
+	if result.Commits != 1 || !strings.Contains(stream.String(), "from :") {
+		t.Errorf("Expected one commit on top of a marked one, got %+v:\n%s", result, stream.String())
+	}
+	inDir(t, other.Path, func() {
+		if _, err := FastImport(other, &stream, FastImportOptions{ImportMarks: importMarks}); err != nil {
+			t.Fatalf("FastImport failed: %v", err)
+		}
+	})
+	sameFiles()
+
+	if _, err := FastExport(repo, &stream, nil, FastExportOptions{}); err == nil || !strings.Contains(err.Error(), "nothing to export") {
+		t.Errorf("Expected an export without revs to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FetchResult describes what Fetch downloaded.
+type FetchResult struct {
+	Remote  string
+	Objects int
+	// Updates lists the local references that changed, by full name.
+	Updates []RefUpdate
+	// Head is the branch the remote's HEAD points at, if any.
+	Head string
+}
+
+// FetchOptions controls how much history and which objects a fetch
+// downloads.
+type FetchOptions struct {
+	// Depth limits the history fetched to that many commits per branch.
+	Depth int
+	// Deepen fetches that many more commits below those of a shallow clone.
+	Deepen int
+	// Unshallow fetches all the history a shallow clone is missing.
+	Unshallow bool
+}
+
+// Fetch downloads the branches and tags of a remote. Only objects missing
+// locally are copied. Branches are stored as remote-tracking branches under
+// refs/remotes/<remote>/, so local branches are never changed; tags are only
+// created, never moved. Remote-tracking branches whose branch was deleted on
+// the remote are removed.
+func Fetch(repo *Repository, remoteName string) (*FetchResult, error) {
+	return FetchWithOptions(repo, remoteName, FetchOptions{})
+}
+
+// FetchWithOptions is Fetch with control over the history fetched. From the
+// promisor remote of a partial clone, blobs are left out as they were when
+// cloning.
+func FetchWithOptions(repo *Repository, remoteName string, opts FetchOptions) (*FetchResult, error) {
+	remote, err := GetRemote(repo, remoteName)
+	if err != nil {
+		return nil, err
+	}
+	var filter *ObjectFilter
+	if remote.Promisor && remote.Filter != "" {
+		if filter, err = ParseObjectFilter(remote.Filter); err != nil {
+			return nil, fmt.Errorf("invalid remote.%s.partialclonefilter: %w", remoteName, err)
+		}
+	}
+	shallow, err := ShallowCommits(repo)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Unshallow && len(shallow) == 0 {
+		return nil, fmt.Errorf("this repository already has its whole history, so there is nothing to unshallow")
+	}
+	conn, err := connectRemote(remote)
+	if err != nil {
+		return nil, err
+	}
+	remoteRefs, head, err := conn.Refs()
+	if err != nil {
+		return nil, err
+	}
+	// The names become paths under .zark and settings in the config, so a
+	// remote must not be able to choose names that step outside refs/.
+	for name := range remoteRefs {
+		if checkRefName(name) != nil {
+			delete(remoteRefs, name)
+		}
+	}
+	if head != "" && checkRefName("refs/heads/"+head) != nil {
+		head = ""
+	}
+
+	result := &FetchResult{Remote: remoteName, Head: head}
+	var newShallow []string
+	if opts.Deepen > 0 || opts.Unshallow {
+		// Fetch below the oldest commits first, so that the fetch of the
+		// branches below stops at history that is now complete.
+		storage := NewStorage(repo)
+		var parents []string
+		for _, hash := range shallow {
+			commit, err := storage.LoadCommit(hash)
+			if err != nil {
+				return nil, err
+			}
+			parents = append(parents, commit.recordedParents()...)
+		}
+		depth := opts.Deepen
+		if opts.Unshallow {
+			depth = 0
+		}
+		reply, err := conn.Fetch(repo, fetchRequest{Wants: parents, Depth: depth, Filter: filter})
+		if err != nil {
+			return nil, err
+		}
+		result.Objects += reply.Objects
+		newShallow = append(newShallow, reply.Shallow...)
+		// The parents are here now; keep the list in step so the fetch
+		// below is negotiated against the deeper history.
+		if err := updateShallow(repo, newShallow); err != nil {
+			return nil, err
+		}
+	}
+
+	var wants []string
+	for name, hash := range remoteRefs {
+		if strings.HasPrefix(name, "refs/heads/") || strings.HasPrefix(name, "refs/tags/") {
+			wants = append(wants, hash)
+		}
+	}
+	sort.Strings(wants)
+	reply, err := conn.Fetch(repo, fetchRequest{Wants: wants, Depth: opts.Depth, Filter: filter})
+	if err != nil {
+		return nil, err
+	}
+	result.Objects += reply.Objects
+	if err := updateShallow(repo, reply.Shallow); err != nil {
+		return nil, err
+	}
+
+	localRefs, err := ListRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+	var known []string
+	for _, hash := range localRefs {
+		known = append(known, hash)
+	}
+	if err := checkConnected(NewStorage(repo), wants, known); err != nil {
+		return nil, fmt.Errorf("the remote did not send everything fetched: %w", err)
+	}
+	trackingPrefix := "refs/remotes/" + remoteName + "/"
+	wanted := make(map[string]string)
+	for name, hash := range remoteRefs {
+		switch {
+		case strings.HasPrefix(name, "refs/heads/"):
+			wanted[trackingPrefix+strings.TrimPrefix(name, "refs/heads/")] = hash
+		case strings.HasPrefix(name, "refs/tags/"):
+			if _, exists := localRefs[name]; !exists {
+				wanted[name] = hash
+			}
+		}
+	}
+	for name := range localRefs {
+		if _, ok := wanted[name]; !ok && strings.HasPrefix(name, trackingPrefix) {
+			wanted[name] = ""
+		}
+	}
+
+	names := make([]string, 0, len(wanted))
+	for name := range wanted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		update := RefUpdate{Name: name, Old: localRefs[name], New: wanted[name]}
+		if update.Old == update.New {
+			continue
+		}
+		if update.New == "" {
+			if err := checkRefName(name); err != nil {
+				return nil, err
+			}
+			if err := os.Remove(filepath.Join(repo.ZarkDir, filepath.FromSlash(name))); err != nil {
+				return nil, fmt.Errorf("failed to remove %s: %w", name, err)
+			}
+		} else if err := UpdateRef(repo, name, update.New); err != nil {
+			return nil, err
+		}
+		result.Updates = append(result.Updates, update)
+	}
+	return result, nil
+}
+
+// CloneOptions makes a clone shallow or partial.
+type CloneOptions struct {
+	// Depth limits the history cloned to that many commits per branch.
+	Depth int
+	// Filter leaves blobs out, to be fetched from the source when needed:
+	// "blob:none" or "blob:limit=<size>".
+	Filter string
+}
+
+// Clone copies the repository at source into a new directory dir, with
+// source configured as the "origin" remote, and checks out the branch the
+// source's HEAD points at, tracking the remote's branch. If dir is empty it is
+// named after source. The source may also be a bundle file.
+func Clone(source, dir string) (*Repository, *FetchResult, error) {
+	return CloneWithOptions(source, dir, CloneOptions{})
+}
+
+// CloneWithOptions is Clone for a shallow or partial clone.
+func CloneWithOptions(source, dir string, opts CloneOptions) (*Repository, *FetchResult, error) {
+	if opts.Depth < 0 {
+		return nil, nil, fmt.Errorf("the depth must be a positive number of commits")
+	}
+	if opts.Filter != "" {
+		if _, err := ParseObjectFilter(opts.Filter); err != nil {
+			return nil, nil, err
+		}
+	}
+	if dir == "" {
+		dir = filepath.Base(strings.TrimSuffix(strings.TrimPrefix(source, "file://"), "/"))
+		dir = strings.TrimSuffix(strings.TrimSuffix(dir, ".zark"), ".bundle")
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, nil, fmt.Errorf("destination '%s' already exists and is not empty", dir)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	if err := os.MkdirAll(absDir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	repo := NewRepository(absDir)
+	if err := repo.Init(); err != nil {
+		return nil, nil, err
+	}
+	if err := AddRemote(repo, DefaultRemote, source); err != nil {
+		return nil, nil, err
+	}
+	if opts.Filter != "" {
+		if err := SetConfigValue(repo.ConfigPath, "remote."+DefaultRemote+".promisor", "true"); err != nil {
+			return nil, nil, err
+		}
+		if err := SetConfigValue(repo.ConfigPath, "remote."+DefaultRemote+".partialclonefilter", opts.Filter); err != nil {
+			return nil, nil, err
+		}
+	}
+	result, err := FetchWithOptions(repo, DefaultRemote, FetchOptions{Depth: opts.Depth})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	branch := result.Head
+	if branch == "" {
+		branch = "main"
+	}
+	if err := SetUpstream(repo, branch, DefaultRemote, branch); err != nil {
+		return nil, nil, err
+	}
+	hash, err := ResolveRef(repo, "refs/remotes/"+DefaultRemote+"/"+branch)
+	if err != nil {
+		// An empty repository: HEAD already points at the unborn main branch.
+		return repo, result, nil
+	}
+	if err := UpdateRef(repo, "refs/heads/"+branch, hash); err != nil {
+		return nil, nil, err
+	}
+	if err := Checkout(repo, branch); err != nil {
+		return nil, nil, err
+	}
+	return repo, result, nil
+}
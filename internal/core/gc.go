@@ -0,0 +1,135 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ReachableObjects returns the hashes of the given commits and of every
+// commit, tree and blob reachable from them.
+func ReachableObjects(storage *Storage, commits []string) (map[string]bool, error) {
+	reachable := make(map[string]bool)
+	pending := append([]string(nil), commits...)
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if hash == "" || reachable[hash] {
+			continue
+		}
+		reachable[hash] = true
+
+		commit, err := storage.LoadCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		if !reachable[commit.TreeHash] {
+			tree, err := storage.LoadTree(commit.TreeHash)
+			if err != nil {
+				return nil, err
+			}
+			reachable[commit.TreeHash] = true
+			for _, entry := range tree.Entries {
+				reachable[entry.Hash] = true
+			}
+		}
+		pending = append(pending, commit.Parents()...)
+	}
+	return reachable, nil
+}
+
+// referencedObjects returns everything that must survive garbage collection:
+// objects reachable from any reference or HEAD, staged blobs, and what a
+// pull stopped on conflicts needs to continue or abort.
+func referencedObjects(repo *Repository, storage *Storage) (map[string]bool, error) {
+	roots, err := historyRoots(repo)
+	if err != nil {
+		return nil, err
+	}
+	pulled, stashed := pullStateObjects(repo)
+	reachable, err := ReachableObjects(storage, append(roots, pulled...))
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range stashed {
+		tree, err := storage.LoadTree(hash)
+		if err != nil {
+			return nil, err
+		}
+		reachable[hash] = true
+		for _, entry := range tree.Entries {
+			reachable[entry.Hash] = true
+		}
+	}
+
+	index, err := LoadIndex(repo.IndexPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	if index != nil {
+		for _, entry := range index.Entries {
+			reachable[entry.Hash] = true
+		}
+	}
+	return reachable, nil
+}
+
+// PruneObjects deletes every object that no reference, HEAD, the index or a
+// stopped pull needs any more, such as content purged from history. Packed objects that
+// are still needed are unpacked first so that the packs can be removed;
+// packing them again is left to the Packer. It returns the number of objects
+// removed.
+func PruneObjects(repo *Repository) (int, error) {
+	storage := NewStorage(repo)
+	keep, err := referencedObjects(repo, storage)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find reachable objects: %w", err)
+	}
+
+	removed := make(map[string]bool)
+	packed, err := storage.PackedObjects()
+	if err != nil {
+		return 0, err
+	}
+	for _, hash := range packed {
+		if !keep[hash] {
+			removed[hash] = true
+			continue
+		}
+		if _, err := os.Stat(storage.loosePath(hash)); err == nil {
+			continue
+		}
+		data, err := storage.Load(hash)
+		if err != nil {
+			return 0, fmt.Errorf("failed to unpack object %s: %w", hash, err)
+		}
+		if err := storage.Store(NewBlob(data)); err != nil {
+			return 0, fmt.Errorf("failed to unpack object %s: %w", hash, err)
+		}
+	}
+
+	packs, err := filepath.Glob(filepath.Join(repo.ZarkDir, "pack", "pack-*"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list packfiles: %w", err)
+	}
+	for _, path := range packs {
+		if err := os.Remove(path); err != nil {
+			return 0, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+
+	packer, err := NewPacker(repo)
+	if err != nil {
+		return 0, err
+	}
+	for _, hash := range packer.looseObjects {
+		if keep[hash] {
+			continue
+		}
+		if err := os.Remove(storage.loosePath(hash)); err != nil {
+			return 0, fmt.Errorf("failed to remove object %s: %w", hash, err)
+		}
+		removed[hash] = true
+	}
+	return len(removed), nil
+}
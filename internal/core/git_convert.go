@@ -0,0 +1,682 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// gitMapFile records which git object each converted Zark object came from
+// or went to, one "<git sha-1> <zark hash>" pair per line, so converting
+// again only handles what is new.
+const gitMapFile = "git-map"
+
+// loadGitMap reads the mapping from git SHA-1s to Zark hashes.
+func loadGitMap(repo *Repository) (map[string]string, error) {
+	mapping := make(map[string]string)
+	file, err := os.Open(filepath.Join(repo.ZarkDir, gitMapFile))
+	if os.IsNotExist(err) {
+		return mapping, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the git mapping: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if git, zark, ok := strings.Cut(scanner.Text(), " "); ok {
+			mapping[git] = zark
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the git mapping: %w", err)
+	}
+	return mapping, nil
+}
+
+// appendGitMap adds pairs to the mapping file.
+func appendGitMap(repo *Repository, pairs [][2]string) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(filepath.Join(repo.ZarkDir, gitMapFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to update the git mapping: %w", err)
+	}
+	w := bufio.NewWriter(file)
+	for _, pair := range pairs {
+		fmt.Fprintf(w, "%s %s\n", pair[0], pair[1])
+	}
+	err = w.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update the git mapping: %w", err)
+	}
+	return nil
+}
+
+// GitImportResult describes what ImportGit converted.
+type GitImportResult struct {
+	Commits int
+	Blobs   int
+	// Updates lists the branches and tags created or moved.
+	Updates []RefUpdate
+	// Notes mention what could not be converted exactly or was left alone.
+	Notes []string
+}
+
+// gitImporter converts git objects into a Zark repository.
+type gitImporter struct {
+	git     *gitRepository
+	storage *Storage
+	mapping map[string]string
+	added   [][2]string
+	// trees caches the files of each git tree converted so far, with paths
+	// relative to it, since most subtrees stay the same from one commit to
+	// the next.
+	trees  map[string][]TreeEntry
+	result *GitImportResult
+	signed int
+}
+
+// ImportGit converts the branches and tags of the git repository at path,
+// with the commits, trees and blobs they need, into repo. Objects converted
+// by an earlier import are skipped. Branches only move forward: a branch
+// with commits of its own here is left alone, as is the current branch when
+// it has unsaved changes. Annotated tags become plain tags.
+func ImportGit(repo *Repository, path string) (*GitImportResult, error) {
+	if err := repo.RequireWorkTree(); err != nil {
+		return nil, err
+	}
+	git, err := openGitRepository(path)
+	if err != nil {
+		return nil, err
+	}
+	defer git.Close()
+	gitRefs, gitHead, err := git.Refs()
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := loadGitMap(repo)
+	if err != nil {
+		return nil, err
+	}
+	importer := &gitImporter{git: git, storage: NewStorage(repo), mapping: mapping, trees: make(map[string][]TreeEntry), result: &GitImportResult{}}
+
+	names := make([]string, 0, len(gitRefs))
+	for name := range gitRefs {
+		if strings.HasPrefix(name, "refs/heads/") || strings.HasPrefix(name, "refs/tags/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	wanted := make(map[string]string)
+	for _, name := range names {
+		commit, err := importer.peel(name, gitRefs[name])
+		if err == nil && commit != "" {
+			wanted[name], err = importer.importCommit(commit)
+		}
+		if err != nil {
+			// Keep what was converted so far for the next attempt.
+			appendGitMap(repo, importer.added)
+			return nil, fmt.Errorf("failed to import %s: %w", name, err)
+		}
+	}
+	if err := appendGitMap(repo, importer.added); err != nil {
+		return nil, err
+	}
+	if importer.signed > 0 {
+		importer.note("%d commit(s) were signed in git; zark cannot keep git signatures, so they were dropped", importer.signed)
+	}
+
+	if err := importer.updateRefs(repo, names, wanted, gitHead); err != nil {
+		return nil, err
+	}
+	return importer.result, nil
+}
+
+func (c *gitImporter) note(format string, args ...interface{}) {
+	c.result.Notes = append(c.result.Notes, fmt.Sprintf(format, args...))
+}
+
+// converted returns the Zark object a git object was converted to, if it
+// is still there.
+func (c *gitImporter) converted(sha string) (string, bool) {
+	hash, ok := c.mapping[sha]
+	return hash, ok && c.storage.Has(hash)
+}
+
+func (c *gitImporter) record(sha, hash string) {
+	c.mapping[sha] = hash
+	c.added = append(c.added, [2]string{sha, hash})
+}
+
+// peel follows annotated tags to the commit they point at. It returns ""
+// for references to something other than a commit.
+func (c *gitImporter) peel(name, sha string) (string, error) {
+	for annotated := false; ; annotated = true {
+		object, err := c.git.Read(sha)
+		if err != nil {
+			return "", err
+		}
+		switch object.Type {
+		case "commit":
+			if annotated && strings.HasPrefix(name, "refs/tags/") {
+				c.note("annotated tag '%s' became a plain tag; its message is not kept", shortRefName(name))
+			}
+			return sha, nil
+		case "tag":
+			if sha = parseGitCommit(object.Data).Header("object"); len(sha) != 40 {
+				return "", fmt.Errorf("malformed tag object")
+			}
+		default:
+			c.note("'%s' points at a %s rather than a commit, so it was left out", shortRefName(name), object.Type)
+			return "", nil
+		}
+	}
+}
+
+// importCommit converts a commit and any of its history not converted yet,
+// oldest first, and returns its Zark hash.
+func (c *gitImporter) importCommit(root string) (string, error) {
+	stack := []string{root}
+	for len(stack) > 0 {
+		sha := stack[len(stack)-1]
+		if _, ok := c.converted(sha); ok {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		object, err := c.git.Read(sha)
+		if err != nil {
+			return "", err
+		}
+		if object.Type != "commit" {
+			return "", fmt.Errorf("%s is a %s, not a commit", sha, object.Type)
+		}
+		parsed := parseGitCommit(object.Data)
+		parents := parsed.All("parent")
+		pending := false
+		for _, parent := range parents {
+			if _, ok := c.converted(parent); !ok {
+				stack = append(stack, parent)
+				pending = true
+			}
+		}
+		if pending {
+			continue
+		}
+		stack = stack[:len(stack)-1]
+		if err := c.convertCommit(sha, parsed, parents); err != nil {
+			return "", err
+		}
+	}
+	hash, _ := c.converted(root)
+	return hash, nil
+}
+
+func (c *gitImporter) convertCommit(sha string, parsed *gitCommit, parents []string) error {
+	files, err := c.treeFiles(parsed.Header("tree"))
+	if err != nil {
+		return err
+	}
+	entries := make([]TreeEntry, 0, len(files))
+	for _, file := range files {
+		if file.Type == "commit" {
+			c.note("submodule '%s' was left out; zark has no submodules", file.Name)
+			continue
+		}
+		entries = append(entries, file)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	tree, err := storeTreeEntries(c.storage, entries)
+	if err != nil {
+		return err
+	}
+	author, err := parseGitIdentity(parsed.Header("author"))
+	if err != nil {
+		return fmt.Errorf("commit %s: %w", sha, err)
+	}
+	committer, err := parseGitIdentity(parsed.Header("committer"))
+	if err != nil {
+		return fmt.Errorf("commit %s: %w", sha, err)
+	}
+	if parsed.Header("gpgsig") != "" {
+		c.signed++
+	}
+
+	commit := &Commit{
+		TreeHash:  tree,
+		Author:    author.Name,
+		Email:     author.Email,
+		Timestamp: author.When,
+		Committer: &committer,
+		// Git messages end with a newline; zark's don't.
+		Message: strings.TrimSuffix(parsed.Message, "\n"),
+	}
+	for i, parent := range parents {
+		hash, _ := c.converted(parent)
+		if i == 0 {
+			commit.Parent = hash
+		} else {
+			commit.MergeParents = append(commit.MergeParents, hash)
+		}
+	}
+	commit.rehash()
+	if err := c.storage.Store(commit); err != nil {
+		return fmt.Errorf("failed to store commit: %w", err)
+	}
+	c.record(sha, commit.Hash())
+	c.result.Commits++
+	return nil
+}
+
+// treeFiles returns the files of a git tree and its subtrees, with paths
+// relative to it, as zark trees list them. Submodules are listed with the
+// type "commit" so that the commit can mention them.
+func (c *gitImporter) treeFiles(sha string) ([]TreeEntry, error) {
+	if files, ok := c.trees[sha]; ok {
+		return files, nil
+	}
+	object, err := c.git.Read(sha)
+	if err != nil {
+		return nil, err
+	}
+	if object.Type != "tree" {
+		return nil, fmt.Errorf("%s is a %s, not a tree", sha, object.Type)
+	}
+	gitEntries, err := parseGitTree(object.Data)
+	if err != nil {
+		return nil, fmt.Errorf("tree %s: %w", sha, err)
+	}
+	var files []TreeEntry
+	for _, entry := range gitEntries {
+		// Names join into paths below, so each must be a single part that
+		// stays inside the working tree and out of .zark and .git.
+		if name := entry.Name; name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") ||
+			strings.EqualFold(name, ".zark") || strings.EqualFold(name, ".git") {
+			return nil, fmt.Errorf("tree %s holds the name '%s', which zark cannot store", sha, name)
+		}
+		mode := ModeFile
+		switch entry.Mode {
+		case gitModeTree:
+			sub, err := c.treeFiles(entry.Hash)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range sub {
+				file.Name = entry.Name + "/" + file.Name
+				files = append(files, file)
+			}
+			continue
+		case gitModeSubmodule:
+			files = append(files, TreeEntry{Name: entry.Name, Hash: entry.Hash, Type: "commit"})
+			continue
+		case ModeExecutable, ModeSymlink:
+			mode = entry.Mode
+		}
+		hash, err := c.importBlob(entry.Hash)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, TreeEntry{Mode: mode, Name: entry.Name, Hash: hash, Type: "blob"})
+	}
+	c.trees[sha] = files
+	return files, nil
+}
+
+func (c *gitImporter) importBlob(sha string) (string, error) {
+	if hash, ok := c.converted(sha); ok {
+		return hash, nil
+	}
+	object, err := c.git.Read(sha)
+	if err != nil {
+		return "", err
+	}
+	if object.Type != "blob" {
+		return "", fmt.Errorf("%s is a %s, not a blob", sha, object.Type)
+	}
+	blob := NewBlob(object.Data)
+	if err := c.storage.Store(blob); err != nil {
+		return "", fmt.Errorf("failed to store blob: %w", err)
+	}
+	c.record(sha, blob.Hash())
+	c.result.Blobs++
+	return blob.Hash(), nil
+}
+
+// updateRefs points the imported branches and tags at their commits,
+// without losing commits made here.
+func (c *gitImporter) updateRefs(repo *Repository, names []string, wanted map[string]string, gitHead string) error {
+	updates, notes, err := applyImportedRefs(repo, c.storage, names, wanted, gitHead, "git's", false)
+	c.result.Updates = append(c.result.Updates, updates...)
+	c.result.Notes = append(c.result.Notes, notes...)
+	return err
+}
+
+// applyImportedRefs moves the refs named in names to the commits in wanted,
+// for importers bringing in history from elsewhere. Branches only move
+// forward and tags never move unless force is set, and the current branch
+// is left alone while it has local changes; each ref skipped gets a note
+// naming source, the importer's side. When the current branch moves, or
+// the repository had no commits yet, a branch is checked out: head if it
+// was imported, otherwise the current branch.
+func applyImportedRefs(repo *Repository, storage *Storage, names []string, wanted map[string]string, head, source string, force bool) ([]RefUpdate, []string, error) {
+	refs, err := ListRefs(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	current, err := CurrentBranch(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, headErr := ResolveRef(repo, "HEAD")
+	unborn := headErr != nil
+
+	var updates []RefUpdate
+	var notes []string
+	checkout := ""
+	for _, name := range names {
+		update := RefUpdate{Name: name, Old: refs[name], New: wanted[name]}
+		if update.New == "" || update.Old == update.New {
+			continue
+		}
+		short := shortRefName(name)
+		if update.Old != "" {
+			if strings.HasPrefix(name, "refs/tags/") {
+				if !force {
+					notes = append(notes, fmt.Sprintf("tag '%s' already points at another commit here, so it was left alone", short))
+					continue
+				}
+				update.Force = true
+			} else if forward, err := isAncestor(storage, update.Old, update.New); err != nil {
+				return updates, notes, err
+			} else if !forward {
+				if !force {
+					notes = append(notes, fmt.Sprintf("branch '%s' has commits here that %s doesn't, so it was left alone", short, source))
+					continue
+				}
+				update.Force = true
+			}
+			if short == current && strings.HasPrefix(name, "refs/heads/") {
+				oldTree, err := commitTreeEntries(storage, update.Old)
+				if err != nil {
+					return updates, notes, err
+				}
+				if changed, _, err := localChanges(repo, storage, oldTree); err != nil {
+					return updates, notes, err
+				} else if len(changed) > 0 {
+					notes = append(notes, fmt.Sprintf("'%s' was not moved because of your changes to %s; save them and import again", short, describePaths(changed)))
+					continue
+				}
+				checkout = short
+			}
+		}
+		if err := UpdateRef(repo, name, update.New); err != nil {
+			return updates, notes, err
+		}
+		updates = append(updates, update)
+	}
+
+	if unborn {
+		// A repository without commits switches to the imported branch.
+		for _, branch := range []string{current, head} {
+			if _, ok := wanted["refs/heads/"+branch]; ok && branch != "" {
+				checkout = branch
+			}
+		}
+	}
+	if checkout != "" {
+		return updates, notes, Checkout(repo, checkout)
+	}
+	return updates, notes, nil
+}
+
+// GitExportResult describes what ExportGit wrote.
+type GitExportResult struct {
+	Dir     string
+	Commits int
+	Objects int
+	Refs    int
+	Notes   []string
+}
+
+// gitExporter converts Zark objects into a git repository.
+type gitExporter struct {
+	git     *gitRepository
+	storage *Storage
+	// reverse maps Zark hashes to git SHA-1s.
+	reverse map[string]string
+	added   [][2]string
+	result  *GitExportResult
+	signed  int
+}
+
+// ExportGit writes the branches and tags of repo, with their history, to a
+// git repository at dir. A new bare repository is created unless dir already
+// holds a git repository, which is then updated. Objects written by an
+// earlier export or import are skipped.
+func ExportGit(repo *Repository, dir string) (*GitExportResult, error) {
+	var git *gitRepository
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		if git, err = openGitRepository(dir); err != nil {
+			return nil, fmt.Errorf("'%s' already exists and is not a git repository", dir)
+		}
+		defer git.Close()
+	} else {
+		branch, err := CurrentBranch(repo)
+		if err != nil {
+			return nil, err
+		}
+		if branch == "" {
+			branch = "main"
+		}
+		if git, err = initGitRepository(dir, branch); err != nil {
+			return nil, err
+		}
+	}
+	mapping, err := loadGitMap(repo)
+	if err != nil {
+		return nil, err
+	}
+	exporter := &gitExporter{git: git, storage: NewStorage(repo), reverse: make(map[string]string), result: &GitExportResult{Dir: git.Dir}}
+	for sha, hash := range mapping {
+		exporter.reverse[hash] = sha
+	}
+
+	refs, err := ListRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		if strings.HasPrefix(name, "refs/heads/") || strings.HasPrefix(name, "refs/tags/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	gitRefs, _, err := git.Refs()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		sha, err := exporter.exportCommit(refs[name])
+		if err != nil {
+			appendGitMap(repo, exporter.added)
+			return nil, fmt.Errorf("failed to export %s: %w", name, err)
+		}
+		if gitRefs[name] == sha {
+			continue
+		}
+		if err := git.UpdateRef(name, sha); err != nil {
+			return nil, err
+		}
+		exporter.result.Refs++
+	}
+	if err := appendGitMap(repo, exporter.added); err != nil {
+		return nil, err
+	}
+	if exporter.signed > 0 {
+		exporter.result.Notes = append(exporter.result.Notes,
+			fmt.Sprintf("%d commit(s) were signed; git cannot check zark signatures, so they were left out", exporter.signed))
+	}
+	return exporter.result, nil
+}
+
+// exported returns the git object a Zark object was written as, if the git
+// repository still has it.
+func (e *gitExporter) exported(hash string) (string, bool) {
+	sha, ok := e.reverse[hash]
+	return sha, ok && e.git.Has(sha)
+}
+
+func (e *gitExporter) record(hash, sha string) {
+	if e.reverse[hash] != sha {
+		e.reverse[hash] = sha
+		e.added = append(e.added, [2]string{sha, hash})
+	}
+}
+
+// exportCommit writes a commit and any of its history not written yet,
+// oldest first, and returns its SHA-1.
+func (e *gitExporter) exportCommit(root string) (string, error) {
+	stack := []string{root}
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		if _, ok := e.exported(hash); ok {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		commit, err := e.storage.LoadCommit(hash)
+		if err != nil {
+			return "", err
+		}
+		pending := false
+		for _, parent := range commit.Parents() {
+			if _, ok := e.exported(parent); !ok {
+				stack = append(stack, parent)
+				pending = true
+			}
+		}
+		if pending {
+			continue
+		}
+		stack = stack[:len(stack)-1]
+		if err := e.writeCommit(commit); err != nil {
+			return "", err
+		}
+	}
+	sha, _ := e.exported(root)
+	return sha, nil
+}
+
+func (e *gitExporter) writeCommit(commit *Commit) error {
+	tree, err := e.storage.LoadTree(commit.TreeHash)
+	if err != nil {
+		return err
+	}
+	treeSHA, err := e.writeTree(tree.Entries)
+	if err != nil {
+		return err
+	}
+	var data strings.Builder
+	fmt.Fprintf(&data, "tree %s\n", treeSHA)
+	for _, parent := range commit.Parents() {
+		sha, _ := e.exported(parent)
+		fmt.Fprintf(&data, "parent %s\n", sha)
+	}
+	fmt.Fprintf(&data, "author %s\n", formatGitIdentity(commit.AuthorIdentity()))
+	fmt.Fprintf(&data, "committer %s\n", formatGitIdentity(commit.CommitterIdentity()))
+	fmt.Fprintf(&data, "\n%s\n", commit.Message)
+	if commit.Signature != nil {
+		e.signed++
+	}
+
+	sha, err := e.git.Write("commit", []byte(data.String()))
+	if err != nil {
+		return err
+	}
+	e.record(commit.Hash(), sha)
+	e.result.Commits++
+	e.result.Objects++
+	return nil
+}
+
+// gitDir collects the files and subdirectories of one directory of a
+// zark tree, to be written as a git tree.
+type gitDir struct {
+	entries []gitTreeEntry
+	subdirs map[string]*gitDir
+}
+
+// writeTree writes a zark tree, which lists every file by its full path, as
+// nested git trees and returns the SHA-1 of the top one.
+func (e *gitExporter) writeTree(entries []TreeEntry) (string, error) {
+	root := &gitDir{subdirs: make(map[string]*gitDir)}
+	for _, entry := range entries {
+		sha, err := e.writeBlob(entry.Hash)
+		if err != nil {
+			return "", err
+		}
+		dir := root
+		parts := strings.Split(entry.Name, "/")
+		for _, part := range parts[:len(parts)-1] {
+			sub, ok := dir.subdirs[part]
+			if !ok {
+				sub = &gitDir{subdirs: make(map[string]*gitDir)}
+				dir.subdirs[part] = sub
+			}
+			dir = sub
+		}
+		dir.entries = append(dir.entries, gitTreeEntry{Mode: normalizeMode(entry.Mode), Name: parts[len(parts)-1], Hash: sha})
+	}
+	return e.writeGitDir(root)
+}
+
+func (e *gitExporter) writeGitDir(dir *gitDir) (string, error) {
+	entries := dir.entries
+	for name, sub := range dir.subdirs {
+		sha, err := e.writeGitDir(sub)
+		if err != nil {
+			return "", err
+		}
+		entries = append(entries, gitTreeEntry{Mode: gitModeTree, Name: name, Hash: sha})
+	}
+	data := formatGitTree(entries)
+	sha := gitObjectHash("tree", data)
+	if !e.git.Has(sha) {
+		if _, err := e.git.Write("tree", data); err != nil {
+			return "", err
+		}
+		e.result.Objects++
+	}
+	return sha, nil
+}
+
+func (e *gitExporter) writeBlob(hash string) (string, error) {
+	if sha, ok := e.exported(hash); ok {
+		return sha, nil
+	}
+	data, err := e.storage.Load(hash)
+	if err != nil {
+		return "", err
+	}
+	sha := gitObjectHash("blob", data)
+	if !e.git.Has(sha) {
+		if _, err := e.git.Write("blob", data); err != nil {
+			return "", err
+		}
+		e.result.Objects++
+	}
+	e.record(hash, sha)
+	return sha, nil
+}
+
+// shortRefName drops the refs/heads/ or refs/tags/ prefix from a name.
+func shortRefName(name string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(name, "refs/heads/"), "refs/tags/")
+}
@@ -0,0 +1,385 @@
+package core
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gitFixture builds a git repository byte by byte, the way git lays it out,
+// so the tests need no git binary.
+type gitFixture struct {
+	t   *testing.T
+	dir string // the .git directory
+}
+
+func newGitFixture(t *testing.T) *gitFixture {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "project", ".git")
+	for _, sub := range []string{"objects/pack", "refs/heads", "refs/tags"} {
+		os.MkdirAll(filepath.Join(dir, sub), 0755)
+	}
+	os.WriteFile(filepath.Join(dir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644)
+	return &gitFixture{t: t, dir: dir}
+}
+
+func fixtureHash(kind string, data []byte) string {
+	sum := sha1.Sum(append([]byte(fmt.Sprintf("%s %d\x00", kind, len(data))), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+func fixtureCompress(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// loose writes a loose object and returns its SHA-1.
+func (f *gitFixture) loose(kind string, data []byte) string {
+	hash := fixtureHash(kind, data)
+	path := filepath.Join(f.dir, "objects", hash[:2], hash[2:])
+	os.MkdirAll(filepath.Dir(path), 0755)
+	raw := append([]byte(fmt.Sprintf("%s %d\x00", kind, len(data))), data...)
+	if err := os.WriteFile(path, fixtureCompress(raw), 0444); err != nil {
+		f.t.Fatalf("Failed to write fixture object: %v", err)
+	}
+	return hash
+}
+
+// fixturePackEntry is an object for a pack, stored as a delta against base
+// if set: by offset if base is earlier in the same pack, else by name.
+type fixturePackEntry struct {
+	kind string
+	data []byte
+	base *fixturePackEntry
+}
+
+// pack writes a pack with an index holding the entries.
+func (f *gitFixture) pack(entries []*fixturePackEntry) {
+	var pack bytes.Buffer
+	pack.WriteString("PACK")
+	binary.Write(&pack, binary.BigEndian, uint32(2))
+	binary.Write(&pack, binary.BigEndian, uint32(len(entries)))
+	types := map[string]byte{"commit": 1, "tree": 2, "blob": 3, "tag": 4}
+	offsets := make(map[*fixturePackEntry]int)
+	hashes := make(map[string]int)
+	for _, entry := range entries {
+		offset := pack.Len()
+		offsets[entry] = offset
+		hashes[fixtureHash(entry.kind, entry.data)] = offset
+
+		kind, payload, prefix := types[entry.kind], entry.data, []byte(nil)
+		if entry.base != nil {
+			payload = fixtureDelta(entry.base.data, entry.data)
+			if baseOffset, ok := offsets[entry.base]; ok {
+				kind = 6
+				n := offset - baseOffset
+				prefix = []byte{byte(n & 0x7f)}
+				for n >>= 7; n > 0; n >>= 7 {
+					n--
+					prefix = append([]byte{byte(0x80 | n&0x7f)}, prefix...)
+				}
+			} else {
+				kind = 7
+				prefix, _ = hex.DecodeString(fixtureHash(entry.base.kind, entry.base.data))
+			}
+		}
+		size := len(payload)
+		c := kind<<4 | byte(size&0x0f)
+		for size >>= 4; size > 0; size >>= 7 {
+			pack.WriteByte(c | 0x80)
+			c = byte(size & 0x7f)
+		}
+		pack.WriteByte(c)
+		pack.Write(prefix)
+		pack.Write(fixtureCompress(payload))
+	}
+	packSum := sha1.Sum(pack.Bytes())
+	pack.Write(packSum[:])
+
+	names := make([]string, 0, len(hashes))
+	for hash := range hashes {
+		names = append(names, hash)
+	}
+	sort.Strings(names)
+	var idx bytes.Buffer
+	idx.Write([]byte{0xff, 't', 'O', 'c', 0, 0, 0, 2})
+	for b := 0; b < 256; b++ {
+		count := sort.Search(len(names), func(i int) bool { return names[i][:2] > fmt.Sprintf("%02x", b) })
+		binary.Write(&idx, binary.BigEndian, uint32(count))
+	}
+	for _, name := range names {
+		raw, _ := hex.DecodeString(name)
+		idx.Write(raw)
+	}
+	idx.Write(make([]byte, 4*len(names)))
+	for _, name := range names {
+		binary.Write(&idx, binary.BigEndian, uint32(hashes[name]))
+	}
+	idx.Write(packSum[:])
+	idxSum := sha1.Sum(idx.Bytes())
+	idx.Write(idxSum[:])
+
+	base := filepath.Join(f.dir, "objects", "pack", "pack-"+hex.EncodeToString(packSum[:]))
+	os.WriteFile(base+".pack", pack.Bytes(), 0444)
+	os.WriteFile(base+".idx", idx.Bytes(), 0444)
+}
+
+// fixtureDelta encodes target as a git delta: a copy of the prefix it
+// shares with base, then the rest inserted.
+func fixtureDelta(base, target []byte) []byte {
+	var delta bytes.Buffer
+	for _, size := range []int{len(base), len(target)} {
+		for ; size >= 0x80; size >>= 7 {
+			delta.WriteByte(byte(size&0x7f) | 0x80)
+		}
+		delta.WriteByte(byte(size))
+	}
+	common := 0
+	for common < len(base) && common < len(target) && common < 0xff && base[common] == target[common] {
+		common++
+	}
+	if common > 0 {
+		delta.Write([]byte{0x80 | 0x10, byte(common)})
+	}
+	for rest := target[common:]; len(rest) > 0; {
+		n := min(len(rest), 0x7f)
+		delta.WriteByte(byte(n))
+		delta.Write(rest[:n])
+		rest = rest[n:]
+	}
+	return delta.Bytes()
+}
+
+func fixtureTree(entries ...string) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < len(entries); i += 3 {
+		fmt.Fprintf(&buf, "%s %s\x00", entries[i], entries[i+1])
+		raw, _ := hex.DecodeString(entries[i+2])
+		buf.Write(raw)
+	}
+	return buf.Bytes()
+}
+
+func (f *gitFixture) ref(name, hash string) {
+	os.MkdirAll(filepath.Dir(filepath.Join(f.dir, name)), 0755)
+	os.WriteFile(filepath.Join(f.dir, name), []byte(hash+"\n"), 0644)
+}
+
+func TestGitImportExport(t *testing.T) {
+	isolateConfig(t)
+	git := newGitFixture(t)
+	ada := "Ada Lovelace <ada@example.com> 1700000000 +0200"
+	grace := "Grace Hopper <grace@example.com> 1700000100 -0500"
+
+	readme := &fixturePackEntry{kind: "blob", data: []byte("# Project\n")}
+	readme2 := &fixturePackEntry{kind: "blob", data: []byte("# Project\n\nNow with more words.\n"), base: readme}
+	script := git.loose("blob", []byte("#!/bin/sh\necho hi\n"))
+	mainGo := git.loose("blob", []byte("package main\n"))
+	link := git.loose("blob", []byte("README.md"))
+	notes := git.loose("blob", []byte("notes\n"))
+	readmeHash, readme2Hash := fixtureHash("blob", readme.data), fixtureHash("blob", readme2.data)
+	src := git.loose("tree", fixtureTree("100644", "main.go", mainGo))
+
+	root1 := &fixturePackEntry{kind: "tree", data: fixtureTree("100644", "README.md", readmeHash, "120000", "link.md", link, "100755", "run.sh", script, "40000", "src", src)}
+	git.loose("tree", root1.data)
+	root2 := git.loose("tree", fixtureTree("100644", "README.md", readmeHash, "120000", "link.md", link, "100644", "notes.txt", notes, "100755", "run.sh", script, "40000", "src", src))
+	root3 := &fixturePackEntry{kind: "tree", data: fixtureTree("100644", "README.md", readme2Hash, "120000", "link.md", link, "100755", "run.sh", script, "40000", "src", src), base: root1}
+	root4 := git.loose("tree", fixtureTree("100644", "README.md", readme2Hash, "120000", "link.md", link, "100644", "notes.txt", notes, "100755", "run.sh", script, "40000", "src", src))
+
+	c1 := git.loose("commit", []byte(fmt.Sprintf("tree %s\nauthor %s\ncommitter %s\n\nInitial commit\n", fixtureHash("tree", root1.data), ada, ada)))
+	c2 := git.loose("commit", []byte(fmt.Sprintf("tree %s\nparent %s\nauthor %s\ncommitter %s\n\nAdd notes\n", root2, c1, ada, grace)))
+	commit3 := &fixturePackEntry{kind: "commit", data: []byte(fmt.Sprintf("tree %s\nparent %s\nauthor %s\ncommitter %s\n\nExpand the readme\n\nWith a body.\n", fixtureHash("tree", root3.data), c1, ada, ada))}
+	c3 := fixtureHash("commit", commit3.data)
+	commit4 := &fixturePackEntry{kind: "commit", data: []byte(fmt.Sprintf("tree %s\nparent %s\nparent %s\nauthor %s\ncommitter %s\n\nMerge feature\n", root4, c3, c2, grace, grace))}
+	c4 := fixtureHash("commit", commit4.data)
+	tag := &fixturePackEntry{kind: "tag", data: []byte(fmt.Sprintf("object %s\ntype commit\ntag v1\ntagger %s\n\nFirst release\n", c1, ada))}
+	git.pack([]*fixturePackEntry{readme, readme2, root3, commit3, commit4, tag})
+
+	git.ref("refs/heads/main", c4)
+	os.WriteFile(filepath.Join(git.dir, "packed-refs"), []byte(fmt.Sprintf("# pack-refs with: peeled\n%s refs/heads/feature\n%s refs/tags/v1\n^%s\n",
+		c2, fixtureHash("tag", tag.data), c1)), 0644)
+
+	repo := NewRepository(t.TempDir())
+	if err := repo.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	inDir(t, repo.Path, func() {
+		if _, err := ImportGit(repo, t.TempDir()); err == nil || !strings.Contains(err.Error(), "not appear to be a git repository") {
+			t.Errorf("Expected a directory without git to be refused, got %v", err)
+		}
+		result, err := ImportGit(repo, filepath.Dir(git.dir))
+		if err != nil {
+			t.Fatalf("ImportGit failed: %v", err)
+		}
+		if result.Commits != 4 || len(result.Updates) != 3 {
+			t.Errorf("Expected 4 commits and 3 references, got %+v", result)
+		}
+		if !strings.Contains(strings.Join(result.Notes, "\n"), "annotated tag 'v1'") {
+			t.Errorf("Expected a note about the annotated tag, got %v", result.Notes)
+		}
+
+		storage := NewStorage(repo)
+		head, _ := ResolveRef(repo, "HEAD")
+		merge, err := storage.LoadCommit(head)
+		if err != nil {
+			t.Fatalf("LoadCommit failed: %v", err)
+		}
+		if len(merge.Parents()) != 2 || merge.Message != "Merge feature" || merge.Author != "Grace Hopper" {
+			t.Errorf("Expected the merge commit, got %+v", merge)
+		}
+		feature, _ := ResolveRef(repo, "feature")
+		second, _ := storage.LoadCommit(feature)
+		if _, offset := second.CommitterIdentity().When.Zone(); second.CommitterIdentity().Name != "Grace Hopper" || offset != -5*3600 ||
+			!second.Timestamp.Equal(time.Unix(1700000000, 0)) {
+			t.Errorf("Expected author and committer to keep their dates and zones, got %+v", second)
+		}
+		if tagged, _ := ResolveRef(repo, "v1"); tagged != second.Parent {
+			t.Error("Expected v1 to point at the first commit")
+		}
+
+		for path, want := range map[string]string{"README.md": string(readme2.data), "src/main.go": "package main\n", "notes.txt": "notes\n"} {
+			if data, _ := os.ReadFile(path); string(data) != want {
+				t.Errorf("Expected %s to be checked out with %q, got %q", path, want, data)
+			}
+		}
+		if info, err := os.Stat("run.sh"); err != nil || info.Mode().Perm()&0111 == 0 {
+			t.Error("Expected run.sh to be executable")
+		}
+		if target, err := os.Readlink("link.md"); err != nil || target != "README.md" {
+			t.Errorf("Expected link.md to be a symlink, got %q %v", target, err)
+		}
+
+		out := filepath.Join(t.TempDir(), "export.git")
+		exported, err := ExportGit(repo, out)
+		if err != nil {
+			t.Fatalf("ExportGit failed: %v", err)
+		}
+		if exported.Commits != 4 || exported.Refs != 3 {
+			t.Errorf("Expected 4 commits and 3 references, got %+v", exported)
+		}
+		target, err := openGitRepository(out)
+		if err != nil {
+			t.Fatalf("Expected a git repository: %v", err)
+		}
+		refs, _, _ := target.Refs()
+		if refs["refs/heads/main"] != c4 || refs["refs/heads/feature"] != c2 || refs["refs/tags/v1"] != c1 {
+			t.Errorf("Expected the exported commits to have their original SHA-1s, got %v", refs)
+		}
+		if object, err := target.Read(c3); err != nil || !bytes.Equal(object.Data, commit3.data) {
+			t.Errorf("Expected the exported commit to match the original, got %v", err)
+		}
+
+		// More work in git is imported incrementally.
+		extra := git.loose("blob", []byte("new\n"))
+		root5 := git.loose("tree", fixtureTree("100644", "README.md", readme2Hash, "120000", "link.md", link, "100644", "new.txt", extra, "100644", "notes.txt", notes, "100755", "run.sh", script, "40000", "src", src))
+		c5 := git.loose("commit", []byte(fmt.Sprintf("tree %s\nparent %s\nauthor %s\ncommitter %s\n\nAdd new.txt\n", root5, c4, ada, ada)))
+		git.ref("refs/heads/main", c5)
+		result, err = ImportGit(repo, git.dir)
+		if err != nil {
+			t.Fatalf("ImportGit failed: %v", err)
+		}
+		if result.Commits != 1 || result.Blobs != 1 || len(result.Updates) != 1 {
+			t.Errorf("Expected only the new commit to be imported, got %+v", result)
+		}
+		if data, _ := os.ReadFile("new.txt"); string(data) != "new\n" {
+			t.Errorf("Expected main to move forward and check out new.txt, got %q", data)
+		}
+		if result, err = ImportGit(repo, git.dir); err != nil || result.Commits != 0 || len(result.Updates) != 0 {
+			t.Errorf("Expected nothing new on a third import, got %+v %v", result, err)
+		}
+
+		exported, err = ExportGit(repo, out)
+		if err != nil || exported.Commits != 1 || exported.Refs != 1 {
+			t.Errorf("Expected the export to add only the new commit, got %+v %v", exported, err)
+		}
+		if refs, _, _ := target.Refs(); refs["refs/heads/main"] != c5 {
+			t.Errorf("Expected main to be exported as %s, got %s", c5, refs["refs/heads/main"])
+		}
+	})
+}
+
+func TestGitImportRefusesHostileNames(t *testing.T) {
+	isolateConfig(t)
+	for _, name := range []string{"..", ".zark", ".Git", "."} {
+		git := newGitFixture(t)
+		blob := git.loose("blob", []byte("#!/bin/sh\necho planted\n"))
+		inner := git.loose("tree", fixtureTree("100755", "pre-save", blob, "100644", "escaped.txt", blob))
+		root := git.loose("tree", fixtureTree("40000", name, inner))
+		commit := git.loose("commit", []byte(fmt.Sprintf("tree %s\nauthor A <a@example.com> 1700000000 +0000\ncommitter A <a@example.com> 1700000000 +0000\n\nInnocent\n", root)))
+		git.ref("refs/heads/main", commit)
+
+		repo := NewRepository(filepath.Join(t.TempDir(), "work"))
+		if err := repo.Init(); err != nil {
+			t.Fatalf("Init failed: %v", err)
+		}
+		inDir(t, repo.Path, func() {
+			if _, err := ImportGit(repo, filepath.Dir(git.dir)); err == nil || !strings.Contains(err.Error(), "cannot store") {
+				t.Errorf("Expected a tree named %q to be refused, got %v", name, err)
+			}
+		})
+		if _, err := os.Stat(filepath.Join(filepath.Dir(repo.Path), "escaped.txt")); !os.IsNotExist(err) {
+			t.Errorf("Expected nothing to be written outside the working tree by %q", name)
+		}
+		if _, err := os.Stat(filepath.Join(repo.ZarkDir, "pre-save")); !os.IsNotExist(err) {
+			t.Errorf("Expected nothing to be written into .zark by %q", name)
+		}
+	}
+}
+
+func TestGitObjectChecks(t *testing.T) {
+	git := newGitFixture(t)
+	blob := git.loose("blob", []byte("hello\n"))
+	// A loose object stored under a name that is not its SHA-1.
+	wrong := strings.Repeat("ab", 20)
+	data, _ := os.ReadFile(filepath.Join(git.dir, "objects", blob[:2], blob[2:]))
+	os.MkdirAll(filepath.Join(git.dir, "objects", wrong[:2]), 0755)
+	os.WriteFile(filepath.Join(git.dir, "objects", wrong[:2], wrong[2:]), data, 0444)
+
+	repo, err := openGitRepository(git.dir)
+	if err != nil {
+		t.Fatalf("openGitRepository failed: %v", err)
+	}
+	defer repo.Close()
+	if object, err := repo.Read(blob); err != nil || string(object.Data) != "hello\n" {
+		t.Errorf("Expected the blob to be read, got %v", err)
+	}
+	if _, err := repo.Read(wrong); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("Expected an object that does not match its name to be refused, got %v", err)
+	}
+
+	// Deltas whose base is the object itself, by name and by offset.
+	data = []byte("a delta that is its own base\n")
+	byName := &fixturePackEntry{kind: "blob", data: data, base: &fixturePackEntry{kind: "blob", data: data}}
+	byOffset := &fixturePackEntry{kind: "blob", data: data}
+	byOffset.base = byOffset
+	for _, entry := range []*fixturePackEntry{byName, byOffset} {
+		cyclic := newGitFixture(t)
+		cyclic.pack([]*fixturePackEntry{entry})
+		repo, err := openGitRepository(cyclic.dir)
+		if err != nil {
+			t.Fatalf("openGitRepository failed: %v", err)
+		}
+		if _, err := repo.Read(fixtureHash("blob", data)); err == nil || !strings.Contains(err.Error(), "too long") {
+			t.Errorf("Expected a delta cycle to be reported, got %v", err)
+		}
+		repo.Close()
+	}
+
+	// The base is 3 bytes, the result claims a terabyte and one insert follows.
+	delta := []byte{3, 0x80, 0x80, 0x80, 0x80, 0x80, 0x20, 1, 'x'}
+	if _, err := applyGitDelta([]byte("abc"), delta); err == nil || !strings.Contains(err.Error(), "more than it can produce") {
+		t.Errorf("Expected an impossible delta size to be refused, got %v", err)
+	}
+}
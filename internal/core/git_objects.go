@@ -0,0 +1,656 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Git stores each object as "<type> <size>\0<data>", named by the SHA-1 of
+// that whole string, either zlib-compressed in objects/xx/yyyy or in a pack
+// with an index. This file reads and writes just enough of that format to
+// convert repositories, without needing git itself.
+
+// Object types in a git pack.
+const (
+	gitPackCommit   = 1
+	gitPackTree     = 2
+	gitPackBlob     = 3
+	gitPackTag      = 4
+	gitPackOfsDelta = 6
+	gitPackRefDelta = 7
+)
+
+var gitPackTypeNames = map[byte]string{gitPackCommit: "commit", gitPackTree: "tree", gitPackBlob: "blob", gitPackTag: "tag"}
+
+// Modes in git trees. Subdirectories are "40000" and submodules "160000".
+const (
+	gitModeTree      = "40000"
+	gitModeSubmodule = "160000"
+)
+
+// gitObject is an object read from a git repository.
+type gitObject struct {
+	Type string
+	Data []byte
+}
+
+// gitRepository reads and writes the objects and references of a git
+// repository at Dir, its .git directory or a bare repository.
+type gitRepository struct {
+	Dir   string
+	packs []*gitPack
+}
+
+// gitPack is an open pack file with the object offsets from its index.
+// Objects are read at their offsets, so packs are never loaded whole.
+type gitPack struct {
+	file    *os.File
+	size    int64
+	offsets map[string]int64
+	// bases keeps recently used delta bases, since a chain of deltas is
+	// usually read one object after the other.
+	bases map[int64]*gitObject
+}
+
+// gitPackBaseCache is how many delta bases a pack keeps.
+const gitPackBaseCache = 256
+
+// openGitRepository opens the git repository at path, which may be a
+// working tree with a .git directory, the .git directory itself or a bare
+// repository.
+func openGitRepository(path string) (*gitRepository, error) {
+	dir := path
+	if info, err := os.Stat(filepath.Join(path, ".git")); err == nil && info.IsDir() {
+		dir = filepath.Join(path, ".git")
+	}
+	for _, name := range []string{"HEAD", "objects"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return nil, fmt.Errorf("'%s' does not appear to be a git repository (no %s)", path, name)
+		}
+	}
+	repo := &gitRepository{Dir: dir}
+	if err := repo.loadPacks(); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// loadPacks reads the pack files and their version 2 indexes.
+func (g *gitRepository) loadPacks() error {
+	indexes, _ := filepath.Glob(filepath.Join(g.Dir, "objects", "pack", "*.idx"))
+	sort.Strings(indexes)
+	for _, idxPath := range indexes {
+		offsets, err := readGitPackIndex(idxPath)
+		if err != nil {
+			return err
+		}
+		pack, err := openGitPack(strings.TrimSuffix(idxPath, ".idx")+".pack", offsets)
+		if err != nil {
+			g.Close()
+			return err
+		}
+		g.packs = append(g.packs, pack)
+	}
+	return nil
+}
+
+func openGitPack(path string, offsets map[string]int64) (*gitPack, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git pack: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read git pack: %w", err)
+	}
+	var header [4]byte
+	if _, err := file.ReadAt(header[:], 0); err != nil || info.Size() < 12 || string(header[:]) != "PACK" {
+		file.Close()
+		return nil, fmt.Errorf("'%s' is not a git pack", path)
+	}
+	return &gitPack{file: file, size: info.Size(), offsets: offsets}, nil
+}
+
+// Close closes the pack files.
+func (g *gitRepository) Close() error {
+	var first error
+	for _, pack := range g.packs {
+		if err := pack.file.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	g.packs = nil
+	return first
+}
+
+// readGitPackIndex reads the object offsets from a version 2 pack index:
+// a header, 256 fan-out counts, the sorted SHA-1s, their CRCs, then 4-byte
+// offsets, with large offsets in a table of 8-byte ones after them.
+func readGitPackIndex(path string) (map[string]int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git pack index: %w", err)
+	}
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(data[4:8]) != 2 {
+		return nil, fmt.Errorf("'%s' is not a version 2 git pack index", path)
+	}
+	count := int(binary.BigEndian.Uint32(data[8+255*4:]))
+	names := 8 + 256*4
+	offsets := names + count*20 + count*4
+	large := offsets + count*4
+	if len(data) < large {
+		return nil, fmt.Errorf("git pack index '%s' is truncated", path)
+	}
+	result := make(map[string]int64, count)
+	for i := 0; i < count; i++ {
+		hash := hex.EncodeToString(data[names+i*20 : names+i*20+20])
+		offset := int64(binary.BigEndian.Uint32(data[offsets+i*4:]))
+		if offset&0x80000000 != 0 {
+			at := large + int(offset&0x7fffffff)*8
+			if len(data) < at+8 {
+				return nil, fmt.Errorf("git pack index '%s' is truncated", path)
+			}
+			offset = int64(binary.BigEndian.Uint64(data[at:]))
+		}
+		result[hash] = offset
+	}
+	return result, nil
+}
+
+func (g *gitRepository) loosePath(hash string) string {
+	return filepath.Join(g.Dir, "objects", hash[:2], hash[2:])
+}
+
+// Has reports whether the repository has the object, loose or packed.
+func (g *gitRepository) Has(hash string) bool {
+	if _, err := os.Stat(g.loosePath(hash)); err == nil {
+		return true
+	}
+	for _, pack := range g.packs {
+		if _, ok := pack.offsets[hash]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Read returns the object with the given SHA-1.
+func (g *gitRepository) Read(hash string) (*gitObject, error) {
+	return g.readObject(hash, 0)
+}
+
+// readObject reads an object by name, depth deltas below the one first
+// asked for, so that a delta naming itself ends instead of recursing.
+func (g *gitRepository) readObject(hash string, depth int) (*gitObject, error) {
+	if len(hash) != 40 {
+		return nil, fmt.Errorf("invalid git object name '%s'", hash)
+	}
+	object, err := g.read(hash, depth)
+	if err != nil {
+		return nil, err
+	}
+	// The name is the SHA-1 of the content, so a damaged object shows up
+	// here instead of being converted.
+	if gitObjectHash(object.Type, object.Data) != hash {
+		return nil, fmt.Errorf("git object %s is corrupt", hash)
+	}
+	return object, nil
+}
+
+func (g *gitRepository) read(hash string, depth int) (*gitObject, error) {
+	if data, err := os.ReadFile(g.loosePath(hash)); err == nil {
+		return readLooseGitObject(hash, data)
+	}
+	for _, pack := range g.packs {
+		if offset, ok := pack.offsets[hash]; ok {
+			object, err := g.readPacked(pack, offset, depth)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read git object %s: %w", hash, err)
+			}
+			return object, nil
+		}
+	}
+	return nil, fmt.Errorf("git object %s not found", hash)
+}
+
+func readLooseGitObject(hash string, compressed []byte) (*gitObject, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress git object %s: %w", hash, err)
+	}
+	defer zr.Close()
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress git object %s: %w", hash, err)
+	}
+	header, data, ok := bytes.Cut(raw, []byte{0})
+	kind, size, _ := strings.Cut(string(header), " ")
+	if !ok || strconv.Itoa(len(data)) != size {
+		return nil, fmt.Errorf("git object %s is corrupt", hash)
+	}
+	return &gitObject{Type: kind, Data: data}, nil
+}
+
+// readPacked reads the object at offset in pack, applying deltas against
+// their base objects.
+func (g *gitRepository) readPacked(pack *gitPack, offset int64, depth int) (*gitObject, error) {
+	if depth > 1000 {
+		return nil, fmt.Errorf("delta chain too long")
+	}
+	if offset < 12 || offset >= pack.size {
+		return nil, fmt.Errorf("object offset %d is outside the pack", offset)
+	}
+	// A bufio.Reader is an io.ByteReader, so zlib reads no further than
+	// the object.
+	r := bufio.NewReader(io.NewSectionReader(pack.file, offset, pack.size-offset))
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("truncated object header")
+	}
+	kind := (c >> 4) & 7
+	size := uint64(c & 0x0f)
+	for shift := uint(4); c&0x80 != 0; shift += 7 {
+		if c, err = r.ReadByte(); err != nil || shift > 57 {
+			return nil, fmt.Errorf("truncated object header")
+		}
+		size |= uint64(c&0x7f) << shift
+	}
+	if size >= math.MaxInt64 {
+		return nil, fmt.Errorf("object claims %d bytes", size)
+	}
+
+	var base *gitObject
+	switch kind {
+	case gitPackOfsDelta:
+		c, _ = r.ReadByte()
+		distance := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			c, _ = r.ReadByte()
+			distance = (distance+1)<<7 | int64(c&0x7f)
+		}
+		baseOffset := offset - distance
+		if base = pack.bases[baseOffset]; base == nil {
+			var err error
+			if base, err = g.readPacked(pack, baseOffset, depth+1); err != nil {
+				return nil, err
+			}
+			if len(pack.bases) >= gitPackBaseCache {
+				pack.bases = nil
+			}
+			if pack.bases == nil {
+				pack.bases = make(map[int64]*gitObject)
+			}
+			pack.bases[baseOffset] = base
+		}
+	case gitPackRefDelta:
+		var name [20]byte
+		if _, err := io.ReadFull(r, name[:]); err != nil {
+			return nil, fmt.Errorf("truncated delta")
+		}
+		var err error
+		if base, err = g.readObject(hex.EncodeToString(name[:]), depth+1); err != nil {
+			return nil, err
+		}
+	}
+
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	defer zr.Close()
+	// Reading one byte past the size is enough to tell an object that
+	// decompresses to more than its header says.
+	data, err := io.ReadAll(io.LimitReader(zr, int64(size)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	if uint64(len(data)) != size {
+		return nil, fmt.Errorf("object does not have the %d bytes its header gives", size)
+	}
+	if base != nil {
+		if data, err = applyGitDelta(base.Data, data); err != nil {
+			return nil, err
+		}
+		return &gitObject{Type: base.Type, Data: data}, nil
+	}
+	name, ok := gitPackTypeNames[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown object type %d", kind)
+	}
+	return &gitObject{Type: name, Data: data}, nil
+}
+
+// applyGitDelta rebuilds an object from its base and a git delta: the two
+// sizes, then instructions that either copy a range of the base or insert
+// new bytes.
+func applyGitDelta(base, delta []byte) ([]byte, error) {
+	r := bytes.NewReader(delta)
+	readSize := func() uint64 {
+		var size uint64
+		for shift := uint(0); ; shift += 7 {
+			c, err := r.ReadByte()
+			if err != nil {
+				return size
+			}
+			size |= uint64(c&0x7f) << shift
+			if c&0x80 == 0 {
+				return size
+			}
+		}
+	}
+	if readSize() != uint64(len(base)) {
+		return nil, fmt.Errorf("delta does not match its base")
+	}
+	size := readSize()
+	// Each byte of instructions left yields at most one inserted byte or a
+	// copy of the whole base, so a larger size is damage; checking it
+	// before allocating keeps a bad delta from asking for a huge buffer.
+	most := uint64(len(base))
+	if most == 0 {
+		most = 1
+	}
+	if size > uint64(r.Len())*most {
+		return nil, fmt.Errorf("delta claims %d bytes, more than it can produce", size)
+	}
+	result := make([]byte, 0, size)
+	for r.Len() > 0 {
+		op, _ := r.ReadByte()
+		switch {
+		case op&0x80 != 0:
+			var offset, length uint64
+			for i := uint(0); i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				c, err := r.ReadByte()
+				if err != nil {
+					return nil, fmt.Errorf("truncated delta")
+				}
+				if i < 4 {
+					offset |= uint64(c) << (8 * i)
+				} else {
+					length |= uint64(c) << (8 * (i - 4))
+				}
+			}
+			if length == 0 {
+				length = 0x10000
+			}
+			if offset+length > uint64(len(base)) {
+				return nil, fmt.Errorf("delta copies past the end of its base")
+			}
+			result = append(result, base[offset:offset+length]...)
+		case op != 0:
+			insert := make([]byte, op)
+			if _, err := io.ReadFull(r, insert); err != nil {
+				return nil, fmt.Errorf("truncated delta")
+			}
+			result = append(result, insert...)
+		default:
+			return nil, fmt.Errorf("invalid delta instruction")
+		}
+		if uint64(len(result)) > size {
+			return nil, fmt.Errorf("delta produced the wrong size")
+		}
+	}
+	if uint64(len(result)) != size {
+		return nil, fmt.Errorf("delta produced the wrong size")
+	}
+	return result, nil
+}
+
+// gitObjectHash returns the SHA-1 that names an object in git.
+func gitObjectHash(kind string, data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", kind, len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Write stores an object as a loose object unless the repository has it,
+// and returns its SHA-1.
+func (g *gitRepository) Write(kind string, data []byte) (string, error) {
+	hash := gitObjectHash(kind, data)
+	if g.Has(hash) {
+		return hash, nil
+	}
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	fmt.Fprintf(zw, "%s %d\x00", kind, len(data))
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress git object: %w", err)
+	}
+	path := g.loosePath(hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to write git object: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0444); err != nil {
+		return "", fmt.Errorf("failed to write git object: %w", err)
+	}
+	return hash, nil
+}
+
+// Refs returns the repository's branches and tags by full name, from
+// packed-refs and the loose files under refs/, and the branch HEAD points at.
+func (g *gitRepository) Refs() (map[string]string, string, error) {
+	refs := make(map[string]string)
+	if data, err := os.ReadFile(filepath.Join(g.Dir, "packed-refs")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			// Lines starting with '^' give the commit a tag above points at.
+			if line == "" || line[0] == '#' || line[0] == '^' {
+				continue
+			}
+			if hash, name, ok := strings.Cut(line, " "); ok {
+				refs[name] = hash
+			}
+		}
+	}
+	err := filepath.Walk(filepath.Join(g.Dir, "refs"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(g.Dir, path)
+		if hash := strings.TrimSpace(string(data)); len(hash) == 40 {
+			refs[filepath.ToSlash(rel)] = hash
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", fmt.Errorf("failed to read git references: %w", err)
+	}
+
+	var head string
+	if data, err := os.ReadFile(filepath.Join(g.Dir, "HEAD")); err == nil {
+		head = strings.TrimPrefix(strings.TrimSpace(string(data)), "ref: refs/heads/")
+		if strings.HasPrefix(head, "ref: ") || len(head) == 40 {
+			head = ""
+		}
+	}
+	return refs, head, nil
+}
+
+// UpdateRef points a reference at hash.
+func (g *gitRepository) UpdateRef(name, hash string) error {
+	path := filepath.Join(g.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to write git reference %s: %w", name, err)
+	}
+	if err := os.WriteFile(path, []byte(hash+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write git reference %s: %w", name, err)
+	}
+	return nil
+}
+
+// initGitRepository creates an empty bare git repository at dir whose HEAD
+// points at branch.
+func initGitRepository(dir, branch string) (*gitRepository, error) {
+	for _, sub := range []string{"objects/info", "objects/pack", "refs/heads", "refs/tags"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(sub)), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create git repository: %w", err)
+		}
+	}
+	files := map[string]string{
+		"HEAD":   "ref: refs/heads/" + branch + "\n",
+		"config": "[core]\n\trepositoryformatversion = 0\n\tfilemode = true\n\tbare = true\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return nil, fmt.Errorf("failed to create git repository: %w", err)
+		}
+	}
+	return &gitRepository{Dir: dir}, nil
+}
+
+// gitTreeEntry is one entry of a git tree object.
+type gitTreeEntry struct {
+	Mode string
+	Name string
+	Hash string
+}
+
+// parseGitTree reads the entries of a git tree: "<mode> <name>\0" followed
+// by the 20-byte SHA-1, for each entry.
+func parseGitTree(data []byte) ([]gitTreeEntry, error) {
+	var entries []gitTreeEntry
+	for len(data) > 0 {
+		header, rest, ok := bytes.Cut(data, []byte{0})
+		mode, name, hasName := strings.Cut(string(header), " ")
+		if !ok || !hasName || len(rest) < 20 {
+			return nil, fmt.Errorf("malformed git tree")
+		}
+		entries = append(entries, gitTreeEntry{Mode: mode, Name: name, Hash: hex.EncodeToString(rest[:20])})
+		data = rest[20:]
+	}
+	return entries, nil
+}
+
+// formatGitTree writes a git tree object. Git sorts entries by name,
+// comparing directories as if their name ended in '/'.
+func formatGitTree(entries []gitTreeEntry) []byte {
+	sortKey := func(entry gitTreeEntry) string {
+		if entry.Mode == gitModeTree {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(entries, func(i, j int) bool { return sortKey(entries[i]) < sortKey(entries[j]) })
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		fmt.Fprintf(&buf, "%s %s\x00", entry.Mode, entry.Name)
+		raw, _ := hex.DecodeString(entry.Hash)
+		buf.Write(raw)
+	}
+	return buf.Bytes()
+}
+
+// gitCommit is a parsed git commit or tag: its header fields in order, and
+// the message after the blank line.
+type gitCommit struct {
+	Headers [][2]string
+	Message string
+}
+
+// parseGitCommit splits a commit or tag object into headers and message.
+// Continuation lines, which start with a space, are joined to the header
+// above them, as in signatures.
+func parseGitCommit(data []byte) *gitCommit {
+	commit := &gitCommit{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	headerLen := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		headerLen += len(line) + 1
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, " ") && len(commit.Headers) > 0 {
+			last := &commit.Headers[len(commit.Headers)-1]
+			last[1] += "\n" + line[1:]
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		commit.Headers = append(commit.Headers, [2]string{key, value})
+	}
+	if headerLen < len(data) {
+		commit.Message = string(data[headerLen:])
+	}
+	return commit
+}
+
+// Header returns the first value of a header, or "".
+func (c *gitCommit) Header(key string) string {
+	for _, header := range c.Headers {
+		if header[0] == key {
+			return header[1]
+		}
+	}
+	return ""
+}
+
+// All returns every value of a header, such as each parent of a merge.
+func (c *gitCommit) All(key string) []string {
+	var values []string
+	for _, header := range c.Headers {
+		if header[0] == key {
+			values = append(values, header[1])
+		}
+	}
+	return values
+}
+
+// parseGitIdentity reads "Name <email> <unix seconds> <+hhmm>".
+func parseGitIdentity(value string) (Identity, error) {
+	open, close := strings.LastIndex(value, "<"), strings.LastIndex(value, ">")
+	if open < 0 || close < open {
+		return Identity{}, fmt.Errorf("malformed identity '%s'", value)
+	}
+	identity := Identity{Name: strings.TrimSpace(value[:open]), Email: value[open+1 : close]}
+	fields := strings.Fields(value[close+1:])
+	if len(fields) != 2 || len(fields[1]) != 5 {
+		return Identity{}, fmt.Errorf("malformed date in identity '%s'", value)
+	}
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Identity{}, fmt.Errorf("malformed date in identity '%s'", value)
+	}
+	hours, err1 := strconv.Atoi(fields[1][1:3])
+	minutes, err2 := strconv.Atoi(fields[1][3:])
+	if err1 != nil || err2 != nil {
+		return Identity{}, fmt.Errorf("malformed time zone in identity '%s'", value)
+	}
+	offset := hours*3600 + minutes*60
+	if fields[1][0] == '-' {
+		offset = -offset
+	}
+	identity.When = time.Unix(seconds, 0).In(time.FixedZone("", offset))
+	return identity, nil
+}
+
+// formatGitIdentity writes an identity the way git commits record it.
+func formatGitIdentity(identity Identity) string {
+	_, offset := identity.When.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	return fmt.Sprintf("%s <%s> %d %c%02d%02d", identity.Name, identity.Email, identity.When.Unix(), sign, offset/3600, offset%3600/60)
+}
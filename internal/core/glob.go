@@ -0,0 +1,57 @@
+package core
+
+import (
+	"path"
+	"strings"
+)
+
+// matchPathGlob matches a slash-separated repository path against a pattern
+// using the same rules as .gitignore and .gitattributes:
+//   - a pattern without a slash matches the file name in any directory
+//   - a pattern with a slash is anchored at the repository root
+//   - "**" matches any number of directories, "*" and "?" stay within one
+//   - a trailing "/" matches everything inside that directory
+func matchPathGlob(pattern, filePath string) bool {
+	pattern = strings.TrimPrefix(strings.TrimSpace(pattern), "./")
+	if pattern == "" {
+		return false
+	}
+
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	if dirOnly {
+		pattern += "/**"
+	}
+
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(filePath, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse repeated "**" and try every possible split point.
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				return true
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(rest, parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], parts[0]); err != nil || !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
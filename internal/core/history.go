@@ -7,8 +7,19 @@ import (
 	"time"
 )
 
+// HistoryOptions controls what ShowHistoryWithOptions prints.
+type HistoryOptions struct {
+	// ShowSignature marks each commit as Good, Bad, Unknown-key or Unsigned.
+	ShowSignature bool
+}
+
 // ShowHistory displays the commit log for the repository, walking the parent chain from HEAD.
 func ShowHistory(repo *Repository) error {
+	return ShowHistoryWithOptions(repo, HistoryOptions{})
+}
+
+// ShowHistoryWithOptions displays the commit log like ShowHistory, with extra detail selected by opts.
+func ShowHistoryWithOptions(repo *Repository, opts HistoryOptions) error {
 	storage := NewStorage(repo)
 
 	commitHash, err := ResolveRef(repo, "HEAD")
@@ -34,12 +45,42 @@ func ShowHistory(repo *Repository) error {
 		// FIX: Print the commitHash from the loop, as the unmarshaled commit struct
 		// does not have its unexported 'hash' field populated.
 		fmt.Printf("\033[33mcommit %s\033[0m\n", commitHash) // Yellow for commit hash
+		if opts.ShowSignature {
+			commit.hash = commitHash
+			printSignatureStatus(VerifyCommit(repo, &commit))
+		}
+		if len(commit.MergeParents) > 0 {
+			short := []string{commit.Parent[:8]}
+			for _, parent := range commit.MergeParents {
+				short = append(short, parent[:8])
+			}
+			fmt.Printf("Merge:  %s\n", strings.Join(short, " "))
+		}
 		fmt.Printf("Author: %s <%s>\n", commit.Author, commit.Email)
+		if committer := commit.CommitterIdentity(); !committer.SamePerson(commit.AuthorIdentity()) {
+			fmt.Printf("Commit: %s\n", committer)
+		}
 		fmt.Printf("Date:   %s\n", commit.Timestamp.Format(time.RFC1123Z))
 		fmt.Printf("\n\t%s\n\n", commit.Message)
 
+		if commit.Parent != "" && storage.isShallow(commitHash) {
+			fmt.Println("(older history was not fetched in this shallow clone; run 'zark fetch --deepen <n>' or 'zark fetch --unshallow' to see more)")
+			break
+		}
 		commitHash = commit.Parent
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// printSignatureStatus prints a one-line, colour-coded signature verdict.
+func printSignatureStatus(result SignatureVerification) {
+	switch result.Status {
+	case SignatureGood:
+		fmt.Printf("\033[32mSignature: Good\033[0m (%s from %s)\n", result.Fingerprint, result.Principal)
+	case SignatureUnsigned:
+		fmt.Println("Signature: Unsigned")
+	default:
+		fmt.Printf("\033[31mSignature: %s\033[0m (%s)\n", result.Status, result.Reason)
+	}
+}
@@ -0,0 +1,201 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Hooks Zark runs around its commands. The pre- hooks and commit-msg can
+// stop the command by exiting with a non-zero status.
+const (
+	HookPreAdd       = "pre-add"
+	HookPreSave      = "pre-save"
+	HookCommitMsg    = "commit-msg"
+	HookPostSave     = "post-save"
+	HookPreCheckout  = "pre-checkout"
+	HookPostCheckout = "post-checkout"
+	HookPreReceive   = "pre-receive"  // In the repository being pushed to
+	HookPostReceive  = "post-receive" // In the repository being pushed to
+)
+
+// Environment variables passed to hooks.
+const (
+	EnvHookName      = "ZARK_HOOK"
+	EnvStagedFiles   = "ZARK_STAGED_FILES"   // Newline separated paths relative to the repository root
+	EnvCommitMessage = "ZARK_COMMIT_MESSAGE" // The proposed commit message
+	EnvCommitMsgFile = "ZARK_COMMIT_MSG_FILE"
+	EnvCommitHash    = "ZARK_COMMIT"
+	EnvPusher        = "ZARK_PUSHER" // The 'zark serve' user pushing, if any
+)
+
+// HookInput is what a hook is given besides the repository location.
+type HookInput struct {
+	Args  []string
+	Env   map[string]string
+	Stdin string
+	// Output receives what the hook prints; by default it goes to the
+	// terminal.
+	Output io.Writer
+}
+
+// builtinHooks are checks Zark runs before any user hooks. They are skipped,
+// like every other pre- hook, by --no-verify.
+var builtinHooks = map[string][]struct {
+	Name string
+	Run  func(repo *Repository) error
+}{
+	HookPreSave: {{Name: "secret scan", Run: scanForSecretsIfEnabled}},
+}
+
+func scanForSecretsIfEnabled(repo *Repository) error {
+	if config, err := LoadConfig(repo); err == nil && !config.GetBool("secrets.scan", true) {
+		return nil
+	}
+	return ScanForSecrets(repo)
+}
+
+// HooksDir returns the directory holding hook scripts: core.hookspath if
+// set, otherwise .zark/hooks.
+func HooksDir(repo *Repository) string {
+	if config, err := LoadConfig(repo); err == nil {
+		if dir, ok := config.Get("core.hookspath"); ok && dir != "" {
+			dir = expandHome(dir)
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(repo.Path, dir)
+			}
+			return dir
+		}
+	}
+	return filepath.Join(repo.ZarkDir, "hooks")
+}
+
+// RunHook runs the built-in checks for a hook, then the executable
+// .zark/hooks/<name> if present, then every hook.<name>.command from the
+// configuration. It stops at the first failure.
+func RunHook(repo *Repository, name string, input HookInput) error {
+	for _, builtin := range builtinHooks[name] {
+		if err := builtin.Run(repo); err != nil {
+			return err
+		}
+	}
+
+	var commands []*exec.Cmd
+	script := filepath.Join(HooksDir(repo), name)
+	if isExecutableFile(script) {
+		commands = append(commands, exec.Command(script, input.Args...))
+	}
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return err
+	}
+	for _, command := range config.GetAll("hook." + name + ".command") {
+		commands = append(commands, shellCommand(command, input.Args))
+	}
+
+	for _, cmd := range commands {
+		cmd.Dir = repo.Path
+		cmd.Env = hookEnvironment(repo, name, input.Env)
+		cmd.Stdin = strings.NewReader(input.Stdin)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if input.Output != nil {
+			cmd.Stdout = input.Output
+			cmd.Stderr = input.Output
+		}
+		if err := cmd.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return fmt.Errorf("%s hook failed (exit status %d)", name, exitErr.ExitCode())
+			}
+			return fmt.Errorf("failed to run %s hook: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// shellCommand runs a configured command through the platform shell; args
+// are available as $1, $2, ...
+func shellCommand(command string, args []string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", append([]string{"/C", command}, args...)...)
+	}
+	return exec.Command("sh", append([]string{"-c", command, "sh"}, args...)...)
+}
+
+func hookEnvironment(repo *Repository, name string, extra map[string]string) []string {
+	env := append(os.Environ(), EnvHookName+"="+name, EnvZarkDir+"="+repo.ZarkDir)
+	if !repo.Bare {
+		env = append(env, EnvZarkWorkTree+"="+repo.Path)
+	}
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+extra[key])
+	}
+	return env
+}
+
+func isExecutableFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode()&0111 != 0
+}
+
+// StagedPaths returns the paths whose staged content differs from HEAD,
+// including files removed from the index.
+func StagedPaths(repo *Repository) ([]string, error) {
+	index, err := LoadIndex(repo.IndexPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	head, err := GetHeadTree(repo, NewStorage(repo))
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	staged := make(map[string]bool)
+	for _, entry := range index.Entries {
+		staged[entry.Path] = true
+		headEntry, ok := head[entry.Path]
+		if !ok || headEntry.Hash != entry.Hash || headEntry.Mode != normalizeMode(entry.Mode) {
+			paths = append(paths, entry.Path)
+		}
+	}
+	for path := range head {
+		if !staged[path] {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// fileListInput builds hook input carrying a list of paths both in
+// ZARK_STAGED_FILES and on stdin, one per line.
+func fileListInput(paths []string) HookInput {
+	var list bytes.Buffer
+	for _, path := range paths {
+		list.WriteString(path + "\n")
+	}
+	return HookInput{
+		Env:   map[string]string{EnvStagedFiles: strings.TrimSuffix(list.String(), "\n")},
+		Stdin: list.String(),
+	}
+}
@@ -0,0 +1,251 @@
+package core
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveOverHTTP serves the bare repository over loopback and points repo's
+// origin at it instead of the path.
+func serveOverHTTP(t *testing.T, repo, bare *Repository) string {
+	t.Helper()
+	repos, err := OpenServedRepositories([]string{bare.Path})
+	if err != nil {
+		t.Fatalf("OpenServedRepositories failed: %v", err)
+	}
+	server := httptest.NewServer(NewHTTPServer(repos))
+	t.Cleanup(server.Close)
+	url := server.URL + "/origin"
+	SetConfigValue(repo.ConfigPath, "remote.origin.url", url)
+	return url
+}
+
+func TestPackStream(t *testing.T) {
+	isolateConfig(t)
+	repo, _, cleanup := setupTestRepo(t)
+	defer cleanup()
+	text := strings.Repeat("a line of text that repeats\n", 50)
+	first := commitFile(t, repo, "notes.txt", text)
+	second := commitFile(t, repo, "notes.txt", text+"one more line\n")
+
+	storage := NewStorage(repo)
+	objects, err := missingObjects(storage, func(string) bool { return false }, []string{second})
+	if err != nil {
+		t.Fatalf("missingObjects failed: %v", err)
+	}
+	var pack bytes.Buffer
+	if err := NewObjectPacker(repo).WritePack(&pack, objects); err != nil {
+		t.Fatalf("WritePack failed: %v", err)
+	}
+
+	other := NewBareRepository(filepath.Join(t.TempDir(), "other.zark"))
+	other.Init()
+	count, err := UnpackObjects(NewStorage(other), bytes.NewReader(pack.Bytes()))
+	if err != nil || count != len(objects) {
+		t.Fatalf("Expected %d objects unpacked, got %d %v", len(objects), count, err)
+	}
+	for _, hash := range append(objects, first) {
+		if !NewStorage(other).Has(hash) {
+			t.Errorf("Expected object %s to be unpacked", hash[:8])
+		}
+	}
+
+	damaged := append([]byte(nil), pack.Bytes()...)
+	damaged[len(damaged)-1] ^= 0xff
+	if _, err := UnpackObjects(NewStorage(other), bytes.NewReader(damaged)); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Expected a damaged pack to be refused, got %v", err)
+	}
+	if _, err := UnpackObjects(NewStorage(other), bytes.NewReader(pack.Bytes()[:pack.Len()/2])); err == nil {
+		t.Error("Expected a truncated pack to be refused")
+	}
+	empty := NewBareRepository(filepath.Join(t.TempDir(), "empty.zark"))
+	empty.Init()
+	UnpackObjects(NewStorage(empty), bytes.NewReader(damaged))
+	if NewStorage(empty).Has(second) {
+		t.Error("Expected a damaged pack to store nothing")
+	}
+
+	// A pack that sends a commit first and then fails does not leave the
+	// commit behind without its tree.
+	commitData, _ := storage.Load(second)
+	var broken bytes.Buffer
+	broken.WriteString("PACK\x00\x00\x00\x02\x00\x00\x00\x02")
+	packer := NewObjectPacker(repo)
+	for _, object := range []struct {
+		kind uint8
+		data []byte
+	}{{OBJ_BLOB, commitData}, {OBJ_REF_DELTA, make([]byte, 40)}} {
+		packer.writePackObjectHeader(&broken, object.kind, uint64(len(object.data)))
+		zw := zlib.NewWriter(&broken)
+		zw.Write(object.data)
+		zw.Close()
+	}
+	sum := sha256.Sum256(broken.Bytes())
+	broken.Write(sum[:])
+	if _, err := UnpackObjects(NewStorage(empty), &broken); err == nil || !strings.Contains(err.Error(), "delta base") {
+		t.Errorf("Expected the missing delta base to be reported, got %v", err)
+	}
+	if NewStorage(empty).Has(second) {
+		t.Error("Expected the commit not to be stored without its tree")
+	}
+}
+
+func TestHTTPTransport(t *testing.T) {
+	t.Run("Push, clone and fetch over HTTP send only missing objects", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		bare := setupBareRemote(t, repo)
+		url := serveOverHTTP(t, repo, bare)
+
+		if _, err := Push(repo, "origin", "main", PushOptions{}); err != nil {
+			t.Fatalf("Push failed: %v", err)
+		}
+		head, _ := ResolveRef(repo, "HEAD")
+		if remoteHead, _ := ResolveRef(bare, "main"); remoteHead != head {
+			t.Fatal("Expected the served repository to receive main")
+		}
+
+		cloneDir := filepath.Join(t.TempDir(), "copy")
+		clone, _, err := Clone(url, cloneDir)
+		if err != nil {
+			t.Fatalf("Clone failed: %v", err)
+		}
+		if data, err := os.ReadFile(filepath.Join(cloneDir, "test.txt")); err != nil || string(data) != "hello" {
+			t.Fatalf("Expected the clone to check out test.txt, got %q %v", data, err)
+		}
+
+		var newHead string
+		inDir(t, cloneDir, func() {
+			newHead = commitFile(t, clone, "notes.txt", "from the clone")
+			result, err := Push(clone, "origin", "main", PushOptions{})
+			if err != nil {
+				t.Fatalf("Push from the clone failed: %v", err)
+			}
+			if result.Objects != 3 {
+				t.Errorf("Expected only the 3 new objects to be sent, got %d", result.Objects)
+			}
+		})
+
+		fetched, err := Fetch(repo, "origin")
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		if fetched.Objects != 3 {
+			t.Errorf("Expected only the 3 new objects to be fetched, got %d", fetched.Objects)
+		}
+		if tracking, _ := ResolveRef(repo, "origin/main"); tracking != newHead {
+			t.Error("Expected origin/main to move to the clone's commit")
+		}
+	})
+
+	t.Run("Rejections come back readable", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		bare := setupBareRemote(t, repo)
+		url := serveOverHTTP(t, repo, bare)
+		Push(repo, "origin", "main", PushOptions{})
+
+		// Move the remote branch behind the client's back.
+		other := commitFile(t, repo, "other.txt", "other")
+		ReceiveRefUpdates(bare, []RefUpdate{{Name: "refs/heads/main", New: other, Force: true}})
+		copyMissingObjects(NewStorage(repo), NewStorage(bare), []string{other})
+
+		conn, _ := connectRemote(&Remote{Name: "origin", URL: url})
+		head, _ := ResolveRef(repo, "HEAD")
+		_, err := conn.Push(repo, []RefUpdate{{Name: "refs/heads/main", Old: strings.Repeat("0", 64), New: head}})
+		if err == nil || !strings.Contains(err.Error(), "fetch first") {
+			t.Errorf("Expected a stale push to be rejected with a reason, got %v", err)
+		}
+
+		if _, _, err := Clone(strings.TrimSuffix(url, "origin")+"missing", filepath.Join(t.TempDir(), "none")); err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("Expected an unknown repository to be reported, got %v", err)
+		}
+	})
+
+	t.Run("Only referenced objects are served and only valid names are taken", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		bare := setupBareRemote(t, repo)
+		url := serveOverHTTP(t, repo, bare)
+		Push(repo, "origin", "main", PushOptions{})
+
+		// A commit the server has but no branch or tag reaches.
+		dropped := commitFile(t, repo, "secret.txt", "secret")
+		copyMissingObjects(NewStorage(repo), NewStorage(bare), []string{dropped})
+		conn, _ := connectRemote(&Remote{Name: "origin", URL: url})
+		local := NewBareRepository(filepath.Join(t.TempDir(), "local.zark"))
+		local.Init()
+		if _, err := conn.Fetch(local, fetchRequest{Objects: []string{dropped}}); err == nil || !strings.Contains(err.Error(), "no object") {
+			t.Errorf("Expected an unreferenced object to be refused, got %v", err)
+		}
+		if _, err := conn.Fetch(local, fetchRequest{Wants: []string{dropped}}); err == nil {
+			t.Error("Expected an unreferenced commit to be refused")
+		}
+
+		hostile := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"refs":{"refs/heads/../../../escaped":%q},"head":"../../escaped"}`, dropped)
+		}))
+		defer hostile.Close()
+		SetConfigValue(repo.ConfigPath, "remote.origin.url", hostile.URL+"/origin")
+		// The hostile remote has no main, so only origin/main goes away.
+		fetched, err := Fetch(repo, "origin")
+		if err != nil || len(fetched.Updates) != 1 || fetched.Updates[0].New != "" || fetched.Head != "" {
+			t.Errorf("Expected invalid names to be dropped, got %+v %v", fetched, err)
+		}
+		if _, err := os.Stat(filepath.Join(repo.Path, "escaped")); !os.IsNotExist(err) {
+			t.Error("Expected nothing to be written outside refs/")
+		}
+	})
+
+	t.Run("References only move to history that fully arrived", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		bare := setupBareRemote(t, repo)
+		Push(repo, "origin", "main", PushOptions{})
+		head, _ := ResolveRef(repo, "HEAD")
+
+		// Only the commit arrives, without its tree, blob or parent.
+		tip := commitFile(t, repo, "more.txt", "more")
+		copyObjects(NewStorage(repo), NewStorage(bare), []string{tip})
+		err := ReceiveRefUpdates(bare, []RefUpdate{{Name: "refs/heads/main", Old: head, New: tip}})
+		if err == nil || !strings.Contains(err.Error(), "did not all arrive") {
+			t.Errorf("Expected an incomplete push to be refused, got %v", err)
+		}
+		if moved, _ := ResolveRef(bare, "refs/heads/main"); moved != head {
+			t.Error("Expected the remote branch to stay put")
+		}
+
+		// A server that sends the commit alone does not move origin/main.
+		var pack bytes.Buffer
+		NewObjectPacker(repo).WritePack(&pack, []string{tip})
+		hostile := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "upload-pack") {
+				w.Write(pack.Bytes())
+				return
+			}
+			fmt.Fprintf(w, `{"refs":{"refs/heads/main":%q},"head":"main"}`, tip)
+		}))
+		defer hostile.Close()
+		local := NewBareRepository(filepath.Join(t.TempDir(), "local.zark"))
+		local.Init()
+		AddRemote(local, "origin", hostile.URL+"/origin")
+		if _, err := Fetch(local, "origin"); err == nil || !strings.Contains(err.Error(), "did not send everything") {
+			t.Errorf("Expected an incomplete fetch to be refused, got %v", err)
+		}
+		if _, err := ResolveRef(local, "refs/remotes/origin/main"); err == nil {
+			t.Error("Expected origin/main not to be created")
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables that override the identities recorded on a commit.
+const (
+	EnvAuthorName     = "ZARK_AUTHOR_NAME"
+	EnvAuthorEmail    = "ZARK_AUTHOR_EMAIL"
+	EnvAuthorDate     = "ZARK_AUTHOR_DATE"
+	EnvCommitterName  = "ZARK_COMMITTER_NAME"
+	EnvCommitterEmail = "ZARK_COMMITTER_EMAIL"
+	EnvCommitterDate  = "ZARK_COMMITTER_DATE"
+)
+
+// Identity is a person together with the moment they acted, kept in their own timezone.
+type Identity struct {
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	When  time.Time `json:"when"`
+}
+
+// String formats the identity as "Name <email>".
+func (i Identity) String() string {
+	return fmt.Sprintf("%s <%s>", i.Name, i.Email)
+}
+
+// SamePerson reports whether two identities name the same person, ignoring time.
+func (i Identity) SamePerson(other Identity) bool {
+	return i.Name == other.Name && strings.EqualFold(i.Email, other.Email)
+}
+
+// ParseIdentity parses "Name <email>". The When field is left zero.
+func ParseIdentity(s string) (Identity, error) {
+	s = strings.TrimSpace(s)
+	open := strings.LastIndex(s, "<")
+	if open < 0 || !strings.HasSuffix(s, ">") {
+		return Identity{}, fmt.Errorf("invalid identity '%s': expected \"Name <email>\"", s)
+	}
+
+	name := strings.TrimSpace(s[:open])
+	email := strings.TrimSpace(s[open+1 : len(s)-1])
+	if name == "" || email == "" {
+		return Identity{}, fmt.Errorf("invalid identity '%s': both a name and an email are required", s)
+	}
+	return Identity{Name: name, Email: email}, nil
+}
+
+// dateLayouts are the absolute formats accepted by ParseDate.
+var dateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon Jan 2 15:04:05 2006 -0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseDate parses a date given on the command line or in the environment.
+// It accepts "now", RFC 3339 and RFC 1123 dates, "YYYY-MM-DD[ HH:MM[:SS]] [zone]"
+// and raw "<unix-seconds> <+zzzz>" timestamps (optionally prefixed with '@').
+// Dates without a zone are interpreted in the local timezone.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "now" {
+		return time.Now(), nil
+	}
+
+	if t, ok := parseRawDate(s); ok {
+		return t, nil
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s': try a format like '2024-03-01 14:30:00 +0100'", s)
+}
+
+// parseRawDate handles "<unix> <+zzzz>" and "@<unix>" forms.
+func parseRawDate(s string) (time.Time, bool) {
+	fields := strings.Fields(strings.TrimPrefix(s, "@"))
+	if len(fields) == 0 || len(fields) > 2 {
+		return time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	// A bare number is only a timestamp when marked with '@'; otherwise it
+	// could just as well be a malformed date.
+	if len(fields) == 1 && !strings.HasPrefix(s, "@") {
+		return time.Time{}, false
+	}
+
+	t := time.Unix(seconds, 0).UTC()
+	if len(fields) == 2 {
+		zone, err := time.Parse("-0700", fields[1])
+		if err != nil {
+			return time.Time{}, false
+		}
+		_, offset := zone.Zone()
+		t = t.In(time.FixedZone("", offset))
+	}
+	return t, true
+}
+
+// resolveIdentity builds an identity from environment overrides, then config,
+// then the operating system account. The date comes from dateVar or now.
+func resolveIdentity(config *Config, nameVar, emailVar, dateVar string) (Identity, error) {
+	identity := Identity{Name: config.User.Name, Email: config.User.Email}
+	if name := os.Getenv(nameVar); name != "" {
+		identity.Name = name
+	}
+	if email := os.Getenv(emailVar); email != "" {
+		identity.Email = email
+	}
+
+	when, err := ParseDate(os.Getenv(dateVar))
+	if err != nil {
+		return Identity{}, fmt.Errorf("%s: %w", dateVar, err)
+	}
+	identity.When = when
+	return identity, nil
+}
+
+// guessIdentity fills in a missing name or email from the operating system account.
+func guessIdentity(name, email string) (string, string) {
+	login := "zark"
+	if u, err := user.Current(); err == nil {
+		login = u.Username
+		if name == "" && u.Name != "" {
+			name = u.Name
+		}
+	}
+	if name == "" {
+		name = login
+	}
+	if email == "" {
+		host, err := os.Hostname()
+		if err != nil || host == "" {
+			host = "localhost"
+		}
+		email = login + "@" + host
+	}
+	return name, email
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// loadCommit reads a commit object from storage.
+func loadCommit(t *testing.T, repo *Repository, hash string) *Commit {
+	t.Helper()
+	data, err := NewStorage(repo).Load(hash)
+	if err != nil {
+		t.Fatalf("Failed to load commit %s: %v", hash, err)
+	}
+	var commit Commit
+	if err := json.Unmarshal(data, &commit); err != nil {
+		t.Fatalf("Failed to unmarshal commit %s: %v", hash, err)
+	}
+	commit.hash = hash
+	return &commit
+}
+
+func TestCommitIdentities(t *testing.T) {
+	t.Run("Parse identities and dates", func(t *testing.T) {
+		identity, err := ParseIdentity("Ada Lovelace <ada@example.com>")
+		if err != nil {
+			t.Fatalf("ParseIdentity failed: %v", err)
+		}
+		if identity.Name != "Ada Lovelace" || identity.Email != "ada@example.com" {
+			t.Errorf("Unexpected identity: %+v", identity)
+		}
+		if _, err := ParseIdentity("no email here"); err == nil {
+			t.Error("Expected ParseIdentity to reject a value without an email")
+		}
+
+		when, err := ParseDate("2024-03-01 14:30:00 +0100")
+		if err != nil {
+			t.Fatalf("ParseDate failed: %v", err)
+		}
+		if _, offset := when.Zone(); offset != 3600 {
+			t.Errorf("Expected the +0100 timezone to be kept, got offset %d", offset)
+		}
+
+		raw, err := ParseDate("1700000000 -0500")
+		if err != nil {
+			t.Fatalf("ParseDate failed for a raw timestamp: %v", err)
+		}
+		if _, offset := raw.Zone(); raw.Unix() != 1700000000 || offset != -5*3600 {
+			t.Errorf("Unexpected raw date: %v", raw)
+		}
+	})
+
+	t.Run("Author and committer are recorded separately", func(t *testing.T) {
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		t.Setenv(EnvCommitterName, "Committer")
+		t.Setenv(EnvCommitterEmail, "committer@example.com")
+
+		os.WriteFile("patch.txt", []byte("contributed"), 0644)
+		AddFiles(repo, []string{"patch.txt"})
+
+		authorDate, _ := ParseDate("2020-01-02 03:04:05 +0530")
+		hash, err := CreateCommitWithOptions(repo, CommitOptions{
+			Message:    "Apply contributed patch",
+			Author:     &Identity{Name: "Contributor", Email: "contrib@example.com"},
+			AuthorDate: authorDate,
+		})
+		if err != nil {
+			t.Fatalf("CreateCommitWithOptions failed: %v", err)
+		}
+
+		commit := loadCommit(t, repo, hash)
+		author := commit.AuthorIdentity()
+		if author.Name != "Contributor" || !author.When.Equal(authorDate) {
+			t.Errorf("Unexpected author: %+v", author)
+		}
+		if _, offset := author.When.Zone(); offset != 5*3600+30*60 {
+			t.Errorf("Expected the author timezone to survive a round trip, got offset %d", offset)
+		}
+		committer := commit.CommitterIdentity()
+		if committer.Name != "Committer" || committer.Email != "committer@example.com" {
+			t.Errorf("Unexpected committer: %+v", committer)
+		}
+	})
+
+	t.Run("Trailers and co-authors", func(t *testing.T) {
+		message := "Fix the parser\n\nIt choked on empty input.\n\n" +
+			"Co-authored-by: Grace Hopper <grace@example.com>\n" +
+			"Signed-off-by: Ada Lovelace <ada@example.com>\n" +
+			"Reviewed-by: Alan Turing\n  <alan@example.com>"
+		commit := &Commit{Author: "Ada Lovelace", Email: "ada@example.com", Message: message}
+
+		trailers := commit.Trailers()
+		if len(trailers) != 3 {
+			t.Fatalf("Expected 3 trailers, got %+v", trailers)
+		}
+		if trailers[2].Key != TrailerReviewedBy || trailers[2].Value != "Alan Turing <alan@example.com>" {
+			t.Errorf("Expected a folded Reviewed-by trailer, got %+v", trailers[2])
+		}
+
+		coAuthors := commit.CoAuthors()
+		if len(coAuthors) != 1 || coAuthors[0].Email != "grace@example.com" {
+			t.Errorf("Unexpected co-authors: %+v", coAuthors)
+		}
+
+		if got := ParseTrailers("Subject: looks like a trailer"); got != nil {
+			t.Errorf("The subject line must not be parsed as a trailer, got %+v", got)
+		}
+	})
+
+	t.Run("Search by author matches co-authors", func(t *testing.T) {
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		os.WriteFile("pair.txt", []byte("paired"), 0644)
+		AddFiles(repo, []string{"pair.txt"})
+		_, err := CreateCommitWithOptions(repo, CommitOptions{
+			Message:   "Pair on the importer",
+			Author:    &Identity{Name: "Driver", Email: "driver@example.com"},
+			CoAuthors: []Identity{{Name: "Navigator", Email: "navigator@example.com"}},
+		})
+		if err != nil {
+			t.Fatalf("CreateCommitWithOptions failed: %v", err)
+		}
+
+		results, err := SearchCommits(repo, "", "Navigator", "")
+		if err != nil {
+			t.Fatalf("SearchCommits failed: %v", err)
+		}
+		if len(results) != 1 || results[0].Author != "Driver" {
+			t.Errorf("Expected the co-authored commit to be found, got %d results", len(results))
+		}
+	})
+}
@@ -1,28 +1,240 @@
 package core
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 // TrackLFS adds a pattern to the LFS tracking file, which is named .zarkattributes.
+// Tracking a pattern that is already tracked leaves the file unchanged.
 func TrackLFS(repo *Repository, pattern string) error {
+	attributes, err := LoadAttributes(repo)
+	if err != nil {
+		return err
+	}
+	for _, tracked := range LFSTrackedPatterns(attributes) {
+		if tracked == pattern {
+			fmt.Printf("'%s' is already tracked.\n", pattern)
+			return nil
+		}
+	}
+
 	// The .zarkattributes file should be in the root of the working directory, not in .zark
-	lfsFilePath := filepath.Join(repo.Path, ".zarkattributes")
+	lfsFilePath := filepath.Join(repo.Path, AttributesFile)
+	existing, err := os.ReadFile(lfsFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read .zarkattributes: %w", err)
+	}
 	f, err := os.OpenFile(lfsFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open .zarkattributes: %w", err)
 	}
 	defer f.Close()
 
-	// This line mimics Git's LFS configuration for a given file pattern.
-	// It tells Zark to use the 'lfs' filter for this pattern.
-	lfsLine := fmt.Sprintf("%s filter=lfs diff=lfs merge=lfs -text", pattern)
+	lfsLine := lfsAttributesLine(pattern)
+	if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		lfsLine = "\n" + lfsLine
+	}
 	if _, err := f.WriteString(lfsLine + "\n"); err != nil {
 		return fmt.Errorf("failed to write to .zarkattributes: %w", err)
 	}
 
 	fmt.Printf("Tracking '%s' for large file storage.\n", pattern)
 	return nil
-}
\ No newline at end of file
+}
+
+// lfsAttributesLine mimics Git's LFS configuration for a given file pattern.
+// It tells Zark to use the 'lfs' filter for this pattern.
+func lfsAttributesLine(pattern string) string {
+	return fmt.Sprintf("%s filter=lfs diff=lfs merge=lfs -text", pattern)
+}
+
+// LFSTrackedPatterns returns the patterns that set filter=lfs, in file order.
+func LFSTrackedPatterns(attributes *Attributes) []string {
+	var patterns []string
+	for _, rule := range attributes.Rules {
+		if rule.Attrs["filter"] == "lfs" {
+			patterns = append(patterns, rule.Pattern)
+		}
+	}
+	return patterns
+}
+
+// UntrackLFS removes the lines that track pattern with LFS from
+// .zarkattributes. Files already committed as pointers stay pointers until
+// they are added again.
+func UntrackLFS(repo *Repository, pattern string) error {
+	lfsFilePath := filepath.Join(repo.Path, AttributesFile)
+	data, err := os.ReadFile(lfsFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read .zarkattributes: %w", err)
+	}
+
+	var kept []string
+	removed := false
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		rules := ParseAttributes([]byte(line)).Rules
+		if len(rules) == 1 && rules[0].Pattern == pattern && rules[0].Attrs["filter"] == "lfs" {
+			removed = true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if !removed {
+		return fmt.Errorf("'%s' is not tracked by LFS", pattern)
+	}
+	if err := os.WriteFile(lfsFilePath, []byte(strings.Join(kept, "")), 0644); err != nil {
+		return fmt.Errorf("failed to write to .zarkattributes: %w", err)
+	}
+
+	fmt.Printf("Stopped tracking '%s'.\n", pattern)
+	return nil
+}
+
+// LFSPointerVersion identifies the pointer format, which is the same as Git LFS's.
+const LFSPointerVersion = "https://git-lfs.github.com/spec/v1"
+
+// maxLFSPointerSize bounds how large a blob may be and still be a pointer.
+const maxLFSPointerSize = 1024
+
+// LFSPointer is the small blob committed in place of a large file. It names
+// the file's content by its sha256 object ID and records its size.
+type LFSPointer struct {
+	OID  string
+	Size int64
+}
+
+// Bytes returns the pointer in its canonical text form.
+func (p LFSPointer) Bytes() []byte {
+	return []byte(fmt.Sprintf("version %s\noid sha256:%s\nsize %d\n", LFSPointerVersion, p.OID, p.Size))
+}
+
+// ParseLFSPointer recognises pointer blobs. It returns false for anything
+// that is not exactly a pointer, so ordinary files are never mistaken for one.
+func ParseLFSPointer(data []byte) (LFSPointer, bool) {
+	if len(data) > maxLFSPointerSize {
+		return LFSPointer{}, false
+	}
+	var p LFSPointer
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) < 3 || lines[0] != "version "+LFSPointerVersion {
+		return LFSPointer{}, false
+	}
+	for _, line := range lines[1:] {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			return LFSPointer{}, false
+		}
+		switch key {
+		case "oid":
+			oid, ok := strings.CutPrefix(value, "sha256:")
+			if !ok || len(oid) != 64 {
+				return LFSPointer{}, false
+			}
+			if _, err := hex.DecodeString(oid); err != nil {
+				return LFSPointer{}, false
+			}
+			p.OID = oid
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return LFSPointer{}, false
+			}
+			p.Size = size
+		}
+	}
+	if p.OID == "" {
+		return LFSPointer{}, false
+	}
+	return p, true
+}
+
+// NewLFSPointer returns the pointer for content without storing anything.
+func NewLFSPointer(content []byte) LFSPointer {
+	sum := sha256.Sum256(content)
+	return LFSPointer{OID: hex.EncodeToString(sum[:]), Size: int64(len(content))}
+}
+
+// LFSObjectsDir returns the local store of large file contents.
+func LFSObjectsDir(repo *Repository) string {
+	return filepath.Join(repo.ZarkDir, "lfs", "objects")
+}
+
+// LFSObjectPath returns where the content with the given oid is kept.
+func LFSObjectPath(repo *Repository, oid string) string {
+	return filepath.Join(LFSObjectsDir(repo), oid)
+}
+
+// HasLFSObject reports whether the content for oid is in the local store.
+func HasLFSObject(repo *Repository, oid string) bool {
+	_, err := os.Stat(LFSObjectPath(repo, oid))
+	return err == nil
+}
+
+// StoreLFSObject moves content into the local LFS store and returns its pointer.
+// The file is written under a temporary name first so that an interrupted
+// write never leaves a corrupt object behind.
+func StoreLFSObject(repo *Repository, content []byte) (LFSPointer, error) {
+	pointer := NewLFSPointer(content)
+	path := LFSObjectPath(repo, pointer.OID)
+	if _, err := os.Stat(path); err == nil {
+		return pointer, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return LFSPointer{}, fmt.Errorf("failed to create LFS object directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "incoming-*")
+	if err != nil {
+		return LFSPointer{}, fmt.Errorf("failed to store LFS object: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return LFSPointer{}, fmt.Errorf("failed to store LFS object: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return LFSPointer{}, fmt.Errorf("failed to store LFS object: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return LFSPointer{}, fmt.Errorf("failed to store LFS object: %w", err)
+	}
+	return pointer, nil
+}
+
+// lfsClean is the filter applied when a file tracked by LFS is added: the
+// content goes into the LFS store and the pointer is what gets staged.
+// Content that already is a pointer is staged unchanged.
+func lfsClean(repo *Repository, content []byte) ([]byte, error) {
+	if _, ok := ParseLFSPointer(content); ok {
+		return content, nil
+	}
+	pointer, err := StoreLFSObject(repo, content)
+	if err != nil {
+		return nil, err
+	}
+	return pointer.Bytes(), nil
+}
+
+// lfsSmudge is the filter applied on checkout: it replaces a pointer with
+// the content it names. If the content has not been downloaded yet, the
+// pointer itself is written and ok is false.
+func lfsSmudge(repo *Repository, pointerData []byte) (content []byte, ok bool, err error) {
+	pointer, isPointer := ParseLFSPointer(pointerData)
+	if !isPointer {
+		return pointerData, true, nil
+	}
+	content, err = os.ReadFile(LFSObjectPath(repo, pointer.OID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return pointerData, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to read LFS object %s: %w", pointer.OID, err)
+	}
+	return content, true, nil
+}
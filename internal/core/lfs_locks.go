@@ -0,0 +1,446 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LFSLockOwner is the user holding a lock, as named by the server.
+type LFSLockOwner struct {
+	Name string `json:"name"`
+}
+
+// LFSLock is a lock on one path, as returned by the LFS locking API.
+type LFSLock struct {
+	ID       string        `json:"id"`
+	Path     string        `json:"path"`
+	LockedAt time.Time     `json:"locked_at"`
+	Owner    *LFSLockOwner `json:"owner,omitempty"`
+}
+
+// OwnerName returns the name of the lock's owner, or "someone" if unknown.
+func (l LFSLock) OwnerName() string {
+	if l.Owner == nil || l.Owner.Name == "" {
+		return "someone"
+	}
+	return l.Owner.Name
+}
+
+// LFSLockRef names the branch a lock request applies to.
+type LFSLockRef struct {
+	Name string `json:"name"`
+}
+
+type lfsCreateLockRequest struct {
+	Path string      `json:"path"`
+	Ref  *LFSLockRef `json:"ref,omitempty"`
+}
+
+type lfsUnlockRequest struct {
+	Force bool        `json:"force,omitempty"`
+	Ref   *LFSLockRef `json:"ref,omitempty"`
+}
+
+type lfsLockResponse struct {
+	Lock    *LFSLock `json:"lock,omitempty"`
+	Message string   `json:"message,omitempty"`
+}
+
+type lfsLockListResponse struct {
+	Locks      []LFSLock `json:"locks"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	Message    string    `json:"message,omitempty"`
+}
+
+type lfsVerifyLocksRequest struct {
+	Ref    *LFSLockRef `json:"ref,omitempty"`
+	Cursor string      `json:"cursor,omitempty"`
+	Limit  int         `json:"limit,omitempty"`
+}
+
+// LFSVerifyLocksResponse splits the locks into those held by the
+// authenticated user and those held by everyone else.
+type LFSVerifyLocksResponse struct {
+	Ours       []LFSLock `json:"ours"`
+	Theirs     []LFSLock `json:"theirs"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	Message    string    `json:"message,omitempty"`
+}
+
+// lockAPI sends a locking API request and decodes the JSON reply into out.
+// It returns the HTTP status so callers can tell conflicts from failures.
+func (c *LFSClient) lockAPI(method, path string, body, out interface{}) (int, error) {
+	var payload []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode lock request: %w", err)
+		}
+		payload = data
+	}
+	req, err := http.NewRequest(method, c.Endpoint+path, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	for key, values := range c.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	if body != nil {
+		req.Header.Set("Content-Type", lfsMediaType)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to contact LFS server: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && resp.StatusCode < 300 {
+		return resp.StatusCode, fmt.Errorf("failed to decode LFS server response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// lockError turns an unexpected locking API status into a readable error.
+func lockError(action string, status int, message string) error {
+	if message != "" {
+		return fmt.Errorf("LFS server refused to %s: %s (HTTP %d)", action, message, status)
+	}
+	return fmt.Errorf("LFS server refused to %s (HTTP %d)", action, status)
+}
+
+// Lock asks the server to lock path for the authenticated user. If someone
+// else holds the lock, the error names them.
+func (c *LFSClient) Lock(path string, ref *LFSLockRef) (*LFSLock, error) {
+	var resp lfsLockResponse
+	status, err := c.lockAPI(http.MethodPost, "/locks", lfsCreateLockRequest{Path: path, Ref: ref}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case status == http.StatusConflict && resp.Lock != nil:
+		return nil, fmt.Errorf("'%s' is already locked by %s", path, resp.Lock.OwnerName())
+	case status != http.StatusCreated && status != http.StatusOK:
+		return nil, lockError("lock '"+path+"'", status, resp.Message)
+	case resp.Lock == nil:
+		return nil, fmt.Errorf("LFS server did not return the new lock")
+	}
+	return resp.Lock, nil
+}
+
+// Unlock releases the lock with the given id. Force releases a lock held by
+// someone else, if the server allows it.
+func (c *LFSClient) Unlock(id string, force bool, ref *LFSLockRef) (*LFSLock, error) {
+	var resp lfsLockResponse
+	status, err := c.lockAPI(http.MethodPost, "/locks/"+url.PathEscape(id)+"/unlock", lfsUnlockRequest{Force: force, Ref: ref}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, lockError("unlock", status, resp.Message)
+	}
+	return resp.Lock, nil
+}
+
+// Locks lists the locks on the server, only those on path if it is set.
+func (c *LFSClient) Locks(path string) ([]LFSLock, error) {
+	var locks []LFSLock
+	cursor := ""
+	for {
+		query := url.Values{}
+		if path != "" {
+			query.Set("path", path)
+		}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		var resp lfsLockListResponse
+		status, err := c.lockAPI(http.MethodGet, "/locks?"+query.Encode(), nil, &resp)
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusOK {
+			return nil, lockError("list locks", status, resp.Message)
+		}
+		locks = append(locks, resp.Locks...)
+		if resp.NextCursor == "" {
+			return locks, nil
+		}
+		cursor = resp.NextCursor
+	}
+}
+
+// VerifyLocks lists every lock, split into ours and theirs.
+func (c *LFSClient) VerifyLocks(ref *LFSLockRef) (*LFSVerifyLocksResponse, error) {
+	result := &LFSVerifyLocksResponse{}
+	cursor := ""
+	for {
+		var resp LFSVerifyLocksResponse
+		status, err := c.lockAPI(http.MethodPost, "/locks/verify", lfsVerifyLocksRequest{Ref: ref, Cursor: cursor}, &resp)
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusOK {
+			return nil, lockError("verify locks", status, resp.Message)
+		}
+		result.Ours = append(result.Ours, resp.Ours...)
+		result.Theirs = append(result.Theirs, resp.Theirs...)
+		if resp.NextCursor == "" {
+			return result, nil
+		}
+		cursor = resp.NextCursor
+	}
+}
+
+// IsLockable reports whether path is marked lockable, so that it is checked
+// out read-only until its user locks it.
+func (a *Attributes) IsLockable(path string) bool {
+	value, _ := a.Get(path, "lockable")
+	return value == "true"
+}
+
+// lfsLocksPath caches the locks we hold, so checkout can tell which
+// lockable files to leave writable without asking the server.
+func lfsLocksPath(repo *Repository) string {
+	return filepath.Join(repo.ZarkDir, "lfs", "locks.json")
+}
+
+// LoadOwnLFSLocks returns the cached locks held by us, keyed by path.
+func LoadOwnLFSLocks(repo *Repository) (map[string]LFSLock, error) {
+	locks := make(map[string]LFSLock)
+	data, err := os.ReadFile(lfsLocksPath(repo))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return locks, nil
+		}
+		return nil, fmt.Errorf("failed to read LFS locks: %w", err)
+	}
+	if err := json.Unmarshal(data, &locks); err != nil {
+		return nil, fmt.Errorf("failed to parse LFS locks: %w", err)
+	}
+	return locks, nil
+}
+
+func saveOwnLFSLocks(repo *Repository, locks map[string]LFSLock) error {
+	data, err := json.MarshalIndent(locks, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(lfsLocksPath(repo)), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(lfsLocksPath(repo), data, 0644); err != nil {
+		return fmt.Errorf("failed to save LFS locks: %w", err)
+	}
+	return nil
+}
+
+// currentLockRef returns the branch lock requests apply to.
+func currentLockRef(repo *Repository) *LFSLockRef {
+	branch, err := CurrentBranch(repo)
+	if err != nil || branch == "" {
+		return nil
+	}
+	return &LFSLockRef{Name: "refs/heads/" + branch}
+}
+
+// setWorkingFileWritable makes a working file writable or read-only without
+// touching its other permission bits. Missing files are ignored.
+func setWorkingFileWritable(repo *Repository, path string, writable bool) error {
+	fullPath := filepath.Join(repo.Path, filepath.FromSlash(path))
+	info, err := os.Lstat(fullPath)
+	if err != nil || info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	perm := info.Mode().Perm()
+	if writable {
+		perm |= 0200
+	} else {
+		perm &^= 0222
+	}
+	if err := os.Chmod(fullPath, perm); err != nil {
+		return fmt.Errorf("failed to change permissions of %s: %w", path, err)
+	}
+	return nil
+}
+
+// LockLFSFile locks path, given relative to the current directory, on the
+// LFS server and makes the working file writable.
+func LockLFSFile(repo *Repository, path string) (*LFSLock, error) {
+	relPath, err := repo.RelativePath(path)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewLFSClient(repo)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := client.Lock(relPath, currentLockRef(repo))
+	if err != nil {
+		return nil, err
+	}
+
+	own, err := LoadOwnLFSLocks(repo)
+	if err != nil {
+		return nil, err
+	}
+	own[lock.Path] = *lock
+	if err := saveOwnLFSLocks(repo, own); err != nil {
+		return nil, err
+	}
+	if !repo.Bare {
+		if err := setWorkingFileWritable(repo, lock.Path, true); err != nil {
+			return nil, err
+		}
+	}
+	return lock, nil
+}
+
+// UnlockLFSFile releases the lock on path, given relative to the current
+// directory, or the lock with the given id when path is empty. A lockable
+// working file becomes read-only again.
+func UnlockLFSFile(repo *Repository, path, id string, force bool) (*LFSLock, error) {
+	client, err := NewLFSClient(repo)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		relPath, err := repo.RelativePath(path)
+		if err != nil {
+			return nil, err
+		}
+		locks, err := client.Locks(relPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, lock := range locks {
+			if lock.Path == relPath {
+				id = lock.ID
+			}
+		}
+		if id == "" {
+			return nil, fmt.Errorf("'%s' is not locked", relPath)
+		}
+	}
+
+	lock, err := client.Unlock(id, force, currentLockRef(repo))
+	if err != nil {
+		return nil, err
+	}
+
+	own, err := LoadOwnLFSLocks(repo)
+	if err != nil {
+		return nil, err
+	}
+	for ownPath, ownLock := range own {
+		if ownLock.ID == id {
+			delete(own, ownPath)
+			path = ownPath
+		}
+	}
+	if lock != nil {
+		path = lock.Path
+	}
+	if err := saveOwnLFSLocks(repo, own); err != nil {
+		return nil, err
+	}
+
+	if !repo.Bare && path != "" {
+		attributes, err := LoadAttributes(repo)
+		if err != nil {
+			return nil, err
+		}
+		if attributes.IsLockable(path) {
+			if err := setWorkingFileWritable(repo, path, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return lock, nil
+}
+
+// ListLFSLocks returns the locks on the server, sorted by path, along with
+// the ids of those held by us. The local cache of our locks is refreshed.
+func ListLFSLocks(repo *Repository) ([]LFSLock, map[string]bool, error) {
+	client, err := NewLFSClient(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	verified, err := client.VerifyLocks(currentLockRef(repo))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ours := make(map[string]bool)
+	own := make(map[string]LFSLock)
+	for _, lock := range verified.Ours {
+		ours[lock.ID] = true
+		own[lock.Path] = lock
+	}
+	if err := saveOwnLFSLocks(repo, own); err != nil {
+		return nil, nil, err
+	}
+
+	locks := append(append([]LFSLock(nil), verified.Ours...), verified.Theirs...)
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Path < locks[j].Path })
+	return locks, ours, nil
+}
+
+// checkLFSLocks refuses to save changes to lockable files locked by someone
+// else. It does nothing unless a staged lockable file changed and an LFS
+// server is configured; if the server cannot be reached, it only warns.
+func checkLFSLocks(repo *Repository, staged []string) error {
+	attributes, err := LoadAttributes(repo)
+	if err != nil {
+		return err
+	}
+	var lockable []string
+	for _, path := range staged {
+		if attributes.IsLockable(path) {
+			lockable = append(lockable, path)
+		}
+	}
+	if len(lockable) == 0 {
+		return nil
+	}
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return err
+	}
+	if config.GetString("lfs.url", "") == "" {
+		return nil
+	}
+
+	client, err := NewLFSClient(repo)
+	if err != nil {
+		return err
+	}
+	verified, err := client.VerifyLocks(currentLockRef(repo))
+	if err != nil {
+		fmt.Printf("warning: could not check LFS locks: %v\n", err)
+		return nil
+	}
+	theirs := make(map[string]LFSLock)
+	for _, lock := range verified.Theirs {
+		theirs[lock.Path] = lock
+	}
+
+	var problems []string
+	for _, path := range lockable {
+		if lock, ok := theirs[path]; ok {
+			problems = append(problems, fmt.Sprintf("  %s is locked by %s", path, lock.OwnerName()))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("cannot save files that someone else has locked:\n%s\nhint: ask them to run 'zark lfs unlock <path>' when they are done, then make your changes again", strings.Join(problems, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testLockServer is a minimal in-memory implementation of the LFS locking
+// API. Users are identified by their bearer token.
+type testLockServer struct {
+	*httptest.Server
+	Users map[string]string // token -> name
+
+	mu     sync.Mutex
+	nextID int
+	locks  []LFSLock
+}
+
+func newTestLockServer(t *testing.T) *testLockServer {
+	t.Helper()
+	s := &testLockServer{Users: map[string]string{"me-token": "me", "alice-token": "alice"}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /locks", s.handleCreate)
+	mux.HandleFunc("GET /locks", s.handleList)
+	mux.HandleFunc("POST /locks/verify", s.handleVerify)
+	mux.HandleFunc("POST /locks/{id}/unlock", s.handleUnlock)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testLockServer) user(w http.ResponseWriter, r *http.Request) (string, bool) {
+	w.Header().Set("Content-Type", lfsMediaType)
+	name, ok := s.Users[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(lfsLockResponse{Message: "credentials needed"})
+	}
+	return name, ok
+}
+
+func (s *testLockServer) handleCreate(w http.ResponseWriter, r *http.Request) {
+	name, ok := s.user(w, r)
+	if !ok {
+		return
+	}
+	var req lfsCreateLockRequest
+	json.NewDecoder(r.Body).Decode(&req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, lock := range s.locks {
+		if lock.Path == req.Path {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(lfsLockResponse{Lock: &lock, Message: "already created lock"})
+			return
+		}
+	}
+	s.nextID++
+	lock := LFSLock{ID: strconv.Itoa(s.nextID), Path: req.Path, LockedAt: time.Now(), Owner: &LFSLockOwner{Name: name}}
+	s.locks = append(s.locks, lock)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(lfsLockResponse{Lock: &lock})
+}
+
+func (s *testLockServer) handleList(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.user(w, r); !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := lfsLockListResponse{Locks: []LFSLock{}}
+	for _, lock := range s.locks {
+		if path := r.URL.Query().Get("path"); path == "" || path == lock.Path {
+			resp.Locks = append(resp.Locks, lock)
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *testLockServer) handleVerify(w http.ResponseWriter, r *http.Request) {
+	name, ok := s.user(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Return one lock per page to exercise the cursor.
+	var req lfsVerifyLocksRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	start, _ := strconv.Atoi(req.Cursor)
+
+	resp := LFSVerifyLocksResponse{Ours: []LFSLock{}, Theirs: []LFSLock{}}
+	if start < len(s.locks) {
+		lock := s.locks[start]
+		if lock.Owner.Name == name {
+			resp.Ours = append(resp.Ours, lock)
+		} else {
+			resp.Theirs = append(resp.Theirs, lock)
+		}
+		if start+1 < len(s.locks) {
+			resp.NextCursor = strconv.Itoa(start + 1)
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *testLockServer) handleUnlock(w http.ResponseWriter, r *http.Request) {
+	name, ok := s.user(w, r)
+	if !ok {
+		return
+	}
+	var req lfsUnlockRequest
+	json.NewDecoder(r.Body).Decode(&req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, lock := range s.locks {
+		if lock.ID != r.PathValue("id") {
+			continue
+		}
+		if lock.Owner.Name != name && !req.Force {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(lfsLockResponse{Message: "lock is owned by " + lock.Owner.Name})
+			return
+		}
+		s.locks = append(s.locks[:i], s.locks[i+1:]...)
+		json.NewEncoder(w).Encode(lfsLockResponse{Lock: &lock})
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(lfsLockResponse{Message: "lock not found"})
+}
+
+// setupLockRepo commits a lockable design.psd and points lfs.url at server.
+func setupLockRepo(t *testing.T, server *testLockServer) (*Repository, func()) {
+	t.Helper()
+	isolateConfig(t)
+	repo, _, cleanup := setupTestRepo(t)
+	SetConfigValue(repo.ConfigPath, "lfs.url", server.URL)
+	SetConfigValue(repo.ConfigPath, "lfs.accesstoken", "me-token")
+
+	os.WriteFile(AttributesFile, []byte("*.psd filter=lfs diff=lfs merge=lfs -text lockable\n"), 0644)
+	AddFiles(repo, []string{AttributesFile})
+	commitFile(t, repo, "design.psd", "layers")
+	return repo, cleanup
+}
+
+// asUser runs fn with the repository authenticating as another user.
+func asUser(t *testing.T, repo *Repository, token string, fn func()) {
+	t.Helper()
+	SetConfigValue(repo.ConfigPath, "lfs.accesstoken", token)
+	defer SetConfigValue(repo.ConfigPath, "lfs.accesstoken", "me-token")
+	fn()
+}
+
+func isWritable(t *testing.T, path string) bool {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", path, err)
+	}
+	return info.Mode().Perm()&0200 != 0
+}
+
+func TestLFSLocks(t *testing.T) {
+	t.Run("Lock, list and unlock", func(t *testing.T) {
+		server := newTestLockServer(t)
+		repo, cleanup := setupLockRepo(t, server)
+		defer cleanup()
+
+		lock, err := LockLFSFile(repo, "design.psd")
+		if err != nil {
+			t.Fatalf("LockLFSFile failed: %v", err)
+		}
+		asUser(t, repo, "alice-token", func() {
+			if _, err := LockLFSFile(repo, "design.psd"); err == nil || !strings.Contains(err.Error(), "already locked by me") {
+				t.Errorf("Expected the lock to be refused, got %v", err)
+			}
+			if _, err := LockLFSFile(repo, "other.psd"); err != nil {
+				t.Fatalf("LockLFSFile failed: %v", err)
+			}
+		})
+
+		locks, ours, err := ListLFSLocks(repo)
+		if err != nil {
+			t.Fatalf("ListLFSLocks failed: %v", err)
+		}
+		if len(locks) != 2 || locks[0].Path != "design.psd" || !ours[lock.ID] || ours[locks[1].ID] {
+			t.Errorf("Expected both locks with only ours marked, got %+v %v", locks, ours)
+		}
+
+		if _, err := UnlockLFSFile(repo, "other.psd", "", false); err == nil || !strings.Contains(err.Error(), "owned by alice") {
+			t.Errorf("Expected unlocking alice's lock to be refused, got %v", err)
+		}
+		if _, err := UnlockLFSFile(repo, "other.psd", "", true); err != nil {
+			t.Errorf("Expected --force to break the lock: %v", err)
+		}
+		if _, err := UnlockLFSFile(repo, "design.psd", "", false); err != nil {
+			t.Fatalf("UnlockLFSFile failed: %v", err)
+		}
+		if locks, _, _ := ListLFSLocks(repo); len(locks) != 0 {
+			t.Errorf("Expected no locks left, got %+v", locks)
+		}
+	})
+
+	t.Run("Lockable files are read-only until locked", func(t *testing.T) {
+		server := newTestLockServer(t)
+		repo, cleanup := setupLockRepo(t, server)
+		defer cleanup()
+
+		if err := Checkout(repo, "main"); err != nil {
+			t.Fatalf("Checkout failed: %v", err)
+		}
+		if isWritable(t, "design.psd") {
+			t.Fatal("Expected the lockable file to be checked out read-only")
+		}
+		if !isWritable(t, "test.txt") {
+			t.Error("Expected other files to stay writable")
+		}
+
+		LockLFSFile(repo, "design.psd")
+		if !isWritable(t, "design.psd") {
+			t.Error("Expected locking to make the file writable")
+		}
+		Checkout(repo, "main")
+		if !isWritable(t, "design.psd") {
+			t.Error("Expected a locked file to stay writable across checkouts")
+		}
+
+		UnlockLFSFile(repo, "design.psd", "", false)
+		if isWritable(t, "design.psd") {
+			t.Error("Expected unlocking to make the file read-only again")
+		}
+	})
+
+	t.Run("Save refuses files locked by someone else", func(t *testing.T) {
+		server := newTestLockServer(t)
+		repo, cleanup := setupLockRepo(t, server)
+		defer cleanup()
+
+		asUser(t, repo, "alice-token", func() {
+			LockLFSFile(repo, "design.psd")
+		})
+		os.WriteFile("design.psd", []byte("my layers"), 0644)
+		AddFiles(repo, []string{"design.psd"})
+		_, err := CreateCommitWithOptions(repo, CommitOptions{Message: "edit", NoVerify: true})
+		if err == nil || !strings.Contains(err.Error(), "design.psd is locked by alice") {
+			t.Fatalf("Expected the save to be refused, got %v", err)
+		}
+
+		asUser(t, repo, "alice-token", func() {
+			UnlockLFSFile(repo, "design.psd", "", false)
+		})
+		if _, err := CreateCommitWithOptions(repo, CommitOptions{Message: "edit", NoVerify: true}); err != nil {
+			t.Errorf("Expected the save to succeed once unlocked: %v", err)
+		}
+	})
+}
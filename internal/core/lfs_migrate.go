@@ -0,0 +1,217 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LFSExtensionUsage is how much of the history's content is taken up by
+// files matching one pattern, such as "*.psd".
+type LFSExtensionUsage struct {
+	Pattern string
+	Files   int
+	Bytes   int64
+}
+
+// lfsMigratePattern returns the pattern a file is grouped under: "*.ext" by
+// extension, or the file name itself when it has none.
+func lfsMigratePattern(filePath string) string {
+	name := path.Base(filePath)
+	if ext := path.Ext(name); ext != "" && ext != name {
+		return "*" + strings.ToLower(ext)
+	}
+	return name
+}
+
+// LFSMigrateInfo adds up the size of every distinct file version in the
+// history by extension, largest first, so that it is clear which patterns
+// are worth moving to LFS. Files already stored as LFS pointers are skipped.
+func LFSMigrateInfo(repo *Repository) ([]LFSExtensionUsage, error) {
+	storage := NewStorage(repo)
+	roots, err := historyRoots(repo)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := commitsParentsFirst(storage, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]*LFSExtensionUsage)
+	seenTrees := make(map[string]bool)
+	seenBlobs := make(map[string]bool)
+	for _, commit := range commits {
+		if seenTrees[commit.TreeHash] {
+			continue
+		}
+		seenTrees[commit.TreeHash] = true
+		tree, err := storage.LoadTree(commit.TreeHash)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range tree.Entries {
+			if seenBlobs[entry.Hash] || entry.Mode == ModeSymlink {
+				continue
+			}
+			seenBlobs[entry.Hash] = true
+			data, err := storage.Load(entry.Hash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load %s: %w", entry.Name, err)
+			}
+			if _, ok := ParseLFSPointer(data); ok {
+				continue
+			}
+			pattern := lfsMigratePattern(entry.Name)
+			if usage[pattern] == nil {
+				usage[pattern] = &LFSExtensionUsage{Pattern: pattern}
+			}
+			usage[pattern].Files++
+			usage[pattern].Bytes += int64(len(data))
+		}
+	}
+
+	result := make([]LFSExtensionUsage, 0, len(usage))
+	for _, u := range usage {
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Bytes != result[j].Bytes {
+			return result[i].Bytes > result[j].Bytes
+		}
+		return result[i].Pattern < result[j].Pattern
+	})
+	return result, nil
+}
+
+// LFSMigrateResult describes what LFSMigrateImport changed.
+type LFSMigrateResult struct {
+	*RewriteResult
+	// Objects lists the contents moved into the LFS store.
+	Objects []LFSObject
+}
+
+// LFSMigrateImport rewrites every commit so that files matching the include
+// patterns are stored as LFS pointers, with their content moved into the
+// LFS store. Each rewritten tree gets a .zarkattributes that tracks the
+// patterns, and the working tree's copy is updated to match HEAD.
+func LFSMigrateImport(repo *Repository, include []string) (*LFSMigrateResult, error) {
+	if len(include) == 0 {
+		return nil, fmt.Errorf("nothing to migrate: give at least one pattern with --include")
+	}
+
+	storage := NewStorage(repo)
+	result := &LFSMigrateResult{}
+	pointers := make(map[string]string)
+	toPointer := func(hash string) (string, error) {
+		if pointerHash, ok := pointers[hash]; ok {
+			return pointerHash, nil
+		}
+		content, err := storage.Load(hash)
+		if err != nil {
+			return "", err
+		}
+		pointerHash := hash
+		if _, isPointer := ParseLFSPointer(content); !isPointer {
+			pointer, err := StoreLFSObject(repo, content)
+			if err != nil {
+				return "", err
+			}
+			blob := NewBlob(pointer.Bytes())
+			if err := storage.Store(blob); err != nil {
+				return "", fmt.Errorf("failed to store blob: %w", err)
+			}
+			pointerHash = blob.Hash()
+			result.Objects = append(result.Objects, LFSObject{OID: pointer.OID, Size: pointer.Size})
+		}
+		pointers[hash] = pointerHash
+		return pointerHash, nil
+	}
+
+	rewrite, err := RewriteHistory(repo, func(entries []TreeEntry) ([]TreeEntry, error) {
+		var attributes []byte
+		var rewritten []TreeEntry
+		for _, entry := range entries {
+			if entry.Name == AttributesFile {
+				data, err := storage.Load(entry.Hash)
+				if err != nil {
+					return nil, fmt.Errorf("failed to load %s: %w", AttributesFile, err)
+				}
+				attributes = data
+				continue
+			}
+			if entry.Mode != ModeSymlink && matchesAnyPattern(include, entry.Name) {
+				newHash, err := toPointer(entry.Hash)
+				if err != nil {
+					return nil, fmt.Errorf("failed to migrate %s: %w", entry.Name, err)
+				}
+				entry.Hash = newHash
+			}
+			rewritten = append(rewritten, entry)
+		}
+
+		blob := NewBlob(withLFSPatterns(attributes, include))
+		if err := storage.Store(blob); err != nil {
+			return nil, fmt.Errorf("failed to store blob: %w", err)
+		}
+		rewritten = append(rewritten, TreeEntry{Mode: ModeFile, Name: AttributesFile, Hash: blob.Hash(), Type: "blob"})
+		sort.Slice(rewritten, func(i, j int) bool { return rewritten[i].Name < rewritten[j].Name })
+		return rewritten, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.RewriteResult = rewrite
+
+	if !repo.Bare && len(rewrite.Commits) > 0 {
+		head, err := GetHeadTree(repo, storage)
+		if err != nil {
+			return nil, err
+		}
+		if entry, ok := head[AttributesFile]; ok {
+			data, err := storage.Load(entry.Hash)
+			if err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(filepath.Join(repo.Path, AttributesFile), data, 0644); err != nil {
+				return nil, fmt.Errorf("failed to update %s: %w", AttributesFile, err)
+			}
+		}
+	}
+	return result, nil
+}
+
+// matchesAnyPattern reports whether filePath matches one of the globs.
+func matchesAnyPattern(patterns []string, filePath string) bool {
+	for _, pattern := range patterns {
+		if matchPathGlob(pattern, filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// withLFSPatterns returns the contents of a .zarkattributes file with a
+// tracking line added for every pattern it does not already track.
+func withLFSPatterns(data []byte, patterns []string) []byte {
+	tracked := make(map[string]bool)
+	for _, pattern := range LFSTrackedPatterns(ParseAttributes(data)) {
+		tracked[pattern] = true
+	}
+	out := append([]byte(nil), data...)
+	for _, pattern := range patterns {
+		if tracked[pattern] {
+			continue
+		}
+		tracked[pattern] = true
+		if len(out) > 0 && !bytes.HasSuffix(out, []byte("\n")) {
+			out = append(out, '\n')
+		}
+		out = append(out, lfsAttributesLine(pattern)+"\n"...)
+	}
+	return out
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultLFSPruneOffsetDays is how far back prune keeps the objects of old
+// commits when lfs.pruneoffsetdays is not set.
+const defaultLFSPruneOffsetDays = 7
+
+// LFSFilesInIndex returns the staged files that are LFS pointers.
+func LFSFilesInIndex(repo *Repository) ([]LFSFile, error) {
+	index, err := LoadIndex(repo.IndexPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not load index: %w", err)
+	}
+	entries := make([]TreeEntry, len(index.Entries))
+	for i, entry := range index.Entries {
+		entries[i] = TreeEntry{Mode: entry.Mode, Name: entry.Path, Hash: entry.Hash, Type: "blob"}
+	}
+	return LFSFilesInTree(NewStorage(repo), entries)
+}
+
+// LFSStatusReport lists the LFS objects that need attention.
+type LFSStatusReport struct {
+	// Missing objects are referenced by a commit or the index but their
+	// content is not in the local store.
+	Missing []LFSFile
+	// Unpushed objects are stored locally but not recorded as uploaded.
+	Unpushed []LFSFile
+}
+
+// LFSStatus compares the LFS objects referenced by the history and the index
+// with the local store and the record of what has been pushed.
+func LFSStatus(repo *Repository) (*LFSStatusReport, error) {
+	files, err := lfsFilesInHistory(repo, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	staged, err := LFSFilesInIndex(repo)
+	if err != nil {
+		return nil, err
+	}
+	pushed, err := LoadPushedLFSObjects(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &LFSStatusReport{}
+	seen := make(map[string]bool)
+	for _, file := range append(files, staged...) {
+		if seen[file.Pointer.OID] {
+			continue
+		}
+		seen[file.Pointer.OID] = true
+		switch {
+		case !HasLFSObject(repo, file.Pointer.OID):
+			report.Missing = append(report.Missing, file)
+		case !pushed[file.Pointer.OID]:
+			report.Unpushed = append(report.Unpushed, file)
+		}
+	}
+	sort.Slice(report.Missing, func(i, j int) bool { return report.Missing[i].Path < report.Missing[j].Path })
+	sort.Slice(report.Unpushed, func(i, j int) bool { return report.Unpushed[i].Path < report.Unpushed[j].Path })
+	return report, nil
+}
+
+// LFSPruneResult describes the local LFS objects prune deleted, or would
+// delete in a dry run.
+type LFSPruneResult struct {
+	Removed []LFSObject
+	Kept    int
+	Bytes   int64
+}
+
+// PruneLFS deletes local LFS objects that are no longer needed. An object is
+// kept if it is used by HEAD, the index, or a commit made within the last
+// lfs.pruneoffsetdays days, or if a commit uses it and it has not been
+// pushed yet, since it would otherwise be lost.
+func PruneLFS(repo *Repository, dryRun bool) (*LFSPruneResult, error) {
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	offset := time.Duration(config.GetInt("lfs.pruneoffsetdays", defaultLFSPruneOffsetDays)) * 24 * time.Hour
+
+	keep := make(map[string]bool)
+	recent, err := lfsFilesInHistory(repo, time.Now().Add(-offset))
+	if err != nil {
+		return nil, err
+	}
+	head, err := LFSFilesAt(repo, "HEAD")
+	if err != nil && !strings.Contains(err.Error(), "no commits yet") {
+		return nil, err
+	}
+	staged, err := LFSFilesInIndex(repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, files := range [][]LFSFile{recent, head, staged} {
+		for _, file := range files {
+			keep[file.Pointer.OID] = true
+		}
+	}
+
+	pushed, err := LoadPushedLFSObjects(repo)
+	if err != nil {
+		return nil, err
+	}
+	all, err := lfsObjectsInHistory(repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range all {
+		if !pushed[obj.OID] {
+			keep[obj.OID] = true
+		}
+	}
+
+	entries, err := os.ReadDir(LFSObjectsDir(repo))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &LFSPruneResult{}, nil
+		}
+		return nil, fmt.Errorf("failed to read LFS objects: %w", err)
+	}
+	result := &LFSPruneResult{}
+	for _, entry := range entries {
+		oid := entry.Name()
+		if entry.IsDir() || len(oid) != 64 {
+			continue
+		}
+		if keep[oid] {
+			result.Kept++
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LFS object %s: %w", shortOID(oid), err)
+		}
+		if !dryRun {
+			if err := os.Remove(LFSObjectPath(repo, oid)); err != nil {
+				return nil, fmt.Errorf("failed to delete LFS object %s: %w", shortOID(oid), err)
+			}
+		}
+		result.Removed = append(result.Removed, LFSObject{OID: oid, Size: info.Size()})
+		result.Bytes += info.Size()
+	}
+	return result, nil
+}
@@ -1,12 +1,32 @@
 package core
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 )
 
+// captureStdout returns everything fn prints to standard output.
+func captureStdout(t *testing.T, fn func() error) string {
+	t.Helper()
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := fn()
+
+	w.Close()
+	os.Stdout = oldStdout
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	buf.ReadFrom(r)
+	return buf.String()
+}
+
 func TestLFS(t *testing.T) {
 	repo, _, cleanup := setupTestRepo(t)
 	defer cleanup()
@@ -30,4 +50,213 @@ func TestLFS(t *testing.T) {
 			t.Errorf("Expected .zarkattributes to contain '%s', but it did not. Got:\n%s", expectedLine, string(content))
 		}
 	})
-}
\ No newline at end of file
+}
+
+func TestLFSCleanAndSmudge(t *testing.T) {
+	isolateConfig(t)
+	repo, _, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	TrackLFS(repo, "*.psd")
+	large := bytes.Repeat([]byte("layer data "), 1000)
+	os.WriteFile("design.psd", large, 0644)
+	if err := AddFiles(repo, []string{".zarkattributes", "design.psd"}); err != nil {
+		t.Fatalf("AddFiles failed: %v", err)
+	}
+
+	t.Run("Tracked files are staged as pointers", func(t *testing.T) {
+		entry := findIndexEntry(t, repo, "design.psd")
+		staged, err := NewStorage(repo).Load(entry.Hash)
+		if err != nil {
+			t.Fatalf("Failed to load staged blob: %v", err)
+		}
+		pointer, ok := ParseLFSPointer(staged)
+		if !ok {
+			t.Fatalf("Expected a pointer to be staged, got %d bytes", len(staged))
+		}
+		if pointer != NewLFSPointer(large) {
+			t.Errorf("Pointer %+v does not describe the file", pointer)
+		}
+		stored, err := os.ReadFile(LFSObjectPath(repo, pointer.OID))
+		if err != nil || !bytes.Equal(stored, large) {
+			t.Errorf("Expected the content in the LFS store: %v", err)
+		}
+	})
+
+	t.Run("Status treats the smudged file as clean", func(t *testing.T) {
+		output := captureStdout(t, func() error { return GetStatus(repo) })
+		if strings.Contains(output, "modified:   design.psd") {
+			t.Errorf("Expected design.psd to be clean, got:\n%s", output)
+		}
+	})
+
+	t.Run("Checkout replaces pointers with content", func(t *testing.T) {
+		if _, err := CreateCommitWithOptions(repo, CommitOptions{Message: "add design", NoVerify: true}); err != nil {
+			t.Fatalf("CreateCommitWithOptions failed: %v", err)
+		}
+		os.Remove("design.psd")
+		if err := Checkout(repo, "main"); err != nil {
+			t.Fatalf("Checkout failed: %v", err)
+		}
+		content, _ := os.ReadFile("design.psd")
+		if !bytes.Equal(content, large) {
+			t.Errorf("Expected the real content after checkout, got %d bytes", len(content))
+		}
+
+		output := captureStdout(t, func() error { return GetStatus(repo) })
+		if strings.Contains(output, "design.psd") {
+			t.Errorf("Expected design.psd to be clean after checkout, got:\n%s", output)
+		}
+	})
+
+	t.Run("Ordinary files are never mistaken for pointers", func(t *testing.T) {
+		if _, ok := ParseLFSPointer([]byte("version 1\noid sha256:abc\nsize 3\n")); ok {
+			t.Error("Expected an invalid pointer to be rejected")
+		}
+		if _, ok := ParseLFSPointer(NewLFSPointer(large).Bytes()); !ok {
+			t.Error("Expected a valid pointer to be recognised")
+		}
+	})
+}
+
+func TestLFSManagement(t *testing.T) {
+	t.Run("Track is idempotent and untrack removes the pattern", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		os.WriteFile(AttributesFile, []byte("*.txt text"), 0644)
+		captureStdout(t, func() error { return TrackLFS(repo, "*.zip") })
+		captureStdout(t, func() error { return TrackLFS(repo, "*.zip") })
+		captureStdout(t, func() error { return TrackLFS(repo, "*.mov") })
+
+		attributes, _ := LoadAttributes(repo)
+		if patterns := LFSTrackedPatterns(attributes); strings.Join(patterns, ",") != "*.zip,*.mov" {
+			t.Fatalf("Expected each pattern once, got %v", patterns)
+		}
+		if len(attributes.Rules) != 3 {
+			t.Errorf("Expected the existing line to be kept, got %+v", attributes.Rules)
+		}
+
+		captureStdout(t, func() error { return UntrackLFS(repo, "*.zip") })
+		attributes, _ = LoadAttributes(repo)
+		if patterns := LFSTrackedPatterns(attributes); strings.Join(patterns, ",") != "*.mov" {
+			t.Errorf("Expected only *.mov to remain tracked, got %v", patterns)
+		}
+		if err := UntrackLFS(repo, "*.zip"); err == nil {
+			t.Error("Expected untracking an unknown pattern to fail")
+		}
+	})
+
+	t.Run("Files, status and prune", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		captureStdout(t, func() error { return TrackLFS(repo, "*.bin") })
+		AddFiles(repo, []string{AttributesFile})
+
+		// An old version that was pushed, then replaced.
+		t.Setenv(EnvCommitterDate, "2020-01-01 12:00:00 +0000")
+		oldContent := []byte("old large content")
+		first := commitFile(t, repo, "data.bin", string(oldContent))
+		oldOID := NewLFSPointer(oldContent).OID
+		recordPushedLFSObjects(repo, []LFSObject{{OID: oldOID}})
+
+		// An old version that was never pushed.
+		unpushedContent := []byte("unpushed large content")
+		commitFile(t, repo, "data.bin", string(unpushedContent))
+		unpushedOID := NewLFSPointer(unpushedContent).OID
+
+		t.Setenv(EnvCommitterDate, "")
+		newContent := []byte("new large content")
+		commitFile(t, repo, "data.bin", string(newContent))
+		newOID := NewLFSPointer(newContent).OID
+
+		files, err := LFSFilesAt(repo, first)
+		if err != nil || len(files) != 1 || files[0].Pointer.OID != oldOID || files[0].Path != "data.bin" {
+			t.Fatalf("Expected the first commit to list the old pointer, got %+v %v", files, err)
+		}
+
+		os.Remove(LFSObjectPath(repo, newOID))
+		report, err := LFSStatus(repo)
+		if err != nil {
+			t.Fatalf("LFSStatus failed: %v", err)
+		}
+		if len(report.Missing) != 1 || report.Missing[0].Pointer.OID != newOID {
+			t.Errorf("Expected the new object to be missing, got %+v", report.Missing)
+		}
+		if len(report.Unpushed) != 1 || report.Unpushed[0].Pointer.OID != unpushedOID {
+			t.Errorf("Expected the unpushed object to be reported, got %+v", report.Unpushed)
+		}
+
+		result, err := PruneLFS(repo, true)
+		if err != nil {
+			t.Fatalf("PruneLFS failed: %v", err)
+		}
+		if len(result.Removed) != 1 || !HasLFSObject(repo, oldOID) {
+			t.Fatalf("Expected a dry run to delete nothing, got %+v", result)
+		}
+		result, _ = PruneLFS(repo, false)
+		if len(result.Removed) != 1 || result.Removed[0].OID != oldOID || HasLFSObject(repo, oldOID) {
+			t.Errorf("Expected only the old pushed object to be deleted, got %+v", result)
+		}
+		if !HasLFSObject(repo, unpushedOID) {
+			t.Error("Expected the unpushed object to be kept")
+		}
+	})
+}
+
+func TestLFSMigrate(t *testing.T) {
+	isolateConfig(t)
+	repo, _, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	design := bytes.Repeat([]byte("layer"), 1000)
+	first := commitFile(t, repo, "art/cover.psd", string(design))
+	commitFile(t, repo, "notes.txt", "hello")
+	redesign := bytes.Repeat([]byte("LAYER"), 1000)
+	commitFile(t, repo, "art/cover.psd", string(redesign))
+
+	usage, err := LFSMigrateInfo(repo)
+	if err != nil {
+		t.Fatalf("LFSMigrateInfo failed: %v", err)
+	}
+	if len(usage) != 2 || usage[0].Pattern != "*.psd" || usage[0].Files != 2 || usage[0].Bytes != 10000 {
+		t.Fatalf("Expected *.psd to lead with two versions, got %+v", usage)
+	}
+
+	result, err := LFSMigrateImport(repo, []string{"*.psd"})
+	if err != nil {
+		t.Fatalf("LFSMigrateImport failed: %v", err)
+	}
+	if result.Commits[first] == "" || len(result.Objects) != 2 {
+		t.Fatalf("Expected the history to be rewritten and 2 objects moved, got %+v", result)
+	}
+	for _, content := range [][]byte{design, redesign} {
+		if !HasLFSObject(repo, NewLFSPointer(content).OID) {
+			t.Error("Expected the content to be in the LFS store")
+		}
+	}
+
+	files, err := LFSFilesAt(repo, result.Commits[first])
+	if err != nil || len(files) != 1 || files[0].Pointer != NewLFSPointer(design) {
+		t.Errorf("Expected the first commit to hold a pointer, got %+v %v", files, err)
+	}
+	attributes, _ := LoadAttributes(repo)
+	if !attributes.IsLFS("art/cover.psd") {
+		t.Error("Expected the working .zarkattributes to track *.psd")
+	}
+
+	status := captureStdout(t, func() error { return GetStatus(repo) })
+	if strings.Contains(status, "modified") {
+		t.Errorf("Expected a clean working tree after migrating, got:\n%s", status)
+	}
+
+	usage, _ = LFSMigrateInfo(repo)
+	for _, u := range usage {
+		if u.Pattern == "*.psd" {
+			t.Errorf("Expected no *.psd content outside LFS, got %+v", u)
+		}
+	}
+}
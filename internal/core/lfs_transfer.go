@@ -0,0 +1,702 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lfsMediaType is the content type of batch API requests and responses.
+const lfsMediaType = "application/vnd.git-lfs+json"
+
+// Batch API operations.
+const (
+	LFSUpload   = "upload"
+	LFSDownload = "download"
+)
+
+// LFSObject identifies a large file in batch requests.
+type LFSObject struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// LFSAction tells the client where and how to transfer one object.
+type LFSAction struct {
+	Href      string            `json:"href"`
+	Header    map[string]string `json:"header,omitempty"`
+	ExpiresIn int               `json:"expires_in,omitempty"`
+}
+
+// LFSObjectError is a per-object error returned by the server.
+type LFSObjectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// LFSBatchObject is one object of a batch response.
+type LFSBatchObject struct {
+	LFSObject
+	Authenticated bool                 `json:"authenticated,omitempty"`
+	Actions       map[string]LFSAction `json:"actions,omitempty"`
+	Error         *LFSObjectError      `json:"error,omitempty"`
+}
+
+// LFSBatchRequest is the body POSTed to <endpoint>/objects/batch.
+type LFSBatchRequest struct {
+	Operation string      `json:"operation"`
+	Transfers []string    `json:"transfers,omitempty"`
+	Objects   []LFSObject `json:"objects"`
+	HashAlgo  string      `json:"hash_algo,omitempty"`
+}
+
+// LFSBatchResponse is the server's answer to a batch request.
+type LFSBatchResponse struct {
+	Transfer string           `json:"transfer,omitempty"`
+	Objects  []LFSBatchObject `json:"objects"`
+	Message  string           `json:"message,omitempty"`
+}
+
+// LFSClient talks to an LFS server using the Git LFS batch API.
+type LFSClient struct {
+	Endpoint    string
+	Header      http.Header // Sent with every batch request, e.g. Authorization
+	HTTP        *http.Client
+	Concurrency int
+}
+
+// NewLFSClient creates a client for the endpoint configured in lfs.url.
+func NewLFSClient(repo *Repository) (*LFSClient, error) {
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := strings.TrimSuffix(config.GetString("lfs.url", ""), "/")
+	if endpoint == "" {
+		return nil, fmt.Errorf("no LFS server configured.\nSet one with 'zark config set lfs.url https://example.com/my-project.git/info/lfs'")
+	}
+
+	client := &LFSClient{
+		Endpoint:    endpoint,
+		Header:      make(http.Header),
+		HTTP:        &http.Client{Timeout: 10 * time.Minute},
+		Concurrency: int(config.GetInt("lfs.concurrenttransfers", 8)),
+	}
+	if token := config.GetString("lfs.accesstoken", ""); token != "" {
+		client.Header.Set("Authorization", "Bearer "+token)
+	}
+	if client.Concurrency < 1 {
+		client.Concurrency = 1
+	}
+	return client, nil
+}
+
+// Batch asks the server how to transfer objects.
+func (c *LFSClient) Batch(operation string, objects []LFSObject) (*LFSBatchResponse, error) {
+	body, err := json.Marshal(LFSBatchRequest{
+		Operation: operation,
+		Transfers: []string{"basic"},
+		Objects:   objects,
+		HashAlgo:  "sha256",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode batch request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.Endpoint+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact LFS server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var batch LFSBatchResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&batch)
+	if resp.StatusCode != http.StatusOK {
+		if decodeErr == nil && batch.Message != "" {
+			return nil, fmt.Errorf("LFS server refused the %s: %s (HTTP %d)", operation, batch.Message, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("LFS server refused the %s (HTTP %d)", operation, resp.StatusCode)
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to decode batch response: %w", decodeErr)
+	}
+	return &batch, nil
+}
+
+// LFSTransferResult summarises a push or fetch.
+type LFSTransferResult struct {
+	Transferred []LFSObject
+	Failed      []LFSObject
+	Skipped     int // Objects the server already had, on upload
+	Errors      []error
+}
+
+// Err combines the per-object errors, if any.
+func (r *LFSTransferResult) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	var msgs []string
+	for _, err := range r.Errors {
+		msgs = append(msgs, "  "+err.Error())
+	}
+	return fmt.Errorf("%d LFS transfer(s) failed:\n%s", len(r.Errors), strings.Join(msgs, "\n"))
+}
+
+// transfer runs fn for every object of a batch response on Concurrency workers.
+// Only the objects that were requested are transferred, with the requested
+// size: the oid names a file on disk, so the server must not pick it.
+func (c *LFSClient) transfer(requested []LFSObject, batch *LFSBatchResponse, action string, fn func(obj LFSBatchObject, action LFSAction) error) *LFSTransferResult {
+	result := &LFSTransferResult{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	work := make(chan LFSBatchObject)
+
+	for i := 0; i < c.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range work {
+				err := fn(obj, obj.Actions[action])
+				mu.Lock()
+				if err != nil {
+					result.Failed = append(result.Failed, obj.LFSObject)
+					result.Errors = append(result.Errors, fmt.Errorf("%s: %w", shortOID(obj.OID), err))
+				} else {
+					result.Transferred = append(result.Transferred, obj.LFSObject)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	pending := make(map[string]LFSObject, len(requested))
+	for _, obj := range requested {
+		if isLFSOID(obj.OID) {
+			pending[obj.OID] = obj
+		}
+	}
+	for _, obj := range batch.Objects {
+		wanted, ok := pending[obj.OID]
+		if !ok {
+			continue
+		}
+		delete(pending, obj.OID)
+		obj.LFSObject = wanted
+		if obj.Error != nil {
+			result.Failed = append(result.Failed, obj.LFSObject)
+			result.Errors = append(result.Errors, fmt.Errorf("%s: %s (code %d)", shortOID(obj.OID), obj.Error.Message, obj.Error.Code))
+			continue
+		}
+		if _, ok := obj.Actions[action]; !ok {
+			if action == LFSDownload {
+				// Without a download action the content never arrives, so
+				// the file would stay a pointer.
+				result.Failed = append(result.Failed, obj.LFSObject)
+				result.Errors = append(result.Errors, fmt.Errorf("%s: the server did not offer a download", shortOID(obj.OID)))
+				continue
+			}
+			result.Skipped++
+			continue
+		}
+		work <- obj
+	}
+	close(work)
+	wg.Wait()
+
+	for _, obj := range requested {
+		reason := ""
+		if !isLFSOID(obj.OID) {
+			reason = "not a valid LFS oid"
+		} else if _, unanswered := pending[obj.OID]; unanswered {
+			delete(pending, obj.OID)
+			reason = "the server did not answer for it"
+		}
+		if reason != "" {
+			result.Failed = append(result.Failed, obj)
+			result.Errors = append(result.Errors, fmt.Errorf("%s: %s", shortOID(obj.OID), reason))
+		}
+	}
+	return result
+}
+
+// isLFSOID reports whether oid is a sha256 in lowercase hex, as LFS names
+// objects.
+func isLFSOID(oid string) bool {
+	if len(oid) != 64 {
+		return false
+	}
+	for _, c := range oid {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Upload sends local objects the server does not have yet. Objects the
+// server already has come back without an upload action and are skipped,
+// so an interrupted push resumes where it stopped when run again.
+func (c *LFSClient) Upload(repo *Repository, objects []LFSObject) (*LFSTransferResult, error) {
+	if len(objects) == 0 {
+		return &LFSTransferResult{}, nil
+	}
+	batch, err := c.Batch(LFSUpload, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	result := c.transfer(objects, batch, LFSUpload, func(obj LFSBatchObject, action LFSAction) error {
+		file, err := os.Open(LFSObjectPath(repo, obj.OID))
+		if err != nil {
+			return fmt.Errorf("missing locally: %w", err)
+		}
+		defer file.Close()
+
+		req, err := http.NewRequest(http.MethodPut, action.Href, file)
+		if err != nil {
+			return err
+		}
+		req.ContentLength = obj.Size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		setActionHeaders(req, action)
+		if err := c.do(req, http.StatusOK, http.StatusCreated, http.StatusNoContent); err != nil {
+			return err
+		}
+
+		if verify, ok := obj.Actions["verify"]; ok {
+			body, _ := json.Marshal(obj.LFSObject)
+			req, err := http.NewRequest(http.MethodPost, verify.Href, bytes.NewReader(body))
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Content-Type", lfsMediaType)
+			req.Header.Set("Accept", lfsMediaType)
+			setActionHeaders(req, verify)
+			if err := c.do(req, http.StatusOK); err != nil {
+				return fmt.Errorf("server could not verify the upload: %w", err)
+			}
+		}
+		return nil
+	})
+
+	return result, nil
+}
+
+// Download fetches objects into the local store. Partial downloads are kept
+// in .zark/lfs/incomplete and resumed with a Range request; every object is
+// checked against its oid before it is moved into the store.
+func (c *LFSClient) Download(repo *Repository, objects []LFSObject) (*LFSTransferResult, error) {
+	if len(objects) == 0 {
+		return &LFSTransferResult{}, nil
+	}
+	batch, err := c.Batch(LFSDownload, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	incomplete := filepath.Join(repo.ZarkDir, "lfs", "incomplete")
+	if err := os.MkdirAll(incomplete, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create LFS download directory: %w", err)
+	}
+
+	return c.transfer(objects, batch, LFSDownload, func(obj LFSBatchObject, action LFSAction) error {
+		return c.downloadObject(repo, filepath.Join(incomplete, obj.OID+".part"), obj.LFSObject, action)
+	}), nil
+}
+
+func (c *LFSClient) downloadObject(repo *Repository, partPath string, obj LFSObject, action LFSAction) error {
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil && info.Size() < obj.Size {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, action.Href, nil)
+	if err != nil {
+		return err
+	}
+	setActionHeaders(req, action)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// The server ignored the range; start again from the beginning.
+		flags |= os.O_TRUNC
+	default:
+		return fmt.Errorf("download failed (HTTP %d)", resp.StatusCode)
+	}
+
+	part, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, resp.Body); err != nil {
+		part.Close()
+		return fmt.Errorf("download interrupted, run the command again to resume: %w", err)
+	}
+	if err := part.Close(); err != nil {
+		return err
+	}
+
+	if err := verifyLFSFile(partPath, obj); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	target := LFSObjectPath(repo, obj.OID)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Rename(partPath, target)
+}
+
+// verifyLFSFile checks that a file's size and sha256 match the object.
+func verifyLFSFile(path string, obj LFSObject) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, bufio.NewReader(file))
+	if err != nil {
+		return err
+	}
+	if size != obj.Size || hex.EncodeToString(hash.Sum(nil)) != obj.OID {
+		return fmt.Errorf("downloaded content does not match its oid (got %d of %d bytes)", size, obj.Size)
+	}
+	return nil
+}
+
+// shortOID abbreviates an oid for messages.
+func shortOID(oid string) string {
+	return oid[:min(12, len(oid))]
+}
+
+func setActionHeaders(req *http.Request, action LFSAction) {
+	for key, value := range action.Header {
+		req.Header.Set(key, value)
+	}
+}
+
+func (c *LFSClient) do(req *http.Request, expected ...int) error {
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %s failed (HTTP %d)", req.Method, req.URL.Redacted(), resp.StatusCode)
+}
+
+// LFSFile is a file stored as an LFS pointer in some commit.
+type LFSFile struct {
+	Path    string
+	Pointer LFSPointer
+}
+
+// LFSFilesInTree returns the files of a tree that are LFS pointers.
+func LFSFilesInTree(storage *Storage, entries []TreeEntry) ([]LFSFile, error) {
+	attributes, err := attributesFromTree(storage, entries)
+	if err != nil {
+		return nil, err
+	}
+	var files []LFSFile
+	for _, entry := range entries {
+		if !attributes.IsLFS(entry.Name) {
+			continue
+		}
+		data, err := storage.Load(entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", entry.Name, err)
+		}
+		if pointer, ok := ParseLFSPointer(data); ok {
+			files = append(files, LFSFile{Path: entry.Name, Pointer: pointer})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// LFSFilesAt returns the LFS files in the commit a revision points at.
+func LFSFilesAt(repo *Repository, rev string) ([]LFSFile, error) {
+	hash, err := ResolveRef(repo, rev)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve ref '%s': %w", rev, err)
+	}
+	storage := NewStorage(repo)
+	commit, err := storage.LoadCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := storage.LoadTree(commit.TreeHash)
+	if err != nil {
+		return nil, err
+	}
+	return LFSFilesInTree(storage, tree.Entries)
+}
+
+// lfsObjectsInHistory returns every LFS object referenced by any commit
+// reachable from a reference or HEAD.
+func lfsObjectsInHistory(repo *Repository) ([]LFSObject, error) {
+	files, err := lfsFilesInHistory(repo, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]LFSObject, len(files))
+	for i, file := range files {
+		objects[i] = LFSObject{OID: file.Pointer.OID, Size: file.Pointer.Size}
+	}
+	return objects, nil
+}
+
+// lfsFilesInHistory returns the LFS files of every commit reachable from a
+// reference or HEAD that was committed at or after since (all commits when
+// since is zero). Each object is listed once, under the first path found.
+func lfsFilesInHistory(repo *Repository, since time.Time) ([]LFSFile, error) {
+	storage := NewStorage(repo)
+	roots, err := historyRoots(repo)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := commitsParentsFirst(storage, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	seenTrees := make(map[string]bool)
+	seen := make(map[string]bool)
+	var files []LFSFile
+	for _, commit := range commits {
+		if seenTrees[commit.TreeHash] || commit.CommitterIdentity().When.Before(since) {
+			continue
+		}
+		seenTrees[commit.TreeHash] = true
+		tree, err := storage.LoadTree(commit.TreeHash)
+		if err != nil {
+			return nil, err
+		}
+		treeFiles, err := LFSFilesInTree(storage, tree.Entries)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range treeFiles {
+			if !seen[file.Pointer.OID] {
+				seen[file.Pointer.OID] = true
+				files = append(files, file)
+			}
+		}
+	}
+	return files, nil
+}
+
+// lfsPushedPath lists the oids known to be on the server, one per line.
+func lfsPushedPath(repo *Repository) string {
+	return filepath.Join(repo.ZarkDir, "lfs", "pushed")
+}
+
+// LoadPushedLFSObjects returns the oids recorded as uploaded.
+func LoadPushedLFSObjects(repo *Repository) (map[string]bool, error) {
+	pushed := make(map[string]bool)
+	data, err := os.ReadFile(lfsPushedPath(repo))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return pushed, nil
+		}
+		return nil, fmt.Errorf("failed to read pushed LFS objects: %w", err)
+	}
+	for _, line := range strings.Fields(string(data)) {
+		pushed[line] = true
+	}
+	return pushed, nil
+}
+
+func recordPushedLFSObjects(repo *Repository, objects []LFSObject) error {
+	pushed, err := LoadPushedLFSObjects(repo)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		pushed[obj.OID] = true
+	}
+	oids := make([]string, 0, len(pushed))
+	for oid := range pushed {
+		oids = append(oids, oid)
+	}
+	sort.Strings(oids)
+	if err := os.MkdirAll(filepath.Dir(lfsPushedPath(repo)), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(lfsPushedPath(repo), []byte(strings.Join(oids, "\n")+"\n"), 0644)
+}
+
+// PushLFS uploads every LFS object referenced by the history that exists
+// locally and has not been recorded as pushed.
+func PushLFS(repo *Repository) (*LFSTransferResult, error) {
+	client, err := NewLFSClient(repo)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := lfsObjectsInHistory(repo)
+	if err != nil {
+		return nil, err
+	}
+	pushed, err := LoadPushedLFSObjects(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []LFSObject
+	for _, obj := range objects {
+		if !pushed[obj.OID] && HasLFSObject(repo, obj.OID) {
+			pending = append(pending, obj)
+		}
+	}
+
+	result, err := client.Upload(repo, pending)
+	if err != nil {
+		return nil, err
+	}
+
+	// Everything that did not fail is now on the server, whether we sent it or not.
+	failed := make(map[string]bool)
+	for _, obj := range result.Failed {
+		failed[obj.OID] = true
+	}
+	var done []LFSObject
+	for _, obj := range pending {
+		if !failed[obj.OID] {
+			done = append(done, obj)
+		}
+	}
+	if err := recordPushedLFSObjects(repo, done); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FetchLFS downloads the LFS objects used by rev, or by every commit in the
+// history when rev is empty, that are missing locally.
+func FetchLFS(repo *Repository, rev string) (*LFSTransferResult, error) {
+	client, err := NewLFSClient(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var wanted []LFSObject
+	if rev == "" {
+		if wanted, err = lfsObjectsInHistory(repo); err != nil {
+			return nil, err
+		}
+	} else {
+		files, err := LFSFilesAt(repo, rev)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, file := range files {
+			if !seen[file.Pointer.OID] {
+				seen[file.Pointer.OID] = true
+				wanted = append(wanted, LFSObject{OID: file.Pointer.OID, Size: file.Pointer.Size})
+			}
+		}
+	}
+
+	var missing []LFSObject
+	for _, obj := range wanted {
+		if !HasLFSObject(repo, obj.OID) {
+			missing = append(missing, obj)
+		}
+	}
+	result, err := client.Download(repo, missing)
+	if err != nil {
+		return nil, err
+	}
+	result.Skipped += len(wanted) - len(missing)
+
+	// Whatever we downloaded is, by definition, on the server.
+	if err := recordPushedLFSObjects(repo, result.Transferred); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// PullLFS fetches the LFS objects for HEAD and replaces the pointers that
+// were checked out in their place with the real content. It returns the
+// paths that were updated.
+func PullLFS(repo *Repository) (*LFSTransferResult, []string, error) {
+	if err := repo.RequireWorkTree(); err != nil {
+		return nil, nil, err
+	}
+	result, err := FetchLFS(repo, "HEAD")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files, err := LFSFilesAt(repo, "HEAD")
+	if err != nil {
+		return nil, nil, err
+	}
+	var updated []string
+	for _, file := range files {
+		path := filepath.Join(repo.Path, filepath.FromSlash(file.Path))
+		current, err := os.ReadFile(path)
+		if err != nil {
+			continue // Deleted or replaced locally; leave it alone.
+		}
+		if !bytes.Equal(current, file.Pointer.Bytes()) || !HasLFSObject(repo, file.Pointer.OID) {
+			continue
+		}
+		content, err := os.ReadFile(LFSObjectPath(repo, file.Pointer.OID))
+		if err != nil {
+			return nil, nil, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Lockable files are read-only, so the content is renamed into place.
+		if err := replaceFile(path, content, info.Mode().Perm()); err != nil {
+			return nil, nil, err
+		}
+		updated = append(updated, file.Path)
+	}
+	return result, updated, nil
+}
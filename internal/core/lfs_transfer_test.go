@@ -0,0 +1,297 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testLFSServer is a minimal in-memory implementation of the LFS batch API.
+type testLFSServer struct {
+	*httptest.Server
+	Token string
+
+	mu            sync.Mutex
+	objects       map[string][]byte
+	uploads       int
+	rangeRequests int
+	corrupt       bool
+	noDownloads   bool
+	// madeUp is an oid the server adds to every batch response.
+	madeUp string
+}
+
+func newTestLFSServer(t *testing.T) *testLFSServer {
+	t.Helper()
+	s := &testLFSServer{Token: "secret-token", objects: make(map[string][]byte)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /objects/batch", s.handleBatch)
+	mux.HandleFunc("PUT /upload/{oid}", s.handleUpload)
+	mux.HandleFunc("POST /verify", s.handleVerify)
+	mux.HandleFunc("GET /download/{oid}", s.handleDownload)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testLFSServer) handleBatch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", lfsMediaType)
+	if r.Header.Get("Authorization") != "Bearer "+s.Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(LFSBatchResponse{Message: "credentials needed"})
+		return
+	}
+	var req LFSBatchRequest
+	json.NewDecoder(r.Body).Decode(&req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := LFSBatchResponse{Transfer: "basic"}
+	for _, obj := range req.Objects {
+		out := LFSBatchObject{LFSObject: obj}
+		_, exists := s.objects[obj.OID]
+		switch {
+		case req.Operation == LFSUpload && !exists:
+			out.Actions = map[string]LFSAction{
+				LFSUpload: {Href: s.URL + "/upload/" + obj.OID, Header: map[string]string{"X-Object-Auth": "up-" + obj.OID}},
+				"verify":  {Href: s.URL + "/verify"},
+			}
+		case req.Operation == LFSDownload && exists && !s.noDownloads:
+			out.Actions = map[string]LFSAction{
+				LFSDownload: {Href: s.URL + "/download/" + obj.OID, Header: map[string]string{"X-Object-Auth": "down-" + obj.OID}},
+			}
+		case req.Operation == LFSDownload && !exists:
+			out.Error = &LFSObjectError{Code: 404, Message: "object does not exist"}
+		}
+		resp.Objects = append(resp.Objects, out)
+	}
+	if s.madeUp != "" {
+		resp.Objects = append(resp.Objects, LFSBatchObject{LFSObject: LFSObject{OID: s.madeUp, Size: 1 << 20}, Actions: map[string]LFSAction{
+			LFSUpload:   {Href: s.URL + "/upload/made-up"},
+			LFSDownload: {Href: s.URL + "/download/made-up"},
+		}})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *testLFSServer) handleUpload(w http.ResponseWriter, r *http.Request) {
+	oid := r.PathValue("oid")
+	if r.Header.Get("X-Object-Auth") != "up-"+oid {
+		http.Error(w, "bad object token", http.StatusForbidden)
+		return
+	}
+	data, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != oid {
+		http.Error(w, "content does not match oid", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.objects[oid] = data
+	s.uploads++
+	s.mu.Unlock()
+}
+
+func (s *testLFSServer) handleVerify(w http.ResponseWriter, r *http.Request) {
+	var obj LFSObject
+	json.NewDecoder(r.Body).Decode(&obj)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if int64(len(s.objects[obj.OID])) != obj.Size {
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func (s *testLFSServer) handleDownload(w http.ResponseWriter, r *http.Request) {
+	oid := r.PathValue("oid")
+	if r.Header.Get("X-Object-Auth") != "down-"+oid {
+		http.Error(w, "bad object token", http.StatusForbidden)
+		return
+	}
+	s.mu.Lock()
+	data := s.objects[oid]
+	if r.Header.Get("Range") != "" {
+		s.rangeRequests++
+	}
+	if s.corrupt {
+		data = bytes.ToUpper(data)
+	}
+	s.mu.Unlock()
+	http.ServeContent(w, r, oid, time.Time{}, bytes.NewReader(data))
+}
+
+// setupLFSRepo commits one LFS-tracked file and points lfs.url at server.
+func setupLFSRepo(t *testing.T, server *testLFSServer) (*Repository, []byte, func()) {
+	t.Helper()
+	isolateConfig(t)
+	repo, _, cleanup := setupTestRepo(t)
+	SetConfigValue(repo.ConfigPath, "lfs.url", server.URL)
+	SetConfigValue(repo.ConfigPath, "lfs.accesstoken", server.Token)
+
+	TrackLFS(repo, "*.bin")
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	os.WriteFile("data.bin", content, 0644)
+	AddFiles(repo, []string{".zarkattributes", "data.bin"})
+	if _, err := CreateCommitWithOptions(repo, CommitOptions{Message: "add data", NoVerify: true}); err != nil {
+		t.Fatalf("CreateCommitWithOptions failed: %v", err)
+	}
+	return repo, content, cleanup
+}
+
+func TestLFSTransfer(t *testing.T) {
+	t.Run("Push uploads once and fetch restores missing objects", func(t *testing.T) {
+		server := newTestLFSServer(t)
+		repo, content, cleanup := setupLFSRepo(t, server)
+		defer cleanup()
+		oid := NewLFSPointer(content).OID
+
+		result, err := PushLFS(repo)
+		if err != nil || result.Err() != nil {
+			t.Fatalf("PushLFS failed: %v %v", err, result.Err())
+		}
+		if len(result.Transferred) != 1 || !bytes.Equal(server.objects[oid], content) {
+			t.Fatalf("Expected the object on the server, got %+v", result)
+		}
+
+		// The server already has everything, so nothing is sent again.
+		os.Remove(lfsPushedPath(repo))
+		PushLFS(repo)
+		if server.uploads != 1 {
+			t.Errorf("Expected a single upload, got %d", server.uploads)
+		}
+
+		os.Remove(LFSObjectPath(repo, oid))
+		result, err = FetchLFS(repo, "HEAD")
+		if err != nil || result.Err() != nil {
+			t.Fatalf("FetchLFS failed: %v %v", err, result.Err())
+		}
+		stored, _ := os.ReadFile(LFSObjectPath(repo, oid))
+		if !bytes.Equal(stored, content) {
+			t.Error("Expected the fetched object to match the original")
+		}
+	})
+
+	t.Run("Interrupted downloads resume with a range request", func(t *testing.T) {
+		server := newTestLFSServer(t)
+		repo, content, cleanup := setupLFSRepo(t, server)
+		defer cleanup()
+		oid := NewLFSPointer(content).OID
+		PushLFS(repo)
+		os.Remove(LFSObjectPath(repo, oid))
+
+		partial := filepath.Join(repo.ZarkDir, "lfs", "incomplete", oid+".part")
+		os.MkdirAll(filepath.Dir(partial), 0755)
+		os.WriteFile(partial, content[:len(content)/2], 0644)
+
+		result, err := FetchLFS(repo, "HEAD")
+		if err != nil || result.Err() != nil {
+			t.Fatalf("FetchLFS failed: %v %v", err, result.Err())
+		}
+		if server.rangeRequests != 1 {
+			t.Errorf("Expected the download to resume with a range request, got %d", server.rangeRequests)
+		}
+		stored, _ := os.ReadFile(LFSObjectPath(repo, oid))
+		if !bytes.Equal(stored, content) {
+			t.Error("Expected the resumed object to match the original")
+		}
+	})
+
+	t.Run("Corrupt downloads are rejected", func(t *testing.T) {
+		server := newTestLFSServer(t)
+		repo, content, cleanup := setupLFSRepo(t, server)
+		defer cleanup()
+		oid := NewLFSPointer(content).OID
+		PushLFS(repo)
+		os.Remove(LFSObjectPath(repo, oid))
+
+		server.corrupt = true
+		result, err := FetchLFS(repo, "HEAD")
+		if err != nil {
+			t.Fatalf("FetchLFS failed: %v", err)
+		}
+		if result.Err() == nil || HasLFSObject(repo, oid) {
+			t.Error("Expected corrupt content to be rejected and not stored")
+		}
+	})
+
+	t.Run("Objects without a download action are reported", func(t *testing.T) {
+		server := newTestLFSServer(t)
+		repo, content, cleanup := setupLFSRepo(t, server)
+		defer cleanup()
+		oid := NewLFSPointer(content).OID
+		PushLFS(repo)
+		os.Remove(LFSObjectPath(repo, oid))
+
+		server.noDownloads = true
+		result, err := FetchLFS(repo, "HEAD")
+		if err != nil {
+			t.Fatalf("FetchLFS failed: %v", err)
+		}
+		if result.Err() == nil || result.Skipped != 0 || len(result.Failed) != 1 {
+			t.Errorf("Expected the missing download to fail, got %+v", result)
+		}
+	})
+
+	t.Run("Objects the server made up are ignored", func(t *testing.T) {
+		server := newTestLFSServer(t)
+		repo, content, cleanup := setupLFSRepo(t, server)
+		defer cleanup()
+		oid := NewLFSPointer(content).OID
+		server.madeUp = "../../config"
+
+		result, err := PushLFS(repo)
+		if err != nil || result.Err() != nil || len(result.Transferred) != 1 || server.uploads != 1 {
+			t.Fatalf("Expected only the requested object to be uploaded, got %+v %v", result, err)
+		}
+		os.Remove(LFSObjectPath(repo, oid))
+		result, err = FetchLFS(repo, "HEAD")
+		if err != nil || result.Err() != nil || len(result.Transferred) != 1 || result.Transferred[0].OID != oid {
+			t.Errorf("Expected only the requested object to be downloaded, got %+v %v", result, err)
+		}
+		if _, err := os.Stat(filepath.Join(repo.ZarkDir, "config.part")); !os.IsNotExist(err) {
+			t.Error("Expected nothing to be written outside the LFS store")
+		}
+	})
+
+	t.Run("Batch requests need valid credentials", func(t *testing.T) {
+		server := newTestLFSServer(t)
+		repo, _, cleanup := setupLFSRepo(t, server)
+		defer cleanup()
+
+		SetConfigValue(repo.ConfigPath, "lfs.accesstoken", "wrong")
+		_, err := PushLFS(repo)
+		if err == nil || !strings.Contains(err.Error(), "credentials needed") {
+			t.Errorf("Expected the server's refusal to be reported, got %v", err)
+		}
+	})
+
+	t.Run("Pull replaces checked out pointers with content", func(t *testing.T) {
+		server := newTestLFSServer(t)
+		repo, content, cleanup := setupLFSRepo(t, server)
+		defer cleanup()
+		pointer := NewLFSPointer(content)
+		PushLFS(repo)
+
+		os.Remove(LFSObjectPath(repo, pointer.OID))
+		os.WriteFile("data.bin", pointer.Bytes(), 0644)
+
+		_, updated, err := PullLFS(repo)
+		if err != nil {
+			t.Fatalf("PullLFS failed: %v", err)
+		}
+		working, _ := os.ReadFile("data.bin")
+		if len(updated) != 1 || !bytes.Equal(working, content) {
+			t.Errorf("Expected data.bin to be replaced with its content, updated %v", updated)
+		}
+	})
+}
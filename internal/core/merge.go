@@ -0,0 +1,451 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Files recording a merge that stopped on conflicts, inside .zark.
+const (
+	mergeHeadFile      = "MERGE_HEAD"      // The commit being merged in
+	mergeMsgFile       = "MERGE_MSG"       // The message for the merge commit
+	mergeConflictsFile = "MERGE_CONFLICTS" // Paths left with conflicts, one per line
+)
+
+// MergeConflict is a path both sides changed in ways that could not be
+// combined automatically.
+type MergeConflict struct {
+	Path string
+	// Reason explains conflicts that could not be marked up in the file,
+	// such as a file deleted on one side and changed on the other. It is
+	// empty when the file holds <<<<<<< conflict markers.
+	Reason string
+}
+
+// treeMerge is the outcome of a three-way merge of trees.
+type treeMerge struct {
+	// Entries is the merged tree, sorted by path. Conflicted paths hold the
+	// version that is staged while the conflict is resolved.
+	Entries   []TreeEntry
+	Conflicts []MergeConflict
+	// markedUp holds the working-tree content, with conflict markers, of
+	// conflicted text files.
+	markedUp map[string][]byte
+}
+
+// MergeBase finds the best common ancestor of two commits: the first
+// ancestor of b, nearest first, that is also an ancestor of a. It returns ""
+// if the histories are unrelated.
+func MergeBase(storage *Storage, a, b string) (string, error) {
+	ancestors := make(map[string]bool)
+	pending := []string{a}
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if hash == "" || ancestors[hash] {
+			continue
+		}
+		ancestors[hash] = true
+		commit, err := storage.LoadCommit(hash)
+		if err != nil {
+			return "", err
+		}
+		pending = append(pending, commit.Parents()...)
+	}
+
+	seen := make(map[string]bool)
+	queue := []string{b}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if hash == "" || seen[hash] {
+			continue
+		}
+		if ancestors[hash] {
+			return hash, nil
+		}
+		seen[hash] = true
+		commit, err := storage.LoadCommit(hash)
+		if err != nil {
+			return "", err
+		}
+		queue = append(queue, commit.Parents()...)
+	}
+	return "", nil
+}
+
+// commitTreeEntries returns the tree of a commit by path; an empty commit
+// hash gives an empty tree.
+func commitTreeEntries(storage *Storage, commitHash string) (map[string]TreeEntry, error) {
+	entries := make(map[string]TreeEntry)
+	if commitHash == "" {
+		return entries, nil
+	}
+	commit, err := storage.LoadCommit(commitHash)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := storage.LoadTree(commit.TreeHash)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range tree.Entries {
+		entry.Mode = normalizeMode(entry.Mode)
+		entries[entry.Name] = entry
+	}
+	return entries, nil
+}
+
+// mergeTrees combines the changes ours and theirs made to base. Paths
+// changed on one side only take that side; text files changed on both are
+// merged line by line, with conflict markers where the changes overlap.
+func mergeTrees(storage *Storage, base, ours, theirs map[string]TreeEntry, oursLabel, theirsLabel string) (*treeMerge, error) {
+	paths := make(map[string]bool)
+	for _, side := range []map[string]TreeEntry{base, ours, theirs} {
+		for path := range side {
+			paths[path] = true
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	result := &treeMerge{markedUp: make(map[string][]byte)}
+	dmp := diffmatchpatch.New()
+	for _, path := range sorted {
+		b, inBase := base[path]
+		o, inOurs := ours[path]
+		t, inTheirs := theirs[path]
+		same := func(x TreeEntry, inX bool, y TreeEntry, inY bool) bool {
+			return inX == inY && (!inX || (x.Hash == y.Hash && x.Mode == y.Mode))
+		}
+
+		switch {
+		case same(o, inOurs, t, inTheirs), same(b, inBase, t, inTheirs):
+			if inOurs {
+				result.Entries = append(result.Entries, o)
+			}
+		case same(b, inBase, o, inOurs):
+			if inTheirs {
+				result.Entries = append(result.Entries, t)
+			}
+		case !inOurs || !inTheirs:
+			// Changed on one side, deleted on the other: keep the change so
+			// nothing is lost, and let the user decide.
+			kept, deletedBy, changedBy := o, theirsLabel, oursLabel
+			if !inOurs {
+				kept, deletedBy, changedBy = t, oursLabel, theirsLabel
+			}
+			result.Entries = append(result.Entries, kept)
+			result.Conflicts = append(result.Conflicts, MergeConflict{
+				Path:   path,
+				Reason: fmt.Sprintf("deleted in %s but changed in %s", deletedBy, changedBy),
+			})
+		default:
+			merged, err := mergeFile(storage, dmp, b, inBase, o, t, oursLabel, theirsLabel)
+			if err != nil {
+				return nil, err
+			}
+			mode := o.Mode
+			if o.Mode == b.Mode {
+				mode = t.Mode
+			}
+			switch {
+			case merged.conflict == "" && !merged.markers:
+				blob := NewBlob(merged.content)
+				if err := storage.Store(blob); err != nil {
+					return nil, fmt.Errorf("failed to store merged %s: %w", path, err)
+				}
+				result.Entries = append(result.Entries, TreeEntry{Mode: mode, Name: path, Hash: blob.Hash(), Type: "blob"})
+			case merged.markers:
+				result.Entries = append(result.Entries, o)
+				result.markedUp[path] = merged.content
+				result.Conflicts = append(result.Conflicts, MergeConflict{Path: path})
+			default:
+				result.Entries = append(result.Entries, o)
+				result.Conflicts = append(result.Conflicts, MergeConflict{Path: path, Reason: merged.conflict})
+			}
+		}
+	}
+	return result, nil
+}
+
+// fileMerge is the outcome of merging one file changed on both sides.
+type fileMerge struct {
+	content []byte
+	// markers is set when content holds conflict markers.
+	markers bool
+	// conflict explains why the file could not be merged at all.
+	conflict string
+}
+
+func mergeFile(storage *Storage, dmp *diffmatchpatch.DiffMatchPatch, base TreeEntry, inBase bool, ours, theirs TreeEntry, oursLabel, theirsLabel string) (*fileMerge, error) {
+	if ours.Mode == ModeSymlink || theirs.Mode == ModeSymlink {
+		return &fileMerge{conflict: fmt.Sprintf("symbolic link changed in both; %s's version is kept", oursLabel)}, nil
+	}
+	var baseData []byte
+	if inBase {
+		data, err := storage.Load(base.Hash)
+		if err != nil {
+			return nil, err
+		}
+		baseData = data
+	}
+	oursData, err := storage.Load(ours.Hash)
+	if err != nil {
+		return nil, err
+	}
+	theirsData, err := storage.Load(theirs.Hash)
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range [][]byte{baseData, oursData, theirsData} {
+		if _, isPointer := ParseLFSPointer(data); isPointer || bytes.IndexByte(data, 0) >= 0 {
+			return &fileMerge{conflict: fmt.Sprintf("binary file changed in both; %s's version is kept", oursLabel)}, nil
+		}
+	}
+	content, clean := merge3(dmp, string(baseData), string(oursData), string(theirsData), oursLabel, theirsLabel)
+	return &fileMerge{content: []byte(content), markers: !clean}, nil
+}
+
+// splitLines splits text after each newline, keeping the newlines.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// matchLines maps each line of base to the line of other it is kept as, or
+// -1 if other removed or changed it.
+func matchLines(dmp *diffmatchpatch.DiffMatchPatch, base, other string) []int {
+	baseRunes, otherRunes, _ := dmp.DiffLinesToRunes(base, other)
+	matches := make([]int, len(baseRunes))
+	for i := range matches {
+		matches[i] = -1
+	}
+	i, j := 0, 0
+	for _, diff := range dmp.DiffMainRunes(baseRunes, otherRunes, false) {
+		n := len([]rune(diff.Text))
+		switch diff.Type {
+		case diffmatchpatch.DiffEqual:
+			for k := 0; k < n; k++ {
+				matches[i+k] = j + k
+			}
+			i += n
+			j += n
+		case diffmatchpatch.DiffDelete:
+			i += n
+		case diffmatchpatch.DiffInsert:
+			j += n
+		}
+	}
+	return matches
+}
+
+// merge3 merges the line changes ours and theirs made to base. Where both
+// changed the same lines differently, both versions are kept between
+// conflict markers and clean is false.
+func merge3(dmp *diffmatchpatch.DiffMatchPatch, base, ours, theirs, oursLabel, theirsLabel string) (string, bool) {
+	baseLines, oursLines, theirsLines := splitLines(base), splitLines(ours), splitLines(theirs)
+	toOurs, toTheirs := matchLines(dmp, base, ours), matchLines(dmp, base, theirs)
+
+	var out strings.Builder
+	clean := true
+	equal := func(a, b []string) bool { return strings.Join(a, "") == strings.Join(b, "") }
+	i, o, t := 0, 0, 0
+	for {
+		// Copy lines both sides kept in place.
+		for i < len(baseLines) && toOurs[i] == o && toTheirs[i] == t {
+			out.WriteString(baseLines[i])
+			i, o, t = i+1, o+1, t+1
+		}
+		if i == len(baseLines) && o == len(oursLines) && t == len(theirsLines) {
+			return out.String(), clean
+		}
+
+		// The changed region runs to the next base line both sides kept.
+		next, nextOurs, nextTheirs := len(baseLines), len(oursLines), len(theirsLines)
+		for k := i; k < len(baseLines); k++ {
+			if toOurs[k] >= 0 && toTheirs[k] >= 0 {
+				next, nextOurs, nextTheirs = k, toOurs[k], toTheirs[k]
+				break
+			}
+		}
+		baseChunk, oursChunk, theirsChunk := baseLines[i:next], oursLines[o:nextOurs], theirsLines[t:nextTheirs]
+		switch {
+		case equal(oursChunk, baseChunk):
+			out.WriteString(strings.Join(theirsChunk, ""))
+		case equal(theirsChunk, baseChunk), equal(oursChunk, theirsChunk):
+			out.WriteString(strings.Join(oursChunk, ""))
+		default:
+			clean = false
+			out.WriteString("<<<<<<< " + oursLabel + "\n")
+			writeChunk(&out, oursChunk)
+			out.WriteString("=======\n")
+			writeChunk(&out, theirsChunk)
+			out.WriteString(">>>>>>> " + theirsLabel + "\n")
+		}
+		i, o, t = next, nextOurs, nextTheirs
+	}
+}
+
+// writeChunk writes lines, making sure the last one ends with a newline so
+// a conflict marker can follow.
+func writeChunk(out *strings.Builder, lines []string) {
+	text := strings.Join(lines, "")
+	out.WriteString(text)
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		out.WriteString("\n")
+	}
+}
+
+// hasConflictMarkers reports whether data still holds the markers merge3
+// writes around a conflict.
+func hasConflictMarkers(data []byte) bool {
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "<<<<<<< ") || strings.HasPrefix(line, ">>>>>>> ") {
+			return true
+		}
+	}
+	return false
+}
+
+// storeTreeEntries stores a tree made of entries and returns its hash.
+func storeTreeEntries(storage *Storage, entries []TreeEntry) (string, error) {
+	tree := NewTree(entries)
+	if err := storage.Store(tree); err != nil {
+		return "", fmt.Errorf("failed to store tree object: %w", err)
+	}
+	return tree.Hash(), nil
+}
+
+// applyTreeMerge checks out the result of a merge: the merged tree is staged
+// and written to the working tree, with conflict markers in the conflicted
+// text files. The conflicted paths are recorded so saving can check they
+// have been resolved.
+func applyTreeMerge(repo *Repository, storage *Storage, merge *treeMerge) error {
+	if _, err := checkoutTree(repo, storage, merge.Entries); err != nil {
+		return err
+	}
+	modes := make(map[string]string, len(merge.Entries))
+	for _, entry := range merge.Entries {
+		modes[entry.Name] = entry.Mode
+	}
+	var paths []string
+	for _, conflict := range merge.Conflicts {
+		if err := checkTreePath(conflict.Path); err != nil {
+			return err
+		}
+		paths = append(paths, conflict.Path)
+		content, ok := merge.markedUp[conflict.Path]
+		if !ok {
+			continue
+		}
+		path := filepath.Join(repo.Path, filepath.FromSlash(conflict.Path))
+		info, statErr := os.Lstat(path)
+		if err := writeWorkingFile(path, content, modes[conflict.Path]); err != nil {
+			return err
+		}
+		if statErr == nil && info.Mode().Perm()&0200 == 0 {
+			// Lockable files stay read-only, as checkout left them.
+			if err := setWorkingFileWritable(repo, conflict.Path, false); err != nil {
+				return err
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	data := strings.Join(paths, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(repo.ZarkDir, mergeConflictsFile), []byte(data), 0644); err != nil {
+		return fmt.Errorf("failed to record conflicts: %w", err)
+	}
+	return nil
+}
+
+// unresolvedConflicts lists the recorded conflicted paths that are not fixed
+// yet: the working file or its staged content still holds conflict markers,
+// or the fixed file has not been added.
+func unresolvedConflicts(repo *Repository) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(repo.ZarkDir, mergeConflictsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conflicts: %w", err)
+	}
+	index, err := LoadIndex(repo.IndexPath)
+	if err != nil {
+		return nil, err
+	}
+	staged := make(map[string]string)
+	for _, entry := range index.Entries {
+		staged[entry.Path] = entry.Hash
+	}
+
+	storage := NewStorage(repo)
+	var unresolved []string
+	for _, path := range strings.Fields(string(data)) {
+		hash, ok := staged[path]
+		if !ok {
+			continue
+		}
+		content, err := storage.Load(hash)
+		if err != nil {
+			return nil, err
+		}
+		if hasConflictMarkers(content) || !workingFileMatches(repo, path, hash, content) {
+			unresolved = append(unresolved, path)
+		}
+	}
+	return unresolved, nil
+}
+
+// workingFileMatches reports whether the working file is the staged blob
+// hash, whose content is staged, or the large file its LFS pointer names.
+func workingFileMatches(repo *Repository, path, hash string, staged []byte) bool {
+	fullPath := filepath.Join(repo.Path, filepath.FromSlash(path))
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return false
+	}
+	content, _, err := readWorkingFile(fullPath, info)
+	if err != nil {
+		return false
+	}
+	if NewBlob(content).Hash() == hash {
+		return true
+	}
+	_, isPointer := ParseLFSPointer(staged)
+	return isPointer && NewBlob(NewLFSPointer(content).Bytes()).Hash() == hash
+}
+
+// MergeInProgress returns the commit being merged in if a merge stopped on
+// conflicts, or "".
+func MergeInProgress(repo *Repository) string {
+	data, err := os.ReadFile(filepath.Join(repo.ZarkDir, mergeHeadFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// clearMergeState forgets a stopped merge.
+func clearMergeState(repo *Repository) {
+	for _, name := range []string{mergeHeadFile, mergeMsgFile, mergeConflictsFile} {
+		os.Remove(filepath.Join(repo.ZarkDir, name))
+	}
+}
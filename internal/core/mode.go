@@ -0,0 +1,92 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// modeFromFileInfo returns the tree mode for a file found in the working tree.
+// The FileInfo must come from Lstat so that symlinks are not followed.
+func modeFromFileInfo(info os.FileInfo) string {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return ModeSymlink
+	}
+	if info.Mode().Perm()&0111 != 0 {
+		return ModeExecutable
+	}
+	return ModeFile
+}
+
+// normalizeMode maps entries written before modes were tracked to ModeFile.
+func normalizeMode(mode string) string {
+	if mode == "" {
+		return ModeFile
+	}
+	return mode
+}
+
+// readWorkingFile reads a file from the working tree the way it is stored in a blob:
+// regular files yield their content, symlinks yield their target.
+func readWorkingFile(path string, info os.FileInfo) ([]byte, string, error) {
+	mode := modeFromFileInfo(info)
+	if mode == ModeSymlink {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read symlink %s: %w", path, err)
+		}
+		return []byte(target), mode, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	return content, mode, nil
+}
+
+// writeWorkingFile materializes blob content in the working tree with the given mode.
+// Any existing file or symlink at path is replaced, even a read-only one.
+func writeWorkingFile(path string, content []byte, mode string) error {
+	switch normalizeMode(mode) {
+	case ModeSymlink:
+		if _, err := os.Lstat(path); err == nil {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to replace %s: %w", path, err)
+			}
+		}
+		if err := os.Symlink(string(content), path); err != nil {
+			return fmt.Errorf("failed to create symlink %s: %w", path, err)
+		}
+		return nil
+	case ModeExecutable:
+		return replaceFile(path, content, 0755)
+	default:
+		return replaceFile(path, content, 0644)
+	}
+}
+
+// replaceFile writes content to a temporary file next to path and renames
+// it into place, so the old file survives if writing fails and read-only
+// files can be replaced.
+func replaceFile(path string, content []byte, perm os.FileMode) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), ".zark-write-*")
+	if err != nil {
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	_, err = temp.Write(content)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// findIndexEntry returns the index entry for path, failing the test if it is missing.
+func findIndexEntry(t *testing.T, repo *Repository, path string) IndexEntry {
+	t.Helper()
+	index, err := LoadIndex(repo.IndexPath)
+	if err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	for _, entry := range index.Entries {
+		if entry.Path == path {
+			return entry
+		}
+	}
+	t.Fatalf("%s was not found in the index", path)
+	return IndexEntry{}
+}
+
+func TestFileModes(t *testing.T) {
+	t.Run("Executable files and symlinks are recorded with their modes", func(t *testing.T) {
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		os.WriteFile("run.sh", []byte("#!/bin/sh\necho hi\n"), 0755)
+		if err := os.Symlink("test.txt", "link.txt"); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+
+		if err := AddFiles(repo, []string{"run.sh", "link.txt"}); err != nil {
+			t.Fatalf("AddFiles failed: %v", err)
+		}
+
+		if mode := findIndexEntry(t, repo, "run.sh").Mode; mode != ModeExecutable {
+			t.Errorf("Expected run.sh to have mode %s, got %s", ModeExecutable, mode)
+		}
+		link := findIndexEntry(t, repo, "link.txt")
+		if link.Mode != ModeSymlink {
+			t.Errorf("Expected link.txt to have mode %s, got %s", ModeSymlink, link.Mode)
+		}
+		if link.Hash != NewBlob([]byte("test.txt")).Hash() {
+			t.Error("Expected the symlink blob to contain the link target")
+		}
+	})
+
+	t.Run("Checkout restores executable bits and symlinks", func(t *testing.T) {
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		os.WriteFile("run.sh", []byte("#!/bin/sh\n"), 0755)
+		os.Symlink("test.txt", "link.txt")
+		AddFiles(repo, []string{"run.sh", "link.txt"})
+		if _, err := CreateCommit(repo, "add script and link", false); err != nil {
+			t.Fatalf("CreateCommit failed: %v", err)
+		}
+
+		os.Remove("run.sh")
+		os.Remove("link.txt")
+		if err := Checkout(repo, "main"); err != nil {
+			t.Fatalf("Checkout failed: %v", err)
+		}
+
+		info, err := os.Stat("run.sh")
+		if err != nil {
+			t.Fatalf("run.sh was not restored: %v", err)
+		}
+		if info.Mode().Perm()&0100 == 0 {
+			t.Errorf("Expected run.sh to be executable, got %v", info.Mode())
+		}
+
+		target, err := os.Readlink("link.txt")
+		if err != nil {
+			t.Fatalf("link.txt was not restored as a symlink: %v", err)
+		}
+		if target != "test.txt" {
+			t.Errorf("Expected link.txt to point to test.txt, got %s", target)
+		}
+	})
+
+	t.Run("Status reports mode-only changes", func(t *testing.T) {
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		if err := os.Chmod("test.txt", 0755); err != nil {
+			t.Fatalf("Failed to chmod test.txt: %v", err)
+		}
+
+		oldStdout := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+
+		err := GetStatus(repo)
+
+		w.Close()
+		os.Stdout = oldStdout
+
+		if err != nil {
+			t.Fatalf("GetStatus failed: %v", err)
+		}
+
+		var buf bytes.Buffer
+		buf.ReadFrom(r)
+		output := buf.String()
+
+		if !strings.Contains(output, "mode changed 100644 -> 100755:   test.txt") {
+			t.Errorf("Expected status to report a mode change for test.txt. Got:\n%s", output)
+		}
+	})
+}
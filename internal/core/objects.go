@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"strings"
 	"time"
 )
 
@@ -38,6 +39,13 @@ type Tree struct {
 	hash    string
 }
 
+// File modes recorded in tree and index entries.
+const (
+	ModeFile       = "100644" // A regular, non-executable file
+	ModeExecutable = "100755" // A regular file with the executable bit set
+	ModeSymlink    = "120000" // A symbolic link; the blob holds the link target
+)
+
 type TreeEntry struct {
 	Mode string `json:"mode"`
 	Name string `json:"name"`
@@ -45,6 +53,19 @@ type TreeEntry struct {
 	Type string `json:"type"`
 }
 
+// isObjectHash reports whether s is an object hash: 64 lowercase hex digits.
+func isObjectHash(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
 func NewTree(entries []TreeEntry) *Tree {
 	data, _ := json.Marshal(entries)
 	hash := sha256.Sum256(data)
@@ -62,14 +83,24 @@ func (t *Tree) Data() []byte {
 }
 
 // Commit represents a snapshot of the repository at a specific time.
+// Author, Email and Timestamp describe who wrote the change and when; Committer
+// records who created the commit object, which differs when applying someone
+// else's work. Older commits have no Committer and are treated as self-committed.
 type Commit struct {
-	TreeHash  string    `json:"tree"`
-	Parent    string    `json:"parent,omitempty"`
-	Author    string    `json:"author"`
-	Email     string    `json:"email"`
-	Timestamp time.Time `json:"timestamp"`
-	Message   string    `json:"message"`
+	TreeHash string `json:"tree"`
+	Parent   string `json:"parent,omitempty"`
+	// MergeParents are the other commits a merge commit combines with Parent.
+	MergeParents []string  `json:"merge_parents,omitempty"`
+	Author       string    `json:"author"`
+	Email        string    `json:"email"`
+	Timestamp    time.Time `json:"timestamp"`
+	Committer    *Identity `json:"committer,omitempty"`
+	Message      string    `json:"message"`
+	// Signature is kept outside the message and excluded from SigningPayload.
+	Signature *CommitSignature `json:"signature,omitempty"`
 	hash      string
+	// grafted is set on the commits a shallow clone has without parents.
+	grafted bool
 }
 
 func NewCommit(treeHash, parent, author, email, message string) *Commit {
@@ -85,6 +116,73 @@ func NewCommit(treeHash, parent, author, email, message string) *Commit {
 	return commit
 }
 
+// NewCommitWithIdentities creates a commit with separate author and committer identities.
+func NewCommitWithIdentities(treeHash, parent string, author, committer Identity, message string) *Commit {
+	commit := &Commit{
+		TreeHash:  treeHash,
+		Parent:    parent,
+		Author:    author.Name,
+		Email:     author.Email,
+		Timestamp: author.When,
+		Committer: &committer,
+		Message:   message,
+	}
+	commit.rehash()
+	return commit
+}
+
+// AuthorIdentity returns the author of the commit.
+func (c *Commit) AuthorIdentity() Identity {
+	return Identity{Name: c.Author, Email: c.Email, When: c.Timestamp}
+}
+
+// CommitterIdentity returns the committer, falling back to the author for
+// commits created before the two were recorded separately.
+func (c *Commit) CommitterIdentity() Identity {
+	if c.Committer != nil {
+		return *c.Committer
+	}
+	return c.AuthorIdentity()
+}
+
+// Parents returns the hashes of the commit's parents, first parent first;
+// the first commit has none and a merge commit has several. In a shallow
+// clone, the oldest commits fetched have none either.
+func (c *Commit) Parents() []string {
+	if c.grafted {
+		return nil
+	}
+	return c.recordedParents()
+}
+
+// recordedParents returns the parents stored in the commit, even those a
+// shallow clone does not have.
+func (c *Commit) recordedParents() []string {
+	if c.Parent == "" {
+		return nil
+	}
+	return append([]string{c.Parent}, c.MergeParents...)
+}
+
+// Trailers returns the "Key: value" trailers at the end of the commit message.
+func (c *Commit) Trailers() []Trailer {
+	return ParseTrailers(c.Message)
+}
+
+// CoAuthors returns the identities listed in Co-authored-by trailers.
+func (c *Commit) CoAuthors() []Identity {
+	var coAuthors []Identity
+	for _, trailer := range c.Trailers() {
+		if !strings.EqualFold(trailer.Key, TrailerCoAuthoredBy) {
+			continue
+		}
+		if identity, err := ParseIdentity(trailer.Value); err == nil {
+			coAuthors = append(coAuthors, identity)
+		}
+	}
+	return coAuthors
+}
+
 // rehash recalculates the commit's hash. This is needed after modification (e.g., signing).
 func (c *Commit) rehash() {
 	data, _ := json.Marshal(c)
@@ -97,4 +195,4 @@ func (c *Commit) Type() string { return "commit" }
 func (c *Commit) Data() []byte {
 	data, _ := json.Marshal(c)
 	return data
-}
\ No newline at end of file
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -39,12 +40,19 @@ func NewPacker(repo *Repository) (*Packer, error) {
 		return nil, fmt.Errorf("failed to scan for loose objects: %w", err)
 	}
 
+	packer := NewObjectPacker(repo)
+	packer.looseObjects = looseObjects
+	return packer, nil
+}
+
+// NewObjectPacker returns a Packer for writing chosen objects with WritePack,
+// without scanning for loose objects.
+func NewObjectPacker(repo *Repository) *Packer {
 	return &Packer{
-		repo:         repo,
-		storage:      NewStorage(repo),
-		looseObjects: looseObjects,
-		dmp:          diffmatchpatch.New(),
-	}, nil
+		repo:    repo,
+		storage: NewStorage(repo),
+		dmp:     diffmatchpatch.New(),
+	}
 }
 
 // PackObjects creates a single .pack file and a .idx file with delta compression.
@@ -56,24 +64,83 @@ func (p *Packer) PackObjects() (string, error) {
 	sort.Strings(p.looseObjects)
 
 	var packData bytes.Buffer
-	var packEntries []PackEntry
-	packedObjects := make(map[string][]byte)
+	packEntries, packHash, err := p.writePack(&packData, p.looseObjects, func(hash string) ([]byte, error) {
+		return p.storage.loadLoose(filepath.Join(p.repo.ObjectsDir, hash[:2], hash[2:]), hash)
+	})
+	if err != nil {
+		return "", err
+	}
 
-	packData.Write([]byte("PACK"))
-	binary.Write(&packData, binary.BigEndian, uint32(2))
-	binary.Write(&packData, binary.BigEndian, uint32(len(p.looseObjects)))
+	packDir := filepath.Join(p.repo.ZarkDir, "pack")
+	os.MkdirAll(packDir, 0755)
+	packFilePath := filepath.Join(packDir, fmt.Sprintf("pack-%s.pack", packHash))
+
+	if err := os.WriteFile(packFilePath, packData.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("failed to write packfile: %w", err)
+	}
+
+	if err := p.writeIndex(packHash, packEntries); err != nil {
+		return "", fmt.Errorf("failed to write pack index: %w", err)
+	}
 
 	for _, hash := range p.looseObjects {
-		objData, err := p.storage.loadLoose(filepath.Join(p.repo.ObjectsDir, hash[:2], hash[2:]), hash)
+		os.Remove(filepath.Join(p.repo.ObjectsDir, hash[:2], hash[2:]))
+	}
+
+	return packHash, nil
+}
+
+// WritePack streams a pack holding the given objects, loose or packed, to w.
+// Objects are read and written one at a time, so the pack is never held in
+// memory as a whole.
+func (p *Packer) WritePack(w io.Writer, hashes []string) error {
+	_, _, err := p.writePack(w, hashes, p.storage.Load)
+	return err
+}
+
+// packWindow is how many of the most recently written objects are tried as
+// delta bases for the next one.
+const packWindow = 10
+
+// countingWriter tracks how many bytes went through it, to record offsets.
+type countingWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += uint64(n)
+	return n, err
+}
+
+// writePack writes the pack header, the objects and the trailing checksum to
+// w. Deltas only refer to objects earlier in the same pack, so a reader can
+// resolve them as it goes. It returns the entries for the index and the pack
+// checksum.
+func (p *Packer) writePack(w io.Writer, hashes []string, load func(string) ([]byte, error)) ([]PackEntry, string, error) {
+	checksum := sha256.New()
+	out := &countingWriter{w: io.MultiWriter(w, checksum)}
+
+	var header bytes.Buffer
+	header.Write([]byte("PACK"))
+	binary.Write(&header, binary.BigEndian, uint32(2))
+	binary.Write(&header, binary.BigEndian, uint32(len(hashes)))
+	if _, err := out.Write(header.Bytes()); err != nil {
+		return nil, "", fmt.Errorf("failed to write pack: %w", err)
+	}
+
+	var packEntries []PackEntry
+	var window []string
+	windowData := make(map[string][]byte)
+	for _, hash := range hashes {
+		objData, err := load(hash)
 		if err != nil {
-			return "", fmt.Errorf("could not load object %s for packing: %w", hash, err)
+			return nil, "", fmt.Errorf("could not load object %s for packing: %w", hash, err)
 		}
-		packedObjects[hash] = objData
-
-		baseHash, delta := p.findBestDelta(hash, objData, packedObjects)
 
-		currentOffset := uint64(packData.Len())
-		packEntries = append(packEntries, PackEntry{Hash: hash, Offset: currentOffset})
+		baseHash, delta := p.findBestDelta(hash, objData, windowData)
+		packEntries = append(packEntries, PackEntry{Hash: hash, Offset: out.n})
 
 		var objType uint8
 		var dataToWrite []byte
@@ -87,35 +154,30 @@ func (p *Packer) PackObjects() (string, error) {
 			dataToWrite = objData
 		}
 
-		p.writePackObjectHeader(&packData, objType, uint64(len(dataToWrite)))
-
-		writer := zlib.NewWriter(&packData)
+		var object bytes.Buffer
+		p.writePackObjectHeader(&object, objType, uint64(len(dataToWrite)))
+		writer := zlib.NewWriter(&object)
 		writer.Write(dataToWrite)
 		writer.Close()
-	}
-
-	packHashBytes := sha256.Sum256(packData.Bytes())
-	packHash := hex.EncodeToString(packHashBytes[:])
-	packDir := filepath.Join(p.repo.ZarkDir, "pack")
-	os.MkdirAll(packDir, 0755)
-	packFilePath := filepath.Join(packDir, fmt.Sprintf("pack-%s.pack", packHash))
-
-	checksum := sha256.Sum256(packData.Bytes())
-	packData.Write(checksum[:])
-
-	if err := os.WriteFile(packFilePath, packData.Bytes(), 0644); err != nil {
-		return "", fmt.Errorf("failed to write packfile: %w", err)
-	}
+		if _, err := out.Write(object.Bytes()); err != nil {
+			return nil, "", fmt.Errorf("failed to write pack: %w", err)
+		}
 
-	if err := p.writeIndex(packHash, packEntries); err != nil {
-		return "", fmt.Errorf("failed to write pack index: %w", err)
+		if _, ok := windowData[hash]; !ok {
+			window = append(window, hash)
+			windowData[hash] = objData
+			if len(window) > packWindow {
+				delete(windowData, window[0])
+				window = window[1:]
+			}
+		}
 	}
 
-	for _, hash := range p.looseObjects {
-		os.Remove(filepath.Join(p.repo.ObjectsDir, hash[:2], hash[2:]))
+	sum := checksum.Sum(nil)
+	if _, err := w.Write(sum); err != nil {
+		return nil, "", fmt.Errorf("failed to write pack: %w", err)
 	}
-
-	return packHash, nil
+	return packEntries, hex.EncodeToString(sum), nil
 }
 
 func (p *Packer) findBestDelta(currentHash string, currentData []byte, packedObjects map[string][]byte) (string, []byte) {
@@ -141,7 +203,11 @@ func (p *Packer) findBestDelta(currentHash string, currentData []byte, packedObj
 	}
 
 	if bestDelta != nil && len(bestDelta) < len(currentData) {
-		return bestBaseHash, bestDelta
+		// Text patches cannot always reproduce binary content exactly, so
+		// only keep a delta that rebuilds the object byte for byte.
+		if _, err := applyDelta(p.dmp, packedObjects[bestBaseHash], bestDelta, currentHash); err == nil {
+			return bestBaseHash, bestDelta
+		}
 	}
 
 	return "", nil
@@ -161,9 +227,6 @@ func (p *Packer) writePackObjectHeader(buf *bytes.Buffer, objType uint8, size ui
 		headerByte = uint8(size & 0x7F)
 		size >>= 7
 	}
-	for i, j := 0, len(header)-1; i < j; i, j = i+1, j-1 {
-		header[i], header[j] = header[j], header[i]
-	}
 	buf.Write(header)
 }
 
@@ -0,0 +1,323 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// shallowFile lists, one per line, the commits of a shallow clone whose
+// parents were not fetched. They are treated as having no parents.
+const shallowFile = "shallow"
+
+// ObjectFilter selects the blobs a partial clone leaves out, to be fetched
+// from the promisor remote when first needed.
+type ObjectFilter struct {
+	// Spec is the filter as given: "blob:none" or "blob:limit=<size>".
+	Spec string
+	// limit is the largest blob kept, or -1 to leave out every blob.
+	limit int64
+}
+
+// ParseObjectFilter parses "blob:none", which leaves out every blob, or
+// "blob:limit=<size>", which leaves out blobs larger than size. The size may
+// end in k, m or g.
+func ParseObjectFilter(spec string) (*ObjectFilter, error) {
+	if spec == "blob:none" {
+		return &ObjectFilter{Spec: spec, limit: -1}, nil
+	}
+	size, ok := strings.CutPrefix(spec, "blob:limit=")
+	if !ok {
+		return nil, fmt.Errorf("unknown filter '%s' (use blob:none or blob:limit=<size>, e.g. blob:limit=1m)", spec)
+	}
+	multiplier := int64(1)
+	switch strings.ToLower(size[max(len(size)-1, 0):]) {
+	case "k":
+		multiplier = 1 << 10
+	case "m":
+		multiplier = 1 << 20
+	case "g":
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		size = size[:len(size)-1]
+	}
+	limit, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || limit < 0 {
+		return nil, fmt.Errorf("invalid size in filter '%s'", spec)
+	}
+	return &ObjectFilter{Spec: spec, limit: limit * multiplier}, nil
+}
+
+// excludes reports whether a blob of the given size is left out.
+func (f *ObjectFilter) excludes(size int) bool {
+	return f != nil && (f.limit < 0 || int64(size) > f.limit)
+}
+
+// fetchRequest says what a fetch wants from a remote.
+type fetchRequest struct {
+	// Wants are the commits to fetch along with their history.
+	Wants []string
+	// Depth limits the history to that many commits from each want; 0
+	// fetches all of it.
+	Depth int
+	// Filter leaves blobs out, for a partial clone.
+	Filter *ObjectFilter
+	// Objects, if set, are exactly the objects to fetch, without walking
+	// anything. Partial clones use it to fill in the blobs left out.
+	Objects []string
+}
+
+// fetchReply is what a remote sent for a fetchRequest.
+type fetchReply struct {
+	Objects int
+	// Shallow are the fetched commits whose parents were left out by Depth.
+	Shallow []string
+}
+
+// selectObjects lists the objects req needs that the fetching side does not
+// have, according to has, and the commits where req.Depth cut the history.
+// A commit the fetching side has is assumed to come with its history, so the
+// list puts blobs and trees first and each commit after its parents: a copy
+// stored in that order and cut short never leaves a commit without them.
+func selectObjects(storage *Storage, has func(hash string) bool, req fetchRequest) ([]string, []string, error) {
+	var objects, shallow []string
+	if req.Objects != nil {
+		for _, hash := range req.Objects {
+			if !storage.Has(hash) {
+				return nil, nil, fmt.Errorf("the repository has no object %s", hash)
+			}
+			if !has(hash) {
+				objects = append(objects, hash)
+			}
+		}
+		return objects, nil, nil
+	}
+
+	type queued struct {
+		hash  string
+		depth int
+	}
+	seen := make(map[string]bool)
+	var trees, commits []string
+	parents := make(map[string][]string)
+	var queue []queued
+	for _, want := range req.Wants {
+		queue = append(queue, queued{want, 1})
+	}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if next.hash == "" || seen[next.hash] || has(next.hash) {
+			continue
+		}
+		seen[next.hash] = true
+		commits = append(commits, next.hash)
+
+		commit, err := storage.LoadCommit(next.hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		parents[next.hash] = commit.Parents()
+		if !seen[commit.TreeHash] && !has(commit.TreeHash) {
+			seen[commit.TreeHash] = true
+			trees = append(trees, commit.TreeHash)
+			tree, err := storage.LoadTree(commit.TreeHash)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, entry := range tree.Entries {
+				if seen[entry.Hash] || has(entry.Hash) {
+					continue
+				}
+				if req.Filter != nil {
+					if req.Filter.limit < 0 || !storage.Has(entry.Hash) {
+						continue
+					}
+					data, err := storage.Load(entry.Hash)
+					if err != nil {
+						return nil, nil, err
+					}
+					if req.Filter.excludes(len(data)) {
+						continue
+					}
+				}
+				seen[entry.Hash] = true
+				objects = append(objects, entry.Hash)
+			}
+		}
+
+		if req.Depth > 0 && next.depth >= req.Depth {
+			if len(commit.recordedParents()) > 0 {
+				shallow = append(shallow, next.hash)
+			}
+			continue
+		}
+		if commit.grafted {
+			return nil, nil, fmt.Errorf("the history before %s is missing here (shallow clone), so it cannot be sent.\n"+
+				"hint: run 'zark fetch --unshallow' to fetch the rest of the history first", next.hash[:8])
+		}
+		for _, parent := range parents[next.hash] {
+			queue = append(queue, queued{parent, next.depth + 1})
+		}
+	}
+	objects = append(objects, trees...)
+	objects = append(objects, parentsFirst(commits, parents)...)
+	return objects, shallow, nil
+}
+
+// parentsFirst orders commits so that each comes after those of its parents
+// that are among them. parents holds the parents of every commit listed.
+func parentsFirst(commits []string, parents map[string][]string) []string {
+	ordered := make([]string, 0, len(commits))
+	done := make(map[string]bool)
+	for _, start := range commits {
+		stack := []string{start}
+		for len(stack) > 0 {
+			hash := stack[len(stack)-1]
+			if done[hash] {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			waiting := false
+			for _, parent := range parents[hash] {
+				if _, listed := parents[parent]; listed && !done[parent] {
+					stack = append(stack, parent)
+					waiting = true
+				}
+			}
+			if !waiting {
+				done[hash] = true
+				ordered = append(ordered, hash)
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	return ordered
+}
+
+// ShallowCommits returns the commits of a shallow clone whose parents were
+// not fetched, or nothing for a full clone.
+func ShallowCommits(repo *Repository) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(repo.ZarkDir, shallowFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the shallow commits: %w", err)
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// updateShallow adds the commits a fetch left without parents to the
+// shallow list, and drops those whose parents are all present now.
+func updateShallow(repo *Repository, added []string) error {
+	current, err := ShallowCommits(repo)
+	if err != nil {
+		return err
+	}
+	storage := NewStorage(repo)
+	seen := make(map[string]bool)
+	var shallow []string
+	for _, hash := range append(current, added...) {
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		commit, err := storage.LoadCommit(hash)
+		if err != nil {
+			return err
+		}
+		for _, parent := range commit.recordedParents() {
+			if !storage.Has(parent) {
+				shallow = append(shallow, hash)
+				break
+			}
+		}
+	}
+
+	path := filepath.Join(repo.ZarkDir, shallowFile)
+	if len(shallow) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to update the shallow commits: %w", err)
+		}
+		return nil
+	}
+	sort.Strings(shallow)
+	if err := os.WriteFile(path, []byte(strings.Join(shallow, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to update the shallow commits: %w", err)
+	}
+	return nil
+}
+
+// isShallow reports whether the commit's parents were left out of a
+// shallow clone.
+func (s *Storage) isShallow(hash string) bool {
+	if s.shallow == nil {
+		s.shallow = make(map[string]bool)
+		commits, _ := ShallowCommits(s.repo)
+		for _, commit := range commits {
+			s.shallow[commit] = true
+		}
+	}
+	return s.shallow[hash]
+}
+
+// promisorRemote returns the remote that promised to supply the objects a
+// partial clone left out, or nil.
+func (s *Storage) promisorRemote() *Remote {
+	if !s.promisorLoaded {
+		s.promisorLoaded = true
+		if remotes, err := ListRemotes(s.repo); err == nil {
+			for _, remote := range remotes {
+				if remote.Promisor {
+					s.promisor, _ = GetRemote(s.repo, remote.Name)
+					break
+				}
+			}
+		}
+	}
+	return s.promisor
+}
+
+// fetchPromised downloads objects a partial clone left out from its
+// promisor remote. It reports false if there is no promisor remote.
+func (s *Storage) fetchPromised(hashes []string) (bool, error) {
+	remote := s.promisorRemote()
+	if remote == nil {
+		return false, nil
+	}
+	conn, err := connectRemote(remote)
+	if err != nil {
+		return true, err
+	}
+	if _, err := conn.Fetch(s.repo, fetchRequest{Objects: hashes}); err != nil {
+		return true, fmt.Errorf("failed to fetch missing objects from '%s': %w", remote.Name, err)
+	}
+	return true, nil
+}
+
+// Prefetch downloads in one go the objects among hashes that a partial
+// clone left out, so that loading them one by one does not take a round
+// trip each. Outside partial clones it does nothing.
+func (s *Storage) Prefetch(hashes []string) error {
+	if s.promisorRemote() == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var missing []string
+	for _, hash := range hashes {
+		if !seen[hash] && !s.Has(hash) {
+			seen[hash] = true
+			missing = append(missing, hash)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	_, err := s.fetchPromised(missing)
+	return err
+}
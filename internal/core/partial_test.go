@@ -0,0 +1,137 @@
+package core
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseObjectFilter(t *testing.T) {
+	for spec, limit := range map[string]int64{"blob:none": -1, "blob:limit=0": 0, "blob:limit=500": 500, "blob:limit=1m": 1 << 20, "blob:limit=2k": 2 << 10} {
+		filter, err := ParseObjectFilter(spec)
+		if err != nil || filter.limit != limit {
+			t.Errorf("Expected %s to have limit %d, got %+v %v", spec, limit, filter, err)
+		}
+	}
+	for _, spec := range []string{"tree:0", "blob:limit=", "blob:limit=big", "blob:limit=-1"} {
+		if _, err := ParseObjectFilter(spec); err == nil {
+			t.Errorf("Expected %s to be refused", spec)
+		}
+	}
+}
+
+func TestShallowClone(t *testing.T) {
+	isolateConfig(t)
+	repo, _, cleanup := setupTestRepo(t)
+	defer cleanup()
+	first, _ := ResolveRef(repo, "HEAD")
+	second := commitFile(t, repo, "notes.txt", "one")
+	third := commitFile(t, repo, "notes.txt", "two")
+	fourth := commitFile(t, repo, "notes.txt", "three")
+	bare := setupBareRemote(t, repo)
+	if _, err := Push(repo, "origin", "main", PushOptions{}); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	clone, _, err := CloneWithOptions(bare.Path, filepath.Join(t.TempDir(), "shallow"), CloneOptions{Depth: 2})
+	if err != nil {
+		t.Fatalf("CloneWithOptions failed: %v", err)
+	}
+	if shallow, _ := ShallowCommits(clone); len(shallow) != 1 || shallow[0] != third {
+		t.Fatalf("Expected %s to be the shallow commit, got %v", third[:8], shallow)
+	}
+	storage := NewStorage(clone)
+	if !storage.Has(fourth) || storage.Has(second) {
+		t.Error("Expected only the last two commits to be cloned")
+	}
+	inDir(t, clone.Path, func() {
+		output := captureStdout(t, func() error { return ShowHistory(clone) })
+		if !strings.Contains(output, third) || strings.Contains(output, second) || !strings.Contains(output, "zark fetch --deepen") {
+			t.Errorf("Expected the history to stop at the shallow commit, got %q", output)
+		}
+
+		commitFile(t, clone, "notes.txt", "four")
+		if _, err := Push(clone, "origin", "main", PushOptions{}); err != nil {
+			t.Errorf("Expected a shallow clone to push new commits: %v", err)
+		}
+	})
+
+	if _, err := FetchWithOptions(clone, "origin", FetchOptions{Deepen: 1}); err != nil {
+		t.Fatalf("Deepen failed: %v", err)
+	}
+	if shallow, _ := ShallowCommits(clone); len(shallow) != 1 || shallow[0] != second {
+		t.Errorf("Expected the history to reach %s, got %v", second[:8], shallow)
+	}
+	if _, err := FetchWithOptions(clone, "origin", FetchOptions{Unshallow: true}); err != nil {
+		t.Fatalf("Unshallow failed: %v", err)
+	}
+	if shallow, _ := ShallowCommits(clone); len(shallow) != 0 || !NewStorage(clone).Has(first) {
+		t.Errorf("Expected the whole history after unshallowing, got %v", shallow)
+	}
+	if _, err := FetchWithOptions(clone, "origin", FetchOptions{Unshallow: true}); err == nil {
+		t.Error("Expected unshallowing a complete repository to be refused")
+	}
+}
+
+func TestPartialClone(t *testing.T) {
+	isolateConfig(t)
+	repo, _, cleanup := setupTestRepo(t)
+	defer cleanup()
+	oldBig := strings.Repeat("a", 4096)
+	commitFile(t, repo, "big.bin", oldBig)
+	commitFile(t, repo, "small.txt", "small v1")
+	commitFile(t, repo, "big.bin", strings.Repeat("b", 4096))
+	commitFile(t, repo, "small.txt", "small v2")
+	bare := setupBareRemote(t, repo)
+	if _, err := Push(repo, "origin", "main", PushOptions{}); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	url := serveOverHTTP(t, repo, bare)
+	oldBigHash, oldSmallHash := NewBlob([]byte(oldBig)).Hash(), NewBlob([]byte("small v1")).Hash()
+
+	t.Run("blob:none leaves out old blobs and fetches them when loaded", func(t *testing.T) {
+		clone, _, err := CloneWithOptions(url, filepath.Join(t.TempDir(), "partial"), CloneOptions{Filter: "blob:none"})
+		if err != nil {
+			t.Fatalf("CloneWithOptions failed: %v", err)
+		}
+		storage := NewStorage(clone)
+		if storage.Has(oldSmallHash) || storage.Has(oldBigHash) {
+			t.Fatal("Expected old blobs to be left out")
+		}
+		if !storage.Has(NewBlob([]byte("small v2")).Hash()) {
+			t.Error("Expected the checked-out blobs to be fetched")
+		}
+		data, err := storage.Load(oldSmallHash)
+		if err != nil || string(data) != "small v1" {
+			t.Fatalf("Expected the blob to be fetched on demand, got %q %v", data, err)
+		}
+		if !storage.Has(oldSmallHash) {
+			t.Error("Expected the fetched blob to be kept")
+		}
+
+		commitFile(t, repo, "later.txt", "later")
+		if _, err := Push(repo, "origin", "main", PushOptions{}); err != nil {
+			t.Fatalf("Push failed: %v", err)
+		}
+		if _, err := Fetch(clone, "origin"); err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		if storage.Has(NewBlob([]byte("later")).Hash()) {
+			t.Error("Expected later fetches to keep leaving blobs out")
+		}
+	})
+
+	t.Run("blob:limit leaves out only big blobs", func(t *testing.T) {
+		clone, _, err := CloneWithOptions(url, filepath.Join(t.TempDir(), "limited"), CloneOptions{Filter: "blob:limit=1k"})
+		if err != nil {
+			t.Fatalf("CloneWithOptions failed: %v", err)
+		}
+		storage := NewStorage(clone)
+		if !storage.Has(oldSmallHash) || storage.Has(oldBigHash) {
+			t.Error("Expected only the big blob to be left out")
+		}
+		if data, err := storage.Load(oldBigHash); err != nil || string(data) != oldBig {
+			t.Errorf("Expected the big blob to be fetched on demand: %v", err)
+		}
+	})
+}
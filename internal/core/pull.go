@@ -0,0 +1,790 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Pull strategies, chosen with pull.strategy or the pull command's flags.
+const (
+	PullMerge           = "merge"   // Combine diverged branches with a merge commit
+	PullRebase          = "rebase"  // Replay local commits on top of the upstream ones
+	PullFastForwardOnly = "ff-only" // Refuse to pull into a branch that has diverged
+)
+
+// State of a pull stopped on conflicts, inside .zark.
+const (
+	rebaseDir     = "rebase"    // Directory holding a stopped rebase
+	autostashFile = "AUTOSTASH" // Local changes put aside until the pull is done
+)
+
+// PullOptions controls how Pull integrates the upstream branch.
+type PullOptions struct {
+	// Strategy is PullMerge, PullRebase or PullFastForwardOnly; empty uses
+	// pull.strategy, which defaults to PullMerge.
+	Strategy string
+	// Autostash puts local changes aside during the pull and brings them
+	// back afterwards; nil uses pull.autostash.
+	Autostash *bool
+}
+
+// PullResult describes what a pull did to the current branch.
+type PullResult struct {
+	Branch   string
+	Upstream string // e.g. "origin/main"
+	Fetch    *FetchResult
+	// Outcome is "up to date", "fast-forward", "merge" or "rebase".
+	Outcome string
+	// Incoming are the upstream commits the branch did not have.
+	Incoming []*Commit
+	// Rebased and Skipped count the local commits replayed by a rebase, and
+	// those dropped because the upstream already had their changes.
+	Rebased, Skipped int
+	// Changed lists the files the pull changed.
+	Changed []PulledFile
+	// Conflicts is set when the pull stopped for conflicts to be fixed.
+	Conflicts []MergeConflict
+	// Stashed is set if local changes were put aside; StashConflicts lists
+	// those that clashed with the pulled changes when brought back.
+	Stashed        bool
+	StashConflicts []MergeConflict
+}
+
+// PulledFile is a file a pull added, modified or deleted.
+type PulledFile struct {
+	Path   string
+	Change string
+}
+
+// SetUpstream records that branch tracks remoteBranch on remote, so pull and
+// push know where to go without being told.
+func SetUpstream(repo *Repository, branch, remote, remoteBranch string) error {
+	if _, err := GetRemote(repo, remote); err != nil {
+		return err
+	}
+	if err := SetConfigValue(repo.ConfigPath, "branch."+branch+".remote", remote); err != nil {
+		return err
+	}
+	return SetConfigValue(repo.ConfigPath, "branch."+branch+".merge", remoteBranch)
+}
+
+// GetUpstream returns the remote and remote branch that branch tracks, or
+// empty strings if it has no upstream.
+func GetUpstream(repo *Repository, branch string) (remote, remoteBranch string, err error) {
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to load config: %w", err)
+	}
+	remote = config.GetString("branch."+branch+".remote", "")
+	if remote == "" {
+		return "", "", nil
+	}
+	return remote, config.GetString("branch."+branch+".merge", branch), nil
+}
+
+// Pull fetches the upstream of the current branch and brings its commits
+// into the branch: by fast-forwarding when the branch has no commits of its
+// own, otherwise with a merge commit or by rebasing, as opts choose. Local
+// changes are refused unless autostash puts them aside. If the merge or
+// rebase stops on conflicts, the result lists them and PullContinue or
+// PullAbort finishes the job.
+func Pull(repo *Repository, opts PullOptions) (*PullResult, error) {
+	if err := repo.RequireWorkTree(); err != nil {
+		return nil, err
+	}
+	if PullInProgress(repo) != "" {
+		return nil, errPullInProgress
+	}
+	branch, err := CurrentBranch(repo)
+	if err != nil {
+		return nil, err
+	}
+	if branch == "" {
+		return nil, fmt.Errorf("you are not on a branch, so there is nothing to pull into.\nhint: check out a branch first, e.g. 'zark checkout main'")
+	}
+	remote, remoteBranch, err := GetUpstream(repo, branch)
+	if err != nil {
+		return nil, err
+	}
+	if remote == "" {
+		return nil, fmt.Errorf("the branch '%s' has no upstream, so zark doesn't know what to pull.\n"+
+			"hint: run 'zark branch set-upstream %s/%s' to pull from the remote's '%s'", branch, DefaultRemote, branch, branch)
+	}
+
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	strategy := opts.Strategy
+	if strategy == "" {
+		strategy = config.GetString("pull.strategy", PullMerge)
+	}
+	if strategy != PullMerge && strategy != PullRebase && strategy != PullFastForwardOnly {
+		return nil, fmt.Errorf("unknown pull strategy '%s' (use %s, %s or %s)", strategy, PullMerge, PullRebase, PullFastForwardOnly)
+	}
+	autostash := config.GetBool("pull.autostash", false)
+	if opts.Autostash != nil {
+		autostash = *opts.Autostash
+	}
+
+	result := &PullResult{Branch: branch, Upstream: remote + "/" + remoteBranch, Outcome: "up to date"}
+	if result.Fetch, err = Fetch(repo, remote); err != nil {
+		return nil, err
+	}
+	theirs, err := ResolveRef(repo, "refs/remotes/"+result.Upstream)
+	if err != nil {
+		return nil, fmt.Errorf("the remote '%s' has no branch named '%s'.\n"+
+			"hint: pick the branch to pull with 'zark branch set-upstream %s/<branch>'", remote, remoteBranch, remote)
+	}
+	ours, _ := ResolveRef(repo, "refs/heads/"+branch)
+
+	storage := NewStorage(repo)
+	if result.Incoming, err = newCommits(storage, theirs, []string{ours}); err != nil {
+		return nil, err
+	}
+	if len(result.Incoming) == 0 {
+		return result, nil
+	}
+	var incoming []string
+	for _, commit := range result.Incoming {
+		incoming = append(incoming, commit.Hash())
+	}
+	if err := EnforceSignaturePolicy(repo, branch, incoming); err != nil {
+		return nil, err
+	}
+
+	fastForward := ours == ""
+	if !fastForward {
+		if fastForward, err = isAncestor(storage, ours, theirs); err != nil {
+			return nil, err
+		}
+	}
+	if !fastForward && strategy == PullFastForwardOnly {
+		outgoing, err := newCommits(storage, ours, []string{theirs})
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("cannot fast-forward: '%s' has %d commit(s) that '%s' doesn't have, and '%s' has %d that you don't.\n"+
+			"hint: run 'zark pull --merge' to combine them with a merge commit, or 'zark pull --rebase' to replay your commits on top",
+			branch, len(outgoing), result.Upstream, result.Upstream, len(result.Incoming))
+	}
+
+	oldTree, err := commitTreeEntries(storage, ours)
+	if err != nil {
+		return nil, err
+	}
+	changed, snapshot, err := localChanges(repo, storage, oldTree)
+	if err != nil {
+		return nil, err
+	}
+	if len(changed) > 0 {
+		if !autostash {
+			return nil, fmt.Errorf("your local changes to %s would be overwritten by the pull.\n"+
+				"hint: save them first with 'zark save', or run 'zark pull --autostash' to put them aside and bring them back afterwards",
+				describePaths(changed))
+		}
+		if err := saveAutostash(repo, storage, ours, snapshot); err != nil {
+			return nil, err
+		}
+		result.Stashed = true
+	}
+
+	switch {
+	case fastForward:
+		result.Outcome = "fast-forward"
+		if err := UpdateRef(repo, "refs/heads/"+branch, theirs); err != nil {
+			return nil, err
+		}
+		if err := Checkout(repo, branch); err != nil {
+			UpdateRef(repo, "refs/heads/"+branch, ours)
+			return nil, err
+		}
+	case strategy == PullRebase:
+		result.Outcome = "rebase"
+		err = startRebase(repo, storage, result, ours, theirs)
+	default:
+		result.Outcome = "merge"
+		err = pullMerge(repo, storage, result, ours, theirs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return finishPull(repo, storage, result, oldTree)
+}
+
+var errPullInProgress = fmt.Errorf("a pull that stopped on conflicts is still in progress.\n" +
+	"hint: fix the conflicts and run 'zark pull --continue', or run 'zark pull --abort' to go back")
+
+// PullInProgress returns "merge" or "rebase" if a pull stopped on conflicts
+// with that strategy, or "".
+func PullInProgress(repo *Repository) string {
+	if MergeInProgress(repo) != "" {
+		return "merge"
+	}
+	if _, err := os.Stat(filepath.Join(repo.ZarkDir, rebaseDir)); err == nil {
+		return "rebase"
+	}
+	return ""
+}
+
+// PullContinue finishes a pull that stopped on conflicts, once they are fixed
+// and staged: a merge is saved as a merge commit, and a rebase saves the
+// commit it stopped at and replays the rest.
+func PullContinue(repo *Repository) (*PullResult, error) {
+	if err := repo.RequireWorkTree(); err != nil {
+		return nil, err
+	}
+	unresolved, err := unresolvedConflicts(repo)
+	if err != nil {
+		return nil, err
+	}
+	if len(unresolved) > 0 {
+		return nil, conflictMarkersError(unresolved)
+	}
+	branch, err := CurrentBranch(repo)
+	if err != nil {
+		return nil, err
+	}
+	storage := NewStorage(repo)
+	result := &PullResult{Branch: branch}
+	if remote, remoteBranch, _ := GetUpstream(repo, branch); remote != "" {
+		result.Upstream = remote + "/" + remoteBranch
+	}
+
+	switch PullInProgress(repo) {
+	case "merge":
+		result.Outcome = "merge"
+		head, _ := ResolveRef(repo, "HEAD")
+		oldTree, err := commitTreeEntries(storage, head)
+		if err != nil {
+			return nil, err
+		}
+		message, err := os.ReadFile(filepath.Join(repo.ZarkDir, mergeMsgFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the merge message: %w", err)
+		}
+		if _, err := CreateCommitWithOptions(repo, CommitOptions{Message: strings.TrimSpace(string(message))}); err != nil {
+			return nil, err
+		}
+		return finishPull(repo, storage, result, oldTree)
+
+	case "rebase":
+		result.Outcome = "rebase"
+		state := filepath.Join(repo.ZarkDir, rebaseDir)
+		result.Upstream = readStateFile(state, "upstream")
+		oldTree, err := commitTreeEntries(storage, readStateFile(state, "orig-head"))
+		if err != nil {
+			return nil, err
+		}
+		stopped, err := storage.LoadCommit(readStateFile(state, "stopped"))
+		if err != nil {
+			return nil, err
+		}
+		unchanged, err := indexMatchesHead(repo, storage)
+		if err != nil {
+			return nil, err
+		}
+		if unchanged {
+			// The fix left nothing of the commit: the upstream had it already.
+			clearMergeState(repo)
+			result.Skipped++
+		} else {
+			author := stopped.AuthorIdentity()
+			_, err := CreateCommitWithOptions(repo, CommitOptions{
+				Message: stopped.Message, Author: &author, AuthorDate: stopped.Timestamp, NoVerify: true,
+			})
+			if err != nil {
+				return nil, err
+			}
+			result.Rebased++
+		}
+		tip, err := ResolveRef(repo, "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		if err := replayCommits(repo, storage, result, tip, strings.Fields(readStateFile(state, "todo"))); err != nil {
+			return nil, err
+		}
+		return finishPull(repo, storage, result, oldTree)
+	}
+	return nil, fmt.Errorf("there is no pull in progress to continue")
+}
+
+// PullAbort gives up on a pull that stopped on conflicts, putting the branch,
+// the index and the working tree back as they were before it.
+func PullAbort(repo *Repository) error {
+	if err := repo.RequireWorkTree(); err != nil {
+		return err
+	}
+	storage := NewStorage(repo)
+	var original string
+	switch PullInProgress(repo) {
+	case "merge":
+		original, _ = ResolveRef(repo, "HEAD")
+	case "rebase":
+		state := filepath.Join(repo.ZarkDir, rebaseDir)
+		original = readStateFile(state, "orig-head")
+		if err := UpdateRef(repo, "refs/heads/"+readStateFile(state, "branch"), original); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("there is no pull in progress to abort")
+	}
+
+	tree, err := commitTreeEntries(storage, original)
+	if err != nil {
+		return err
+	}
+	if _, err := checkoutTree(repo, storage, sortedTreeEntries(tree)); err != nil {
+		return err
+	}
+	clearMergeState(repo)
+	if err := os.RemoveAll(filepath.Join(repo.ZarkDir, rebaseDir)); err != nil {
+		return fmt.Errorf("failed to remove the rebase state: %w", err)
+	}
+	_, err = restoreAutostash(repo, storage)
+	return err
+}
+
+// finishPull brings back stashed local changes once the pull is complete and
+// works out which files it changed.
+func finishPull(repo *Repository, storage *Storage, result *PullResult, oldTree map[string]TreeEntry) (*PullResult, error) {
+	if len(result.Conflicts) > 0 {
+		return result, nil
+	}
+	newTree, err := GetHeadTree(repo, storage)
+	if err != nil {
+		return nil, err
+	}
+	for path, entry := range newTree {
+		if old, ok := oldTree[path]; !ok {
+			result.Changed = append(result.Changed, PulledFile{Path: path, Change: "added"})
+		} else if old.Hash != entry.Hash || old.Mode != entry.Mode {
+			result.Changed = append(result.Changed, PulledFile{Path: path, Change: "modified"})
+		}
+	}
+	for path := range oldTree {
+		if _, ok := newTree[path]; !ok {
+			result.Changed = append(result.Changed, PulledFile{Path: path, Change: "deleted"})
+		}
+	}
+	sort.Slice(result.Changed, func(i, j int) bool { return result.Changed[i].Path < result.Changed[j].Path })
+
+	if _, err := os.Stat(filepath.Join(repo.ZarkDir, autostashFile)); err == nil {
+		result.Stashed = true
+		if result.StashConflicts, err = restoreAutostash(repo, storage); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// pullMerge combines the upstream commit with the branch in a merge commit,
+// or stops with the conflicts marked up in the working tree.
+func pullMerge(repo *Repository, storage *Storage, result *PullResult, ours, theirs string) error {
+	base, err := MergeBase(storage, ours, theirs)
+	if err != nil {
+		return err
+	}
+	var trees [3]map[string]TreeEntry
+	for i, hash := range []string{base, ours, theirs} {
+		if trees[i], err = commitTreeEntries(storage, hash); err != nil {
+			return err
+		}
+	}
+	merge, err := mergeTrees(storage, trees[0], trees[1], trees[2], result.Branch, result.Upstream)
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Merge %s into %s", result.Upstream, result.Branch)
+	if len(merge.Conflicts) > 0 {
+		result.Conflicts = merge.Conflicts
+		if err := applyTreeMerge(repo, storage, merge); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(repo.ZarkDir, mergeHeadFile), []byte(theirs+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to record the merge: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(repo.ZarkDir, mergeMsgFile), []byte(message+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to record the merge: %w", err)
+		}
+		return nil
+	}
+
+	tree, err := storeTreeEntries(storage, merge.Entries)
+	if err != nil {
+		return err
+	}
+	commit, err := newCommitObject(repo, storage, tree, []string{ours, theirs}, CommitOptions{Message: message})
+	if err != nil {
+		return err
+	}
+	if err := UpdateRef(repo, "refs/heads/"+result.Branch, commit.Hash()); err != nil {
+		return err
+	}
+	_, err = checkoutTree(repo, storage, merge.Entries)
+	return err
+}
+
+// startRebase replays the branch's own commits on top of the upstream one.
+// Merge commits are dropped; the commits they brought in are replayed.
+func startRebase(repo *Repository, storage *Storage, result *PullResult, ours, theirs string) error {
+	outgoing, err := newCommits(storage, ours, []string{theirs})
+	if err != nil {
+		return err
+	}
+	replay := make(map[string]bool)
+	for _, commit := range outgoing {
+		replay[commit.Hash()] = len(commit.MergeParents) == 0
+	}
+	history, err := commitsParentsFirst(storage, []string{ours})
+	if err != nil {
+		return err
+	}
+	var todo []string
+	for _, commit := range history {
+		if replay[commit.Hash()] {
+			todo = append(todo, commit.Hash())
+		}
+	}
+
+	state := filepath.Join(repo.ZarkDir, rebaseDir)
+	if err := os.MkdirAll(state, 0755); err != nil {
+		return fmt.Errorf("failed to record the rebase: %w", err)
+	}
+	for name, value := range map[string]string{"branch": result.Branch, "upstream": result.Upstream, "orig-head": ours} {
+		if err := writeStateFile(state, name, value); err != nil {
+			return err
+		}
+	}
+	return replayCommits(repo, storage, result, theirs, todo)
+}
+
+// replayCommits applies the changes of each commit in todo on top of tip,
+// keeping their authors and messages. It stops at the first commit whose
+// changes conflict, leaving the rest for PullContinue.
+func replayCommits(repo *Repository, storage *Storage, result *PullResult, tip string, todo []string) error {
+	state := filepath.Join(repo.ZarkDir, rebaseDir)
+	for i, hash := range todo {
+		commit, err := storage.LoadCommit(hash)
+		if err != nil {
+			return err
+		}
+		var trees [3]map[string]TreeEntry
+		for j, side := range []string{commit.Parent, tip, hash} {
+			if trees[j], err = commitTreeEntries(storage, side); err != nil {
+				return err
+			}
+		}
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		merge, err := mergeTrees(storage, trees[0], trees[1], trees[2], result.Upstream, hash[:8]+" ("+subject+")")
+		if err != nil {
+			return err
+		}
+
+		if len(merge.Conflicts) > 0 {
+			result.Conflicts = merge.Conflicts
+			if err := UpdateRef(repo, "refs/heads/"+result.Branch, tip); err != nil {
+				return err
+			}
+			if err := applyTreeMerge(repo, storage, merge); err != nil {
+				return err
+			}
+			if err := writeStateFile(state, "todo", strings.Join(todo[i+1:], "\n")); err != nil {
+				return err
+			}
+			return writeStateFile(state, "stopped", hash)
+		}
+
+		tree, err := storeTreeEntries(storage, merge.Entries)
+		if err != nil {
+			return err
+		}
+		tipCommit, err := storage.LoadCommit(tip)
+		if err != nil {
+			return err
+		}
+		if tree == tipCommit.TreeHash {
+			result.Skipped++
+			continue
+		}
+		author := commit.AuthorIdentity()
+		replayed, err := newCommitObject(repo, storage, tree, []string{tip}, CommitOptions{
+			Message: commit.Message, Author: &author, AuthorDate: commit.Timestamp,
+		})
+		if err != nil {
+			return err
+		}
+		tip = replayed.Hash()
+		result.Rebased++
+	}
+
+	if err := UpdateRef(repo, "refs/heads/"+result.Branch, tip); err != nil {
+		return err
+	}
+	entries, err := commitTreeEntries(storage, tip)
+	if err != nil {
+		return err
+	}
+	if _, err := checkoutTree(repo, storage, sortedTreeEntries(entries)); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(state); err != nil {
+		return fmt.Errorf("failed to remove the rebase state: %w", err)
+	}
+	return nil
+}
+
+// localChanges compares the tracked files in the working tree with the HEAD
+// tree. It returns the paths that differ and a snapshot of the tracked files
+// as they are now, with changed content stored as blobs.
+func localChanges(repo *Repository, storage *Storage, head map[string]TreeEntry) ([]string, []TreeEntry, error) {
+	index, err := LoadIndex(repo.IndexPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	staged := make(map[string]IndexEntry)
+	if index != nil {
+		for _, entry := range index.Entries {
+			staged[entry.Path] = entry
+		}
+	}
+	attributes, err := LoadAttributes(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tracked := make(map[string]bool)
+	for path := range head {
+		tracked[path] = true
+	}
+	for path := range staged {
+		tracked[path] = true
+	}
+
+	var changed []string
+	var snapshot []TreeEntry
+	for path := range tracked {
+		fullPath := filepath.Join(repo.Path, filepath.FromSlash(path))
+		info, err := os.Lstat(fullPath)
+		if os.IsNotExist(err) {
+			if _, ok := head[path]; ok {
+				changed = append(changed, path)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		content, mode, err := readWorkingFile(fullPath, info)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if mode != ModeSymlink && attributes.IsLFS(path) {
+			if content, err = lfsClean(repo, content); err != nil {
+				return nil, nil, err
+			}
+		}
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:])
+		if !storage.Has(hash) {
+			if err := storage.Store(NewBlob(content)); err != nil {
+				return nil, nil, fmt.Errorf("failed to store %s: %w", path, err)
+			}
+		}
+		snapshot = append(snapshot, TreeEntry{Mode: mode, Name: path, Hash: hash, Type: "blob"})
+		if known, ok := head[path]; !ok || known.Hash != hash || known.Mode != mode {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Name < snapshot[j].Name })
+	return changed, snapshot, nil
+}
+
+// pullStateObjects returns the commits and trees a pull stopped on conflicts
+// still needs, for gc to keep: the commits a rebase started from and has
+// yet to replay, the commit a merge is bringing in, and the local changes
+// put aside with the commit they were made on.
+func pullStateObjects(repo *Repository) (commits, trees []string) {
+	state := filepath.Join(repo.ZarkDir, rebaseDir)
+	commits = append(commits, readStateFile(state, "orig-head"), readStateFile(state, "stopped"))
+	commits = append(commits, strings.Fields(readStateFile(state, "todo"))...)
+	commits = append(commits, MergeInProgress(repo))
+	if fields := strings.Fields(readStateFile(repo.ZarkDir, autostashFile)); len(fields) > 0 {
+		trees = append(trees, fields[0])
+		commits = append(commits, fields[1:]...)
+	}
+	return commits, trees
+}
+
+// saveAutostash records the snapshot of local changes made on top of base,
+// to be brought back by restoreAutostash.
+func saveAutostash(repo *Repository, storage *Storage, base string, snapshot []TreeEntry) error {
+	tree, err := storeTreeEntries(storage, snapshot)
+	if err != nil {
+		return err
+	}
+	data := tree + " " + base + "\n"
+	if err := os.WriteFile(filepath.Join(repo.ZarkDir, autostashFile), []byte(data), 0644); err != nil {
+		return fmt.Errorf("failed to put local changes aside: %w", err)
+	}
+	return nil
+}
+
+// restoreAutostash brings stashed local changes back into the working tree,
+// on top of the current HEAD. The index is left alone, so they show up as
+// changes not staged yet. Changes that clash with HEAD are marked up as
+// conflicts and returned.
+func restoreAutostash(repo *Repository, storage *Storage) ([]MergeConflict, error) {
+	path := filepath.Join(repo.ZarkDir, autostashFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the local changes put aside: %w", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("the local changes put aside in %s are damaged", path)
+	}
+	stashTree, err := storage.LoadTree(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	stash := make(map[string]TreeEntry)
+	for _, entry := range stashTree.Entries {
+		stash[entry.Name] = entry
+	}
+	var baseCommit string
+	if len(fields) > 1 {
+		baseCommit = fields[1]
+	}
+	base, err := commitTreeEntries(storage, baseCommit)
+	if err != nil {
+		return nil, err
+	}
+	head, err := GetHeadTree(repo, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	merge, err := mergeTrees(storage, base, stash, head, "your changes", "the pulled commits")
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTreePaths(merge.Entries); err != nil {
+		return nil, err
+	}
+	attributes, err := attributesFromTree(storage, merge.Entries)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]bool)
+	for _, entry := range merge.Entries {
+		merged[entry.Name] = true
+		content, markedUp := merge.markedUp[entry.Name]
+		if known, ok := head[entry.Name]; ok && !markedUp && known.Hash == entry.Hash && known.Mode == entry.Mode {
+			continue
+		}
+		if !markedUp {
+			if content, err = storage.Load(entry.Hash); err != nil {
+				return nil, err
+			}
+			if attributes.IsLFS(entry.Name) && normalizeMode(entry.Mode) != ModeSymlink {
+				if content, _, err = lfsSmudge(repo, content); err != nil {
+					return nil, err
+				}
+			}
+		}
+		fullPath := filepath.Join(repo.Path, filepath.FromSlash(entry.Name))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %w", entry.Name, err)
+		}
+		if err := writeWorkingFile(fullPath, content, normalizeMode(entry.Mode)); err != nil {
+			return nil, err
+		}
+	}
+	for name := range head {
+		if !merged[name] {
+			os.Remove(filepath.Join(repo.Path, filepath.FromSlash(name)))
+		}
+	}
+
+	if err := os.Remove(path); err != nil {
+		return nil, fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return merge.Conflicts, nil
+}
+
+// indexMatchesHead reports whether the index holds exactly the HEAD tree.
+func indexMatchesHead(repo *Repository, storage *Storage) (bool, error) {
+	head, err := GetHeadTree(repo, storage)
+	if err != nil {
+		return false, err
+	}
+	index, err := LoadIndex(repo.IndexPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to load index: %w", err)
+	}
+	if len(index.Entries) != len(head) {
+		return false, nil
+	}
+	for _, entry := range index.Entries {
+		known, ok := head[entry.Path]
+		if !ok || known.Hash != entry.Hash || known.Mode != normalizeMode(entry.Mode) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// sortedTreeEntries turns a tree keyed by path into its entries in path order.
+func sortedTreeEntries(tree map[string]TreeEntry) []TreeEntry {
+	entries := make([]TreeEntry, 0, len(tree))
+	for _, entry := range tree {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// conflictMarkersError refuses to go on while conflicts are not fixed.
+func conflictMarkersError(paths []string) error {
+	return fmt.Errorf("%s still have conflicts to fix, or the fix is not added yet.\n"+
+		"hint: edit them to keep the lines you want, remove the <<<<<<<, ======= and >>>>>>> conflict markers, then 'zark add' them",
+		describePaths(paths))
+}
+
+// describePaths names a few paths for a message.
+func describePaths(paths []string) string {
+	quoted := make([]string, 0, len(paths))
+	for i, path := range paths {
+		if i == 3 {
+			quoted = append(quoted, fmt.Sprintf("%d more", len(paths)-i))
+			break
+		}
+		quoted = append(quoted, "'"+path+"'")
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func writeStateFile(dir, name, value string) error {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to record the rebase: %w", err)
+	}
+	return nil
+}
+
+func readStateFile(dir, name string) string {
+	data, _ := os.ReadFile(filepath.Join(dir, name))
+	return strings.TrimSpace(string(data))
+}
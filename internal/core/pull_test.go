@@ -0,0 +1,324 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// setupPull pushes repo's main to a new bare origin, tracking it, and
+// returns a function that commits a file in a second clone and pushes it,
+// as a teammate would.
+func setupPull(t *testing.T, repo *Repository) func(path, content string) string {
+	t.Helper()
+	setupBareRemote(t, repo)
+	if _, err := Push(repo, "origin", "main", PushOptions{SetUpstream: true}); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	url, _ := GetRemote(repo, "origin")
+	cloneDir := filepath.Join(t.TempDir(), "teammate")
+	clone, _, err := Clone(url.URL, cloneDir)
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	return func(path, content string) string {
+		var hash string
+		inDir(t, cloneDir, func() {
+			hash = commitFile(t, clone, path, content)
+			if _, err := Push(clone, "origin", "main", PushOptions{}); err != nil {
+				t.Fatalf("Teammate's push failed: %v", err)
+			}
+		})
+		return hash
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	dmp := diffmatchpatch.New()
+	base := "one\ntwo\nthree\nfour\nfive\n"
+
+	merged, clean := merge3(dmp, base, "ONE\ntwo\nthree\nfour\nfive\n", "one\ntwo\nthree\nfour\nFIVE\nsix\n", "ours", "theirs")
+	if !clean || merged != "ONE\ntwo\nthree\nfour\nFIVE\nsix\n" {
+		t.Errorf("Expected separate changes to combine, got %v %q", clean, merged)
+	}
+
+	merged, clean = merge3(dmp, base, "one\n2\nthree\nfour\nfive\n", "one\nTWO\nthree\nfour\nfive\n", "ours", "theirs")
+	want := "one\n<<<<<<< ours\n2\n=======\nTWO\n>>>>>>> theirs\nthree\nfour\nfive\n"
+	if clean || merged != want {
+		t.Errorf("Expected overlapping changes to be marked up, got %v %q", clean, merged)
+	}
+
+	if merged, clean = merge3(dmp, base, base+"six\n", base+"six\n", "ours", "theirs"); !clean || merged != base+"six\n" {
+		t.Errorf("Expected the same change on both sides to merge cleanly, got %v %q", clean, merged)
+	}
+}
+
+func TestPull(t *testing.T) {
+	t.Run("Branches without commits of their own fast-forward", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		if _, err := Pull(repo, PullOptions{}); err == nil || !strings.Contains(err.Error(), "set-upstream") {
+			t.Errorf("Expected a hint to set the upstream, got %v", err)
+		}
+		teammate := setupPull(t, repo)
+		theirs := teammate("notes.txt", "from a teammate")
+
+		result, err := Pull(repo, PullOptions{Strategy: PullFastForwardOnly})
+		if err != nil {
+			t.Fatalf("Pull failed: %v", err)
+		}
+		if result.Outcome != "fast-forward" || len(result.Incoming) != 1 || len(result.Changed) != 1 || result.Changed[0].Change != "added" {
+			t.Errorf("Expected a fast-forward adding one file, got %+v", result)
+		}
+		if head, _ := ResolveRef(repo, "HEAD"); head != theirs {
+			t.Error("Expected main to move to the teammate's commit")
+		}
+		if data, _ := os.ReadFile("notes.txt"); string(data) != "from a teammate" {
+			t.Errorf("Expected notes.txt to be checked out, got %q", data)
+		}
+
+		if result, err = Pull(repo, PullOptions{}); err != nil || result.Outcome != "up to date" {
+			t.Errorf("Expected a second pull to be up to date, got %+v %v", result, err)
+		}
+	})
+
+	t.Run("Diverged branches are merged unless --ff-only", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		teammate := setupPull(t, repo)
+		theirs := teammate("theirs.txt", "theirs")
+		ours := commitFile(t, repo, "ours.txt", "ours")
+
+		_, err := Pull(repo, PullOptions{Strategy: PullFastForwardOnly})
+		if err == nil || !strings.Contains(err.Error(), "cannot fast-forward") || !strings.Contains(err.Error(), "--rebase") {
+			t.Fatalf("Expected --ff-only to refuse diverged branches, got %v", err)
+		}
+
+		result, err := Pull(repo, PullOptions{})
+		if err != nil {
+			t.Fatalf("Pull failed: %v", err)
+		}
+		if result.Outcome != "merge" || len(result.Conflicts) != 0 {
+			t.Fatalf("Expected a clean merge, got %+v", result)
+		}
+		head, _ := ResolveRef(repo, "HEAD")
+		merge, _ := NewStorage(repo).LoadCommit(head)
+		if parents := merge.Parents(); len(parents) != 2 || parents[0] != ours || parents[1] != theirs {
+			t.Errorf("Expected a merge commit of %s and %s, got %v", ours[:8], theirs[:8], parents)
+		}
+		for _, path := range []string{"ours.txt", "theirs.txt"} {
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("Expected %s after the merge: %v", path, err)
+			}
+		}
+		if _, err := Push(repo, "origin", "main", PushOptions{}); err != nil {
+			t.Errorf("Expected the merged branch to push: %v", err)
+		}
+	})
+
+	t.Run("Conflicts stop the merge until they are fixed", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		teammate := setupPull(t, repo)
+		teammate("test.txt", "hello from them")
+		commitFile(t, repo, "test.txt", "hello from me")
+
+		result, err := Pull(repo, PullOptions{})
+		if err != nil {
+			t.Fatalf("Pull failed: %v", err)
+		}
+		if len(result.Conflicts) != 1 || result.Conflicts[0].Path != "test.txt" {
+			t.Fatalf("Expected a conflict in test.txt, got %+v", result.Conflicts)
+		}
+		data, _ := os.ReadFile("test.txt")
+		if want := "<<<<<<< main\nhello from me\n=======\nhello from them\n>>>>>>> origin/main\n"; string(data) != want {
+			t.Errorf("Expected conflict markers, got %q", data)
+		}
+		if _, err := Pull(repo, PullOptions{}); err == nil || !strings.Contains(err.Error(), "--continue") {
+			t.Errorf("Expected another pull to point at --continue, got %v", err)
+		}
+
+		AddFiles(repo, []string{"test.txt"})
+		if _, err := PullContinue(repo); err == nil || !strings.Contains(err.Error(), "conflict markers") {
+			t.Errorf("Expected files with markers to be refused, got %v", err)
+		}
+		os.WriteFile("test.txt", []byte("hello from both of us\n"), 0644)
+		AddFiles(repo, []string{"test.txt"})
+		if _, err := PullContinue(repo); err != nil {
+			t.Fatalf("PullContinue failed: %v", err)
+		}
+		head, _ := ResolveRef(repo, "HEAD")
+		merge, _ := NewStorage(repo).LoadCommit(head)
+		if len(merge.Parents()) != 2 || !strings.HasPrefix(merge.Message, "Merge origin/main into main") {
+			t.Errorf("Expected a merge commit, got %+v", merge)
+		}
+		if PullInProgress(repo) != "" {
+			t.Error("Expected the merge to be finished")
+		}
+	})
+
+	t.Run("Conflicted lockable files get markers and stay read-only", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		commitFile(t, repo, AttributesFile, "*.txt lockable\n")
+		teammate := setupPull(t, repo)
+		teammate("test.txt", "hello from them")
+		commitFile(t, repo, "test.txt", "hello from me")
+
+		result, err := Pull(repo, PullOptions{})
+		if err != nil || len(result.Conflicts) != 1 {
+			t.Fatalf("Expected a conflict in test.txt, got %+v %v", result, err)
+		}
+		if data, _ := os.ReadFile("test.txt"); !strings.Contains(string(data), "<<<<<<< main") {
+			t.Errorf("Expected conflict markers, got %q", data)
+		}
+		if info, err := os.Stat("test.txt"); err != nil || info.Mode().Perm()&0200 != 0 {
+			t.Errorf("Expected test.txt to stay read-only, got %v %v", info.Mode(), err)
+		}
+	})
+
+	t.Run("Rebase replays local commits on top", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		teammate := setupPull(t, repo)
+		theirs := teammate("theirs.txt", "theirs")
+		commitFile(t, repo, "one.txt", "one")
+		commitFile(t, repo, "two.txt", "two")
+		SetConfigValue(repo.ConfigPath, "pull.strategy", "rebase")
+
+		result, err := Pull(repo, PullOptions{})
+		if err != nil {
+			t.Fatalf("Pull failed: %v", err)
+		}
+		if result.Outcome != "rebase" || result.Rebased != 2 {
+			t.Fatalf("Expected 2 commits rebased, got %+v", result)
+		}
+		storage := NewStorage(repo)
+		head, _ := ResolveRef(repo, "HEAD")
+		second, _ := storage.LoadCommit(head)
+		first, _ := storage.LoadCommit(second.Parent)
+		if first.Parent != theirs || second.Message != "update two.txt" || len(second.MergeParents) != 0 {
+			t.Errorf("Expected a straight line on top of the teammate's commit")
+		}
+		for _, path := range []string{"one.txt", "two.txt", "theirs.txt"} {
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("Expected %s after the rebase: %v", path, err)
+			}
+		}
+	})
+
+	t.Run("A rebase stopped on conflicts continues or aborts", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		teammate := setupPull(t, repo)
+		theirs := teammate("test.txt", "theirs")
+		ours := commitFile(t, repo, "test.txt", "mine")
+		commitFile(t, repo, "later.txt", "later")
+
+		result, err := Pull(repo, PullOptions{Strategy: PullRebase})
+		if err != nil || len(result.Conflicts) != 1 {
+			t.Fatalf("Expected the rebase to stop on test.txt, got %+v %v", result, err)
+		}
+		if head, _ := ResolveRef(repo, "HEAD"); head != theirs {
+			t.Error("Expected main to point at the upstream commit while stopped")
+		}
+		if _, err := PullContinue(repo); err == nil || !strings.Contains(err.Error(), "not added yet") {
+			t.Errorf("Expected a fix that is not added to be refused, got %v", err)
+		}
+		if err := PullAbort(repo); err != nil {
+			t.Fatalf("PullAbort failed: %v", err)
+		}
+		if head, _ := ResolveRef(repo, "HEAD"); head == theirs || PullInProgress(repo) != "" {
+			t.Error("Expected abort to restore main")
+		}
+		if data, _ := os.ReadFile("test.txt"); string(data) != "mine" {
+			t.Errorf("Expected test.txt to be restored, got %q", data)
+		}
+
+		Pull(repo, PullOptions{Strategy: PullRebase})
+		os.WriteFile("test.txt", []byte("mine and theirs"), 0644)
+		AddFiles(repo, []string{"test.txt"})
+		result, err = PullContinue(repo)
+		if err != nil || result.Rebased != 2 {
+			t.Fatalf("Expected the rebase to finish with 2 commits, got %+v %v", result, err)
+		}
+		storage := NewStorage(repo)
+		head, _ := ResolveRef(repo, "HEAD")
+		last, _ := storage.LoadCommit(head)
+		fixed, _ := storage.LoadCommit(last.Parent)
+		original, _ := storage.LoadCommit(ours)
+		if fixed.Parent != theirs || fixed.Message != original.Message || !fixed.Timestamp.Equal(original.Timestamp) {
+			t.Errorf("Expected the fixed commit to keep its message and date on top of upstream")
+		}
+	})
+
+	t.Run("gc keeps what a stopped pull needs", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		teammate := setupPull(t, repo)
+		teammate("test.txt", "theirs")
+		ours := commitFile(t, repo, "test.txt", "mine")
+		os.WriteFile("notes.txt", []byte("put aside"), 0644)
+		AddFiles(repo, []string{"notes.txt"})
+		os.WriteFile("notes.txt", []byte("put aside, then changed"), 0644)
+
+		stash := true
+		if result, err := Pull(repo, PullOptions{Strategy: PullRebase, Autostash: &stash}); err != nil || len(result.Conflicts) != 1 {
+			t.Fatalf("Expected the rebase to stop on test.txt, got %+v %v", result, err)
+		}
+		if _, err := PruneObjects(repo); err != nil {
+			t.Fatalf("PruneObjects failed: %v", err)
+		}
+		if err := PullAbort(repo); err != nil {
+			t.Fatalf("PullAbort after gc failed: %v", err)
+		}
+		if head, _ := ResolveRef(repo, "HEAD"); head != ours {
+			t.Error("Expected abort to restore main after gc")
+		}
+		if data, _ := os.ReadFile("notes.txt"); string(data) != "put aside, then changed" {
+			t.Errorf("Expected the stashed change to come back after gc, got %q", data)
+		}
+	})
+
+	t.Run("Local changes are refused or stashed", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		teammate := setupPull(t, repo)
+		teammate("notes.txt", "line one\nline two\n")
+		os.WriteFile("test.txt", []byte("work in progress"), 0644)
+
+		_, err := Pull(repo, PullOptions{})
+		if err == nil || !strings.Contains(err.Error(), "'test.txt'") || !strings.Contains(err.Error(), "--autostash") {
+			t.Fatalf("Expected local changes to stop the pull, got %v", err)
+		}
+
+		SetConfigValue(repo.ConfigPath, "pull.autostash", "true")
+		result, err := Pull(repo, PullOptions{})
+		if err != nil {
+			t.Fatalf("Pull failed: %v", err)
+		}
+		if !result.Stashed || len(result.StashConflicts) != 0 {
+			t.Errorf("Expected the changes to be stashed and restored cleanly, got %+v", result)
+		}
+		if data, _ := os.ReadFile("test.txt"); string(data) != "work in progress" {
+			t.Errorf("Expected the local change to come back, got %q", data)
+		}
+		if data, _ := os.ReadFile("notes.txt"); string(data) != "line one\nline two\n" {
+			t.Errorf("Expected the pulled file, got %q", data)
+		}
+		if _, err := os.Stat(filepath.Join(repo.ZarkDir, autostashFile)); !os.IsNotExist(err) {
+			t.Error("Expected the stash to be dropped once restored")
+		}
+	})
+}
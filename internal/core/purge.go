@@ -0,0 +1,164 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PurgeReplacement is the text leaked strings are replaced with by default.
+const PurgeReplacement = "***REMOVED***"
+
+// ScanHistory scans every file in every commit reachable from a reference or
+// HEAD. Each version of a file is scanned once and its findings are
+// attributed to the oldest commit that contains it.
+func ScanHistory(repo *Repository) ([]SecretFinding, error) {
+	rules, err := LoadSecretRules(repo)
+	if err != nil {
+		return nil, err
+	}
+	baseline, err := LoadSecretBaseline(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	storage := NewStorage(repo)
+	roots, err := historyRoots(repo)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := commitsParentsFirst(storage, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []SecretFinding
+	scanned := make(map[string]bool)
+	for _, commit := range commits {
+		tree, err := storage.LoadTree(commit.TreeHash)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range tree.Entries {
+			key := entry.Name + "\x00" + entry.Hash
+			if scanned[key] || rules.Excluded(entry.Name) {
+				continue
+			}
+			scanned[key] = true
+
+			content, err := storage.Load(entry.Hash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s in commit %s: %w", entry.Name, commit.hash[:8], err)
+			}
+			if isBinaryContent(content) {
+				continue
+			}
+			for _, finding := range rules.ScanContent(entry.Name, content) {
+				if baseline.Contains(finding) {
+					continue
+				}
+				finding.Commit = commit.hash
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings, nil
+}
+
+// historyRoots returns the commits every reference and HEAD point at.
+func historyRoots(repo *Repository) ([]string, error) {
+	refs, err := ListRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+	var roots []string
+	for _, hash := range refs {
+		roots = append(roots, hash)
+	}
+	if head, err := ResolveRef(repo, "HEAD"); err == nil {
+		roots = append(roots, head)
+	} else if !strings.Contains(err.Error(), "no commits yet") {
+		return nil, err
+	}
+	return roots, nil
+}
+
+// PurgeOptions selects what PurgeHistory removes.
+type PurgeOptions struct {
+	// Replacements maps each leaked string to the text that replaces it.
+	Replacements map[string]string
+	// DropPaths are globs, like .gitignore patterns, of files removed from every commit.
+	DropPaths []string
+}
+
+// PurgeHistory rewrites every commit so that no file contains the given
+// strings and no file matches the dropped paths. The old objects remain in
+// the object database until PruneObjects (zark gc) removes them.
+func PurgeHistory(repo *Repository, opts PurgeOptions) (*RewriteResult, error) {
+	if len(opts.Replacements) == 0 && len(opts.DropPaths) == 0 {
+		return nil, fmt.Errorf("nothing to purge: give strings to replace or paths to drop")
+	}
+
+	// Replace longer strings first so a secret containing another is removed whole.
+	secrets := make([]string, 0, len(opts.Replacements))
+	for secret := range opts.Replacements {
+		if secret == "" {
+			return nil, fmt.Errorf("cannot purge an empty string")
+		}
+		secrets = append(secrets, secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		if len(secrets[i]) != len(secrets[j]) {
+			return len(secrets[i]) > len(secrets[j])
+		}
+		return secrets[i] < secrets[j]
+	})
+
+	storage := NewStorage(repo)
+	newBlobs := make(map[string]string)
+	cleanBlob := func(hash string) (string, error) {
+		if newHash, ok := newBlobs[hash]; ok {
+			return newHash, nil
+		}
+		content, err := storage.Load(hash)
+		if err != nil {
+			return "", err
+		}
+		cleaned := content
+		for _, secret := range secrets {
+			cleaned = bytes.ReplaceAll(cleaned, []byte(secret), []byte(opts.Replacements[secret]))
+		}
+		newHash := hash
+		if !bytes.Equal(cleaned, content) {
+			blob := NewBlob(cleaned)
+			if err := storage.Store(blob); err != nil {
+				return "", fmt.Errorf("failed to store blob: %w", err)
+			}
+			newHash = blob.Hash()
+		}
+		newBlobs[hash] = newHash
+		return newHash, nil
+	}
+
+	return RewriteHistory(repo, func(entries []TreeEntry) ([]TreeEntry, error) {
+		var kept []TreeEntry
+	entryLoop:
+		for _, entry := range entries {
+			for _, pattern := range opts.DropPaths {
+				if matchPathGlob(pattern, entry.Name) {
+					continue entryLoop
+				}
+			}
+			if len(secrets) > 0 {
+				newHash, err := cleanBlob(entry.Hash)
+				if err != nil {
+					return nil, fmt.Errorf("failed to clean %s: %w", entry.Name, err)
+				}
+				entry.Hash = newHash
+			}
+			kept = append(kept, entry)
+		}
+		return kept, nil
+	})
+}
@@ -0,0 +1,353 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PushResult describes what Push changed on the remote.
+type PushResult struct {
+	Remote   string
+	Update   RefUpdate
+	Objects  int
+	UpToDate bool
+}
+
+// PushOptions selects what Push sends.
+type PushOptions struct {
+	// Force allows replacing remote commits that are not in the local branch.
+	Force bool
+	// Delete removes the branch from the remote instead of updating it.
+	Delete bool
+	// RemoteBranch names the branch on the remote; empty means the same name
+	// as the local branch.
+	RemoteBranch string
+	// SetUpstream makes the remote branch the local branch's upstream once
+	// pushed, for later pulls and pushes.
+	SetUpstream bool
+}
+
+// Push sends a local branch to a branch on a remote, of the same name unless
+// opts.RemoteBranch says otherwise, refusing to overwrite remote commits
+// unless opts.Force is set. The remote-tracking branch is updated to match.
+func Push(repo *Repository, remoteName, branch string, opts PushOptions) (*PushResult, error) {
+	remote, err := GetRemote(repo, remoteName)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := connectRemote(remote)
+	if err != nil {
+		return nil, err
+	}
+	remoteRefs, _, err := conn.Refs()
+	if err != nil {
+		return nil, err
+	}
+
+	remoteBranch := opts.RemoteBranch
+	if remoteBranch == "" {
+		remoteBranch = branch
+	}
+	refName := "refs/heads/" + remoteBranch
+	update := RefUpdate{Name: refName, Old: remoteRefs[refName], Force: opts.Force}
+	result := &PushResult{Remote: remoteName, Update: update}
+	if opts.Delete {
+		if update.Old == "" {
+			return nil, fmt.Errorf("the remote has no branch named '%s'", remoteBranch)
+		}
+	} else {
+		local, err := ResolveRef(repo, "refs/heads/"+branch)
+		if err != nil {
+			return nil, fmt.Errorf("there is no local branch named '%s'", branch)
+		}
+		update.New = local
+		result.Update = update
+		if update.Old == update.New {
+			result.UpToDate = true
+			return result, pushSetUpstream(repo, branch, remoteName, remoteBranch, opts)
+		}
+		if update.Old != "" && !opts.Force {
+			if err := checkFastForward(NewStorage(repo), update, remoteName); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result.Objects, err = conn.Push(repo, []RefUpdate{update})
+	if err != nil {
+		return nil, err
+	}
+
+	tracking := "refs/remotes/" + remoteName + "/" + remoteBranch
+	if update.New == "" {
+		if err := os.Remove(filepath.Join(repo.ZarkDir, filepath.FromSlash(tracking))); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove %s: %w", tracking, err)
+		}
+		return result, nil
+	}
+	if err := UpdateRef(repo, tracking, update.New); err != nil {
+		return nil, err
+	}
+	return result, pushSetUpstream(repo, branch, remoteName, remoteBranch, opts)
+}
+
+// pushSetUpstream records the pushed branch as the upstream if asked to.
+func pushSetUpstream(repo *Repository, branch, remoteName, remoteBranch string, opts PushOptions) error {
+	if !opts.SetUpstream || opts.Delete {
+		return nil
+	}
+	return SetUpstream(repo, branch, remoteName, remoteBranch)
+}
+
+// checkFastForward makes sure update only adds commits on top of the
+// remote's, as judged from the local object database.
+func checkFastForward(storage *Storage, update RefUpdate, remoteName string) error {
+	branch := strings.TrimPrefix(update.Name, "refs/heads/")
+	if !storage.Has(update.Old) {
+		return fmt.Errorf("rejected: the remote's '%s' has commits you don't have yet (fetch first).\n"+
+			"hint: run 'zark pull' (or 'zark fetch %s' and combine '%s/%s' with your work), then push again", branch, remoteName, remoteName, branch)
+	}
+	ok, err := isAncestor(storage, update.Old, update.New)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("rejected: your '%s' is missing commits that are on the remote (non-fast-forward).\n"+
+			"hint: run 'zark pull' to combine '%s/%s' with your work and push again, or use --force to replace the remote's commits", branch, remoteName, branch)
+	}
+	return nil
+}
+
+// isAncestor reports whether ancestor is descendant or one of its parents,
+// grandparents and so on. Commits missing from storage end the walk.
+func isAncestor(storage *Storage, ancestor, descendant string) (bool, error) {
+	seen := make(map[string]bool)
+	pending := []string{descendant}
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if hash == ancestor {
+			return true, nil
+		}
+		if hash == "" || seen[hash] || !storage.Has(hash) {
+			continue
+		}
+		seen[hash] = true
+		commit, err := storage.LoadCommit(hash)
+		if err != nil {
+			return false, err
+		}
+		pending = append(pending, commit.Parents()...)
+	}
+	return false, nil
+}
+
+// ReceiveRefUpdates applies reference updates pushed to repo, once their
+// objects have arrived. An update is rejected if the reference moved since
+// the pusher looked at it, if it would drop commits without Force, if it
+// targets the branch checked out in a working tree, or if it breaks the
+// rules of a protected branch. The pre-receive hook can veto the whole push;
+// the post-receive hook runs once it is applied.
+func ReceiveRefUpdates(repo *Repository, updates []RefUpdate) error {
+	return receiveRefUpdates(repo, updates, "")
+}
+
+// receiveRefUpdates is ReceiveRefUpdates for a push by the named user of
+// 'zark serve', passed to hooks as ZARK_PUSHER.
+func receiveRefUpdates(repo *Repository, updates []RefUpdate, pusher string) error {
+	refs, err := ListRefs(repo)
+	if err != nil {
+		return err
+	}
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return err
+	}
+	check := &receiveCheck{repo: repo, storage: NewStorage(repo), config: config, refs: refs}
+	if !repo.Bare {
+		if branch, err := CurrentBranch(repo); err == nil && branch != "" {
+			check.checkedOut = "refs/heads/" + branch
+		}
+	}
+
+	var rejected []string
+	for _, update := range updates {
+		if reason := check.rejection(refs[update.Name], update); reason != "" {
+			rejected = append(rejected, fmt.Sprintf("  %s: %s", update.Name, reason))
+		}
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("the remote rejected the push:\n%s", strings.Join(rejected, "\n"))
+	}
+
+	hookInput := receiveHookInput(refs, updates, pusher)
+	var output bytes.Buffer
+	hookInput.Output = &output
+	if err := RunHook(repo, HookPreReceive, hookInput); err != nil {
+		message := fmt.Sprintf("the remote rejected the push: %v", err)
+		if text := strings.TrimSpace(output.String()); text != "" {
+			message += "\n  " + strings.ReplaceAll(text, "\n", "\n  ")
+		}
+		return fmt.Errorf("%s", message)
+	}
+
+	for _, update := range updates {
+		if update.New == "" {
+			if err := os.Remove(filepath.Join(repo.ZarkDir, filepath.FromSlash(update.Name))); err != nil {
+				return fmt.Errorf("failed to delete %s: %w", update.Name, err)
+			}
+			continue
+		}
+		if err := UpdateRef(repo, update.Name, update.New); err != nil {
+			return err
+		}
+	}
+
+	// The push has happened, so a failing post-receive hook can only be
+	// reported.
+	hookInput.Output = os.Stderr
+	if err := RunHook(repo, HookPostReceive, hookInput); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	return nil
+}
+
+// receiveHookInput describes a push to the receive hooks: one
+// "<old> <new> <ref>" line per update on stdin, with a hash of zeros for a
+// missing side, and the pusher in ZARK_PUSHER.
+func receiveHookInput(refs map[string]string, updates []RefUpdate, pusher string) HookInput {
+	zero := strings.Repeat("0", 64)
+	orZero := func(hash string) string {
+		if hash == "" {
+			return zero
+		}
+		return hash
+	}
+	var stdin strings.Builder
+	for _, update := range updates {
+		fmt.Fprintf(&stdin, "%s %s %s\n", orZero(refs[update.Name]), orZero(update.New), update.Name)
+	}
+	return HookInput{Stdin: stdin.String(), Env: map[string]string{EnvPusher: pusher}}
+}
+
+// receiveCheck holds what the receiving side needs to judge updates.
+type receiveCheck struct {
+	repo       *Repository
+	storage    *Storage
+	config     *ConfigSet
+	refs       map[string]string
+	checkedOut string
+}
+
+// rejection explains why update may not be applied, or returns "".
+func (c *receiveCheck) rejection(current string, update RefUpdate) string {
+	if !strings.HasPrefix(update.Name, "refs/heads/") && !strings.HasPrefix(update.Name, "refs/tags/") {
+		return "only branches and tags can be pushed"
+	}
+	if checkRefName(update.Name) != nil {
+		return "invalid reference name"
+	}
+	if update.Name == c.checkedOut {
+		return "the branch is checked out in the remote's working tree; push to a bare repository or another branch"
+	}
+	branch, isBranch := strings.CutPrefix(update.Name, "refs/heads/")
+	protected := isBranch && c.config.GetBool("branch."+branch+".protected", false)
+	if current != update.Old && !update.Force {
+		return "the branch changed since you last fetched (fetch first)"
+	}
+	if update.New == "" {
+		if current == "" {
+			return "no such branch"
+		}
+		if protected {
+			return fmt.Sprintf("'%s' is a protected branch and cannot be deleted", branch)
+		}
+		return ""
+	}
+	if !c.storage.Has(update.New) {
+		return "the pushed commit did not arrive"
+	}
+	var known []string
+	for _, hash := range c.refs {
+		known = append(known, hash)
+	}
+	if err := checkConnected(c.storage, []string{update.New}, known); err != nil {
+		return "the pushed history did not all arrive: " + err.Error()
+	}
+	if current != "" && (!update.Force || protected) {
+		ok, err := isAncestor(c.storage, current, update.New)
+		if err != nil {
+			return err.Error()
+		}
+		if !ok && protected {
+			return fmt.Sprintf("'%s' is a protected branch: force pushes are not allowed; combine the remote's commits with yours instead", branch)
+		}
+		if !ok {
+			return "non-fast-forward: the push would drop commits"
+		}
+	}
+	if isBranch && c.config.GetBool("branch."+branch+".verifysignatures", false) {
+		return c.signatureRejection(branch, update.New)
+	}
+	return ""
+}
+
+// signatureRejection checks that the commits a push adds to branch all have
+// good signatures.
+func (c *receiveCheck) signatureRejection(branch, tip string) string {
+	var known []string
+	for _, hash := range c.refs {
+		known = append(known, hash)
+	}
+	added, err := newCommits(c.storage, tip, known)
+	if err != nil {
+		return err.Error()
+	}
+	for _, commit := range added {
+		if result := VerifyCommit(c.repo, commit); result.Status != SignatureGood {
+			return fmt.Sprintf("'%s' only accepts signed commits, but %s is %s (%s); sign your saves with 'zark save --sign'",
+				branch, commit.Hash()[:8], result.Status, result.Reason)
+		}
+	}
+	return ""
+}
+
+// newCommits lists the commits reachable from tip but not from any of known.
+func newCommits(storage *Storage, tip string, known []string) ([]*Commit, error) {
+	seen := make(map[string]bool)
+	pending := append([]string(nil), known...)
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if hash == "" || seen[hash] || !storage.Has(hash) {
+			continue
+		}
+		seen[hash] = true
+		commit, err := storage.LoadCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, commit.Parents()...)
+	}
+
+	var added []*Commit
+	pending = []string{tip}
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if hash == "" || seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		commit, err := storage.LoadCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		added = append(added, commit)
+		pending = append(pending, commit.Parents()...)
+	}
+	return added, nil
+}
@@ -15,10 +15,23 @@ func ResolveRef(repo *Repository, ref string) (string, error) {
 		return ref, nil
 	}
 
-	// Check if it's a branch
-	refPath := filepath.Join(repo.RefsDir, "heads", ref)
-	if data, err := os.ReadFile(refPath); err == nil {
-		return strings.TrimSpace(string(data)), nil
+	// Check if it's a branch, then a tag or remote-tracking branch such as
+	// "origin/main", then a full name such as "refs/remotes/origin/main".
+	candidates := []string{
+		filepath.Join(repo.RefsDir, "heads", ref),
+		filepath.Join(repo.RefsDir, "tags", ref),
+		filepath.Join(repo.RefsDir, "remotes", ref),
+	}
+	if strings.HasPrefix(ref, "refs/") {
+		candidates = append(candidates, filepath.Join(repo.ZarkDir, filepath.FromSlash(ref)))
+	}
+	for _, refPath := range candidates {
+		if info, err := os.Stat(refPath); err != nil || info.IsDir() {
+			continue
+		}
+		if data, err := os.ReadFile(refPath); err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
 	}
 
 	// Check if it's HEAD
@@ -33,9 +46,14 @@ func ResolveRef(repo *Repository, ref string) (string, error) {
 		headRef := strings.TrimSpace(string(headData))
 		if strings.HasPrefix(headRef, "ref: ") {
 			branchPath := filepath.Join(repo.ZarkDir, headRef[5:])
-			if data, err := os.ReadFile(branchPath); err == nil {
+			data, err := os.ReadFile(branchPath)
+			if err == nil {
 				return strings.TrimSpace(string(data)), nil
 			}
+			if os.IsNotExist(err) {
+				// A new repository points HEAD at a branch that has no commits yet.
+				return "", fmt.Errorf("no commits yet on branch '%s'", strings.TrimPrefix(headRef[5:], "refs/heads/"))
+			}
 			return "", fmt.Errorf("broken HEAD reference: %s", headRef[5:])
 		}
 		return headRef, nil
@@ -46,10 +64,24 @@ func ResolveRef(repo *Repository, ref string) (string, error) {
 
 // GetHeadTreeEntries returns a map of file paths to blob hashes for the current HEAD commit.
 func GetHeadTreeEntries(repo *Repository, storage *Storage) (map[string]string, error) {
+	tree, err := GetHeadTree(repo, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]string)
+	for path, entry := range tree {
+		entries[path] = entry.Hash
+	}
+	return entries, nil
+}
+
+// GetHeadTree returns a map of file paths to the full tree entries of the current HEAD commit.
+func GetHeadTree(repo *Repository, storage *Storage) (map[string]TreeEntry, error) {
 	headHash, err := ResolveRef(repo, "HEAD")
 	if err != nil {
 		if strings.Contains(err.Error(), "no commits yet") {
-			return make(map[string]string), nil
+			return make(map[string]TreeEntry), nil
 		}
 		return nil, err
 	}
@@ -74,10 +106,102 @@ func GetHeadTreeEntries(repo *Repository, storage *Storage) (map[string]string,
 		return nil, fmt.Errorf("failed to unmarshal tree: %w", err)
 	}
 
-	entries := make(map[string]string)
+	entries := make(map[string]TreeEntry)
 	for _, entry := range treeEntries {
-		entries[entry.Name] = entry.Hash
+		entry.Mode = normalizeMode(entry.Mode)
+		entries[entry.Name] = entry
 	}
 
 	return entries, nil
-}
\ No newline at end of file
+}
+
+// ListRefs returns every reference under refs/ (branches, tags, ...) mapped
+// to the commit it points at, keyed by its full name, e.g. "refs/heads/main".
+func ListRefs(repo *Repository) (map[string]string, error) {
+	refs := make(map[string]string)
+	err := filepath.Walk(repo.RefsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(repo.ZarkDir, path)
+		if err != nil {
+			return err
+		}
+		refs[filepath.ToSlash(rel)] = strings.TrimSpace(string(data))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list references: %w", err)
+	}
+	return refs, nil
+}
+
+// checkRefName rejects reference names that git would, and in particular
+// any that could point outside .zark/refs once joined onto a path: names
+// must start with refs/, and no part may be empty, start with a dot or end
+// with .lock, nor hold "..", "@{", spaces, control characters, backslashes
+// or any of ~^:?*[.
+func checkRefName(name string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("'%s' is not a valid reference name: %s", name, reason)
+	}
+	if !strings.HasPrefix(name, "refs/") {
+		return invalid("it must start with refs/")
+	}
+	if strings.Contains(name, "..") || strings.Contains(name, "@{") {
+		return invalid("it contains '..' or '@{'")
+	}
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return invalid(fmt.Sprintf("it contains %q", c))
+		}
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || strings.HasPrefix(part, ".") || strings.HasSuffix(part, ".lock") {
+			return invalid("each part must be non-empty, not start with '.' and not end with '.lock'")
+		}
+	}
+	if strings.HasSuffix(name, ".") {
+		return invalid("it ends with '.'")
+	}
+	return nil
+}
+
+// UpdateRef points the full reference name (e.g. "refs/heads/main") at hash.
+func UpdateRef(repo *Repository, name, hash string) error {
+	if err := checkRefName(name); err != nil {
+		return err
+	}
+	path := filepath.Join(repo.ZarkDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", name, err)
+	}
+	if err := os.WriteFile(path, []byte(hash+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to update %s: %w", name, err)
+	}
+	return nil
+}
+
+// CurrentBranch returns the name of the branch HEAD points at, such as
+// "main", or "" when HEAD is detached.
+func CurrentBranch(repo *Repository) (string, error) {
+	data, err := os.ReadFile(repo.HeadPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	head := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(head, "ref: ") {
+		return "", nil
+	}
+	return strings.TrimPrefix(head[5:], "refs/heads/"), nil
+}
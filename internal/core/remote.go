@@ -0,0 +1,310 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Remote is another repository this one exchanges commits with.
+type Remote struct {
+	Name string
+	URL  string
+	// Token is sent to http:// remotes that need authentication.
+	Token string
+	// Promisor is set on the remote a partial clone came from, which
+	// supplies the objects it left out; Filter says which those were.
+	Promisor bool
+	Filter   string
+}
+
+// DefaultRemote is the name clone gives the repository it copied.
+const DefaultRemote = "origin"
+
+var remoteNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// AddRemote records a remote in the repository config. Local paths are
+// stored as absolute paths so the remote works from any directory.
+func AddRemote(repo *Repository, name, url string) error {
+	if !remoteNamePattern.MatchString(name) {
+		return fmt.Errorf("'%s' is not a valid remote name: use letters, digits, '.', '_' and '-'", name)
+	}
+	if _, err := GetRemote(repo, name); err == nil {
+		return fmt.Errorf("remote '%s' already exists", name)
+	}
+	if isLocalRemoteURL(url) && !strings.HasPrefix(url, "file://") {
+		abs, err := filepath.Abs(url)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", url, err)
+		}
+		url = abs
+	}
+	return SetConfigValue(repo.ConfigPath, "remote."+name+".url", url)
+}
+
+// ListRemotes returns the configured remotes sorted by name.
+func ListRemotes(repo *Repository) ([]Remote, error) {
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	var remotes []Remote
+	for _, name := range config.Subsections("remote") {
+		if url := config.GetString("remote."+name+".url", ""); url != "" {
+			remotes = append(remotes, Remote{Name: name, URL: url, Promisor: config.GetBool("remote."+name+".promisor", false)})
+		}
+	}
+	return remotes, nil
+}
+
+// GetRemote returns the remote with the given name.
+func GetRemote(repo *Repository, name string) (*Remote, error) {
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	url := config.GetString("remote."+name+".url", "")
+	if url == "" {
+		return nil, fmt.Errorf("no remote named '%s'.\nhint: add one with 'zark remote add %s <path-or-url>'", name, name)
+	}
+	return &Remote{
+		Name:     name,
+		URL:      url,
+		Token:    config.GetString("remote."+name+".token", os.Getenv(EnvRemoteToken)),
+		Promisor: config.GetBool("remote."+name+".promisor", false),
+		Filter:   config.GetString("remote."+name+".partialclonefilter", ""),
+	}, nil
+}
+
+// RemoveRemote deletes a remote from the config along with its
+// remote-tracking branches. Branches tracking it no longer have an upstream.
+func RemoveRemote(repo *Repository, name string) error {
+	if _, err := GetRemote(repo, name); err != nil {
+		return err
+	}
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := RemoveConfigSection(repo.ConfigPath, "remote."+name); err != nil {
+		return err
+	}
+	for _, branch := range config.Subsections("branch") {
+		if config.GetString("branch."+branch+".remote", "") != name {
+			continue
+		}
+		// Either key may be missing from the repository's own config file.
+		UnsetConfigValue(repo.ConfigPath, "branch."+branch+".remote")
+		UnsetConfigValue(repo.ConfigPath, "branch."+branch+".merge")
+	}
+	if err := os.RemoveAll(filepath.Join(repo.RefsDir, "remotes", name)); err != nil {
+		return fmt.Errorf("failed to remove remote-tracking branches: %w", err)
+	}
+	return nil
+}
+
+// RefUpdate describes a reference moving from Old to New. An empty Old means
+// the reference is created; an empty New means it is deleted.
+type RefUpdate struct {
+	Name  string `json:"name"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+	Force bool   `json:"force,omitempty"`
+}
+
+// remoteConnection is how fetch and push talk to another repository.
+type remoteConnection interface {
+	// Refs lists the remote's references by full name and the branch its
+	// HEAD points at.
+	Refs() (refs map[string]string, head string, err error)
+	// Fetch copies the objects req asks for that local lacks into local.
+	Fetch(local *Repository, req fetchRequest) (*fetchReply, error)
+	// Push sends the objects the updates need and asks the remote to apply
+	// them. It returns how many objects were sent.
+	Push(local *Repository, updates []RefUpdate) (int, error)
+}
+
+// isLocalRemoteURL reports whether url names a repository on this machine.
+func isLocalRemoteURL(url string) bool {
+	return !strings.Contains(url, "://") || strings.HasPrefix(url, "file://")
+}
+
+// EnvRemoteToken supplies the token for http:// remotes without
+// remote.<name>.token, such as the one 'zark clone' is about to create.
+const EnvRemoteToken = "ZARK_REMOTE_TOKEN"
+
+// connectRemote opens a connection to the remote's repository.
+func connectRemote(remote *Remote) (remoteConnection, error) {
+	url := remote.URL
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return newHTTPRemote(remote), nil
+	}
+	if !isLocalRemoteURL(url) {
+		return nil, fmt.Errorf("unsupported remote URL '%s': use a path, a file:// URL or an http:// URL", url)
+	}
+	path := strings.TrimPrefix(url, "file://")
+	if isBundleFile(path) {
+		bundle, err := ReadBundle(path)
+		if err != nil {
+			return nil, err
+		}
+		return &bundleRemote{bundle: bundle}, nil
+	}
+	repo, err := openLocalRemote(path)
+	if err != nil {
+		return nil, err
+	}
+	return &localRemote{repo: repo}, nil
+}
+
+// openLocalRemote opens the repository at path, which may have a working
+// tree or be bare. Unlike discovery, parent directories are not searched.
+func openLocalRemote(path string) (*Repository, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	if info, err := os.Stat(filepath.Join(path, ".zark")); err == nil && info.IsDir() {
+		repo := NewRepository(path)
+		repo.Bare = configSaysBare(repo.ConfigPath)
+		return repo, nil
+	}
+	if isBareRepository(path) {
+		return NewBareRepository(path), nil
+	}
+	return nil, fmt.Errorf("'%s' does not appear to be a zark repository", path)
+}
+
+// localRemote is a repository on the same filesystem.
+type localRemote struct {
+	repo *Repository
+}
+
+func (r *localRemote) Refs() (map[string]string, string, error) {
+	refs, err := ListRefs(r.repo)
+	if err != nil {
+		return nil, "", err
+	}
+	head, err := CurrentBranch(r.repo)
+	if err != nil {
+		return nil, "", err
+	}
+	return refs, head, nil
+}
+
+func (r *localRemote) Fetch(local *Repository, req fetchRequest) (*fetchReply, error) {
+	src, dst := NewStorage(r.repo), NewStorage(local)
+	objects, shallow, err := selectObjects(src, dst.Has, req)
+	if err != nil {
+		return nil, err
+	}
+	copied, err := copyObjects(src, dst, objects)
+	if err != nil {
+		return nil, err
+	}
+	return &fetchReply{Objects: copied, Shallow: shallow}, nil
+}
+
+func (r *localRemote) Push(local *Repository, updates []RefUpdate) (int, error) {
+	var wants []string
+	for _, update := range updates {
+		if update.New != "" {
+			wants = append(wants, update.New)
+		}
+	}
+	copied, err := copyMissingObjects(NewStorage(local), NewStorage(r.repo), wants)
+	if err != nil {
+		return 0, err
+	}
+	return copied, ReceiveRefUpdates(r.repo, updates)
+}
+
+// missingObjects lists the objects reachable from wants that the other side
+// does not have, according to has. A commit the other side has is assumed to
+// come with its whole history, so the walk stops there.
+func missingObjects(storage *Storage, has func(hash string) bool, wants []string) ([]string, error) {
+	missing, _, err := selectObjects(storage, has, fetchRequest{Wants: wants})
+	return missing, err
+}
+
+// copyMissingObjects copies the objects reachable from wants that dst lacks
+// from src to dst and returns how many were copied.
+func copyMissingObjects(src, dst *Storage, wants []string) (int, error) {
+	missing, err := missingObjects(src, dst.Has, wants)
+	if err != nil {
+		return 0, err
+	}
+	return copyObjects(src, dst, missing)
+}
+
+// checkConnected returns an error unless the history of tips is all present:
+// each commit down to those reachable from known, with its tree and, outside
+// a partial clone, the tree's blobs. A transfer cut short or a sender that
+// left objects out must not get references moved to history that cannot be
+// read. Hashes are printed with %.8s, as they may come from the sender.
+func checkConnected(storage *Storage, tips, known []string) error {
+	seen := make(map[string]bool)
+	pending := append([]string(nil), known...)
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if hash == "" || seen[hash] || !storage.Has(hash) {
+			continue
+		}
+		seen[hash] = true
+		commit, err := storage.LoadCommit(hash)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, commit.Parents()...)
+	}
+
+	partial := storage.promisorRemote() != nil
+	pending = append(pending[:0], tips...)
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if hash == "" || seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		if !storage.Has(hash) {
+			return fmt.Errorf("commit %.8s is missing", hash)
+		}
+		commit, err := storage.LoadCommit(hash)
+		if err != nil {
+			return err
+		}
+		if !storage.Has(commit.TreeHash) {
+			return fmt.Errorf("tree %.8s of commit %.8s is missing", commit.TreeHash, hash)
+		}
+		tree, err := storage.LoadTree(commit.TreeHash)
+		if err != nil {
+			return err
+		}
+		for _, entry := range tree.Entries {
+			if !partial && !storage.Has(entry.Hash) {
+				return fmt.Errorf("%s of commit %.8s is missing", entry.Name, hash)
+			}
+		}
+		pending = append(pending, commit.Parents()...)
+	}
+	return nil
+}
+
+// copyObjects copies the given objects from src to dst.
+func copyObjects(src, dst *Storage, hashes []string) (int, error) {
+	for _, hash := range hashes {
+		data, err := src.Load(hash)
+		if err != nil {
+			return 0, err
+		}
+		// Objects carry no type header, so any object can be stored as raw data.
+		if err := dst.Store(NewBlob(data)); err != nil {
+			return 0, fmt.Errorf("failed to store object %s: %w", hash[:8], err)
+		}
+	}
+	return len(hashes), nil
+}
@@ -0,0 +1,296 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// inDir runs fn with dir as the current directory.
+func inDir(t *testing.T, dir string, fn func()) {
+	t.Helper()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change to %s: %v", dir, err)
+	}
+	defer os.Chdir(wd)
+	fn()
+}
+
+// setupBareRemote creates an empty bare repository and adds it to repo as origin.
+func setupBareRemote(t *testing.T, repo *Repository) *Repository {
+	t.Helper()
+	bare := NewBareRepository(filepath.Join(t.TempDir(), "origin.zark"))
+	if err := bare.Init(); err != nil {
+		t.Fatalf("Failed to create bare repository: %v", err)
+	}
+	if err := AddRemote(repo, "origin", bare.Path); err != nil {
+		t.Fatalf("AddRemote failed: %v", err)
+	}
+	return bare
+}
+
+func TestRemoteConfig(t *testing.T) {
+	isolateConfig(t)
+	repo, _, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	os.Mkdir("../other", 0755)
+	if err := AddRemote(repo, "backup", "../other"); err != nil {
+		t.Fatalf("AddRemote failed: %v", err)
+	}
+	if err := AddRemote(repo, "backup", "/elsewhere"); err == nil {
+		t.Error("Expected adding an existing remote to fail")
+	}
+	if err := AddRemote(repo, "bad/name", "/elsewhere"); err == nil {
+		t.Error("Expected an invalid remote name to be refused")
+	}
+
+	remotes, err := ListRemotes(repo)
+	if err != nil || len(remotes) != 1 || remotes[0].Name != "backup" || !filepath.IsAbs(remotes[0].URL) {
+		t.Fatalf("Expected one remote with an absolute path, got %+v %v", remotes, err)
+	}
+
+	UpdateRef(repo, "refs/remotes/backup/main", strings.Repeat("a", 64))
+	if err := RemoveRemote(repo, "backup"); err != nil {
+		t.Fatalf("RemoveRemote failed: %v", err)
+	}
+	if remotes, _ := ListRemotes(repo); len(remotes) != 0 {
+		t.Errorf("Expected no remotes, got %+v", remotes)
+	}
+	if _, err := os.Stat(filepath.Join(repo.RefsDir, "remotes", "backup")); !os.IsNotExist(err) {
+		t.Error("Expected the remote-tracking branches to be removed")
+	}
+	if _, err := GetRemote(repo, "backup"); err == nil {
+		t.Error("Expected a removed remote to be unknown")
+	}
+}
+
+func TestCloneFetchPush(t *testing.T) {
+	t.Run("Push, clone and fetch copy only missing objects", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		bare := setupBareRemote(t, repo)
+
+		result, err := Push(repo, "origin", "main", PushOptions{})
+		if err != nil {
+			t.Fatalf("Push failed: %v", err)
+		}
+		head, _ := ResolveRef(repo, "HEAD")
+		if remoteHead, _ := ResolveRef(bare, "main"); remoteHead != head || result.Update.Old != "" {
+			t.Fatalf("Expected the bare repository to receive main, got %+v", result)
+		}
+		if tracking, _ := ResolveRef(repo, "origin/main"); tracking != head {
+			t.Error("Expected the remote-tracking branch to follow the push")
+		}
+		if again, _ := Push(repo, "origin", "main", PushOptions{}); !again.UpToDate {
+			t.Error("Expected a second push to be up to date")
+		}
+
+		cloneDir := filepath.Join(t.TempDir(), "copy")
+		clone, _, err := Clone(bare.Path, cloneDir)
+		if err != nil {
+			t.Fatalf("Clone failed: %v", err)
+		}
+		if data, err := os.ReadFile(filepath.Join(cloneDir, "test.txt")); err != nil || string(data) != "hello" {
+			t.Fatalf("Expected the clone to check out test.txt, got %q %v", data, err)
+		}
+		if branch, _ := CurrentBranch(clone); branch != "main" {
+			t.Errorf("Expected the clone to be on main, got %q", branch)
+		}
+
+		var newHead string
+		inDir(t, cloneDir, func() {
+			newHead = commitFile(t, clone, "notes.txt", "from the clone")
+			if _, err := Push(clone, "origin", "main", PushOptions{}); err != nil {
+				t.Fatalf("Push from the clone failed: %v", err)
+			}
+		})
+
+		fetched, err := Fetch(repo, "origin")
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		// One commit, its tree and the new blob.
+		if fetched.Objects != 3 {
+			t.Errorf("Expected only the 3 new objects to be copied, got %d", fetched.Objects)
+		}
+		if len(fetched.Updates) != 1 || fetched.Updates[0].Name != "refs/remotes/origin/main" || fetched.Updates[0].New != newHead {
+			t.Errorf("Expected origin/main to move to the new commit, got %+v", fetched.Updates)
+		}
+		if local, _ := ResolveRef(repo, "main"); local != head {
+			t.Error("Expected fetch to leave the local branch alone")
+		}
+	})
+
+	t.Run("Push refuses to drop remote commits unless forced", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		bare := setupBareRemote(t, repo)
+		Push(repo, "origin", "main", PushOptions{})
+
+		cloneDir := filepath.Join(t.TempDir(), "copy")
+		clone, _, _ := Clone(bare.Path, cloneDir)
+		inDir(t, cloneDir, func() {
+			commitFile(t, clone, "theirs.txt", "theirs")
+			Push(clone, "origin", "main", PushOptions{})
+		})
+
+		mine := commitFile(t, repo, "mine.txt", "mine")
+		if _, err := Push(repo, "origin", "main", PushOptions{}); err == nil || !strings.Contains(err.Error(), "fetch first") {
+			t.Fatalf("Expected the push to be rejected until fetching, got %v", err)
+		}
+		Fetch(repo, "origin")
+		if _, err := Push(repo, "origin", "main", PushOptions{}); err == nil || !strings.Contains(err.Error(), "non-fast-forward") {
+			t.Fatalf("Expected a non-fast-forward rejection, got %v", err)
+		}
+		if _, err := Push(repo, "origin", "main", PushOptions{Force: true}); err != nil {
+			t.Fatalf("Expected a forced push to succeed: %v", err)
+		}
+		if remoteHead, _ := ResolveRef(bare, "main"); remoteHead != mine {
+			t.Error("Expected the forced push to replace the remote branch")
+		}
+
+		if _, err := Push(repo, "origin", "main", PushOptions{Delete: true}); err != nil {
+			t.Fatalf("Expected deleting the remote branch to succeed: %v", err)
+		}
+		if _, err := ResolveRef(bare, "main"); err == nil {
+			t.Error("Expected the remote branch to be deleted")
+		}
+	})
+
+	t.Run("The remote rejects stale and checked-out updates", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		head, _ := ResolveRef(repo, "HEAD")
+
+		err := ReceiveRefUpdates(repo, []RefUpdate{{Name: "refs/heads/main", Old: head, New: head}})
+		if err == nil || !strings.Contains(err.Error(), "checked out") {
+			t.Errorf("Expected pushing to the checked out branch to be refused, got %v", err)
+		}
+		err = ReceiveRefUpdates(repo, []RefUpdate{{Name: "refs/heads/feature", Old: head, New: head}})
+		if err == nil || !strings.Contains(err.Error(), "fetch first") {
+			t.Errorf("Expected a stale update to be refused, got %v", err)
+		}
+		if err := ReceiveRefUpdates(repo, []RefUpdate{{Name: "refs/heads/feature", New: head}}); err != nil {
+			t.Errorf("Expected a new branch to be accepted: %v", err)
+		}
+		err = ReceiveRefUpdates(repo, []RefUpdate{{Name: "refs/heads/a//b", New: head}})
+		if err == nil || !strings.Contains(err.Error(), "invalid reference name") {
+			t.Errorf("Expected an invalid name to be refused, got %v", err)
+		}
+	})
+}
+
+func TestCloneRefusesHostileTrees(t *testing.T) {
+	isolateConfig(t)
+	source := NewBareRepository(filepath.Join(t.TempDir(), "hostile.zark"))
+	if err := source.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	storage := NewStorage(source)
+	blob := NewBlob([]byte("#!/bin/sh\necho planted\n"))
+	storage.Store(blob)
+	for _, name := range []string{".zark/hooks/pre-save", ".ZARK/hooks/pre-save", "../escaped-clone.txt", "a/../../escaped-clone.txt", "/tmp/escaped-clone.txt", "./a.txt", ""} {
+		tree := NewTree([]TreeEntry{{Mode: ModeExecutable, Name: name, Hash: blob.Hash(), Type: "blob"}})
+		storage.Store(tree)
+		commit := NewCommit(tree.Hash(), "", "Mallory", "mallory@example.com", "innocent")
+		storage.Store(commit)
+		UpdateRef(source, "refs/heads/main", commit.Hash())
+
+		parent := t.TempDir()
+		if _, _, err := Clone(source.Path, filepath.Join(parent, "clone")); err == nil || !strings.Contains(err.Error(), "the tree holds the path") {
+			t.Errorf("Expected a tree holding %q to be refused, got %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(parent, "clone", ".zark", "hooks", "pre-save")); !os.IsNotExist(err) {
+			t.Errorf("Expected no hook to be planted by %q", name)
+		}
+		if _, err := os.Stat(filepath.Join(parent, "escaped-clone.txt")); !os.IsNotExist(err) {
+			t.Errorf("Expected nothing to be written outside the clone by %q", name)
+		}
+	}
+}
+
+func TestObjectsAreSentDependenciesFirst(t *testing.T) {
+	isolateConfig(t)
+	repo, _, cleanup := setupTestRepo(t)
+	defer cleanup()
+	first := commitFile(t, repo, "one.txt", "one")
+	second := commitFile(t, repo, "two.txt", "two")
+
+	// A merge whose second parent descends from its first, so the walk
+	// reaches the first parent before the second.
+	storage := NewStorage(repo)
+	head, _ := storage.LoadCommit(second)
+	merge := NewCommit(head.TreeHash, first, "Test", "test@example.com", "merge")
+	merge.MergeParents = []string{second}
+	merge.rehash()
+	storage.Store(merge)
+
+	objects, err := missingObjects(storage, func(string) bool { return false }, []string{merge.Hash()})
+	if err != nil {
+		t.Fatalf("missingObjects failed: %v", err)
+	}
+	position := make(map[string]int)
+	for i, hash := range objects {
+		position[hash] = i
+	}
+	for _, hash := range objects {
+		commit, err := storage.LoadCommit(hash)
+		if err != nil || commit.TreeHash == "" {
+			continue
+		}
+		tree, _ := storage.LoadTree(commit.TreeHash)
+		needed := append([]string{commit.TreeHash}, commit.Parents()...)
+		for _, entry := range tree.Entries {
+			needed = append(needed, entry.Hash)
+		}
+		for _, dependency := range needed {
+			if position[dependency] > position[hash] {
+				t.Errorf("Expected %s to be sent before commit %s", dependency[:8], hash[:8])
+			}
+		}
+	}
+}
+
+func TestCheckRefName(t *testing.T) {
+	for _, name := range []string{"refs/heads/main", "refs/heads/feature/login", "refs/tags/v1.0", "refs/remotes/origin/main"} {
+		if err := checkRefName(name); err != nil {
+			t.Errorf("Expected %q to be valid: %v", name, err)
+		}
+	}
+	for _, name := range []string{"main", "refs/heads/../../../escaped", "refs/heads/", "refs//heads/x", "/refs/heads/x",
+		"refs/heads/.hidden", "refs/heads/x.lock", "refs/heads/a b", "refs/heads/tab\tx", "refs/heads/x\\y", "refs/heads/x."} {
+		if err := checkRefName(name); err == nil {
+			t.Errorf("Expected %q to be refused", name)
+		}
+	}
+}
+
+func TestStorageNoticesNewPacks(t *testing.T) {
+	isolateConfig(t)
+	repo, _, cleanup := setupTestRepo(t)
+	defer cleanup()
+	storage := NewStorage(repo)
+	blob := NewBlob([]byte("packed later"))
+	if storage.Has(blob.Hash()) {
+		t.Fatal("Expected the blob not to exist yet")
+	}
+
+	storage.Store(blob)
+	packer, err := NewPacker(repo)
+	if err != nil {
+		t.Fatalf("NewPacker failed: %v", err)
+	}
+	if _, err := packer.PackObjects(); err != nil {
+		t.Fatalf("PackObjects failed: %v", err)
+	}
+	os.Remove(storage.loosePath(blob.Hash()))
+	if data, err := storage.Load(blob.Hash()); !storage.Has(blob.Hash()) || string(data) != "packed later" {
+		t.Errorf("Expected the same storage to find the blob in the new pack, got %q %v", data, err)
+	}
+}
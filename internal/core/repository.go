@@ -1,10 +1,10 @@
 package core
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 )
 
 // Repository represents a Zark repository's structure and paths.
@@ -16,9 +16,11 @@ type Repository struct {
 	ConfigPath string
 	HeadPath   string
 	IndexPath  string
+	// Bare repositories have no working tree; the metadata lives directly in Path.
+	Bare bool
 }
 
-// Config holds the repository's configuration.
+// Config holds the typed settings Zark reads from the merged configuration.
 type Config struct {
 	User UserConfig `json:"user"`
 	Core CoreConfig `json:"core"`
@@ -35,7 +37,12 @@ type CoreConfig struct {
 
 // NewRepository creates a new Repository struct for a given path.
 func NewRepository(path string) *Repository {
-	zarkDir := filepath.Join(path, ".zark")
+	return NewRepositoryAt(path, filepath.Join(path, ".zark"))
+}
+
+// NewRepositoryAt creates a Repository whose metadata directory lives at zarkDir
+// and whose working tree is rooted at path. The two need not be nested.
+func NewRepositoryAt(path, zarkDir string) *Repository {
 	return &Repository{
 		Path:       path,
 		ZarkDir:    zarkDir,
@@ -47,6 +54,14 @@ func NewRepository(path string) *Repository {
 	}
 }
 
+// NewBareRepository creates a Repository for a bare repository, where the
+// objects, refs and config sit directly in path and there is no working tree.
+func NewBareRepository(path string) *Repository {
+	repo := NewRepositoryAt(path, path)
+	repo.Bare = true
+	return repo
+}
+
 // Init initializes the directory structure and default files for a new repository.
 func (r *Repository) Init() error {
 	dirs := []string{
@@ -63,22 +78,10 @@ func (r *Repository) Init() error {
 		}
 	}
 
-	// Create initial config
-	config := Config{
-		User: UserConfig{
-			Name:  "User",
-			Email: "user@example.com",
-		},
-		Core: CoreConfig{
-			Bare: false,
-		},
-	}
-	configData, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
-	}
-	if err := os.WriteFile(r.ConfigPath, configData, 0644); err != nil {
-		return fmt.Errorf("failed to write config: %w", err)
+	// Record whether the repository is bare; any existing settings are kept
+	// so that re-initializing does not clobber them.
+	if err := SetConfigValue(r.ConfigPath, "core.bare", strconv.FormatBool(r.Bare)); err != nil {
+		return err
 	}
 
 	// Create initial HEAD pointing to the main branch
@@ -86,6 +89,11 @@ func (r *Repository) Init() error {
 		return fmt.Errorf("failed to write HEAD: %w", err)
 	}
 
+	// Bare repositories have no working tree, and therefore no index.
+	if r.Bare {
+		return nil
+	}
+
 	// Create empty index
 	index := NewIndex()
 	if err := index.Save(r.IndexPath); err != nil {
@@ -96,22 +104,39 @@ func (r *Repository) Init() error {
 }
 
 // Exists checks if a .zark directory exists at the repository path.
+// For bare repositories it checks for the HEAD file instead.
 func (r *Repository) Exists() bool {
+	if r.Bare {
+		_, err := os.Stat(r.HeadPath)
+		return err == nil
+	}
 	_, err := os.Stat(r.ZarkDir)
 	return err == nil
 }
 
-// GetConfig reads and unmarshals the repository's config file.
-func (r *Repository) GetConfig() (*Config, error) {
-	data, err := os.ReadFile(r.ConfigPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config: %w", err)
+// RequireWorkTree returns an error if the repository has no working tree.
+func (r *Repository) RequireWorkTree() error {
+	if r.Bare {
+		return fmt.Errorf("this operation must be run in a work tree, but '%s' is a bare repository", r.Path)
 	}
+	return nil
+}
 
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+// GetConfig returns the effective configuration for the repository, merged
+// from the system, global and repository config files and the environment.
+func (r *Repository) GetConfig() (*Config, error) {
+	set, err := LoadConfig(r)
+	if err != nil {
+		return nil, err
 	}
 
-	return &config, nil
-}
\ No newline at end of file
+	return &Config{
+		User: UserConfig{
+			Name:  set.GetString("user.name", ""),
+			Email: set.GetString("user.email", ""),
+		},
+		Core: CoreConfig{
+			Bare: set.GetBool("core.bare", false),
+		},
+	}, nil
+}
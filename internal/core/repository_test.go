@@ -0,0 +1,68 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBareRepository(t *testing.T) {
+	t.Run("Init lays out a bare repository without a working tree", func(t *testing.T) {
+		dir := t.TempDir()
+		repo := NewBareRepository(dir)
+		if err := repo.Init(); err != nil {
+			t.Fatalf("Init failed: %v", err)
+		}
+
+		for _, name := range []string{"HEAD", "config", "objects", "refs"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Errorf("Expected %s directly in the bare repository: %v", name, err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".zark")); !os.IsNotExist(err) {
+			t.Error("A bare repository should not contain a .zark directory")
+		}
+		if _, err := os.Stat(filepath.Join(dir, "index")); !os.IsNotExist(err) {
+			t.Error("A bare repository should not have an index")
+		}
+
+		config, err := repo.GetConfig()
+		if err != nil {
+			t.Fatalf("GetConfig failed: %v", err)
+		}
+		if !config.Core.Bare {
+			t.Error("Expected core.bare to be true")
+		}
+	})
+
+	t.Run("Discovery recognises bare repositories", func(t *testing.T) {
+		dir := t.TempDir()
+		NewBareRepository(dir).Init()
+
+		repo, err := FindRepository(filepath.Join(dir, "refs", "heads"))
+		if err != nil {
+			t.Fatalf("FindRepository failed: %v", err)
+		}
+		if !repo.Bare || repo.ZarkDir != dir {
+			t.Errorf("Expected a bare repository at %s, got %+v", dir, repo)
+		}
+	})
+
+	t.Run("Working tree operations refuse to run", func(t *testing.T) {
+		dir := t.TempDir()
+		repo := NewBareRepository(dir)
+		repo.Init()
+
+		err := AddFiles(repo, []string{"anything.txt"})
+		if err == nil || !strings.Contains(err.Error(), "bare repository") {
+			t.Errorf("Expected AddFiles to refuse in a bare repository, got %v", err)
+		}
+		if err := GetStatus(repo); err == nil {
+			t.Error("Expected GetStatus to refuse in a bare repository")
+		}
+		if _, err := CreateCommit(repo, "message", false); err == nil {
+			t.Error("Expected CreateCommit to refuse in a bare repository")
+		}
+	})
+}
@@ -0,0 +1,228 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TreeRewriter returns the new entries for a tree. It is called once for
+// every distinct tree in the history being rewritten.
+type TreeRewriter func(entries []TreeEntry) ([]TreeEntry, error)
+
+// RewriteResult describes what RewriteHistory changed.
+type RewriteResult struct {
+	// Commits maps every rewritten commit to its replacement.
+	Commits map[string]string
+	// Refs lists the references that now point at a different commit.
+	Refs []string
+	// MapPath is the file the old-to-new commit map was written to.
+	MapPath string
+}
+
+// RewriteHistory rewrites every commit reachable from any reference or HEAD,
+// replacing each tree with the result of rewrite. Commits whose tree and
+// parents are unchanged keep their hash; the others are recreated with the
+// same author, committer and message but without their signature, which no
+// longer matches. References, HEAD and the index are moved to the rewritten
+// commits, and the old-to-new commit map is saved in .zark/rewrite-map.
+func RewriteHistory(repo *Repository, rewrite TreeRewriter) (*RewriteResult, error) {
+	storage := NewStorage(repo)
+	refs, err := ListRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	headData, err := os.ReadFile(repo.HeadPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	detachedHead := strings.TrimSpace(string(headData))
+	if strings.HasPrefix(detachedHead, "ref: ") {
+		detachedHead = ""
+	}
+
+	var roots []string
+	for _, hash := range refs {
+		roots = append(roots, hash)
+	}
+	if detachedHead != "" {
+		roots = append(roots, detachedHead)
+	}
+	order, err := commitsParentsFirst(storage, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RewriteResult{Commits: make(map[string]string)}
+	newTrees := make(map[string]string)
+	for _, commit := range order {
+		newTree, ok := newTrees[commit.TreeHash]
+		if !ok {
+			tree, err := storage.LoadTree(commit.TreeHash)
+			if err != nil {
+				return nil, err
+			}
+			entries, err := rewrite(tree.Entries)
+			if err != nil {
+				return nil, err
+			}
+			rewritten := NewTree(entries)
+			if err := storage.Store(rewritten); err != nil {
+				return nil, fmt.Errorf("failed to store tree object: %w", err)
+			}
+			newTree = rewritten.Hash()
+			newTrees[commit.TreeHash] = newTree
+		}
+
+		parents := commit.Parents()
+		parentsChanged := false
+		for i, parent := range parents {
+			if mapped, ok := result.Commits[parent]; ok {
+				parents[i] = mapped
+				parentsChanged = true
+			}
+		}
+		if newTree == commit.TreeHash && !parentsChanged {
+			continue
+		}
+
+		rewritten := *commit
+		rewritten.TreeHash = newTree
+		if len(parents) > 0 {
+			rewritten.Parent = parents[0]
+			rewritten.MergeParents = parents[1:]
+		}
+		rewritten.Signature = nil
+		rewritten.rehash()
+		if err := storage.Store(&rewritten); err != nil {
+			return nil, fmt.Errorf("failed to store commit object: %w", err)
+		}
+		result.Commits[commit.hash] = rewritten.Hash()
+	}
+
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if newHash, ok := result.Commits[refs[name]]; ok {
+			if err := UpdateRef(repo, name, newHash); err != nil {
+				return nil, err
+			}
+			result.Refs = append(result.Refs, name)
+		}
+	}
+	if newHash, ok := result.Commits[detachedHead]; ok {
+		if err := os.WriteFile(repo.HeadPath, []byte(newHash), 0644); err != nil {
+			return nil, fmt.Errorf("failed to update HEAD: %w", err)
+		}
+		result.Refs = append(result.Refs, "HEAD")
+	}
+
+	if err := writeRewriteMap(repo, result); err != nil {
+		return nil, err
+	}
+	if !repo.Bare && len(result.Commits) > 0 {
+		if err := resetIndexToHead(repo, storage); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// commitsParentsFirst loads every commit reachable from roots and orders
+// them so that each commit comes after all of its parents.
+func commitsParentsFirst(storage *Storage, roots []string) ([]*Commit, error) {
+	var order []*Commit
+	visited := make(map[string]bool)
+	type frame struct {
+		commit   *Commit
+		expanded bool
+	}
+	var stack []frame
+	for _, root := range roots {
+		if root == "" || visited[root] {
+			continue
+		}
+		commit, err := storage.LoadCommit(root)
+		if err != nil {
+			return nil, err
+		}
+		visited[root] = true
+		stack = append(stack, frame{commit: commit})
+
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if top.expanded {
+				order = append(order, top.commit)
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			top.expanded = true
+			for _, parent := range top.commit.Parents() {
+				if visited[parent] {
+					continue
+				}
+				parentCommit, err := storage.LoadCommit(parent)
+				if err != nil {
+					return nil, err
+				}
+				visited[parent] = true
+				stack = append(stack, frame{commit: parentCommit})
+			}
+		}
+	}
+	return order, nil
+}
+
+func writeRewriteMap(repo *Repository, result *RewriteResult) error {
+	olds := make([]string, 0, len(result.Commits))
+	for old := range result.Commits {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+
+	var b strings.Builder
+	for _, old := range olds {
+		fmt.Fprintf(&b, "%s %s\n", old, result.Commits[old])
+	}
+	result.MapPath = filepath.Join(repo.ZarkDir, "rewrite-map")
+	if err := os.WriteFile(result.MapPath, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write rewrite map: %w", err)
+	}
+	return nil
+}
+
+// resetIndexToHead replaces the staged content with the tree of HEAD,
+// leaving the working tree untouched.
+func resetIndexToHead(repo *Repository, storage *Storage) error {
+	head, err := GetHeadTree(repo, storage)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(head))
+	for path := range head {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	index := NewIndex()
+	for _, path := range paths {
+		entry := head[path]
+		var size int64
+		var modified time.Time
+		if info, err := os.Lstat(filepath.Join(repo.Path, path)); err == nil {
+			size, modified = info.Size(), info.ModTime()
+		}
+		index.Add(path, entry.Hash, entry.Mode, size, modified)
+	}
+	if err := index.Save(repo.IndexPath); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+	return nil
+}
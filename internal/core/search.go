@@ -43,7 +43,7 @@ func SearchCommits(repo *Repository, query, author, message string) ([]*Commit,
 			commit.hash = hash // Set the hash since it's not in the JSON
 
 			match := true
-			if author != "" && !strings.Contains(commit.Author, author) {
+			if author != "" && !commitHasAuthor(&commit, author) {
 				match = false
 			}
 			if message != "" && !strings.Contains(commit.Message, message) {
@@ -65,4 +65,16 @@ func SearchCommits(repo *Repository, query, author, message string) ([]*Commit,
 	}
 
 	return results, nil
-}
\ No newline at end of file
+}
+
+// commitHasAuthor reports whether the author's or any co-author's name or
+// email contains the search term, so pair-programmed commits are found for both people.
+func commitHasAuthor(commit *Commit, term string) bool {
+	identities := append([]Identity{commit.AuthorIdentity()}, commit.CoAuthors()...)
+	for _, identity := range identities {
+		if strings.Contains(identity.Name, term) || strings.Contains(identity.Email, term) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,355 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// AllowSecretMarker placed anywhere on a line tells the scanner to ignore that line.
+const AllowSecretMarker = "zark:allow-secret"
+
+// SecretRule is a named pattern that identifies one kind of secret.
+type SecretRule struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Regex       string `json:"regex"`
+	// SecretGroup is the capture group holding the secret itself; 0 means the whole match.
+	SecretGroup int `json:"secret_group,omitempty"`
+	// MinEntropy rejects matches whose secret has less Shannon entropy (bits
+	// per character) than this, which filters out placeholders like "xxxx...".
+	MinEntropy float64 `json:"min_entropy,omitempty"`
+	// Paths limits the rule to files matching these globs.
+	Paths []string `json:"paths,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// SecretRules is the scanner configuration read from .zark/secrets.json.
+type SecretRules struct {
+	// UseDefaultRules keeps the built-in rules; rules with the same name replace them.
+	UseDefaultRules *bool        `json:"use_default_rules,omitempty"`
+	Rules           []SecretRule `json:"rules,omitempty"`
+	// ExcludePaths are globs of files never scanned, e.g. "testdata/" or "*.lock".
+	ExcludePaths []string `json:"exclude_paths,omitempty"`
+	// Allowlist holds regexes; a secret matching any of them is ignored.
+	Allowlist []string `json:"allowlist,omitempty"`
+
+	allow []*regexp.Regexp
+}
+
+// SecretFinding is one potential secret found by the scanner.
+type SecretFinding struct {
+	Rule   string `json:"rule"`
+	Path   string `json:"path"`
+	Line   int    `json:"line"`
+	Commit string `json:"commit,omitempty"`
+	// Fingerprint identifies the finding independently of its line number,
+	// so baselined findings stay accepted when code moves around.
+	Fingerprint string `json:"fingerprint"`
+	secret      string
+}
+
+// Redacted returns the secret with all but its first few characters hidden.
+func (f SecretFinding) Redacted() string {
+	if len(f.secret) <= 4 {
+		return "****"
+	}
+	return f.secret[:4] + strings.Repeat("*", min(len(f.secret)-4, 16))
+}
+
+// Secret returns the matched secret.
+func (f SecretFinding) Secret() string { return f.secret }
+
+// defaultSecretRules are used unless a rules file disables them.
+var defaultSecretRules = []SecretRule{
+	{
+		Name:        "generic-secret",
+		Description: "Assignment of an API key, token, secret or password",
+		Regex:       `(?i)(api[_-]?key|secret|token|password|passwd)["']?[\s=:]+['"]?([a-zA-Z0-9_.\-/+=]{20,})['"]?`,
+		SecretGroup: 2,
+		MinEntropy:  3.0,
+	},
+	{
+		Name:        "aws-access-key-id",
+		Description: "AWS access key ID",
+		Regex:       `\b((?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16})\b`,
+		SecretGroup: 1,
+	},
+	{
+		Name:        "aws-secret-access-key",
+		Description: "AWS secret access key",
+		Regex:       `(?i)aws_?secret_?access_?key["']?[\s=:]+['"]?([A-Za-z0-9/+=]{40})\b`,
+		SecretGroup: 1,
+		MinEntropy:  3.5,
+	},
+	{
+		Name:        "private-key",
+		Description: "PEM or OpenSSH private key block",
+		Regex:       `-----BEGIN ((RSA|DSA|EC|OPENSSH|PGP|ENCRYPTED) )?PRIVATE KEY( BLOCK)?-----`,
+	},
+	{
+		Name:        "jwt",
+		Description: "JSON Web Token",
+		Regex:       `\b(eyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,})`,
+		SecretGroup: 1,
+	},
+	{
+		Name:        "github-token",
+		Description: "GitHub personal access or app token",
+		Regex:       `\b(gh[pousr]_[A-Za-z0-9]{36,})\b`,
+		SecretGroup: 1,
+	},
+	{
+		Name:        "slack-token",
+		Description: "Slack API token",
+		Regex:       `\b(xox[abposr]-[A-Za-z0-9-]{10,})\b`,
+		SecretGroup: 1,
+	},
+}
+
+// SecretRulesPath returns the location of the rules file.
+func SecretRulesPath(repo *Repository) string {
+	return filepath.Join(repo.ZarkDir, "secrets.json")
+}
+
+// SecretBaselinePath returns the location of the baseline of accepted findings.
+func SecretBaselinePath(repo *Repository) string {
+	return filepath.Join(repo.ZarkDir, "secrets-baseline.json")
+}
+
+// LoadSecretRules reads .zark/secrets.json, falling back to the built-in rules,
+// and compiles every pattern.
+func LoadSecretRules(repo *Repository) (*SecretRules, error) {
+	rules := &SecretRules{}
+	data, err := os.ReadFile(SecretRulesPath(repo))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read secret rules: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, rules); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", SecretRulesPath(repo), err)
+		}
+	}
+
+	if rules.UseDefaultRules == nil || *rules.UseDefaultRules {
+		custom := make(map[string]bool)
+		for _, rule := range rules.Rules {
+			custom[rule.Name] = true
+		}
+		for _, rule := range defaultSecretRules {
+			if !custom[rule.Name] {
+				rules.Rules = append(rules.Rules, rule)
+			}
+		}
+	}
+
+	if err := rules.compile(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (r *SecretRules) compile() error {
+	for i := range r.Rules {
+		rule := &r.Rules[i]
+		if rule.Name == "" {
+			return fmt.Errorf("secret rule %d has no name", i+1)
+		}
+		re, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			return fmt.Errorf("secret rule '%s' has an invalid regex: %w", rule.Name, err)
+		}
+		if rule.SecretGroup > re.NumSubexp() {
+			return fmt.Errorf("secret rule '%s' uses group %d but the regex only has %d", rule.Name, rule.SecretGroup, re.NumSubexp())
+		}
+		rule.re = re
+	}
+	for _, pattern := range r.Allowlist {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid allowlist regex '%s': %w", pattern, err)
+		}
+		r.allow = append(r.allow, re)
+	}
+	return nil
+}
+
+// Excluded reports whether path is excluded from scanning.
+func (r *SecretRules) Excluded(path string) bool {
+	for _, pattern := range r.ExcludePaths {
+		if matchPathGlob(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// ScanContent returns every finding in content, which belongs to path.
+func (r *SecretRules) ScanContent(path string, content []byte) []SecretFinding {
+	if r.Excluded(path) {
+		return nil
+	}
+	return r.scan(path, content, true)
+}
+
+// scan applies the rules line by line. With checkPaths false every rule is
+// applied regardless of its Paths, which tells whether content is clean at any path.
+func (r *SecretRules) scan(path string, content []byte, checkPaths bool) []SecretFinding {
+	var findings []SecretFinding
+	for i, line := range bytes.Split(content, []byte("\n")) {
+		if bytes.Contains(line, []byte(AllowSecretMarker)) {
+			continue
+		}
+		for j := range r.Rules {
+			rule := &r.Rules[j]
+			if checkPaths && !rule.appliesTo(path) {
+				continue
+			}
+			for _, match := range rule.re.FindAllSubmatch(line, -1) {
+				secret := string(match[rule.SecretGroup])
+				if rule.MinEntropy > 0 && ShannonEntropy(secret) < rule.MinEntropy {
+					continue
+				}
+				if r.allowed(secret) {
+					continue
+				}
+				findings = append(findings, newSecretFinding(rule.Name, path, i+1, secret))
+			}
+		}
+	}
+	return findings
+}
+
+func (rule *SecretRule) appliesTo(path string) bool {
+	if len(rule.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range rule.Paths {
+		if matchPathGlob(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *SecretRules) allowed(secret string) bool {
+	for _, re := range r.allow {
+		if re.MatchString(secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func newSecretFinding(rule, path string, line int, secret string) SecretFinding {
+	sum := sha256.Sum256([]byte(rule + "\x00" + path + "\x00" + secret))
+	return SecretFinding{
+		Rule:        rule,
+		Path:        path,
+		Line:        line,
+		Fingerprint: hex.EncodeToString(sum[:8]),
+		secret:      secret,
+	}
+}
+
+// Fingerprint identifies the rule set, so cached results are discarded when rules change.
+func (r *SecretRules) Fingerprint() string {
+	data, _ := json.Marshal(struct {
+		Rules     []SecretRule
+		Allowlist []string
+	}{r.Rules, r.Allowlist})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// isBinaryContent uses the same heuristic as Git: a NUL byte in the first 8000 bytes.
+func isBinaryContent(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
+
+// ShannonEntropy returns the entropy of s in bits per character.
+func ShannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// SecretBaseline lists findings that have been reviewed and accepted.
+type SecretBaseline struct {
+	Findings []SecretFinding `json:"findings"`
+}
+
+// LoadSecretBaseline reads the baseline file; a missing file is an empty baseline.
+func LoadSecretBaseline(repo *Repository) (*SecretBaseline, error) {
+	baseline := &SecretBaseline{}
+	data, err := os.ReadFile(SecretBaselinePath(repo))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return baseline, nil
+		}
+		return nil, fmt.Errorf("failed to read secrets baseline: %w", err)
+	}
+	if err := json.Unmarshal(data, baseline); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", SecretBaselinePath(repo), err)
+	}
+	return baseline, nil
+}
+
+// WriteSecretBaseline records findings as accepted, replacing the previous baseline.
+func WriteSecretBaseline(repo *Repository, findings []SecretFinding) error {
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Path != findings[j].Path {
+			return findings[i].Path < findings[j].Path
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	data, err := json.MarshalIndent(SecretBaseline{Findings: findings}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets baseline: %w", err)
+	}
+	return os.WriteFile(SecretBaselinePath(repo), data, 0644)
+}
+
+// Contains reports whether a finding has been accepted.
+func (b *SecretBaseline) Contains(finding SecretFinding) bool {
+	for _, accepted := range b.Findings {
+		if accepted.Fingerprint == finding.Fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatSecretFindings renders findings one per line for error messages.
+func FormatSecretFindings(findings []SecretFinding) string {
+	var b strings.Builder
+	for _, finding := range findings {
+		location := fmt.Sprintf("%s:%d", finding.Path, finding.Line)
+		if finding.Commit != "" {
+			location = finding.Commit[:8] + " " + location
+		}
+		fmt.Fprintf(&b, "  %s  [%s] %s\n", location, finding.Rule, finding.Redacted())
+	}
+	return b.String()
+}
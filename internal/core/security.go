@@ -1,64 +1,134 @@
 package core
 
 import (
-	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
+	"sort"
 )
 
-// ScanForSecrets scans staged files for potential secrets before a commit.
-func ScanForSecrets(repo *Repository) error {
+// secretScanCache remembers blobs that contain nothing any rule matches, so
+// unchanged files are not rescanned on every save. Blobs with findings are
+// always rescanned because whether they are reported depends on their path.
+type secretScanCache struct {
+	Rules string   `json:"rules"`
+	Clean []string `json:"clean"`
+
+	path  string
+	clean map[string]bool
+	dirty bool
+}
+
+func loadSecretScanCache(repo *Repository, rules *SecretRules) *secretScanCache {
+	cache := &secretScanCache{
+		path:  filepath.Join(repo.ZarkDir, "secrets-cache.json"),
+		clean: make(map[string]bool),
+	}
+	// A missing or unreadable cache only means more scanning.
+	data, err := os.ReadFile(cache.path)
+	if err == nil && json.Unmarshal(data, cache) == nil && cache.Rules == rules.Fingerprint() {
+		for _, hash := range cache.Clean {
+			cache.clean[hash] = true
+		}
+	}
+	cache.Rules = rules.Fingerprint()
+	return cache
+}
+
+func (c *secretScanCache) markClean(hash string) {
+	if !c.clean[hash] {
+		c.clean[hash] = true
+		c.dirty = true
+	}
+}
+
+func (c *secretScanCache) save() error {
+	if !c.dirty {
+		return nil
+	}
+	c.Clean = c.Clean[:0]
+	for hash := range c.clean {
+		c.Clean = append(c.Clean, hash)
+	}
+	sort.Strings(c.Clean)
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secret scan cache: %w", err)
+	}
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write secret scan cache: %w", err)
+	}
+	return nil
+}
+
+// FindSecrets scans the staged content of every file in the index with the
+// repository's secret rules and returns every finding that is not in the
+// baseline. Binary files are skipped.
+func FindSecrets(repo *Repository) ([]SecretFinding, error) {
 	index, err := LoadIndex(repo.IndexPath)
 	if err != nil {
 		// If the index doesn't exist, there's nothing to scan.
 		if os.IsNotExist(err) {
-			return nil
+			return nil, nil
 		}
-		return err
+		return nil, err
 	}
 
-	// This regex is a simple example. Real-world scanners use more sophisticated patterns.
-	// It looks for common keywords followed by what might be a secret string.
-	re := regexp.MustCompile(`(?i)(api_key|secret|token|password)[\s=:]+['"]?([a-zA-Z0-9_.-]{20,})['"]?`)
+	rules, err := LoadSecretRules(repo)
+	if err != nil {
+		return nil, err
+	}
+	baseline, err := LoadSecretBaseline(repo)
+	if err != nil {
+		return nil, err
+	}
 
+	storage := NewStorage(repo)
+	cache := loadSecretScanCache(repo, rules)
+	var findings []SecretFinding
 	for _, entry := range index.Entries {
-		filePath := filepath.Join(repo.Path, entry.Path)
-		file, err := os.Open(filePath)
+		if cache.clean[entry.Hash] || rules.Excluded(entry.Path) {
+			continue
+		}
+
+		content, err := storage.Load(entry.Hash)
 		if err != nil {
-			// Silently skip files that can't be opened.
+			return nil, fmt.Errorf("failed to read staged content of %s: %w", entry.Path, err)
+		}
+		if isBinaryContent(content) || len(rules.scan(entry.Path, content, false)) == 0 {
+			cache.markClean(entry.Hash)
 			continue
 		}
-		defer file.Close()
 
-		scanner := bufio.NewScanner(file)
-		lineNumber := 0
-		for scanner.Scan() {
-			lineNumber++
-			if re.MatchString(scanner.Text()) {
-				// Found a potential secret. Abort the commit with an actionable error message.
-				return fmt.Errorf(
-					"error: potential secret found in %s on line %d.\n"+
-						"To override, commit with the '--no-verify' flag (not implemented). Aborting commit",
-					entry.Path, lineNumber,
-				)
+		for _, finding := range rules.ScanContent(entry.Path, content) {
+			if !baseline.Contains(finding) {
+				findings = append(findings, finding)
 			}
 		}
 	}
 
-	return nil
+	if err := cache.save(); err != nil {
+		return nil, err
+	}
+	return findings, nil
 }
 
-// SignCommit is a placeholder for GPG signing logic.
-func SignCommit(commit *Commit) (*Commit, error) {
-	// In a real implementation, you would use a library like `golang.org/x/crypto/openpgp`
-	// to sign the commit data with a user's GPG key. This involves finding the user's key,
-	// creating a signature, and appending it to the commit message.
-	fmt.Println("Signing commit (placeholder)...")
-	// For this placeholder, we'll just add a fake signature block to the message.
-	commit.Message += "\n\n-----BEGIN ZARK SIGNATURE-----\n"
-	commit.Message += "gpcA/p1AyoA4oFATESgC5eU+A8vB8+A9vA8+A9vA8+A9vA8+A9vA8+A9vA8+A9vA8+A9\n"
-	commit.Message += "-----END ZARK SIGNATURE-----\n"
-	return commit, nil
-}
\ No newline at end of file
+// ScanForSecrets scans staged files for potential secrets before a commit
+// and reports all of them at once.
+func ScanForSecrets(repo *Repository) error {
+	findings, err := FindSecrets(repo)
+	if err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"error: %d potential secret(s) found in staged files:\n%s"+
+			"Remove them, add '%s' to a line that is a false positive,\n"+
+			"or accept the current findings with 'zark secrets baseline'. Aborting commit",
+		len(findings), FormatSecretFindings(findings), AllowSecretMarker,
+	)
+}
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Access levels a user can have on a served repository. Write includes read.
+const (
+	AccessNone  = "none"
+	AccessRead  = "read"
+	AccessWrite = "write"
+)
+
+// passwordIterations is the PBKDF2 work factor for new password hashes.
+const passwordIterations = 600000
+
+// ServerUsers is the users file of 'zark serve --users'. Passwords and tokens
+// are stored hashed, as produced by HashPassword and NewAccessToken.
+//
+//	{
+//	  "users": {
+//	    "alice": {"password": "pbkdf2-sha256$...", "tokens": ["sha256:..."],
+//	              "access": {"project": "write", "*": "read"}}
+//	  },
+//	  "anonymous": {"docs": "read"}
+//	}
+//
+// Access maps repository names, or "*" for any other repository, to "read",
+// "write" or "none". Anonymous is the access of requests without credentials.
+type ServerUsers struct {
+	Users     map[string]ServerUser `json:"users"`
+	Anonymous map[string]string     `json:"anonymous,omitempty"`
+}
+
+// ServerUser is one account in the users file.
+type ServerUser struct {
+	Password string            `json:"password,omitempty"`
+	Tokens   []string          `json:"tokens,omitempty"`
+	Access   map[string]string `json:"access"`
+}
+
+// LoadServerUsers reads and checks a users file.
+func LoadServerUsers(path string) (*ServerUsers, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+	var users ServerUsers
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse users file %s: %w", path, err)
+	}
+	check := func(owner string, access map[string]string) error {
+		for repo, level := range access {
+			if level != AccessNone && level != AccessRead && level != AccessWrite {
+				return fmt.Errorf("users file %s: %s has access '%s' to '%s'; use read, write or none", path, owner, level, repo)
+			}
+		}
+		return nil
+	}
+	for name, user := range users.Users {
+		if err := check(name, user.Access); err != nil {
+			return nil, err
+		}
+		if user.Password != "" && !strings.HasPrefix(user.Password, "pbkdf2-sha256$") {
+			return nil, fmt.Errorf("users file %s: the password of %s is not hashed.\nhint: create the hash with 'zark serve hash-password'", path, name)
+		}
+		for _, token := range user.Tokens {
+			if !strings.HasPrefix(token, "sha256:") {
+				return nil, fmt.Errorf("users file %s: a token of %s is not hashed.\nhint: create tokens with 'zark serve new-token'", path, name)
+			}
+		}
+	}
+	if err := check("anonymous", users.Anonymous); err != nil {
+		return nil, err
+	}
+	return &users, nil
+}
+
+// HashPassword returns the users-file form of a password.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkPassword compares a password with a hash made by HashPassword.
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	salt, saltErr := base64.RawStdEncoding.DecodeString(parts[2])
+	expected, keyErr := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || saltErr != nil || keyErr != nil {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	return err == nil && subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// NewAccessToken generates a random token and the hash to put in the users
+// file. Tokens are long and random, so a plain SHA-256 is enough.
+func NewAccessToken() (token, hash string, err error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token = "zark_" + hex.EncodeToString(raw)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Authenticate identifies the user behind a request from its bearer token or
+// basic-auth name and password. It returns "" for a request without
+// credentials, and an error if the credentials are wrong.
+func (u *ServerUsers) Authenticate(r *http.Request) (string, error) {
+	if name, password, ok := r.BasicAuth(); ok {
+		if user, exists := u.Users[name]; exists && user.Password != "" && checkPassword(user.Password, password) {
+			return name, nil
+		}
+		// Some clients send a token as the password of any user name.
+		if name, ok := u.userForToken(password); ok {
+			return name, nil
+		}
+		return "", fmt.Errorf("wrong user name or password")
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if name, ok := u.userForToken(token); ok {
+			return name, nil
+		}
+		return "", fmt.Errorf("the token is not valid")
+	}
+	return "", nil
+}
+
+func (u *ServerUsers) userForToken(token string) (string, bool) {
+	hash := hashToken(token)
+	for name, user := range u.Users {
+		for _, candidate := range user.Tokens {
+			if subtle.ConstantTimeCompare([]byte(candidate), []byte(hash)) == 1 {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Access returns the access level of user, or of anonymous requests when
+// user is "", on the named repository.
+func (u *ServerUsers) Access(user, repo string) string {
+	access := u.Anonymous
+	if user != "" {
+		access = u.Users[user].Access
+	}
+	if level, ok := access[repo]; ok {
+		return level
+	}
+	if level, ok := access["*"]; ok {
+		return level
+	}
+	return AccessNone
+}
+
+// allows reports whether level grants the wanted access.
+func allows(level, want string) bool {
+	return level == AccessWrite || (level == AccessRead && want == AccessRead)
+}
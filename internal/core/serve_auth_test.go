@@ -0,0 +1,170 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveWithUsers serves the bare repository over loopback, restricted by a
+// users file in which alice can push, bob can only read, and carol pushes
+// with the returned token.
+func serveWithUsers(t *testing.T, bare *Repository) (url, token string) {
+	t.Helper()
+	password, err := HashPassword("alice-secret")
+	if err != nil {
+		t.Fatalf("HashPassword failed: %v", err)
+	}
+	token, tokenHash, err := NewAccessToken()
+	if err != nil {
+		t.Fatalf("NewAccessToken failed: %v", err)
+	}
+	users := ServerUsers{Users: map[string]ServerUser{
+		"alice": {Password: password, Access: map[string]string{"origin": AccessWrite}},
+		"bob":   {Password: password, Access: map[string]string{"*": AccessRead}},
+		"carol": {Tokens: []string{tokenHash}, Access: map[string]string{"*": AccessWrite}},
+	}}
+	data, _ := json.Marshal(users)
+	path := filepath.Join(t.TempDir(), "users.json")
+	os.WriteFile(path, data, 0600)
+
+	repos, _ := OpenServedRepositories([]string{bare.Path})
+	server := NewHTTPServer(repos)
+	if server.Users, err = LoadServerUsers(path); err != nil {
+		t.Fatalf("LoadServerUsers failed: %v", err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return httpServer.URL + "/origin", token
+}
+
+// withCredentials puts a user name and password into an http:// URL.
+func withCredentials(url, user, password string) string {
+	return strings.Replace(url, "http://", "http://"+user+":"+password+"@", 1)
+}
+
+func TestServeAuthentication(t *testing.T) {
+	isolateConfig(t)
+	repo, _, cleanup := setupTestRepo(t)
+	defer cleanup()
+	bare := setupBareRemote(t, repo)
+	url, token := serveWithUsers(t, bare)
+
+	SetConfigValue(repo.ConfigPath, "remote.origin.url", url)
+	if _, err := Push(repo, "origin", "main", PushOptions{}); err == nil || !strings.Contains(err.Error(), "authentication required") ||
+		!strings.Contains(err.Error(), "hint:") {
+		t.Errorf("Expected an anonymous push to ask for credentials, got %v", err)
+	}
+
+	SetConfigValue(repo.ConfigPath, "remote.origin.url", withCredentials(url, "alice", "wrong"))
+	if _, err := Push(repo, "origin", "main", PushOptions{}); err == nil || !strings.Contains(err.Error(), "wrong user name or password") {
+		t.Errorf("Expected a wrong password to be refused, got %v", err)
+	} else if strings.Contains(err.Error(), "wrong@") {
+		t.Errorf("Expected the password to be hidden from messages, got %v", err)
+	}
+
+	SetConfigValue(repo.ConfigPath, "remote.origin.url", withCredentials(url, "alice", "alice-secret"))
+	if _, err := Push(repo, "origin", "main", PushOptions{}); err != nil {
+		t.Fatalf("Expected alice to push: %v", err)
+	}
+
+	SetConfigValue(repo.ConfigPath, "remote.origin.url", withCredentials(url, "bob", "alice-secret"))
+	if _, err := Fetch(repo, "origin"); err != nil {
+		t.Errorf("Expected bob to fetch: %v", err)
+	}
+	commitFile(t, repo, "bob.txt", "bob")
+	if _, err := Push(repo, "origin", "main", PushOptions{}); err == nil || !strings.Contains(err.Error(), "bob is not allowed to push to 'origin'") {
+		t.Errorf("Expected bob's push to be forbidden, got %v", err)
+	}
+
+	SetConfigValue(repo.ConfigPath, "remote.origin.url", url)
+	SetConfigValue(repo.ConfigPath, "remote.origin.token", token)
+	if _, err := Push(repo, "origin", "main", PushOptions{}); err != nil {
+		t.Errorf("Expected carol to push with her token: %v", err)
+	}
+}
+
+func TestProtectedBranches(t *testing.T) {
+	t.Run("Protected branches refuse force pushes and deletion", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		bare := setupBareRemote(t, repo)
+		Push(repo, "origin", "main", PushOptions{})
+		SetConfigValue(bare.ConfigPath, "branch.main.protected", "true")
+
+		cloneDir := filepath.Join(t.TempDir(), "copy")
+		clone, _, _ := Clone(bare.Path, cloneDir)
+		inDir(t, cloneDir, func() {
+			commitFile(t, clone, "theirs.txt", "theirs")
+			if _, err := Push(clone, "origin", "main", PushOptions{}); err != nil {
+				t.Fatalf("Expected a fast-forward to a protected branch to succeed: %v", err)
+			}
+		})
+
+		commitFile(t, repo, "mine.txt", "mine")
+		_, err := Push(repo, "origin", "main", PushOptions{Force: true})
+		if err == nil || !strings.Contains(err.Error(), "protected branch: force pushes are not allowed") {
+			t.Errorf("Expected the force push to be refused, got %v", err)
+		}
+		_, err = Push(repo, "origin", "main", PushOptions{Delete: true})
+		if err == nil || !strings.Contains(err.Error(), "cannot be deleted") {
+			t.Errorf("Expected the deletion to be refused, got %v", err)
+		}
+	})
+
+	t.Run("Branches with verifysignatures only accept signed commits", func(t *testing.T) {
+		isolateConfig(t)
+		key := setupSigningKey(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		bare := setupBareRemote(t, repo)
+		Push(repo, "origin", "main", PushOptions{})
+		head, _ := ResolveRef(repo, "HEAD")
+		SetConfigValue(bare.ConfigPath, "branch.main.verifysignatures", "true")
+		trustKey(t, bare, "tester@example.com", key)
+
+		commitFile(t, repo, "unsigned.txt", "unsigned")
+		_, err := Push(repo, "origin", "main", PushOptions{})
+		if err == nil || !strings.Contains(err.Error(), "only accepts signed commits") {
+			t.Fatalf("Expected unsigned commits to be refused, got %v", err)
+		}
+
+		// Commits already on the branch are not checked again.
+		UpdateRef(repo, "refs/heads/main", head)
+		signedTestCommit(t, repo, "signed.txt")
+		if _, err := Push(repo, "origin", "main", PushOptions{}); err != nil {
+			t.Errorf("Expected signed commits to be accepted: %v", err)
+		}
+	})
+}
+
+func TestReceiveHooks(t *testing.T) {
+	isolateConfig(t)
+	repo, _, cleanup := setupTestRepo(t)
+	defer cleanup()
+	bare := setupBareRemote(t, repo)
+	head, _ := ResolveRef(repo, "HEAD")
+
+	writeHook(t, bare, HookPreReceive, "echo \"no pushes on Fridays\"\nexit 1\n")
+	_, err := Push(repo, "origin", "main", PushOptions{})
+	if err == nil || !strings.Contains(err.Error(), "pre-receive hook failed") || !strings.Contains(err.Error(), "no pushes on Fridays") {
+		t.Fatalf("Expected the hook's message in the rejection, got %v", err)
+	}
+	if _, err := ResolveRef(bare, "main"); err == nil {
+		t.Error("Expected the vetoed push not to create main")
+	}
+
+	os.Remove(filepath.Join(bare.ZarkDir, "hooks", HookPreReceive))
+	SetConfigValue(bare.ConfigPath, "hook.post-receive.command", "cat > pushed.log")
+	if _, err := Push(repo, "origin", "main", PushOptions{}); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(bare.Path, "pushed.log"))
+	if want := strings.Repeat("0", 64) + " " + head + " refs/heads/main\n"; string(data) != want {
+		t.Errorf("Expected post-receive to get %q, got %q", want, data)
+	}
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SignatureFormatEd25519 identifies signatures made directly with an ed25519 key.
+const SignatureFormatEd25519 = "ed25519"
+
+// signatureNamespace is prepended to the payload before signing so that a
+// commit signature can never be replayed as a signature over something else.
+const signatureNamespace = "zark-commit-signature-v1\n"
+
+// CommitSignature is a detached signature over a commit's signing payload.
+type CommitSignature struct {
+	Format    string `json:"format"`
+	PublicKey string `json:"public_key"` // "ssh-ed25519 AAAA..." without a comment
+	Value     string `json:"value"`      // base64-encoded signature
+}
+
+// ErrNoSigningKey is returned when signing is requested but no key is configured.
+var ErrNoSigningKey = errors.New("no signing key configured. Run 'zark keys generate' to create one")
+
+// SigningPayload returns the canonical bytes a signature covers: the commit
+// serialized without its signature. The payload is therefore the same before
+// and after signing, and verifiers can reconstruct it from the stored commit.
+func (c *Commit) SigningPayload() []byte {
+	unsigned := *c
+	unsigned.Signature = nil
+	data, _ := json.Marshal(&unsigned)
+	return append([]byte(signatureNamespace), data...)
+}
+
+// SignCommit signs the commit with key, stores the signature in the commit's
+// Signature field and recalculates its hash.
+func SignCommit(commit *Commit, key *SigningKey) (*Commit, error) {
+	if key == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	signature := ed25519.Sign(key.Private, commit.SigningPayload())
+	commit.Signature = &CommitSignature{
+		Format:    SignatureFormatEd25519,
+		PublicKey: FormatSSHPublicKey(key.Public),
+		Value:     base64.StdEncoding.EncodeToString(signature),
+	}
+	commit.rehash()
+	return commit, nil
+}
+
+// VerifySignature checks the commit's signature against the public key embedded
+// in it and returns that key. It says nothing about whether the key is trusted.
+func (c *Commit) VerifySignature() (ed25519.PublicKey, error) {
+	if c.Signature == nil {
+		return nil, errors.New("commit is not signed")
+	}
+	if c.Signature.Format != SignatureFormatEd25519 {
+		return nil, fmt.Errorf("unsupported signature format '%s'", c.Signature.Format)
+	}
+
+	public, _, err := ParseSSHPublicKey(c.Signature.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(c.Signature.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if !ed25519.Verify(public, c.SigningPayload(), signature) {
+		return public, errors.New("signature does not match the commit contents")
+	}
+	return public, nil
+}
+
+// KeysDir returns the directory where `zark keys generate` stores keys,
+// next to the global config file.
+func KeysDir() (string, error) {
+	globalPath := ConfigPathForScope(ScopeGlobal, nil)
+	if globalPath == "" {
+		return "", errors.New("cannot determine the home directory for storing keys")
+	}
+	return filepath.Join(filepath.Dir(globalPath), "keys"), nil
+}
+
+// ConfiguredSigningKey loads the key named by user.signingkey.
+func ConfiguredSigningKey(repo *Repository) (*SigningKey, error) {
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	path, ok := config.Get("user.signingkey")
+	if !ok || path == "" {
+		return nil, ErrNoSigningKey
+	}
+	return LoadSigningKey(path)
+}
+
+// KeyInfo describes a key found in the keys directory.
+type KeyInfo struct {
+	Name        string
+	Path        string
+	Fingerprint string
+	PublicKey   string
+}
+
+// ListSigningKeys returns the public keys stored in the keys directory.
+func ListSigningKeys() ([]KeyInfo, error) {
+	dir, err := KeysDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read keys directory: %w", err)
+	}
+
+	var keys []KeyInfo
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pub") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+		public, _, err := ParseSSHPublicKey(strings.TrimSpace(string(data)))
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ".pub")
+		keys = append(keys, KeyInfo{
+			Name:        name,
+			Path:        filepath.Join(dir, name),
+			Fingerprint: SSHFingerprint(public),
+			PublicKey:   strings.TrimSpace(string(data)),
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys, nil
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupSigningKey generates a key in a temporary directory and configures it
+// through ZARK_SIGNING_KEY.
+func setupSigningKey(t *testing.T) *SigningKey {
+	t.Helper()
+	key, err := GenerateSigningKey("tester@example.com")
+	if err != nil {
+		t.Fatalf("GenerateSigningKey failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := key.Save(path); err != nil {
+		t.Fatalf("Failed to save key: %v", err)
+	}
+	t.Setenv("ZARK_SIGNING_KEY", path)
+	return key
+}
+
+func TestCommitSigning(t *testing.T) {
+	t.Run("Keys survive an OpenSSH round trip", func(t *testing.T) {
+		key := setupSigningKey(t)
+
+		loaded, err := LoadSigningKey(os.Getenv("ZARK_SIGNING_KEY"))
+		if err != nil {
+			t.Fatalf("LoadSigningKey failed: %v", err)
+		}
+		if !bytes.Equal(loaded.Private, key.Private) || loaded.Comment != "tester@example.com" {
+			t.Error("Loaded key does not match the generated key")
+		}
+
+		public, comment, err := ParseSSHPublicKey(key.AuthorizedKey())
+		if err != nil {
+			t.Fatalf("ParseSSHPublicKey failed: %v", err)
+		}
+		if !bytes.Equal(public, key.Public) || comment != "tester@example.com" {
+			t.Error("Parsed public key does not match the generated key")
+		}
+	})
+
+	t.Run("Signed commits carry a verifiable signature outside the message", func(t *testing.T) {
+		key := setupSigningKey(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		os.WriteFile("signed.txt", []byte("signed content"), 0644)
+		AddFiles(repo, []string{"signed.txt"})
+		hash, err := CreateCommitWithOptions(repo, CommitOptions{Message: "Signed change", Sign: true})
+		if err != nil {
+			t.Fatalf("CreateCommitWithOptions failed: %v", err)
+		}
+
+		commit := loadCommit(t, repo, hash)
+		if commit.Message != "Signed change" {
+			t.Errorf("The signature must not be stored in the message, got %q", commit.Message)
+		}
+		if commit.Signature == nil {
+			t.Fatal("Expected the commit to have a signature")
+		}
+
+		public, err := commit.VerifySignature()
+		if err != nil {
+			t.Fatalf("VerifySignature failed: %v", err)
+		}
+		if !bytes.Equal(public, key.Public) {
+			t.Error("The commit was signed with an unexpected key")
+		}
+
+		commit.Message = "Tampered change"
+		if _, err := commit.VerifySignature(); err == nil {
+			t.Error("Expected verification to fail after the message was changed")
+		}
+	})
+
+	t.Run("The signed payload does not depend on the signature", func(t *testing.T) {
+		key := setupSigningKey(t)
+		commit := NewCommit("tree", "", "tester", "tester@example.com", "message")
+		before := commit.SigningPayload()
+		unsignedHash := commit.Hash()
+
+		SignCommit(commit, key)
+		if !bytes.Equal(before, commit.SigningPayload()) {
+			t.Error("Signing changed the signed payload")
+		}
+		if commit.Hash() == unsignedHash {
+			t.Error("Expected the stored signature to change the commit hash")
+		}
+	})
+
+	t.Run("Signing without a key fails clearly", func(t *testing.T) {
+		isolateConfig(t)
+		t.Setenv("ZARK_SIGNING_KEY", "")
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		_, err := CreateCommitWithOptions(repo, CommitOptions{Message: "unsigned", Sign: true})
+		if err == nil {
+			t.Fatal("Expected signing without a configured key to fail")
+		}
+	})
+}
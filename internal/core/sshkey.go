@@ -0,0 +1,241 @@
+package core
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	sshKeyTypeEd25519 = "ssh-ed25519"
+	opensshMagic      = "openssh-key-v1\x00"
+)
+
+// SigningKey is an ed25519 key pair used to sign commits.
+type SigningKey struct {
+	Private ed25519.PrivateKey
+	Public  ed25519.PublicKey
+	Comment string
+}
+
+// GenerateSigningKey creates a new random ed25519 key pair.
+func GenerateSigningKey(comment string) (*SigningKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return &SigningKey{Private: private, Public: public, Comment: comment}, nil
+}
+
+// LoadSigningKey reads an unencrypted ed25519 private key in OpenSSH
+// ("BEGIN OPENSSH PRIVATE KEY") or PKCS#8 ("BEGIN PRIVATE KEY") PEM format.
+func LoadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM encoded private key", path)
+	}
+
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		key, err := parseOpenSSHPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		private, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an ed25519 key; only ed25519 keys can sign commits", path)
+		}
+		return &SigningKey{Private: private, Public: private.Public().(ed25519.PublicKey)}, nil
+	}
+	return nil, fmt.Errorf("%s holds an unsupported key type '%s'", path, block.Type)
+}
+
+// Save writes the private key in OpenSSH format to path and the public key to path.pub.
+func (k *SigningKey) Save(path string) error {
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: marshalOpenSSHPrivateKey(k)})
+	if err := os.WriteFile(path, pemData, 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := os.WriteFile(path+".pub", []byte(k.AuthorizedKey()+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+	return nil
+}
+
+// AuthorizedKey returns the public key in "ssh-ed25519 AAAA... comment" form.
+func (k *SigningKey) AuthorizedKey() string {
+	line := FormatSSHPublicKey(k.Public)
+	if k.Comment != "" {
+		line += " " + k.Comment
+	}
+	return line
+}
+
+// FormatSSHPublicKey encodes an ed25519 public key as "ssh-ed25519 AAAA...".
+func FormatSSHPublicKey(public ed25519.PublicKey) string {
+	return sshKeyTypeEd25519 + " " + base64.StdEncoding.EncodeToString(sshPublicKeyWire(public))
+}
+
+// ParseSSHPublicKey parses "ssh-ed25519 AAAA... [comment]".
+func ParseSSHPublicKey(line string) (ed25519.PublicKey, string, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, "", fmt.Errorf("invalid public key '%s'", line)
+	}
+	if fields[0] != sshKeyTypeEd25519 {
+		return nil, "", fmt.Errorf("unsupported public key type '%s'; only ssh-ed25519 is supported", fields[0])
+	}
+
+	wire, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid public key encoding: %w", err)
+	}
+	r := &sshReader{data: wire}
+	keyType, key := r.readString(), r.readString()
+	if r.err != nil || string(keyType) != sshKeyTypeEd25519 || len(key) != ed25519.PublicKeySize {
+		return nil, "", errors.New("malformed ssh-ed25519 public key")
+	}
+	return ed25519.PublicKey(key), strings.Join(fields[2:], " "), nil
+}
+
+// SSHFingerprint returns the OpenSSH-style "SHA256:..." fingerprint of a public key.
+func SSHFingerprint(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(sshPublicKeyWire(public))
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+func sshPublicKeyWire(public ed25519.PublicKey) []byte {
+	var buf bytes.Buffer
+	writeSSHString(&buf, []byte(sshKeyTypeEd25519))
+	writeSSHString(&buf, public)
+	return buf.Bytes()
+}
+
+// marshalOpenSSHPrivateKey encodes an unencrypted key in the openssh-key-v1 format.
+func marshalOpenSSHPrivateKey(k *SigningKey) []byte {
+	var private bytes.Buffer
+	var check [4]byte
+	rand.Read(check[:])
+	private.Write(check[:])
+	private.Write(check[:])
+	writeSSHString(&private, []byte(sshKeyTypeEd25519))
+	writeSSHString(&private, k.Public)
+	writeSSHString(&private, k.Private)
+	writeSSHString(&private, []byte(k.Comment))
+	for i := byte(1); private.Len()%8 != 0; i++ {
+		private.WriteByte(i)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(opensshMagic)
+	writeSSHString(&buf, []byte("none"))
+	writeSSHString(&buf, []byte("none"))
+	writeSSHString(&buf, nil)
+	binary.Write(&buf, binary.BigEndian, uint32(1))
+	writeSSHString(&buf, sshPublicKeyWire(k.Public))
+	writeSSHString(&buf, private.Bytes())
+	return buf.Bytes()
+}
+
+func parseOpenSSHPrivateKey(data []byte) (*SigningKey, error) {
+	if !bytes.HasPrefix(data, []byte(opensshMagic)) {
+		return nil, errors.New("not an openssh-key-v1 key")
+	}
+	r := &sshReader{data: data[len(opensshMagic):]}
+	cipher, kdf := string(r.readString()), string(r.readString())
+	r.readString() // kdf options
+	count := r.readUint32()
+	r.readString() // public key
+	private := r.readString()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if cipher != "none" || kdf != "none" {
+		return nil, errors.New("the key is passphrase protected; Zark can only use unencrypted keys")
+	}
+	if count != 1 {
+		return nil, fmt.Errorf("expected one key, found %d", count)
+	}
+
+	pr := &sshReader{data: private}
+	if pr.readUint32() != pr.readUint32() {
+		return nil, errors.New("corrupt private key (check bytes differ)")
+	}
+	keyType := string(pr.readString())
+	public := pr.readString()
+	secret := pr.readString()
+	comment := string(pr.readString())
+	if pr.err != nil {
+		return nil, pr.err
+	}
+	if keyType != sshKeyTypeEd25519 {
+		return nil, fmt.Errorf("unsupported key type '%s'; only ed25519 keys can sign commits", keyType)
+	}
+	if len(public) != ed25519.PublicKeySize || len(secret) != ed25519.PrivateKeySize {
+		return nil, errors.New("malformed ed25519 key")
+	}
+	return &SigningKey{
+		Private: ed25519.PrivateKey(secret),
+		Public:  ed25519.PublicKey(public),
+		Comment: comment,
+	}, nil
+}
+
+func writeSSHString(buf *bytes.Buffer, s []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(s)))
+	buf.Write(s)
+}
+
+// sshReader decodes the length-prefixed fields used by the SSH wire format.
+// The first error sticks, so callers can check once after several reads.
+type sshReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sshReader) readUint32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) < 4 {
+		r.err = errors.New("truncated key data")
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return v
+}
+
+func (r *sshReader) readString() []byte {
+	n := r.readUint32()
+	if r.err != nil {
+		return nil
+	}
+	if uint32(len(r.data)) < n {
+		r.err = errors.New("truncated key data")
+		return nil
+	}
+	s := r.data[:n]
+	r.data = r.data[n:]
+	return s
+}
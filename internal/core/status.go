@@ -11,9 +11,19 @@ import (
 
 // GetStatus handles the core logic of determining and printing the repository status.
 func GetStatus(repo *Repository) error {
+	if err := repo.RequireWorkTree(); err != nil {
+		return err
+	}
+
+	branchStatus, err := GetBranchStatus(repo)
+	if err != nil {
+		return err
+	}
+	printBranchStatus(branchStatus)
+
 	// FIX: Pass the entire repo object to NewStorage.
 	storage := NewStorage(repo)
-	headTree, err := GetHeadTreeEntries(repo, storage)
+	headTree, err := GetHeadTree(repo, storage)
 	if err != nil {
 		if !strings.Contains(err.Error(), "no commits yet") {
 			return fmt.Errorf("could not get HEAD tree: %w", err)
@@ -24,22 +34,30 @@ func GetStatus(repo *Repository) error {
 	if err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("could not load index: %w", err)
 	}
-	indexEntries := make(map[string]string)
+	indexEntries := make(map[string]IndexEntry)
 	if index != nil {
 		for _, entry := range index.Entries {
-			indexEntries[entry.Path] = entry.Hash
+			indexEntries[entry.Path] = entry
 		}
 	}
 
+	attributes, err := LoadAttributes(repo)
+	if err != nil {
+		return err
+	}
+
 	stagedChanges := make(map[string]string)
 	unstagedChanges := make(map[string]string)
 	untrackedFiles := []string{}
 
-	for path, hash := range indexEntries {
-		if headHash, ok := headTree[path]; !ok {
+	for path, entry := range indexEntries {
+		headEntry, ok := headTree[path]
+		if !ok {
 			stagedChanges[path] = "new file"
-		} else if headHash != hash {
+		} else if headEntry.Hash != entry.Hash {
 			stagedChanges[path] = "modified"
+		} else if headEntry.Mode != normalizeMode(entry.Mode) {
+			stagedChanges[path] = modeChangeStatus(headEntry.Mode, entry.Mode)
 		}
 	}
 	for path := range headTree {
@@ -52,20 +70,30 @@ func GetStatus(repo *Repository) error {
 		if err != nil {
 			return err
 		}
-		if strings.Contains(path, ".zark") || info.IsDir() {
+		if repo.isZarkDir(path, info) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() {
 			return nil
 		}
 		relPath, _ := filepath.Rel(repo.Path, path)
+		relPath = filepath.ToSlash(relPath)
 
-		if indexHash, ok := indexEntries[relPath]; ok {
-			content, err := os.ReadFile(path)
+		if entry, ok := indexEntries[relPath]; ok {
+			content, mode, err := readWorkingFile(path, info)
 			if err != nil {
 				return err
 			}
 			currentHashBytes := sha256.Sum256(content)
 			currentHash := hex.EncodeToString(currentHashBytes[:])
-			if currentHash != indexHash {
+			if currentHash != entry.Hash && mode != ModeSymlink && attributes.IsLFS(relPath) {
+				// A smudged LFS file is clean if it is the content its staged pointer names.
+				currentHash = NewBlob(NewLFSPointer(content).Bytes()).Hash()
+			}
+			if currentHash != entry.Hash {
 				unstagedChanges[relPath] = "modified"
+			} else if mode != normalizeMode(entry.Mode) {
+				unstagedChanges[relPath] = modeChangeStatus(entry.Mode, mode)
 			}
 		} else {
 			untrackedFiles = append(untrackedFiles, relPath)
@@ -77,8 +105,8 @@ func GetStatus(repo *Repository) error {
 	}
 
 	for path := range indexEntries {
-		fullPath := filepath.Join(repo.Path, path)
-		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+		fullPath := filepath.Join(repo.Path, filepath.FromSlash(path))
+		if _, err := os.Lstat(fullPath); os.IsNotExist(err) {
 			unstagedChanges[path] = "deleted"
 		}
 	}
@@ -97,6 +125,140 @@ func GetStatus(repo *Repository) error {
 	return nil
 }
 
+// BranchStatus describes where HEAD is, how the branch compares with its
+// upstream, and any operation stopped half-way.
+type BranchStatus struct {
+	Branch string // "" when HEAD is detached
+	Head   string // "" before the first commit
+	// Upstream is the branch's upstream, e.g. "origin/main", or "". If it has
+	// not been fetched (or was deleted on the remote), UpstreamGone is set.
+	Upstream     string
+	UpstreamGone bool
+	// Ahead counts the commits only the branch has; Behind those only the
+	// upstream has.
+	Ahead, Behind int
+	// Operation is "merge" or "rebase" while a pull is stopped on conflicts.
+	Operation string
+	// Stopped is the commit a stopped rebase was replaying, and Onto the
+	// upstream it was replaying onto.
+	Stopped *Commit
+	Onto    string
+	// Unresolved lists the conflicted files 'zark pull --continue' would
+	// still refuse, as unresolvedConflicts finds them.
+	Unresolved []string
+}
+
+// GetBranchStatus works out the branch, upstream and operation in progress.
+func GetBranchStatus(repo *Repository) (*BranchStatus, error) {
+	branch, err := CurrentBranch(repo)
+	if err != nil {
+		return nil, err
+	}
+	status := &BranchStatus{Branch: branch}
+	status.Head, _ = ResolveRef(repo, "HEAD")
+	storage := NewStorage(repo)
+
+	if branch != "" {
+		remote, remoteBranch, err := GetUpstream(repo, branch)
+		if err != nil {
+			return nil, err
+		}
+		if remote != "" {
+			status.Upstream = remote + "/" + remoteBranch
+			upstream, err := ResolveRef(repo, "refs/remotes/"+status.Upstream)
+			if err != nil {
+				status.UpstreamGone = true
+			} else if status.Ahead, status.Behind, err = AheadBehind(storage, status.Head, upstream); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	status.Operation = PullInProgress(repo)
+	if status.Operation == "rebase" {
+		state := filepath.Join(repo.ZarkDir, rebaseDir)
+		status.Onto = readStateFile(state, "upstream")
+		if status.Stopped, err = storage.LoadCommit(readStateFile(state, "stopped")); err != nil {
+			return nil, err
+		}
+	}
+	if status.Operation != "" {
+		if status.Unresolved, err = unresolvedConflicts(repo); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// AheadBehind counts the commits reachable from local but not upstream
+// (ahead), and from upstream but not local (behind).
+func AheadBehind(storage *Storage, local, upstream string) (ahead, behind int, err error) {
+	outgoing, err := newCommits(storage, local, []string{upstream})
+	if err != nil {
+		return 0, 0, err
+	}
+	incoming, err := newCommits(storage, upstream, []string{local})
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(outgoing), len(incoming), nil
+}
+
+// printBranchStatus prints the header of 'zark status'.
+func printBranchStatus(status *BranchStatus) {
+	switch {
+	case status.Branch == "" && status.Head != "":
+		fmt.Printf("HEAD detached at %s\n", status.Head[:8])
+		fmt.Println("  (use \"zark checkout <branch>\" to get back on a branch)")
+	default:
+		fmt.Printf("On branch %s\n", status.Branch)
+	}
+	if status.Head == "" {
+		fmt.Println("No commits yet")
+	}
+
+	switch {
+	case status.Upstream == "":
+	case status.UpstreamGone:
+		fmt.Printf("Upstream: %s (not fetched yet, or deleted on the remote)\n", status.Upstream)
+		fmt.Println("  (use \"zark fetch\" to check, or \"zark branch set-upstream\" to pick another)")
+	case status.Ahead == 0 && status.Behind == 0:
+		fmt.Printf("Upstream: %s (up to date)\n", status.Upstream)
+	default:
+		fmt.Printf("Upstream: %s (ahead %d, behind %d)\n", status.Upstream, status.Ahead, status.Behind)
+		switch {
+		case status.Behind == 0:
+			fmt.Println("  (use \"zark push\" to send your commits)")
+		case status.Ahead == 0:
+			fmt.Println("  (use \"zark pull\" to bring in the new commits)")
+		default:
+			fmt.Println("  (use \"zark pull\" to combine the two, then \"zark push\")")
+		}
+	}
+
+	switch status.Operation {
+	case "merge":
+		fmt.Println("\nYou are in the middle of a merge that stopped on conflicts.")
+	case "rebase":
+		subject, _, _ := strings.Cut(status.Stopped.Message, "\n")
+		fmt.Printf("\nYou are in the middle of a rebase onto %s, stopped on conflicts at %s (%s).\n",
+			status.Onto, status.Stopped.Hash()[:8], subject)
+	default:
+		fmt.Println()
+		return
+	}
+	if len(status.Unresolved) > 0 {
+		fmt.Println("  (fix the conflicts and \"zark add\" the files, then run \"zark pull --continue\")")
+	} else {
+		fmt.Println("  (all conflicts fixed: run \"zark pull --continue\")")
+	}
+	fmt.Println("  (use \"zark pull --abort\" to go back to where you were)")
+	for _, path := range status.Unresolved {
+		fmt.Printf("\t\033[31mboth changed:   %s\033[0m\n", path)
+	}
+	fmt.Println()
+}
+
 func printStatus(title string, changes map[string]string) {
 	if len(changes) > 0 {
 		fmt.Println(title)
@@ -110,4 +272,9 @@ func printStatus(title string, changes map[string]string) {
 		}
 		fmt.Println()
 	}
-}
\ No newline at end of file
+}
+
+// modeChangeStatus describes a change that only affects a file's mode.
+func modeChangeStatus(oldMode, newMode string) string {
+	return fmt.Sprintf("mode changed %s -> %s", normalizeMode(oldMode), normalizeMode(newMode))
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBranchStatus(t *testing.T) {
+	t.Run("The header shows the branch and how it compares with upstream", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		if output := captureStdout(t, func() error { return GetStatus(repo) }); !strings.HasPrefix(output, "On branch main\n") ||
+			strings.Contains(output, "Upstream:") {
+			t.Errorf("Expected only the branch without an upstream, got %q", output)
+		}
+
+		teammate := setupPull(t, repo)
+		if output := captureStdout(t, func() error { return GetStatus(repo) }); !strings.Contains(output, "Upstream: origin/main (up to date)") {
+			t.Errorf("Expected to be up to date, got %q", output)
+		}
+
+		teammate("theirs.txt", "theirs")
+		commitFile(t, repo, "one.txt", "one")
+		commitFile(t, repo, "two.txt", "two")
+		Fetch(repo, "origin")
+		status, err := GetBranchStatus(repo)
+		if err != nil {
+			t.Fatalf("GetBranchStatus failed: %v", err)
+		}
+		if status.Ahead != 2 || status.Behind != 1 {
+			t.Errorf("Expected ahead 2, behind 1, got %+v", status)
+		}
+		output := captureStdout(t, func() error { return GetStatus(repo) })
+		if !strings.Contains(output, "Upstream: origin/main (ahead 2, behind 1)") || !strings.Contains(output, "zark pull") {
+			t.Errorf("Expected ahead and behind counts with a hint, got %q", output)
+		}
+
+		head, _ := ResolveRef(repo, "HEAD")
+		Checkout(repo, head)
+		if output := captureStdout(t, func() error { return GetStatus(repo) }); !strings.HasPrefix(output, "HEAD detached at "+head[:8]) {
+			t.Errorf("Expected a detached HEAD, got %q", output)
+		}
+	})
+
+	t.Run("A stopped pull is reported with hints", func(t *testing.T) {
+		isolateConfig(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+		teammate := setupPull(t, repo)
+		teammate("test.txt", "theirs")
+		commitFile(t, repo, "test.txt", "mine")
+		Pull(repo, PullOptions{Strategy: PullRebase})
+		// Staged with its markers, the file is still unresolved.
+		AddFiles(repo, []string{"test.txt"})
+
+		output := captureStdout(t, func() error { return GetStatus(repo) })
+		for _, want := range []string{"middle of a rebase onto origin/main", "update test.txt", "zark pull --continue", "zark pull --abort", "both changed:   test.txt"} {
+			if !strings.Contains(output, want) {
+				t.Errorf("Expected %q in the status, got %q", want, output)
+			}
+		}
+
+		os.WriteFile("test.txt", []byte("both"), 0644)
+		AddFiles(repo, []string{"test.txt"})
+		if output := captureStdout(t, func() error { return GetStatus(repo) }); !strings.Contains(output, "all conflicts fixed") {
+			t.Errorf("Expected the status to say the conflicts are fixed, got %q", output)
+		}
+	})
+}
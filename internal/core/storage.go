@@ -1,14 +1,20 @@
 package core
 
 import (
+	"bufio"
 	"bytes"
 	"compress/zlib"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
@@ -17,6 +23,34 @@ import (
 type Storage struct {
 	repo *Repository
 	dmp  *diffmatchpatch.DiffMatchPatch
+
+	// shallow holds the commits of a shallow clone whose parents are
+	// missing, loaded on first use.
+	shallow map[string]bool
+	// promisor is the remote a partial clone fetches left-out objects from.
+	promisor       *Remote
+	promisorLoaded bool
+
+	// indexes caches the parsed pack indexes by path. packIndexes keeps it
+	// in step with the pack directory, so packs written or removed since
+	// are noticed without parsing every index again.
+	indexesMu sync.Mutex
+	indexes   map[string][]PackEntry
+}
+
+// packIndex is a pack's index file with its parsed entries.
+type packIndex struct {
+	path    string
+	entries []PackEntry
+}
+
+// find returns the entry for hash, if the pack holds it.
+func (p packIndex) find(hash string) (PackEntry, bool) {
+	i := sort.Search(len(p.entries), func(i int) bool { return p.entries[i].Hash >= hash })
+	if i < len(p.entries) && p.entries[i].Hash == hash {
+		return p.entries[i], true
+	}
+	return PackEntry{}, false
 }
 
 func NewStorage(repo *Repository) *Storage {
@@ -49,14 +83,50 @@ func (s *Storage) Store(obj Object) error {
 }
 
 // Load reads and decompresses an object from the database,
-// checking loose objects first, then packfiles.
+// checking loose objects first, then packfiles. In a partial clone, objects
+// that were left out are fetched from the promisor remote.
 func (s *Storage) Load(hash string) ([]byte, error) {
-	loosePath := filepath.Join(s.repo.ObjectsDir, hash[:2], hash[2:])
+	if len(hash) < 3 {
+		return nil, fmt.Errorf("invalid object hash '%s'", hash)
+	}
+	loosePath := s.loosePath(hash)
 	if _, err := os.Stat(loosePath); err == nil {
 		return s.loadLoose(loosePath, hash)
 	}
 
-	return s.loadFromPack(hash)
+	data, err := s.loadFromPack(hash)
+	if err == nil || s.Has(hash) {
+		return data, err
+	}
+	if promised, fetchErr := s.fetchPromised([]string{hash}); fetchErr != nil {
+		return nil, fetchErr
+	} else if !promised || !s.Has(hash) {
+		return nil, err
+	}
+	return s.Load(hash)
+}
+
+// Has reports whether the object is in the database, loose or packed,
+// without reading it.
+func (s *Storage) Has(hash string) bool {
+	if len(hash) < 3 {
+		return false
+	}
+	if _, err := os.Stat(s.loosePath(hash)); err == nil {
+		return true
+	}
+	packs, _ := s.packIndexes()
+	for _, pack := range packs {
+		if _, ok := pack.find(hash); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// loosePath returns where the loose copy of an object is stored.
+func (s *Storage) loosePath(hash string) string {
+	return filepath.Join(s.repo.ObjectsDir, hash[:2], hash[2:])
 }
 
 func (s *Storage) loadLoose(path, hash string) ([]byte, error) {
@@ -76,68 +146,207 @@ func (s *Storage) loadLoose(path, hash string) ([]byte, error) {
 }
 
 func (s *Storage) loadFromPack(hash string) ([]byte, error) {
-	packDir := filepath.Join(s.repo.ZarkDir, "pack")
-	var data []byte
-	var found bool
-
-	err := filepath.Walk(packDir, func(path string, info os.FileInfo, err error) error {
-		if found || err != nil {
-			return err
+	packs, err := s.packIndexes()
+	for _, pack := range packs {
+		if entry, ok := pack.find(hash); ok {
+			return s.readPackObject(strings.TrimSuffix(pack.path, ".idx")+".pack", entry.Offset, hash)
 		}
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".idx") {
-			packData, err := s.findInPack(path, hash)
-			if err == nil {
-				data = packData
-				found = true
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("object not found in loose objects or packfiles: %s", hash)
+}
+
+// packIndexes returns every pack index in the repository, parsed. Packs
+// are named after their contents, so an index is only parsed the first
+// time its path is seen. Indexes that cannot be read are left out and
+// reported in the error, alongside the ones that could.
+func (s *Storage) packIndexes() ([]packIndex, error) {
+	paths, err := filepath.Glob(filepath.Join(s.repo.ZarkDir, "pack", "*.idx"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packfiles: %w", err)
+	}
+	s.indexesMu.Lock()
+	defer s.indexesMu.Unlock()
+	current := make(map[string][]PackEntry, len(paths))
+	packs := make([]packIndex, 0, len(paths))
+	var readErr error
+	for _, path := range paths {
+		entries, ok := s.indexes[path]
+		if !ok {
+			var err error
+			if entries, err = readPackIndex(path); err != nil {
+				// It may still be being written; try again next time.
+				readErr = err
+				continue
 			}
 		}
-		return nil
-	})
+		current[path] = entries
+		packs = append(packs, packIndex{path: path, entries: entries})
+	}
+	s.indexes = current
+	return packs, readErr
+}
 
+// PackedObjects returns the hashes of every object stored in a packfile.
+func (s *Storage) PackedObjects() ([]string, error) {
+	packs, err := s.packIndexes()
 	if err != nil {
 		return nil, err
 	}
-	if !found {
-		return nil, fmt.Errorf("object not found in loose objects or packfiles: %s", hash)
+	var hashes []string
+	for _, pack := range packs {
+		for _, entry := range pack.entries {
+			hashes = append(hashes, entry.Hash)
+		}
 	}
-	return data, nil
+	return hashes, nil
 }
 
-func (s *Storage) findInPack(idxPath, targetHash string) ([]byte, error) {
+// readPackIndex parses an index written by Packer.writeIndex: a header, the
+// 256-entry fanout table, the sorted hashes, their CRCs and their offsets.
+func readPackIndex(idxPath string) ([]PackEntry, error) {
 	idxData, err := os.ReadFile(idxPath)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to read pack index: %w", err)
 	}
 
-	shaOffset := 8 + 256*4
-	numObjects := (len(idxData) - shaOffset - 20 - 20) / (32 + 4)
+	const headerSize = 8
+	const fanoutSize = 256 * 4
+	if len(idxData) < headerSize+fanoutSize || !bytes.Equal(idxData[:4], []byte{0xff, 't', 'O', 'c'}) {
+		return nil, fmt.Errorf("%s is not a valid pack index", idxPath)
+	}
+	count := int(binary.BigEndian.Uint32(idxData[headerSize+fanoutSize-4 : headerSize+fanoutSize]))
 
-	for i := 0; i < numObjects; i++ {
-		hashStart := shaOffset + i*32
-		hashInIndex := string(idxData[hashStart : hashStart+32])
+	hashStart := headerSize + fanoutSize
+	crcStart := hashStart + count*32
+	offsetStart := crcStart + count*4
+	if len(idxData) < offsetStart+count*4 {
+		return nil, fmt.Errorf("pack index %s is truncated", idxPath)
+	}
 
-		if hashInIndex == targetHash {
-			offsetStart := shaOffset + numObjects*32 + i*4
-			offset := binary.BigEndian.Uint32(idxData[offsetStart : offsetStart+4])
+	entries := make([]PackEntry, count)
+	for i := range entries {
+		entries[i] = PackEntry{
+			Hash:   hex.EncodeToString(idxData[hashStart+i*32 : hashStart+(i+1)*32]),
+			CRC:    binary.BigEndian.Uint32(idxData[crcStart+i*4:]),
+			Offset: uint64(binary.BigEndian.Uint32(idxData[offsetStart+i*4:])),
+		}
+	}
+	return entries, nil
+}
 
-			packPath := strings.TrimSuffix(idxPath, ".idx") + ".pack"
-			packFile, err := os.Open(packPath)
-			if err != nil {
-				return nil, err
-			}
-			defer packFile.Close()
+// readPackObject reads the object at offset in a packfile, resolving deltas
+// against their base object.
+func (s *Storage) readPackObject(packPath string, offset uint64, hash string) ([]byte, error) {
+	packFile, err := os.Open(packPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open packfile: %w", err)
+	}
+	defer packFile.Close()
 
-			packFile.Seek(int64(offset), 0)
+	if _, err := packFile.Seek(int64(offset), io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek in packfile: %w", err)
+	}
+	reader := bufio.NewReader(packFile)
+	objType, _, err := readPackObjectHeader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object header for %s: %w", hash, err)
+	}
 
-			r, err := zlib.NewReader(packFile)
-			if err != nil {
-				return nil, err
-			}
-			defer r.Close()
+	r, err := zlib.NewReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress object %s: %w", hash, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress object %s: %w", hash, err)
+	}
 
-			return io.ReadAll(r)
+	if objType != OBJ_REF_DELTA {
+		return data, nil
+	}
+	if len(data) < 32 {
+		return nil, fmt.Errorf("delta for object %s is truncated", hash)
+	}
+	baseHash := hex.EncodeToString(data[:32])
+	base, err := s.Load(baseHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load delta base %s: %w", baseHash, err)
+	}
+	return applyDelta(s.dmp, base, data[32:], hash)
+}
+
+// readPackObjectHeader reads the variable-length type and size that precede
+// every object in a packfile.
+func readPackObjectHeader(r io.ByteReader) (uint8, uint64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	objType := (c >> 4) & 0x07
+	size := uint64(c & 0x0F)
+	shift := uint(4)
+	for c&0x80 != 0 {
+		if c, err = r.ReadByte(); err != nil {
+			return 0, 0, err
 		}
+		size |= uint64(c&0x7F) << shift
+		shift += 7
+	}
+	return objType, size, nil
+}
+
+// applyDelta rebuilds an object from its base and a text patch, and checks
+// the result against the expected hash.
+func applyDelta(dmp *diffmatchpatch.DiffMatchPatch, base, delta []byte, hash string) ([]byte, error) {
+	result, err := patchDelta(dmp, base, delta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse delta for %s: %w", hash, err)
+	}
+	sum := sha256.Sum256(result)
+	if hex.EncodeToString(sum[:]) != hash {
+		return nil, fmt.Errorf("delta for object %s did not reproduce it", hash)
+	}
+	return result, nil
+}
+
+// patchDelta applies a text patch to base.
+func patchDelta(dmp *diffmatchpatch.DiffMatchPatch, base, delta []byte) ([]byte, error) {
+	patches, err := dmp.PatchFromText(string(delta))
+	if err != nil {
+		return nil, err
 	}
+	result, _ := dmp.PatchApply(patches, string(base))
+	return []byte(result), nil
+}
 
-	return nil, fmt.Errorf("hash not found in index %s", idxPath)
-}
\ No newline at end of file
+// LoadCommit loads and decodes a commit object.
+func (s *Storage) LoadCommit(hash string) (*Commit, error) {
+	data, err := s.Load(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load commit object %s: %w", hash, err)
+	}
+	var commit Commit
+	if err := json.Unmarshal(data, &commit); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal commit %s: %w", hash, err)
+	}
+	commit.hash = hash
+	commit.grafted = s.isShallow(hash)
+	return &commit, nil
+}
+
+// LoadTree loads and decodes a tree object.
+func (s *Storage) LoadTree(hash string) (*Tree, error) {
+	data, err := s.Load(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tree object %s: %w", hash, err)
+	}
+	var entries []TreeEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tree %s: %w", hash, err)
+	}
+	return &Tree{Entries: entries, hash: hash}, nil
+}
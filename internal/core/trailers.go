@@ -0,0 +1,91 @@
+package core
+
+import (
+	"strings"
+)
+
+// Well-known commit message trailers.
+const (
+	TrailerCoAuthoredBy = "Co-authored-by"
+	TrailerSignedOffBy  = "Signed-off-by"
+	TrailerReviewedBy   = "Reviewed-by"
+)
+
+// Trailer is a "Key: value" line in the final paragraph of a commit message.
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+// ParseTrailers extracts the trailers from a commit message. Trailers form the
+// last paragraph of the message, in which every line is either "Key: value"
+// or an indented continuation of the previous value. The first paragraph (the
+// subject) is never treated as trailers.
+func ParseTrailers(message string) []Trailer {
+	paragraphs := strings.Split(strings.TrimSpace(strings.ReplaceAll(message, "\r\n", "\n")), "\n\n")
+	if len(paragraphs) < 2 {
+		return nil
+	}
+
+	var trailers []Trailer
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(trailers) > 0 {
+			last := &trailers[len(trailers)-1]
+			last.Value += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || !isTrailerKey(key) {
+			return nil
+		}
+		trailers = append(trailers, Trailer{Key: key, Value: strings.TrimSpace(value)})
+	}
+	return trailers
+}
+
+// AppendTrailers adds trailers to the end of a message, reusing an existing
+// trailer paragraph when there is one. Trailers already present are not duplicated.
+func AppendTrailers(message string, trailers []Trailer) string {
+	if len(trailers) == 0 {
+		return message
+	}
+
+	message = strings.TrimRight(message, "\n")
+	existing := ParseTrailers(message)
+	var lines []string
+	for _, trailer := range trailers {
+		duplicate := false
+		for _, e := range existing {
+			if strings.EqualFold(e.Key, trailer.Key) && e.Value == trailer.Value {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			lines = append(lines, trailer.Key+": "+trailer.Value)
+		}
+	}
+	if len(lines) == 0 {
+		return message
+	}
+
+	separator := "\n\n"
+	if len(existing) > 0 {
+		separator = "\n"
+	}
+	return message + separator + strings.Join(lines, "\n")
+}
+
+// isTrailerKey reports whether s looks like a trailer token such as "Signed-off-by".
+func isTrailerKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
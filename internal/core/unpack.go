@@ -0,0 +1,139 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// UnpackObjects reads a pack written by Packer.WritePack from r and stores
+// its objects. The pack is first copied to a temporary file and its checksum
+// checked, so a damaged pack stores nothing; the objects are then read back
+// one at a time, so the pack is never held in memory as a whole. Deltas are
+// resolved against objects already in storage. It returns how many objects
+// were stored.
+func UnpackObjects(storage *Storage, r io.Reader) (int, error) {
+	spool, err := os.CreateTemp(storage.repo.ZarkDir, "incoming-*.pack")
+	if err != nil {
+		return 0, fmt.Errorf("failed to receive pack: %w", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	sum := sha256.New()
+	length, err := io.Copy(io.MultiWriter(spool, sum), r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to receive pack: %w", err)
+	}
+	if length < 12+sha256.Size {
+		return 0, fmt.Errorf("pack is truncated")
+	}
+
+	// The trailer is the checksum of everything before it; hashing the
+	// whole file also hashed the trailer, so check the two apart.
+	body := length - sha256.Size
+	var trailer [sha256.Size]byte
+	if _, err := spool.ReadAt(trailer[:], body); err != nil {
+		return 0, fmt.Errorf("failed to read pack: %w", err)
+	}
+	sum.Reset()
+	if _, err := io.Copy(sum, io.NewSectionReader(spool, 0, body)); err != nil {
+		return 0, fmt.Errorf("failed to read pack: %w", err)
+	}
+	if !bytes.Equal(trailer[:], sum.Sum(nil)) {
+		return 0, fmt.Errorf("pack checksum does not match: the transfer was damaged")
+	}
+
+	// A bufio.Reader is an io.ByteReader, so zlib reads exactly one object
+	// and no further.
+	pack := bufio.NewReader(io.NewSectionReader(spool, 0, body))
+	var header [12]byte
+	if _, err := io.ReadFull(pack, header[:]); err != nil {
+		return 0, fmt.Errorf("failed to read pack header: %w", err)
+	}
+	if string(header[:4]) != "PACK" || binary.BigEndian.Uint32(header[4:8]) != 2 {
+		return 0, fmt.Errorf("received data is not a pack")
+	}
+	count := binary.BigEndian.Uint32(header[8:])
+
+	// Commits are stored after everything else, so a pack that fails part
+	// way never leaves a commit whose tree or parents were not stored; a
+	// commit here is taken to come with its history.
+	var commits []*Blob
+	held := make(map[string][]byte)
+	for i := uint32(0); i < count; i++ {
+		objType, size, err := readPackObjectHeader(pack)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read object header: %w", err)
+		}
+		if size >= math.MaxInt64 {
+			return 0, fmt.Errorf("pack object claims %d bytes", size)
+		}
+		zr, err := zlib.NewReader(pack)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decompress object: %w", err)
+		}
+		// Reading one byte past the size is enough to tell an object that
+		// decompresses to more than its header says.
+		data, err := io.ReadAll(io.LimitReader(zr, int64(size)+1))
+		zr.Close()
+		if err != nil {
+			return 0, fmt.Errorf("failed to decompress object: %w", err)
+		}
+		if uint64(len(data)) > size {
+			return 0, fmt.Errorf("pack object is larger than the %d bytes its header gives", size)
+		}
+		if uint64(len(data)) != size {
+			return 0, fmt.Errorf("pack object has %d bytes, expected %d", len(data), size)
+		}
+
+		if objType == OBJ_REF_DELTA {
+			if len(data) < 32 {
+				return 0, fmt.Errorf("pack contains a truncated delta")
+			}
+			baseHash := hex.EncodeToString(data[:32])
+			base, ok := held[baseHash]
+			if !ok {
+				if base, err = storage.Load(baseHash); err != nil {
+					return 0, fmt.Errorf("failed to load delta base %s: %w", baseHash, err)
+				}
+			}
+			if data, err = patchDelta(storage.dmp, base, data[32:]); err != nil {
+				return 0, fmt.Errorf("failed to apply delta against %s: %w", baseHash[:8], err)
+			}
+		}
+		if looksLikeCommit(data) {
+			object := NewBlob(data)
+			commits = append(commits, object)
+			held[object.Hash()] = data
+			continue
+		}
+		if err := storage.Store(NewBlob(data)); err != nil {
+			return 0, fmt.Errorf("failed to store object: %w", err)
+		}
+	}
+	for _, commit := range commits {
+		if err := storage.Store(commit); err != nil {
+			return 0, fmt.Errorf("failed to store object: %w", err)
+		}
+	}
+
+	return int(count), nil
+}
+
+// looksLikeCommit reports whether data decodes as a commit. Objects carry no
+// type, so a blob holding the same JSON is taken for one too.
+func looksLikeCommit(data []byte) bool {
+	if len(data) == 0 || data[0] != '{' {
+		return false
+	}
+	var commit Commit
+	return json.Unmarshal(data, &commit) == nil && commit.TreeHash != ""
+}
@@ -0,0 +1,205 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SignatureStatus is the outcome of checking a commit's signature.
+type SignatureStatus int
+
+const (
+	SignatureUnsigned   SignatureStatus = iota // The commit carries no signature
+	SignatureGood                              // Valid, made by a key trusted for the committer
+	SignatureBad                               // The signature does not match the commit
+	SignatureUnknownKey                        // Valid, but the key is not trusted for the committer
+)
+
+func (s SignatureStatus) String() string {
+	switch s {
+	case SignatureGood:
+		return "Good"
+	case SignatureBad:
+		return "Bad"
+	case SignatureUnknownKey:
+		return "Unknown-key"
+	}
+	return "Unsigned"
+}
+
+// SignatureVerification describes the result of verifying one commit.
+type SignatureVerification struct {
+	Status      SignatureStatus
+	Fingerprint string // Fingerprint of the signing key, if the commit is signed
+	Principal   string // Identity the allowed signers file associates with the key
+	Reason      string // Human readable explanation for anything but Good
+}
+
+// AllowedSigner is one line of an allowed_signers file: the identities
+// (emails, optionally with '*' wildcards) a public key may sign for.
+type AllowedSigner struct {
+	Principals []string
+	PublicKey  ed25519.PublicKey
+}
+
+// AllowedSignersPaths returns the trust store files consulted during
+// verification: the file named by signing.allowedsigners, the repository's
+// .zark/allowed_signers and the global allowed_signers next to the global config.
+func AllowedSignersPaths(repo *Repository) []string {
+	var paths []string
+	if config, err := LoadConfig(repo); err == nil {
+		if path, ok := config.Get("signing.allowedsigners"); ok && path != "" {
+			paths = append(paths, expandHome(path))
+		}
+	}
+	if repo != nil {
+		paths = append(paths, filepath.Join(repo.ZarkDir, "allowed_signers"))
+	}
+	if globalPath := ConfigPathForScope(ScopeGlobal, nil); globalPath != "" {
+		paths = append(paths, filepath.Join(filepath.Dir(globalPath), "allowed_signers"))
+	}
+	return paths
+}
+
+// LoadAllowedSigners reads every trust store that exists. The format follows
+// OpenSSH's allowed_signers: "<principals> [options] ssh-ed25519 <key>",
+// with comma-separated principals and '#' comments.
+func LoadAllowedSigners(repo *Repository) ([]AllowedSigner, error) {
+	var signers []AllowedSigner
+	for _, path := range AllowedSignersPaths(repo) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read allowed signers: %w", err)
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		lineNumber := 0
+		for scanner.Scan() {
+			lineNumber++
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			fields := strings.Fields(line)
+			keyStart := -1
+			for i, field := range fields {
+				if field == sshKeyTypeEd25519 {
+					keyStart = i
+					break
+				}
+			}
+			if keyStart < 1 {
+				return nil, fmt.Errorf("%s:%d: expected '<principals> ssh-ed25519 <key>'", path, lineNumber)
+			}
+			public, _, err := ParseSSHPublicKey(strings.Join(fields[keyStart:], " "))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+			}
+			signers = append(signers, AllowedSigner{
+				Principals: strings.Split(fields[0], ","),
+				PublicKey:  public,
+			})
+		}
+	}
+	return signers, nil
+}
+
+// VerifyCommit checks a commit's signature against the allowed signers.
+// A signature is Good only if it is valid and its key is trusted for the
+// committer's email address.
+func VerifyCommit(repo *Repository, commit *Commit) SignatureVerification {
+	if commit.Signature == nil {
+		return SignatureVerification{Status: SignatureUnsigned, Reason: "commit is not signed"}
+	}
+
+	public, err := commit.VerifySignature()
+	result := SignatureVerification{}
+	if public != nil {
+		result.Fingerprint = SSHFingerprint(public)
+	}
+	if err != nil {
+		result.Status = SignatureBad
+		result.Reason = err.Error()
+		return result
+	}
+
+	signers, err := LoadAllowedSigners(repo)
+	if err != nil {
+		result.Status = SignatureUnknownKey
+		result.Reason = err.Error()
+		return result
+	}
+
+	email := commit.CommitterIdentity().Email
+	keyKnown := false
+	for _, signer := range signers {
+		if !public.Equal(signer.PublicKey) {
+			continue
+		}
+		keyKnown = true
+		for _, principal := range signer.Principals {
+			if principalMatches(principal, email) {
+				result.Status = SignatureGood
+				result.Principal = email
+				return result
+			}
+		}
+	}
+
+	result.Status = SignatureUnknownKey
+	if keyKnown {
+		result.Reason = fmt.Sprintf("key %s is not allowed to sign for %s", result.Fingerprint, email)
+	} else {
+		result.Reason = fmt.Sprintf("key %s is not in allowed_signers", result.Fingerprint)
+	}
+	return result
+}
+
+// principalMatches compares a principal pattern (which may contain '*') with an email.
+func principalMatches(pattern, email string) bool {
+	matched, err := filepath.Match(strings.ToLower(pattern), strings.ToLower(email))
+	return err == nil && matched
+}
+
+// branchRequiresSignatures reports whether branch.<name>.verifysignatures is set.
+func branchRequiresSignatures(repo *Repository, branch string) bool {
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return false
+	}
+	return config.GetBool("branch."+branch+".verifysignatures", false)
+}
+
+// EnforceSignaturePolicy refuses commits that are not Good when the branch
+// is configured with branch.<name>.verifysignatures.
+func EnforceSignaturePolicy(repo *Repository, branch string, commitHashes []string) error {
+	if branch == "" || !branchRequiresSignatures(repo, branch) {
+		return nil
+	}
+
+	storage := NewStorage(repo)
+	for _, hash := range commitHashes {
+		commit, err := storage.LoadCommit(hash)
+		if err != nil {
+			return err
+		}
+		result := VerifyCommit(repo, commit)
+		if result.Status != SignatureGood {
+			return fmt.Errorf(
+				"branch '%s' only accepts commits with good signatures, but %s is %s (%s).\n"+
+					"Add the signer's key to .zark/allowed_signers or unset branch.%s.verifysignatures",
+				branch, hash[:8], result.Status, result.Reason, branch,
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// signedTestCommit creates a signed commit by tester@example.com and returns its hash.
+func signedTestCommit(t *testing.T, repo *Repository, file string) string {
+	t.Helper()
+	t.Setenv(EnvCommitterName, "tester")
+	t.Setenv(EnvCommitterEmail, "tester@example.com")
+	os.WriteFile(file, []byte("content of "+file), 0644)
+	AddFiles(repo, []string{file})
+	hash, err := CreateCommitWithOptions(repo, CommitOptions{Message: "add " + file, Sign: true})
+	if err != nil {
+		t.Fatalf("CreateCommitWithOptions failed: %v", err)
+	}
+	return hash
+}
+
+// trustKey adds key to the repository's allowed_signers for principals.
+func trustKey(t *testing.T, repo *Repository, principals string, key *SigningKey) {
+	t.Helper()
+	line := principals + " " + FormatSSHPublicKey(key.Public) + "\n"
+	if err := os.WriteFile(filepath.Join(repo.ZarkDir, "allowed_signers"), []byte(line), 0644); err != nil {
+		t.Fatalf("Failed to write allowed_signers: %v", err)
+	}
+}
+
+func TestSignatureVerification(t *testing.T) {
+	t.Run("Commits are classified as Good, Unknown-key, Bad or Unsigned", func(t *testing.T) {
+		isolateConfig(t)
+		key := setupSigningKey(t)
+		repo, initialHash, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		hash := signedTestCommit(t, repo, "signed.txt")
+		storage := NewStorage(repo)
+		commit, _ := storage.LoadCommit(hash)
+
+		if got := VerifyCommit(repo, commit).Status; got != SignatureUnknownKey {
+			t.Errorf("Expected Unknown-key before the key is trusted, got %s", got)
+		}
+
+		trustKey(t, repo, "someone-else@example.com", key)
+		if got := VerifyCommit(repo, commit).Status; got != SignatureUnknownKey {
+			t.Errorf("Expected Unknown-key when the key belongs to someone else, got %s", got)
+		}
+
+		trustKey(t, repo, "*@example.com", key)
+		result := VerifyCommit(repo, commit)
+		if result.Status != SignatureGood || result.Principal != "tester@example.com" {
+			t.Errorf("Expected a Good signature from tester@example.com, got %+v", result)
+		}
+
+		commit.Message = "tampered"
+		if got := VerifyCommit(repo, commit).Status; got != SignatureBad {
+			t.Errorf("Expected Bad for a tampered commit, got %s", got)
+		}
+
+		unsigned, _ := storage.LoadCommit(initialHash)
+		if got := VerifyCommit(repo, unsigned).Status; got != SignatureUnsigned {
+			t.Errorf("Expected Unsigned for the initial commit, got %s", got)
+		}
+	})
+
+	t.Run("History shows signature status", func(t *testing.T) {
+		isolateConfig(t)
+		key := setupSigningKey(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		signedTestCommit(t, repo, "signed.txt")
+		trustKey(t, repo, "tester@example.com", key)
+
+		oldStdout := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+
+		err := ShowHistoryWithOptions(repo, HistoryOptions{ShowSignature: true})
+
+		w.Close()
+		os.Stdout = oldStdout
+		if err != nil {
+			t.Fatalf("ShowHistoryWithOptions failed: %v", err)
+		}
+
+		var buf bytes.Buffer
+		buf.ReadFrom(r)
+		output := buf.String()
+		if !strings.Contains(output, "Signature: Good") || !strings.Contains(output, "Signature: Unsigned") {
+			t.Errorf("Expected both a Good and an Unsigned commit in the history. Got:\n%s", output)
+		}
+	})
+
+	t.Run("Branch policy refuses to check out unsigned commits", func(t *testing.T) {
+		isolateConfig(t)
+		key := setupSigningKey(t)
+		repo, _, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		CreateBranch(repo, "release")
+		SetConfigValue(repo.ConfigPath, "branch.release.verifysignatures", "true")
+
+		err := Checkout(repo, "release")
+		if err == nil || !strings.Contains(err.Error(), "good signatures") {
+			t.Fatalf("Expected checkout of an unsigned branch tip to be refused, got %v", err)
+		}
+
+		trustKey(t, repo, "tester@example.com", key)
+		hash := signedTestCommit(t, repo, "release.txt")
+		os.WriteFile(filepath.Join(repo.RefsDir, "heads", "release"), []byte(hash+"\n"), 0644)
+		if err := Checkout(repo, "release"); err != nil {
+			t.Errorf("Expected checkout of a well-signed branch tip to succeed, got %v", err)
+		}
+	})
+}